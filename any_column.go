@@ -0,0 +1,203 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// BytesEncoding defines how AnyColumn writes []byte values.
+type BytesEncoding int
+
+const (
+	// BytesAsString writes the bytes as a string as is.
+	BytesAsString BytesEncoding = iota
+	// BytesAsBase64 writes the bytes as a standard base64 string.
+	BytesAsBase64
+	// BytesAsHex writes the bytes as a lower-case hex string.
+	BytesAsHex
+)
+
+// AnyColumnRules holds the configurable coercion rules of AnyColumn,
+// see WithAnyColumnRules.
+type AnyColumnRules struct {
+	// Bytes defines how []byte values are written. Defaults to
+	// BytesAsString.
+	Bytes BytesEncoding
+	// RejectNil makes nil values fail the message with
+	// ErrUnsupportedType instead of being omitted.
+	RejectNil bool
+	// Float32Shortest makes float32 values written with their
+	// shortest decimal representation, e.g. 0.1 instead of
+	// 0.10000000149011612.
+	Float32Shortest bool
+}
+
+// AnyColumn adds a column value of an arbitrary Go type to the
+// pending message, choosing the ILP encoding with the following
+// coercion rules:
+//
+//	int, int8 ... int64           - integer (long) column
+//	uint, uint8 ... uint64        - integer column, see Uint64Column
+//	float32, float64              - double column
+//	bool                          - boolean column
+//	string                        - string column
+//	time.Time                     - timestamp column
+//	*big.Int                      - long256 column
+//	[]byte                        - string column, see BytesEncoding
+//	fmt.Stringer                  - string column with String()
+//	nil, nil pointers             - omitted, see AnyColumnRules
+//	pointers                      - the value they point to
+//
+// Named types, e.g. type Celsius float64, are written by their
+// underlying kind, unless they implement fmt.Stringer. Other types fail the
+// message with ErrUnsupportedType.
+func (b *buffer) AnyColumn(name string, val interface{}) *buffer {
+	if b.lastErr != nil {
+		return b
+	}
+	switch v := val.(type) {
+	case nil:
+		return b.anyNil(name)
+	case time.Time:
+		return b.TimestampColumn(name, v)
+	case *big.Int:
+		if v == nil {
+			return b.anyNil(name)
+		}
+		return b.Long256Column(name, v)
+	case int64:
+		return b.Int64Column(name, v)
+	case int:
+		return b.Int64Column(name, int64(v))
+	case int32:
+		return b.Int64Column(name, int64(v))
+	case int16:
+		return b.Int64Column(name, int64(v))
+	case int8:
+		return b.Int64Column(name, int64(v))
+	case uint64:
+		return b.Uint64Column(name, v)
+	case uint:
+		return b.Uint64Column(name, uint64(v))
+	case uint32:
+		return b.Uint64Column(name, uint64(v))
+	case uint16:
+		return b.Uint64Column(name, uint64(v))
+	case uint8:
+		return b.Uint64Column(name, uint64(v))
+	case float64:
+		return b.Float64Column(name, v)
+	case float32:
+		return b.Float64Column(name, b.anyFloat32(v))
+	case bool:
+		return b.BoolColumn(name, v)
+	case string:
+		return b.StringColumn(name, v)
+	case []byte:
+		if v == nil {
+			return b.anyNil(name)
+		}
+		return b.StringColumn(name, b.anyBytes(v))
+	case fmt.Stringer:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return b.anyNil(name)
+			}
+			// Pointers to values with their own String method, e.g.
+			// *time.Time, are written as the value they point to.
+			if elem, ok := rv.Elem().Interface().(fmt.Stringer); ok {
+				return b.AnyColumn(name, elem)
+			}
+		}
+		return b.StringColumn(name, v.String())
+	}
+	return b.anyKind(name, reflect.ValueOf(val))
+}
+
+// anyKind writes values of named types and pointers by their kind.
+func (b *buffer) anyKind(name string, rv reflect.Value) *buffer {
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return b.anyNil(name)
+		}
+		return b.AnyColumn(name, rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return b.Int64Column(name, rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return b.Uint64Column(name, rv.Uint())
+	case reflect.Float32:
+		return b.Float64Column(name, b.anyFloat32(float32(rv.Float())))
+	case reflect.Float64:
+		return b.Float64Column(name, rv.Float())
+	case reflect.Bool:
+		return b.BoolColumn(name, rv.Bool())
+	case reflect.String:
+		return b.StringColumn(name, rv.String())
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			if rv.IsNil() {
+				return b.anyNil(name)
+			}
+			return b.StringColumn(name, b.anyBytes(rv.Bytes()))
+		}
+	}
+	b.lastErr = fmt.Errorf("unsupported column value type: %s: %T: %w", name, rv.Interface(), ErrUnsupportedType)
+	return b
+}
+
+func (b *buffer) anyNil(name string) *buffer {
+	if b.anyRules.RejectNil {
+		b.lastErr = fmt.Errorf("nil column value: %s: %w", name, ErrUnsupportedType)
+	}
+	return b
+}
+
+func (b *buffer) anyFloat32(v float32) float64 {
+	if !b.anyRules.Float32Shortest {
+		return float64(v)
+	}
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+	return f
+}
+
+func (b *buffer) anyBytes(v []byte) string {
+	switch b.anyRules.Bytes {
+	case BytesAsBase64:
+		return base64.StdEncoding.EncodeToString(v)
+	case BytesAsHex:
+		return hex.EncodeToString(v)
+	default:
+		return string(v)
+	}
+}
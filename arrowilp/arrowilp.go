@@ -0,0 +1,258 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+// Package arrowilp writes Apache Arrow records as ILP rows, so that
+// the batches of analytics pipelines and Flight streams can be handed
+// over to QuestDB without a row-based conversion layer. The column
+// types are resolved once per record, and the rows are then written
+// with the typed column values.
+//
+// Columns are mapped by their names. The mapping rules are:
+//
+//   - bool columns are written as boolean columns.
+//   - Signed integer columns and unsigned ones of up to 32 bits are
+//     written as long columns, uint64 columns as unsigned long ones.
+//   - float32 and float64 columns are written as double columns.
+//   - string and large string columns are written as string columns.
+//   - timestamp columns are written as timestamp columns.
+//   - Dictionary columns with string values are written as symbols
+//     even if they are not listed in Mapping.Symbols.
+//   - Other column types are not supported and must be skipped.
+//
+// Null values are omitted, so their columns are null. Rows with
+// null symbols and columns only are skipped, since an ILP row needs
+// at least one non-null value.
+//
+// The package is a separate module, so that the client doesn't
+// depend on Arrow.
+package arrowilp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	qdb "github.com/questdb/go-questdb-client/v3"
+)
+
+// Mapping is a record to rows mapping spec. Columns are referred by
+// their Arrow field names.
+type Mapping struct {
+	// Symbols lists the string columns written as symbols.
+	Symbols []string
+	// Timestamp is the timestamp column used as the designated
+	// timestamp. The server assigns the timestamp on insertion if
+	// empty or if the value is null.
+	Timestamp string
+	// Columns renames the columns. The default column names are
+	// the Arrow field names.
+	Columns map[string]string
+	// Skip lists the columns that are not written.
+	Skip []string
+}
+
+// cell writes the value of a column at the given row.
+type cell struct {
+	arr   arrow.Array
+	write func(s qdb.LineSender, i int)
+}
+
+// WriteRecord writes the rows of the record to the sender. The rows
+// are added to the sender's buffer and flushed according to its auto
+// flush settings. If a row fails, the preceding rows stay buffered
+// and the error holds the row index.
+func WriteRecord(ctx context.Context, s qdb.LineSender, table string, rec arrow.Record, m Mapping) error {
+	symbols, columns, ts, err := plan(rec, m)
+	if err != nil {
+		return err
+	}
+	var unit arrow.TimeUnit
+	if ts != nil {
+		unit = ts.DataType().(*arrow.TimestampType).Unit
+	}
+	for i := 0; i < int(rec.NumRows()); i++ {
+		if nullRow(symbols, i) && nullRow(columns, i) {
+			continue
+		}
+		s.Table(table)
+		for _, c := range symbols {
+			if !c.arr.IsNull(i) {
+				c.write(s, i)
+			}
+		}
+		for _, c := range columns {
+			if !c.arr.IsNull(i) {
+				c.write(s, i)
+			}
+		}
+		if ts != nil && !ts.IsNull(i) {
+			err = s.At(ctx, ts.Value(i).ToTime(unit))
+		} else {
+			err = s.AtNow(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("arrowilp: row %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// nullRow reports whether all the cells are null at the given row.
+func nullRow(cells []cell, i int) bool {
+	for _, c := range cells {
+		if !c.arr.IsNull(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// plan resolves the writers of the record columns.
+func plan(rec arrow.Record, m Mapping) (symbols, columns []cell, ts *array.Timestamp, err error) {
+	isSymbol := make(map[string]bool, len(m.Symbols))
+	for _, name := range m.Symbols {
+		isSymbol[name] = true
+	}
+	skip := make(map[string]bool, len(m.Skip))
+	for _, name := range m.Skip {
+		skip[name] = true
+	}
+	for j := 0; j < int(rec.NumCols()); j++ {
+		field, arr := rec.ColumnName(j), rec.Column(j)
+		if skip[field] {
+			continue
+		}
+		if field == m.Timestamp {
+			var ok bool
+			if ts, ok = arr.(*array.Timestamp); !ok {
+				return nil, nil, nil, fmt.Errorf("arrowilp: designated timestamp column is not a timestamp: %s: %s", field, arr.DataType())
+			}
+			continue
+		}
+		name := field
+		if renamed, ok := m.Columns[field]; ok {
+			name = renamed
+		}
+		if dict, ok := arr.(*array.Dictionary); ok {
+			c, err := dictionaryCell(name, dict)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("arrowilp: %w: %s", err, field)
+			}
+			symbols = append(symbols, c)
+			continue
+		}
+		if isSymbol[field] {
+			c, ok := symbolCell(name, arr)
+			if !ok {
+				return nil, nil, nil, fmt.Errorf("arrowilp: symbol column is not a string: %s: %s", field, arr.DataType())
+			}
+			symbols = append(symbols, c)
+			continue
+		}
+		c, ok := columnCell(name, arr)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("arrowilp: unsupported column type: %s: %s", field, arr.DataType())
+		}
+		columns = append(columns, c)
+	}
+	if m.Timestamp != "" && ts == nil && !skip[m.Timestamp] {
+		return nil, nil, nil, fmt.Errorf("arrowilp: designated timestamp column not found: %s", m.Timestamp)
+	}
+	return symbols, columns, ts, nil
+}
+
+// stringer is implemented by the string and large string arrays.
+type stringer interface {
+	arrow.Array
+	Value(i int) string
+}
+
+func symbolCell(name string, arr arrow.Array) (cell, bool) {
+	a, ok := arr.(stringer)
+	if !ok {
+		return cell{}, false
+	}
+	return cell{arr, func(s qdb.LineSender, i int) { s.Symbol(name, a.Value(i)) }}, true
+}
+
+func dictionaryCell(name string, dict *array.Dictionary) (cell, error) {
+	values, ok := dict.Dictionary().(stringer)
+	if !ok {
+		return cell{}, fmt.Errorf("dictionary values are not strings: %s", dict.DataType())
+	}
+	return cell{dict, func(s qdb.LineSender, i int) {
+		s.Symbol(name, values.Value(dict.GetValueIndex(i)))
+	}}, nil
+}
+
+// integer is the set of the integer types written as long columns.
+type integer interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32
+}
+
+type valuer[T any] interface {
+	arrow.Array
+	Value(i int) T
+}
+
+func longCell[T integer](name string, a valuer[T]) cell {
+	return cell{a, func(s qdb.LineSender, i int) { s.Int64Column(name, int64(a.Value(i))) }}
+}
+
+func columnCell(name string, arr arrow.Array) (cell, bool) {
+	switch a := arr.(type) {
+	case *array.Boolean:
+		return cell{a, func(s qdb.LineSender, i int) { s.BoolColumn(name, a.Value(i)) }}, true
+	case *array.Int8:
+		return longCell[int8](name, a), true
+	case *array.Int16:
+		return longCell[int16](name, a), true
+	case *array.Int32:
+		return longCell[int32](name, a), true
+	case *array.Int64:
+		return longCell[int64](name, a), true
+	case *array.Uint8:
+		return longCell[uint8](name, a), true
+	case *array.Uint16:
+		return longCell[uint16](name, a), true
+	case *array.Uint32:
+		return longCell[uint32](name, a), true
+	case *array.Uint64:
+		return cell{a, func(s qdb.LineSender, i int) { s.Uint64Column(name, a.Value(i)) }}, true
+	case *array.Float32:
+		return cell{a, func(s qdb.LineSender, i int) { s.Float64Column(name, float64(a.Value(i))) }}, true
+	case *array.Float64:
+		return cell{a, func(s qdb.LineSender, i int) { s.Float64Column(name, a.Value(i)) }}, true
+	case *array.String:
+		return cell{a, func(s qdb.LineSender, i int) { s.StringColumn(name, a.Value(i)) }}, true
+	case *array.LargeString:
+		return cell{a, func(s qdb.LineSender, i int) { s.StringColumn(name, a.Value(i)) }}, true
+	case *array.Timestamp:
+		unit := a.DataType().(*arrow.TimestampType).Unit
+		return cell{a, func(s qdb.LineSender, i int) { s.TimestampColumn(name, a.Value(i).ToTime(unit)) }}, true
+	default:
+		return cell{}, false
+	}
+}
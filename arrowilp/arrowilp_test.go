@@ -0,0 +1,169 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package arrowilp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/questdb/go-questdb-client/v3/arrowilp"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRecord(t *testing.T) arrow.Record {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "host", Type: arrow.BinaryTypes.String},
+		{Name: "level", Type: &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int8, ValueType: arrow.BinaryTypes.String}},
+		{Name: "code", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "value", Type: arrow.PrimitiveTypes.Float64},
+		{Name: "ok", Type: arrow.FixedWidthTypes.Boolean},
+		{Name: "payload", Type: arrow.BinaryTypes.Binary},
+		{Name: "ts", Type: arrow.FixedWidthTypes.Timestamp_us},
+	}, nil)
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer b.Release()
+
+	b.Field(0).(*array.StringBuilder).AppendValues([]string{"h1", "h2"}, nil)
+	level := b.Field(1).(*array.BinaryDictionaryBuilder)
+	assert.NoError(t, level.Append([]byte("INFO")))
+	assert.NoError(t, level.Append([]byte("WARN")))
+	b.Field(2).(*array.Int32Builder).AppendValues([]int32{42, 0}, []bool{true, false})
+	b.Field(3).(*array.Float64Builder).AppendValues([]float64{1.5, 2.5}, nil)
+	b.Field(4).(*array.BooleanBuilder).AppendValues([]bool{true, false}, nil)
+	b.Field(5).(*array.BinaryBuilder).AppendValues([][]byte{[]byte("hi"), nil}, nil)
+	b.Field(6).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1000, 2000}, nil)
+	return b.NewRecord()
+}
+
+func TestWriteRecord(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	rec := newRecord(t)
+	defer rec.Release()
+	err = arrowilp.WriteRecord(ctx, sender, "events", rec, arrowilp.Mapping{
+		Symbols:   []string{"host"},
+		Timestamp: "ts",
+		Columns:   map[string]string{"value": "v"},
+		Skip:      []string{"payload"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+
+	it := sender.(qdb.DryRunSender).Lines()
+	assert.True(t, it.Next())
+	assert.Equal(t, "events,host=h1,level=INFO code=42i,v=1.5,ok=t 1000000", it.Line())
+	assert.True(t, it.Next())
+	// Null values are omitted.
+	assert.Equal(t, "events,host=h2,level=WARN v=2.5,ok=f 2000000", it.Line())
+	assert.False(t, it.Next())
+}
+
+func TestWriteRecordNullRows(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "code", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "ts", Type: arrow.FixedWidthTypes.Timestamp_us},
+	}, nil)
+	b := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer b.Release()
+	b.Field(0).(*array.StringBuilder).AppendValues([]string{"", "h2", "", ""}, []bool{false, true, false, false})
+	b.Field(1).(*array.Int64Builder).AppendValues([]int64{0, 0, 0, 4}, []bool{false, false, false, true})
+	b.Field(2).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1, 2, 3, 4}, nil)
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	err = arrowilp.WriteRecord(ctx, sender, "events", rec, arrowilp.Mapping{
+		Symbols:   []string{"host"},
+		Timestamp: "ts",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+
+	// The rows with nulls only are skipped.
+	it := sender.(qdb.DryRunSender).Lines()
+	assert.True(t, it.Next())
+	assert.Equal(t, "events,host=h2 2000", it.Line())
+	assert.True(t, it.Next())
+	assert.Equal(t, "events code=4i 4000", it.Line())
+	assert.False(t, it.Next())
+}
+
+func TestWriteRecordErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mapping  arrowilp.Mapping
+		expected string
+	}{
+		{
+			name:     "unsupported column type",
+			mapping:  arrowilp.Mapping{},
+			expected: "unsupported column type: payload: binary",
+		},
+		{
+			name:     "non-string symbol",
+			mapping:  arrowilp.Mapping{Symbols: []string{"code"}, Skip: []string{"payload"}},
+			expected: "symbol column is not a string: code: int32",
+		},
+		{
+			name:     "non-timestamp designated timestamp",
+			mapping:  arrowilp.Mapping{Timestamp: "code", Skip: []string{"payload"}},
+			expected: "designated timestamp column is not a timestamp: code: int32",
+		},
+		{
+			name:     "missing designated timestamp",
+			mapping:  arrowilp.Mapping{Timestamp: "time", Skip: []string{"payload"}},
+			expected: "designated timestamp column not found: time",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			rec := newRecord(t)
+			defer rec.Release()
+			err = arrowilp.WriteRecord(ctx, sender, "events", rec, tc.mapping)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,358 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// QueueItem is a row waiting in an AsyncQueue. Implementations
+// must keep items intact, since they carry the row's flush token.
+type QueueItem struct {
+	Row   Row
+	token *FlushToken
+}
+
+// AsyncQueue is the queue of rows waiting for the AsyncSender
+// workers. NewChannelQueue, NewRingQueue and NewDiskQueue provide
+// implementations with different durability and speed trade-offs,
+// while AsyncSenderConfig.NewQueue allows plugging in custom ones.
+//
+// Implementations must be safe for concurrent use.
+type AsyncQueue interface {
+	// Push adds the item to the queue. If the queue is full and wait
+	// is true, Push waits until there is room or the context is
+	// done; otherwise, it returns ErrQueueFull.
+	Push(ctx context.Context, item QueueItem, wait bool) error
+	// Pop removes the oldest item, waiting until there is one. It
+	// returns false once the queue is closed and drained.
+	Pop() (QueueItem, bool)
+	// Len returns the number of items in the queue.
+	Len() int
+	// Close stops the queue. Push is not called after Close.
+	Close() error
+}
+
+// AsyncQueueAcker is an optional interface of AsyncQueue. The
+// AsyncSender workers call Ack once the rows they popped are flushed
+// or reported to OnError, so that durable queues know when they may
+// forget them. Rows dropped by AsyncSender.Close with a done context
+// are not acknowledged.
+type AsyncQueueAcker interface {
+	// Ack acknowledges the given number of popped rows.
+	Ack(n int)
+}
+
+type channelQueue struct {
+	ch chan QueueItem
+}
+
+// NewChannelQueue creates an in-memory queue of the given size
+// backed by a buffered channel. It's the default AsyncSender queue.
+func NewChannelQueue(size int) AsyncQueue {
+	return &channelQueue{ch: make(chan QueueItem, size)}
+}
+
+func (q *channelQueue) Push(ctx context.Context, item QueueItem, wait bool) error {
+	if !wait {
+		select {
+		case q.ch <- item:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	}
+	select {
+	case q.ch <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *channelQueue) Pop() (QueueItem, bool) {
+	item, ok := <-q.ch
+	return item, ok
+}
+
+func (q *channelQueue) Len() int {
+	return len(q.ch)
+}
+
+func (q *channelQueue) Close() error {
+	close(q.ch)
+	return nil
+}
+
+type ringQueue struct {
+	mu     sync.Mutex
+	items  []QueueItem
+	head   int
+	n      int
+	closed bool
+
+	// notEmpty and notFull wake up a single waiter. Waiters pass
+	// the signal on if there are more items or more room left.
+	notEmpty chan struct{}
+	notFull  chan struct{}
+	done     chan struct{}
+}
+
+// NewRingQueue creates an in-memory queue of the given size backed
+// by a preallocated ring buffer. Unlike the channel queue, it
+// reuses the same slots for all rows.
+func NewRingQueue(size int) AsyncQueue {
+	return newRingQueue(size)
+}
+
+func newRingQueue(size int) *ringQueue {
+	return &ringQueue{
+		items:    make([]QueueItem, size),
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (q *ringQueue) Push(ctx context.Context, item QueueItem, wait bool) error {
+	for {
+		q.mu.Lock()
+		if q.n < len(q.items) {
+			q.items[(q.head+q.n)%len(q.items)] = item
+			q.n++
+			if q.n < len(q.items) {
+				signal(q.notFull)
+			}
+			q.mu.Unlock()
+			signal(q.notEmpty)
+			return nil
+		}
+		q.mu.Unlock()
+		if !wait {
+			return ErrQueueFull
+		}
+		select {
+		case <-q.notFull:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *ringQueue) Pop() (QueueItem, bool) {
+	for {
+		q.mu.Lock()
+		if q.n > 0 {
+			item := q.items[q.head]
+			q.items[q.head] = QueueItem{}
+			q.head = (q.head + 1) % len(q.items)
+			q.n--
+			if q.n > 0 {
+				signal(q.notEmpty)
+			}
+			q.mu.Unlock()
+			signal(q.notFull)
+			return item, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return QueueItem{}, false
+		}
+		select {
+		case <-q.notEmpty:
+		case <-q.done:
+		}
+	}
+}
+
+func (q *ringQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+func (q *ringQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+	return nil
+}
+
+const diskQueueFileName = "queue.ilp"
+
+type diskQueue struct {
+	ring *ringQueue
+
+	// pushMu serializes the pushes, so that a push failed after
+	// writing its row to the file can take the row back. It's not
+	// held by Ack, so that the workers are not blocked by a push
+	// waiting for them to make room.
+	pushMu sync.Mutex
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	// unacked is the number of rows pushed, but not acknowledged.
+	// It's incremented along with the file write, before the row is
+	// added to the ring, so that it never drops to zero while the
+	// file holds rows that are not flushed yet.
+	unacked int
+}
+
+// NewDiskQueue creates a queue of the given size that keeps a copy
+// of the queued rows in a file in the given directory, so that they
+// survive a process restart. Rows left in the file by a previous
+// process are queued first. The file is truncated once all queued
+// rows are acknowledged by the AsyncSender workers, see
+// AsyncQueueAcker, so rows flushed since the last truncation may
+// be sent again after a crash. Rows dropped by AsyncSender.Close
+// with a done context are kept for the next process.
+//
+// Rows are encoded as ILP lines, so invalid rows are rejected by
+// Push. The file is not synced on each Push, so the rows don't
+// survive an OS crash.
+func NewDiskQueue(dir string, size int) (AsyncQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %v", err)
+	}
+	path := filepath.Join(dir, diskQueueFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue file: %v", err)
+	}
+
+	var rows []Row
+	d := NewLineDecoder(f)
+	for d.Next() {
+		rows = append(rows, d.Row())
+	}
+	if err := d.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read queue file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read queue file: %v", err)
+	}
+	if len(rows) > size {
+		size = len(rows)
+	}
+	q := &diskQueue{ring: newRingQueue(size), f: f, size: info.Size(), unacked: len(rows)}
+	for _, row := range rows {
+		q.ring.Push(context.Background(), QueueItem{Row: row}, false)
+	}
+	return q, nil
+}
+
+func (q *diskQueue) Push(ctx context.Context, item QueueItem, wait bool) error {
+	line, err := item.Row.AppendILP(nil)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	q.pushMu.Lock()
+	defer q.pushMu.Unlock()
+
+	// The row is written before it's added to the ring, so that
+	// it can't be acknowledged before it's in the file.
+	q.mu.Lock()
+	size := q.size
+	if q.f != nil {
+		if _, err := q.f.Write(line); err != nil {
+			q.f.Truncate(size)
+			q.mu.Unlock()
+			return fmt.Errorf("failed to write queue file: %v", err)
+		}
+		q.size += int64(len(line))
+	}
+	q.unacked++
+	q.mu.Unlock()
+
+	if err := q.ring.Push(ctx, item, wait); err != nil {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.unacked--
+		if q.f != nil {
+			// No rows were written since, and the file can't be
+			// truncated by Ack while the row is unacknowledged.
+			if q.unacked == 0 {
+				size = 0
+			}
+			q.f.Truncate(size)
+			q.size = size
+		}
+		return err
+	}
+	return nil
+}
+
+func (q *diskQueue) Pop() (QueueItem, bool) {
+	item, ok := q.ring.Pop()
+	if !ok {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.f != nil {
+			q.f.Close()
+			q.f = nil
+		}
+	}
+	return item, ok
+}
+
+func (q *diskQueue) Ack(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.unacked -= n
+	if q.unacked == 0 && q.f != nil {
+		// All rows are flushed, so the file may start over.
+		q.f.Truncate(0)
+		q.size = 0
+	}
+}
+
+func (q *diskQueue) Len() int {
+	return q.ring.Len()
+}
+
+func (q *diskQueue) Close() error {
+	return q.ring.Close()
+}
@@ -0,0 +1,317 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+// OverflowPolicy defines what AsyncSender does with a row sent
+// to a full queue.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Send wait until there is room in the
+	// queue or the context is done.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject makes Send return ErrQueueFull immediately.
+	OverflowReject
+)
+
+// ErrQueueFull is returned by AsyncSender when the queue is full
+// and the OverflowReject policy is used.
+var ErrQueueFull = errors.New("async sender queue is full")
+
+var errAsyncSenderClosed = errors.New("async sender is closed")
+
+const (
+	defaultAsyncQueueSize = 1024
+	defaultAsyncWorkers   = 1
+)
+
+// AsyncSenderConfig holds AsyncSender settings.
+type AsyncSenderConfig struct {
+	// QueueSize is the max number of rows waiting in the queue.
+	// Defaults to 1024.
+	QueueSize int
+	// Workers is the number of worker goroutines, each of them
+	// with its own sender. Defaults to 1.
+	Workers int
+	// Overflow defines the behavior of Send when the queue is full.
+	// Defaults to OverflowBlock.
+	Overflow OverflowPolicy
+	// ShardByTable makes each worker handle its own subset of
+	// tables, so that rows of the same table are flushed in the
+	// order they were sent, while flushes of different tables run
+	// concurrently. Each worker gets its own queue of QueueSize
+	// rows.
+	ShardByTable bool
+	// OnError, if set, is called by the workers for invalid rows
+	// and failed flushes. It must not block.
+	OnError func(err error)
+	// NewQueue, if set, creates the queue of the given shard with
+	// room for size rows. The shard is always 0 unless sharding by
+	// table is enabled. Defaults to NewChannelQueue.
+	NewQueue func(shard, size int) (AsyncQueue, error)
+}
+
+// AsyncSender accepts complete rows into a bounded queue. Worker
+// goroutines write the queued rows to their senders and flush them
+// once the queue is drained, or earlier if auto-flush kicks in.
+//
+//	sender, err := qdb.NewAsyncSender(ctx, qdb.AsyncSenderConfig{Workers: 4}, qdb.WithHttp())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer sender.Close(ctx)
+//
+//	err = sender.Send(ctx, qdb.Row{
+//		Table:   "trades",
+//		Columns: []qdb.TypedValue{{Name: "price", Value: 2615.54}},
+//	})
+//
+// AsyncSender is safe for concurrent use.
+type AsyncSender struct {
+	// queues holds a queue per worker if sharding by table is
+	// enabled; otherwise, the workers share a single queue.
+	queues   []AsyncQueue
+	overflow OverflowPolicy
+	onError  func(err error)
+	senders  []LineSender
+	wg       sync.WaitGroup
+	// cancel stops the workers if Close gives up on draining.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncSender creates an AsyncSender and starts its workers.
+// The worker senders are created with the given options.
+func NewAsyncSender(ctx context.Context, conf AsyncSenderConfig, opts ...LineSenderOption) (*AsyncSender, error) {
+	if conf.QueueSize < 0 {
+		return nil, errors.New("queue size is negative")
+	}
+	if conf.Workers < 0 {
+		return nil, errors.New("number of workers is negative")
+	}
+	if conf.Overflow != OverflowBlock && conf.Overflow != OverflowReject {
+		return nil, errors.New("unknown overflow policy")
+	}
+	if conf.QueueSize == 0 {
+		conf.QueueSize = defaultAsyncQueueSize
+	}
+	if conf.Workers == 0 {
+		conf.Workers = defaultAsyncWorkers
+	}
+
+	s := &AsyncSender{
+		overflow: conf.Overflow,
+		onError:  conf.OnError,
+	}
+	queues := 1
+	if conf.ShardByTable {
+		queues = conf.Workers
+	}
+	for i := 0; i < queues; i++ {
+		q := NewChannelQueue(conf.QueueSize)
+		if conf.NewQueue != nil {
+			var err error
+			q, err = conf.NewQueue(i, conf.QueueSize)
+			if err != nil {
+				s.closeAll(ctx)
+				return nil, err
+			}
+		}
+		s.queues = append(s.queues, q)
+	}
+	for i := 0; i < conf.Workers; i++ {
+		ls, err := NewLineSender(ctx, opts...)
+		if err != nil {
+			s.closeAll(ctx)
+			return nil, err
+		}
+		s.senders = append(s.senders, ls)
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(len(s.senders))
+	for i, ls := range s.senders {
+		go s.work(ls, s.queues[i%len(s.queues)])
+	}
+	return s, nil
+}
+
+// closeAll releases the queues and senders created so far.
+func (s *AsyncSender) closeAll(ctx context.Context) {
+	for _, q := range s.queues {
+		q.Close()
+	}
+	for _, ls := range s.senders {
+		ls.Close(ctx)
+	}
+}
+
+// Send puts the row into the queue. The row must not be modified
+// after the call.
+//
+// Errors for invalid rows and failed flushes are reported to the
+// OnError callback. Use SendWithToken to wait for a specific row.
+func (s *AsyncSender) Send(ctx context.Context, row Row) error {
+	return s.send(ctx, QueueItem{Row: row})
+}
+
+// SendWithToken puts the row into the queue and returns a token
+// that is resolved once the row is flushed. If the row is invalid,
+// the token is resolved with the validation error.
+func (s *AsyncSender) SendWithToken(ctx context.Context, row Row) (*FlushToken, error) {
+	t := newFlushToken()
+	if err := s.send(ctx, QueueItem{Row: row, token: t}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *AsyncSender) send(ctx context.Context, item QueueItem) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errAsyncSenderClosed
+	}
+
+	queue := s.queues[0]
+	if len(s.queues) > 1 {
+		h := fnv.New32a()
+		h.Write([]byte(item.Row.Table))
+		queue = s.queues[h.Sum32()%uint32(len(s.queues))]
+	}
+	return queue.Push(ctx, item, s.overflow == OverflowBlock)
+}
+
+// QueueLen returns the number of rows waiting in the queue.
+func (s *AsyncSender) QueueLen() int {
+	n := 0
+	for _, q := range s.queues {
+		n += q.Len()
+	}
+	return n
+}
+
+func (s *AsyncSender) work(ls LineSender, queue AsyncQueue) {
+	defer s.wg.Done()
+	acker, _ := queue.(AsyncQueueAcker)
+	// Number of rows popped since the last flush.
+	popped := 0
+	ack := func() {
+		// Rows of a flush interrupted by Close are not acknowledged,
+		// so that durable queues keep them.
+		if acker != nil && popped > 0 && s.ctx.Err() == nil {
+			acker.Ack(popped)
+		}
+		popped = 0
+	}
+	for {
+		item, ok := queue.Pop()
+		if !ok {
+			break
+		}
+		if s.ctx.Err() != nil {
+			if item.token != nil {
+				item.token.resolve(errClosedBeforeFlush)
+			}
+			continue
+		}
+		popped++
+
+		err := writeRow(s.ctx, ls, &item.Row)
+		if err != nil {
+			s.reportErr(err)
+			if item.token != nil {
+				item.token.resolve(err)
+			}
+		} else if item.token != nil {
+			ls.PendingFlush().chain(item.token)
+		}
+
+		if queue.Len() == 0 {
+			if err := ls.Flush(s.ctx); err != nil {
+				s.reportErr(err)
+			}
+			ack()
+		}
+	}
+	if s.ctx.Err() == nil {
+		if err := ls.Flush(s.ctx); err != nil {
+			s.reportErr(err)
+		}
+		ack()
+	}
+	ls.Close(s.ctx)
+}
+
+func (s *AsyncSender) reportErr(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// Close stops accepting new rows and waits until the workers send
+// the queued rows and close their senders. If the context is done
+// first, the remaining rows are dropped and the context error is
+// returned.
+func (s *AsyncSender) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var closeErr error
+	for _, q := range s.queues {
+		if err := q.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return closeErr
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
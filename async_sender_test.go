@@ -0,0 +1,493 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncSender(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	var (
+		mu     sync.Mutex
+		errors []error
+	)
+	sender, err := qdb.NewAsyncSender(
+		ctx,
+		qdb.AsyncSenderConfig{
+			QueueSize: 16,
+			OnError: func(err error) {
+				mu.Lock()
+				errors = append(errors, err)
+				mu.Unlock()
+			},
+		},
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+	)
+	assert.NoError(t, err)
+
+	token, err := sender.SendWithToken(ctx, qdb.Row{
+		Table:   testTable,
+		Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(1)}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, token.Result(ctx))
+	expectLines(t, srv.BackCh, []string{testTable + " a_col=1i"})
+
+	token, err = sender.SendWithToken(ctx, qdb.Row{
+		Table:   testTable,
+		Columns: []qdb.TypedValue{{Name: "a_col", Value: int32(1)}},
+	})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, token.Result(ctx), "unsupported column value type")
+
+	err = sender.Send(ctx, qdb.Row{
+		Table:   testTable,
+		Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(2)}},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, sender.Close(ctx))
+	expectLines(t, srv.BackCh, []string{testTable + " a_col=2i"})
+
+	mu.Lock()
+	assert.Len(t, errors, 1)
+	mu.Unlock()
+
+	err = sender.Send(ctx, qdb.Row{Table: testTable})
+	assert.ErrorContains(t, err, "async sender is closed")
+}
+
+func TestAsyncSenderWorkers(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewAsyncSender(
+		ctx,
+		qdb.AsyncSenderConfig{Workers: 3},
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+	)
+	assert.NoError(t, err)
+
+	const n = 100
+	// The server blocks until the lines are consumed, so they
+	// have to be read while the rows are sent.
+	linesCh := make(chan []string)
+	go func() {
+		actual := make([]string, 0, n)
+		timeout := time.After(3 * time.Second)
+		for len(actual) < n {
+			select {
+			case l := <-srv.BackCh:
+				actual = append(actual, l)
+			case <-timeout:
+				linesCh <- actual
+				return
+			}
+		}
+		linesCh <- actual
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n/4; i++ {
+				err := sender.Send(ctx, qdb.Row{
+					Table:   testTable,
+					Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(g*n + i)}},
+				})
+				assert.NoError(t, err)
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.NoError(t, sender.Close(ctx))
+
+	expected := make([]string, 0, n)
+	for g := 0; g < 4; g++ {
+		for i := 0; i < n/4; i++ {
+			expected = append(expected, fmt.Sprintf("%s a_col=%di", testTable, g*n+i))
+		}
+	}
+	actual := <-linesCh
+	assert.ElementsMatch(t, expected, actual)
+}
+
+func TestAsyncSenderOverflowReject(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := qdb.NewAsyncSender(ctx, qdb.AsyncSenderConfig{Overflow: 42}, qdb.WithHttp())
+	assert.ErrorContains(t, err, "unknown overflow policy")
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewAsyncSender(
+		ctx,
+		qdb.AsyncSenderConfig{QueueSize: 1, Overflow: qdb.OverflowReject},
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	row := qdb.Row{
+		Table:   testTable,
+		Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(1)}},
+	}
+	var rejected bool
+	for i := 0; i < 10000 && !rejected; i++ {
+		err = sender.Send(ctx, row)
+		if err != nil {
+			assert.ErrorIs(t, err, qdb.ErrQueueFull)
+			rejected = true
+		}
+	}
+	assert.True(t, rejected)
+}
+
+func TestAsyncSenderShardByTable(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewAsyncSender(
+		ctx,
+		qdb.AsyncSenderConfig{Workers: 3, ShardByTable: true},
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+	)
+	assert.NoError(t, err)
+
+	const n = 50
+	tables := []string{"table_a", "table_b", "table_c", "table_d"}
+	linesCh := make(chan []string)
+	go func() {
+		actual := make([]string, 0, n*len(tables))
+		timeout := time.After(3 * time.Second)
+		for len(actual) < n*len(tables) {
+			select {
+			case l := <-srv.BackCh:
+				actual = append(actual, l)
+			case <-timeout:
+				linesCh <- actual
+				return
+			}
+		}
+		linesCh <- actual
+	}()
+
+	for i := 0; i < n; i++ {
+		for _, table := range tables {
+			err := sender.Send(ctx, qdb.Row{
+				Table:   table,
+				Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(i)}},
+			})
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, sender.Close(ctx))
+
+	perTable := make(map[string][]string)
+	for _, l := range <-linesCh {
+		table := strings.SplitN(l, " ", 2)[0]
+		perTable[table] = append(perTable[table], l)
+	}
+	for _, table := range tables {
+		expected := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			expected = append(expected, fmt.Sprintf("%s a_col=%di", table, i))
+		}
+		assert.Equal(t, expected, perTable[table])
+	}
+}
+
+func TestAsyncQueues(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	testCases := []struct {
+		name     string
+		newQueue func(shard, size int) (qdb.AsyncQueue, error)
+	}{
+		{"channel", nil},
+		{"ring", func(_, size int) (qdb.AsyncQueue, error) {
+			return qdb.NewRingQueue(size), nil
+		}},
+		{"spsc", func(_, size int) (qdb.AsyncQueue, error) {
+			return qdb.NewSPSCQueue(size), nil
+		}},
+		{"disk", func(shard, size int) (qdb.AsyncQueue, error) {
+			return qdb.NewDiskQueue(fmt.Sprintf("%s/%d", dir, shard), size)
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, err := qdb.NewAsyncSender(
+				ctx,
+				qdb.AsyncSenderConfig{QueueSize: 4, NewQueue: tc.newQueue},
+				qdb.WithHttp(),
+				qdb.WithAddress(srv.Addr()),
+			)
+			assert.NoError(t, err)
+
+			const n = 10
+			// The server blocks until the lines are consumed.
+			linesCh := make(chan []string)
+			go func() {
+				actual := make([]string, 0, n)
+				timeout := time.After(3 * time.Second)
+				for len(actual) < n {
+					select {
+					case l := <-srv.BackCh:
+						actual = append(actual, l)
+					case <-timeout:
+						linesCh <- actual
+						return
+					}
+				}
+				linesCh <- actual
+			}()
+
+			var expected []string
+			for i := 0; i < n; i++ {
+				err = sender.Send(ctx, qdb.Row{
+					Table:   testTable,
+					Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(i)}},
+				})
+				assert.NoError(t, err)
+				expected = append(expected, fmt.Sprintf("%s a_col=%di", testTable, i))
+			}
+			assert.NoError(t, sender.Close(ctx))
+			assert.Equal(t, expected, <-linesCh)
+		})
+	}
+}
+
+func TestDiskQueueRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	q, err := qdb.NewDiskQueue(dir, 4)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		err = q.Push(ctx, qdb.QueueItem{Row: qdb.Row{
+			Table:   testTable,
+			Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(i)}},
+		}}, false)
+		assert.NoError(t, err)
+	}
+	err = q.Push(ctx, qdb.QueueItem{Row: qdb.Row{Table: testTable}}, false)
+	assert.ErrorIs(t, err, qdb.ErrEmptyMessage)
+
+	// The rows are kept by a new queue, e.g. after a crash.
+	q, err = qdb.NewDiskQueue(dir, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, q.Len())
+	item, ok := q.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), item.Row.Columns[0].Value)
+
+	// The popped rows are kept until acknowledged.
+	_, ok = q.Pop()
+	assert.True(t, ok)
+	assert.NoError(t, q.Close())
+	_, ok = q.Pop()
+	assert.False(t, ok)
+
+	q, err = qdb.NewDiskQueue(dir, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, q.Len())
+
+	// The file starts over once all rows are acknowledged.
+	for i := 0; i < 2; i++ {
+		_, ok = q.Pop()
+		assert.True(t, ok)
+	}
+	q.(qdb.AsyncQueueAcker).Ack(2)
+	assert.NoError(t, q.Close())
+	_, ok = q.Pop()
+	assert.False(t, ok)
+
+	q, err = qdb.NewDiskQueue(dir, 4)
+	assert.NoError(t, err)
+	assert.Zero(t, q.Len())
+	assert.NoError(t, q.Close())
+}
+
+func TestDiskQueueFailedPush(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	row := func(i int) qdb.QueueItem {
+		return qdb.QueueItem{Row: qdb.Row{
+			Table:   testTable,
+			Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(i)}},
+		}}
+	}
+
+	q, err := qdb.NewDiskQueue(dir, 2)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, q.Push(ctx, row(i), false))
+	}
+	// The row of a failed push is not kept in the file.
+	err = q.Push(ctx, row(2), false)
+	assert.ErrorIs(t, err, qdb.ErrQueueFull)
+
+	// The file keeps the rows that are not acknowledged yet.
+	for i := 0; i < 2; i++ {
+		_, ok := q.Pop()
+		assert.True(t, ok)
+	}
+	q.(qdb.AsyncQueueAcker).Ack(1)
+	assert.NoError(t, q.Push(ctx, row(3), false))
+	assert.NoError(t, q.Push(ctx, row(4), false))
+	assert.ErrorIs(t, q.Push(ctx, row(5), false), qdb.ErrQueueFull)
+
+	q, err = qdb.NewDiskQueue(dir, 2)
+	assert.NoError(t, err)
+	var got []int64
+	for q.Len() > 0 {
+		item, ok := q.Pop()
+		assert.True(t, ok)
+		got = append(got, item.Row.Columns[0].Value.(int64))
+	}
+	assert.Equal(t, []int64{0, 1, 3, 4}, got)
+	assert.NoError(t, q.Close())
+}
+
+func TestDiskQueueCloseTimeout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// The server hangs, so that the flush is still in progress
+	// when Close gives up.
+	requests := make(chan struct{}, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request context is only done once the body is read.
+		io.Copy(io.Discard, r.Body)
+		requests <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewAsyncSender(
+		ctx,
+		qdb.AsyncSenderConfig{QueueSize: 4, NewQueue: func(_, size int) (qdb.AsyncQueue, error) {
+			return qdb.NewDiskQueue(dir, size)
+		}},
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Listener.Addr().String()),
+	)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		err = sender.Send(ctx, qdb.Row{
+			Table:   testTable,
+			Columns: []qdb.TypedValue{{Name: "a_col", Value: int64(i)}},
+		})
+		assert.NoError(t, err)
+	}
+	<-requests
+
+	closeCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, sender.Close(closeCtx), context.DeadlineExceeded)
+
+	// The rows dropped by Close are kept for the next process.
+	q, err := qdb.NewDiskQueue(dir, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, q.Len())
+	assert.NoError(t, q.Close())
+}
+
+func TestSPSCQueue(t *testing.T) {
+	ctx := context.Background()
+
+	q := qdb.NewSPSCQueue(3)
+	const n = 10000
+	go func() {
+		for i := 0; i < n; i++ {
+			err := q.Push(ctx, qdb.QueueItem{Row: qdb.Row{Table: fmt.Sprint(i)}}, true)
+			assert.NoError(t, err)
+		}
+		q.Close()
+	}()
+
+	i := 0
+	for {
+		item, ok := q.Pop()
+		if !ok {
+			break
+		}
+		assert.Equal(t, fmt.Sprint(i), item.Row.Table)
+		i++
+	}
+	assert.Equal(t, n, i)
+
+	// The size is rounded up to a power of two.
+	q = qdb.NewSPSCQueue(3)
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, q.Push(ctx, qdb.QueueItem{}, false))
+	}
+	assert.ErrorIs(t, q.Push(ctx, qdb.QueueItem{}, false), qdb.ErrQueueFull)
+	assert.Equal(t, 4, q.Len())
+
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, q.Push(cancelCtx, qdb.QueueItem{}, true), context.DeadlineExceeded)
+}
@@ -26,20 +26,19 @@ package questdb
 
 import (
 	"bytes"
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"math/big"
+	"reflect"
+	"sort"
 	"strconv"
 	"time"
+	"unicode/utf8"
 )
 
-// errInvalidMsg indicates a failed attempt to construct an ILP
-// message, e.g. duplicate calls to Table method or illegal
-// chars found in table or column name.
-var errInvalidMsg = errors.New("invalid message")
-
 // buffer is a wrapper on top of bytes.Buffer. It extends the
 // original struct with methods for writing int64 and float64
 // numbers without unnecessary allocations.
@@ -49,13 +48,124 @@ type buffer struct {
 	initBufSize   int
 	maxBufSize    int
 	fileNameLimit int
+	// maxColumns is the max number of symbols and columns in
+	// a message; 0 means no limit.
+	maxColumns int
+	msgColumns int
+
+	lastErr   error
+	hasTable  bool
+	hasTags   bool
+	hasFields bool
+
+	// msgEnds holds the end offset of each completed message in
+	// the buffer. Anything past the last offset belongs to the
+	// pending message.
+	msgEnds []int
+	// msgBase is subtracted from msgEnds to get the offsets in the
+	// buffer. It grows as the oldest messages are dropped, so that
+	// they are dropped without copying.
+	msgBase int
+
+	// Number of significant digits for float columns; 0 means
+	// the shortest representation that round-trips.
+	floatPrecision int
+	// Whether uint64 columns are sent as long256 instead of long.
+	uint64AsLong256 bool
+	// Whether messages without a designated timestamp are stamped
+	// with the client clock.
+	clientTimestamps bool
+
+	// Pending rows guard fields
+	maxPendingRows    int
+	rejectPendingRows bool
+
+	// Encoded symbols written after the table name of each message.
+	globalSymbols []byte
+	// Number of the global symbols, counted as columns of each
+	// message.
+	globalSymbolCount int
+
+	// Symbol reordering fields
+	reorderSymbols bool
+	fieldsPos      int
+
+	ctrlChars  ControlCharPolicy
+	validation ValidationLevel
+
+	// String length limit fields
+	maxStrLen   int
+	truncateStr bool
+	truncMarker string
+	// Truncated string values in the pending message and
+	// in the completed messages since the last flush.
+	pendingTruncated int
+	truncated        int
+
+	// Monotonic timestamp guard fields
+	tableName   string
+	tsGuard     bool
+	tsTolerance int64
+	tsWarn      func(err error)
+	lastTs      map[string]int64
+	// Updates of lastTs by the completed messages, so that they can
+	// be rolled back along with the messages.
+	tsUndo       []tsUpdate
+	failedTsUndo []tsUpdate
+
+	// Checkpoint-related fields
+	gen        uint64
+	genSeq     uint64
+	failed     []byte
+	failedEnds []int
+	failedGen  uint64
+
+	// Token resolved by the next flush.
+	flushToken *FlushToken
+
+	// Pool the buffer memory is taken from, if any.
+	pool *BufferPool
+
+	// Shedder applied once the max pending rows limit is reached.
+	shedder *Shedder
+	// Whether the rows kept after a failed flush are being shed
+	// until the next flush.
+	shedding bool
+
+	// Row interceptors called by At.
+	interceptors []func(*RowView) error
+
+	// Redaction fields
+	redactor  Redactor
+	redacting bool
+
+	// Duplicate suppression fields
+	dupFilter *DuplicateFilter
+	dupHashes map[uint64]struct{}
 
-	lastMsgPos int
-	lastErr    error
-	hasTable   bool
-	hasTags    bool
-	hasFields  bool
-	msgCount   int
+	// Coercion rules of AnyColumn.
+	anyRules AnyColumnRules
+
+	// Schema registry fields
+	schemas      *SchemaRegistry
+	strictSchema bool
+	tableColumns map[string]ColumnType
+
+	// Process-wide memory limit fields.
+	memLimit     int64
+	memPolicy    OverflowPolicy
+	memAccounted int64
+}
+
+// Checkpoint is a snapshot of the sender's buffer state that can be
+// used to roll back the buffer with the Restore method.
+//
+// A checkpoint only covers completed messages: a message that is
+// pending at the time of the Checkpoint call is not included.
+type Checkpoint struct {
+	gen       uint64
+	msgCount  int
+	truncated int
 }
 
 func newBuffer(initBufSize int, maxBufSize int, fileNameLimit int) buffer {
@@ -67,7 +177,97 @@ func newBuffer(initBufSize int, maxBufSize int, fileNameLimit int) buffer {
 	return b
 }
 
+// newBufferFromConf creates a buffer with the message-level options
+// of the given config applied.
+func newBufferFromConf(conf *lineSenderConfig) (buffer, error) {
+	b := newBuffer(conf.initBufSize, conf.maxBufSize, conf.fileNameLimit)
+	if conf.tsGuard {
+		b.enableTimestampGuard(conf.tsTolerance, conf.tsWarn)
+	}
+	b.reorderSymbols = conf.reorderSymbols
+	b.usePool(conf.bufferPool)
+	b.memLimit = conf.memoryLimit
+	b.memPolicy = conf.memoryOverflow
+	b.ctrlChars = conf.ctrlChars
+	b.validation = conf.validation
+	b.setStringLimit(conf)
+	b.floatPrecision = conf.floatPrecision
+	b.uint64AsLong256 = conf.uint64AsLong256
+	b.clientTimestamps = conf.clientTimestamps
+	b.maxPendingRows = conf.maxPendingRows
+	b.rejectPendingRows = conf.maxPendingRows > 0 && conf.pendingRowsPolicy == PendingRowsPolicyError && conf.shedder == nil
+	b.shedder = conf.shedder
+	b.interceptors = conf.rowInterceptors
+	b.redactor = conf.redactor
+	b.schemas = conf.schemas
+	b.strictSchema = conf.strictSchema
+	b.anyRules = conf.anyRules
+	b.dupFilter = conf.dupFilter
+
+	var err error
+	b.globalSymbols, err = encodeGlobalSymbols(conf.globalSymbols, conf.fileNameLimit)
+	b.globalSymbolCount = len(conf.globalSymbols)
+	if err != nil {
+		return buffer{}, err
+	}
+	return b, nil
+}
+
+// enableTimestampGuard turns on the per-table check for designated
+// timestamps going backwards by more than the given tolerance.
+func (b *buffer) enableTimestampGuard(tolerance time.Duration, warn func(err error)) {
+	b.tsGuard = true
+	b.tsTolerance = int64(tolerance)
+	b.tsWarn = warn
+	b.lastTs = make(map[string]int64)
+}
+
+// tsUpdate is an update of the latest timestamp of a table made by
+// the msg-th completed message.
+type tsUpdate struct {
+	msg   int
+	table string
+	prev  int64
+	had   bool
+}
+
+// updateLastTs advances the latest timestamp of the table after the
+// last message was completed.
+func (b *buffer) updateLastTs(table string, tsNanos int64) {
+	prev, ok := b.lastTs[table]
+	if ok && tsNanos <= prev {
+		return
+	}
+	b.lastTs[table] = tsNanos
+	b.tsUndo = append(b.tsUndo, tsUpdate{
+		msg:   b.msgCount() - 1,
+		table: table,
+		prev:  prev,
+		had:   ok,
+	})
+}
+
+// undoLastTs rolls back the updates of the latest timestamps made by
+// the completed messages starting from the n-th one.
+func (b *buffer) undoLastTs(undo []tsUpdate, n int) []tsUpdate {
+	i := len(undo)
+	for ; i > 0 && undo[i-1].msg >= n; i-- {
+		u := undo[i-1]
+		if u.had {
+			b.lastTs[u.table] = u.prev
+		} else {
+			delete(b.lastTs, u.table)
+		}
+	}
+	return undo[:i]
+}
+
 func (b *buffer) ResetSize() {
+	if b.pool != nil {
+		// The memory is taken from the pool on the next write.
+		b.Buffer = bytes.Buffer{}
+		return
+	}
 	b.Buffer = *bytes.NewBuffer(make([]byte, 0, b.initBufSize))
 }
 
@@ -109,9 +309,13 @@ func (b *buffer) writeFloat(f float64) {
 		b.WriteString("Infinity")
 		return
 	}
+	prec := -1
+	if b.floatPrecision > 0 {
+		prec = b.floatPrecision
+	}
 	// We need up to 24 bytes to fit a float64, including a sign.
 	var a [24]byte
-	s := strconv.AppendFloat(a[0:0], f, 'G', -1, 64)
+	s := strconv.AppendFloat(a[0:0], f, 'G', prec, 64)
 	b.Write(s)
 }
 
@@ -122,33 +326,281 @@ func (b *buffer) writeBigInt(i *big.Int) {
 	b.Write(s)
 }
 
-// WriteTo wraps the built-in bytes.Buffer.WriteTo method
-// and writes the contents of the buffer to the provided
-// io.Writer
+// WriteTo writes the contents of the buffer to the provided
+// io.Writer and resets the buffer. In case of an error, the
+// contents are dropped, but can be brought back with restore.
+//
+// A partial write is treated as a failure of the whole batch:
+// there is no way to tell which of the written messages were
+// received by the server.
 func (b *buffer) WriteTo(w io.Writer) (int64, error) {
-	n, err := b.Buffer.WriteTo(w)
+	n, err := w.Write(b.Bytes())
+	if err == nil && n < b.Len() {
+		err = io.ErrShortWrite
+	}
 	if err != nil {
-		b.lastMsgPos -= int(n)
-		return n, err
+		b.dropFailed(err)
+		return int64(n), err
+	}
+	b.reset()
+	return int64(n), nil
+}
+
+// reset empties the buffer after a successful flush.
+func (b *buffer) reset() {
+	b.Buffer.Reset()
+	b.release()
+	b.msgEnds = b.msgEnds[:0]
+	b.msgBase = 0
+	b.shedding = false
+	b.failed = nil
+	b.failedEnds = nil
+	b.tsUndo = b.tsUndo[:0]
+	b.failedTsUndo = nil
+	b.truncated = 0
+	b.clearDuplicates()
+	b.syncMem()
+	b.nextGen()
+	b.resolveFlush(nil)
+}
+
+// dropFailed empties the buffer after a failed flush. The dropped
+// contents are kept until the next successful flush, so that they
+// can be restored from a checkpoint taken before the flush.
+func (b *buffer) dropFailed(err error) {
+	// Anything past the last message boundary is an unfinished
+	// message and is not worth keeping.
+	b.failed = b.Bytes()[:b.lastMsgPos()]
+	b.failedEnds = b.relativeMsgEnds()
+	b.failedGen = b.gen
+	b.failedTsUndo = b.tsUndo
+	b.tsUndo = nil
+	b.ResetSize()
+	b.msgEnds = nil
+	b.msgBase = 0
+	b.shedding = false
+	b.truncated = 0
+	b.clearDuplicates()
+	b.syncMem()
+	b.resetMsgFlags()
+	b.nextGen()
+	b.resolveFlush(err)
+}
+
+// detach hands over the completed messages to the caller along with
+// the pending flush token, and makes the buffer continue with the
+// spare memory, if any, without copying. The detached messages can be
+// brought back with keepFailed if their flush fails.
+func (b *buffer) detach(spare []byte) detachedBatch {
+	d := detachedBatch{
+		data:   b.Bytes(),
+		ends:   b.relativeMsgEnds(),
+		gen:    b.gen,
+		tsUndo: b.tsUndo,
+		token:  b.flushToken,
+	}
+	b.flushToken = nil
+	switch {
+	case b.pool != nil:
+		// The memory is taken from the pool on the next write.
+		b.Buffer = bytes.Buffer{}
+	case spare != nil:
+		b.Buffer = *bytes.NewBuffer(spare[:0])
+	default:
+		b.Buffer = *bytes.NewBuffer(make([]byte, 0, b.initBufSize))
+	}
+	b.msgEnds = nil
+	b.msgBase = 0
+	b.shedding = false
+	b.failed = nil
+	b.failedEnds = nil
+	b.tsUndo = nil
+	b.failedTsUndo = nil
+	b.truncated = 0
+	b.clearDuplicates()
+	b.syncMem()
+	b.nextGen()
+	return d
+}
+
+// keepFailed keeps the messages of a failed detached batch, so that
+// they can be restored from a checkpoint taken before the flush.
+func (b *buffer) keepFailed(d detachedBatch) {
+	b.failed = d.data
+	b.failedEnds = d.ends
+	b.failedGen = d.gen
+	b.failedTsUndo = d.tsUndo
+}
+
+// detachedBatch holds the messages detached from the buffer.
+type detachedBatch struct {
+	data   []byte
+	ends   []int
+	gen    uint64
+	tsUndo []tsUpdate
+	token  *FlushToken
+}
+
+// checkPendingRows returns an error if one more message would exceed
+// the max pending rows limit and the limit is configured to reject
+// such messages.
+func (b *buffer) checkPendingRows() error {
+	if b.rejectPendingRows && b.msgCount() >= b.maxPendingRows {
+		return fmt.Errorf("%w: limit=%d", ErrMaxPendingRows, b.maxPendingRows)
+	}
+	return nil
+}
+
+// pendingRowsFull reports whether the max pending rows limit is
+// reached and the buffer has to be flushed. With a shedder, it's
+// false while the rows kept after a failed flush are being shed.
+func (b *buffer) pendingRowsFull() bool {
+	return b.maxPendingRows > 0 && !b.rejectPendingRows && !b.shedding && b.msgCount() >= b.maxPendingRows
+}
+
+// lastMsgPos returns the end offset of the last completed message.
+func (b *buffer) lastMsgPos() int {
+	if len(b.msgEnds) == 0 {
+		return 0
 	}
-	b.lastMsgPos = 0
-	b.msgCount = 0
-	return n, nil
+	return b.msgEnds[len(b.msgEnds)-1] - b.msgBase
+}
+
+// relativeMsgEnds returns the end offsets of the completed messages
+// in the buffer.
+func (b *buffer) relativeMsgEnds() []int {
+	if b.msgBase != 0 {
+		for i := range b.msgEnds {
+			b.msgEnds[i] -= b.msgBase
+		}
+		b.msgBase = 0
+	}
+	return b.msgEnds
+}
+
+// msgStart returns the start offset of the i-th completed message.
+// For i equal to the message count, it returns the end offset of
+// the last message.
+func (b *buffer) msgStart(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return b.msgEnds[i-1] - b.msgBase
+}
+
+// dropFirstMsgs removes the first n completed messages from the
+// buffer. Checkpoints taken before the call are no longer valid.
+func (b *buffer) dropFirstMsgs(n int) {
+	if n <= 0 {
+		return
+	}
+	b.forgetMsgs(0, n)
+	end := b.msgStart(n)
+	b.Next(end)
+	b.msgBase += end
+	b.msgEnds = b.msgEnds[n:]
+	// The message indexes are shifted, while the checkpoints taken
+	// before are no longer valid, so the updates can't be rolled back.
+	b.tsUndo = b.tsUndo[:0]
+	b.syncMem()
+	b.nextGen()
+}
+
+// lastMsgStart returns the start offset of the last completed
+// message.
+func (b *buffer) lastMsgStart() int {
+	if len(b.msgEnds) < 2 {
+		return 0
+	}
+	return b.msgEnds[len(b.msgEnds)-2] - b.msgBase
+}
+
+// oversizedLastMsg returns true if the last completed message is
+// larger than the given limit. Zero limit means no limit.
+func (b *buffer) oversizedLastMsg(limit int) bool {
+	return limit > 0 && b.lastMsgPos()-b.lastMsgStart() > limit
+}
+
+// msgCount returns the number of completed messages.
+func (b *buffer) msgCount() int {
+	return len(b.msgEnds)
+}
+
+// commitMsg marks everything written so far as a completed message.
+func (b *buffer) commitMsg() {
+	b.msgEnds = append(b.msgEnds, b.Len()+b.msgBase)
+	b.truncated += b.pendingTruncated
+	b.resetMsgFlags()
+	b.syncMem()
+}
+
+func (b *buffer) nextGen() {
+	b.genSeq++
+	b.gen = b.genSeq
+}
+
+func (b *buffer) checkpoint() Checkpoint {
+	return Checkpoint{
+		gen:       b.gen,
+		msgCount:  b.msgCount(),
+		truncated: b.truncated,
+	}
+}
+
+func (b *buffer) restore(cp Checkpoint) error {
+	switch {
+	case cp.gen == b.gen && cp.msgCount <= len(b.msgEnds):
+		b.forgetMsgs(cp.msgCount, len(b.msgEnds))
+		b.msgEnds = b.msgEnds[:cp.msgCount]
+		b.Truncate(b.lastMsgPos())
+		b.truncated = cp.truncated
+		b.tsUndo = b.undoLastTs(b.tsUndo, cp.msgCount)
+	case cp.gen == b.failedGen && b.failed != nil && cp.msgCount <= len(b.failedEnds):
+		// The messages completed since the flush are dropped too.
+		b.undoLastTs(b.tsUndo, 0)
+		b.tsUndo = b.undoLastTs(b.failedTsUndo, cp.msgCount)
+		b.failedTsUndo = nil
+		b.msgEnds = b.failedEnds[:cp.msgCount]
+		b.msgBase = 0
+		b.Buffer = *bytes.NewBuffer(b.failed[:b.lastMsgPos()])
+		b.gen = b.failedGen
+		b.truncated = cp.truncated
+		b.failed = nil
+		b.failedEnds = nil
+		b.rebuildDuplicates()
+	default:
+		return errors.New("checkpoint is no longer valid: buffer was flushed after the checkpoint")
+	}
+	b.syncMem()
+	b.lastErr = nil
+	b.resetMsgFlags()
+	return nil
 }
 
 func (b *buffer) writeTableName(str string) error {
 	if str == "" {
-		return fmt.Errorf("table name cannot be empty: %w", errInvalidMsg)
+		return fmt.Errorf("table name cannot be empty: %w", ErrInvalidName)
 	}
-	// We use string length in bytes as an approximation. That's to
-	// avoid calculating the number of runes.
-	if len(str) > b.fileNameLimit {
-		return fmt.Errorf("table name length exceeds the limit: %w", errInvalidMsg)
+	if n, tooLong := nameTooLong(str, b.fileNameLimit); tooLong {
+		return fmt.Errorf("table name length exceeds the limit: length=%d, limit=%d: %s: %w", n, b.fileNameLimit, str, ErrInvalidName)
 	}
-	// Since we're interested in ASCII chars, it's fine to iterate
-	// through bytes instead of runes.
+	if b.validation == ValidationOff {
+		b.WriteString(str)
+		return nil
+	}
+	// Since we're mostly interested in ASCII chars, we iterate
+	// through bytes and only decode multi-byte chars.
 	for i := 0; i < len(str); i++ {
 		ch := str[i]
+		if ch >= utf8.RuneSelf {
+			size, illegal := illegalNameRune(str[i:])
+			if illegal {
+				return fmt.Errorf("table name contains invalid UTF-8 or the zero width no-break space char: %s: %w", str, ErrInvalidName)
+			}
+			b.WriteString(str[i : i+size])
+			i += size - 1
+			continue
+		}
 		switch ch {
 		case ' ':
 			b.WriteByte('\\')
@@ -156,13 +608,16 @@ func (b *buffer) writeTableName(str string) error {
 			b.WriteByte('\\')
 		case '.':
 			if i == 0 || i == len(str)-1 {
-				return fmt.Errorf("table name contains '.' char at the start or end: %s: %w", str, errInvalidMsg)
+				return fmt.Errorf("table name contains '.' char at the start or end: %s: %w", str, ErrInvalidName)
+			}
+			if b.validation == ValidationServerParity && str[i+1] == '.' {
+				return fmt.Errorf("table name contains consecutive '.' chars: %s: %w", str, ErrInvalidName)
 			}
 		default:
 			if illegalTableNameChar(ch) {
 				return fmt.Errorf("table name contains an illegal char: "+
 					"'\\n', '\\r', '?', ',', ''', '\"', '\\', '/', ':', ')', '(', '+', '*' '%%', '~', or a non-printable char: %s: %w",
-					str, errInvalidMsg)
+					str, ErrInvalidName)
 			}
 		}
 		b.WriteByte(ch)
@@ -236,19 +691,61 @@ func illegalTableNameChar(ch byte) bool {
 	return false
 }
 
+// nameTooLong returns the name length and reports whether it
+// exceeds the limit. Since the server limits names in UTF-16 chars,
+// the length in bytes is only an upper bound for non-ASCII names.
+func nameTooLong(name string, limit int) (int, bool) {
+	if len(name) <= limit {
+		return len(name), false
+	}
+	n := 0
+	for _, r := range name {
+		// Chars outside of the BMP take two UTF-16 chars.
+		if r > 0xffff {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n, n > limit
+}
+
+// illegalNameRune decodes the multi-byte UTF-8 char at the start
+// of str and reports its size and whether it's not allowed in names.
+// The server rejects invalid UTF-8 and the zero width no-break space
+// char, also known as BOM.
+func illegalNameRune(str string) (int, bool) {
+	r, size := utf8.DecodeRuneInString(str)
+	if r == utf8.RuneError && size == 1 {
+		return size, true
+	}
+	return size, r == '\uFEFF'
+}
+
 func (b *buffer) writeColumnName(str string) error {
 	if str == "" {
-		return fmt.Errorf("column name cannot be empty: %w", errInvalidMsg)
+		return fmt.Errorf("column name cannot be empty: %w", ErrInvalidName)
 	}
-	// We use string length in bytes as an approximation. That's to
-	// avoid calculating the number of runes.
-	if len(str) > b.fileNameLimit {
-		return fmt.Errorf("column name length exceeds the limit: %w", errInvalidMsg)
+	if n, tooLong := nameTooLong(str, b.fileNameLimit); tooLong {
+		return fmt.Errorf("column name length exceeds the limit: length=%d, limit=%d: %s: %w", n, b.fileNameLimit, str, ErrInvalidName)
 	}
-	// Since we're interested in ASCII chars, it's fine to iterate
-	// through bytes instead of runes.
+	if b.validation == ValidationOff {
+		b.WriteString(str)
+		return nil
+	}
+	// Since we're mostly interested in ASCII chars, we iterate
+	// through bytes and only decode multi-byte chars.
 	for i := 0; i < len(str); i++ {
 		ch := str[i]
+		if ch >= utf8.RuneSelf {
+			size, illegal := illegalNameRune(str[i:])
+			if illegal {
+				return fmt.Errorf("column name contains invalid UTF-8 or the zero width no-break space char: %s: %w", str, ErrInvalidName)
+			}
+			b.WriteString(str[i : i+size])
+			i += size - 1
+			continue
+		}
 		switch ch {
 		case ' ':
 			b.WriteByte('\\')
@@ -258,7 +755,7 @@ func (b *buffer) writeColumnName(str string) error {
 			if illegalColumnNameChar(ch) {
 				return fmt.Errorf("column name contains an illegal char: "+
 					"'\\n', '\\r', '?', '.', ',', ''', '\"', '\\', '/', ':', ')', '(', '+', '-', '*' '%%', '~', or a non-printable char: %s: %w",
-					str, errInvalidMsg)
+					str, ErrInvalidName)
 			}
 		}
 		b.WriteByte(ch)
@@ -337,10 +834,19 @@ func illegalColumnNameChar(ch byte) bool {
 }
 
 func (b *buffer) writeStrValue(str string, quoted bool) error {
+	if b.validation == ValidationServerParity && !utf8.ValidString(str) {
+		return fmt.Errorf("string value is not valid UTF-8: %q: %w", str, ErrInvalidMessage)
+	}
 	// Since we're interested in ASCII chars, it's fine to iterate
 	// through bytes instead of runes.
 	for i := 0; i < len(str); i++ {
 		ch := str[i]
+		if b.ctrlChars != ControlCharsEscape && isControlChar(ch) {
+			if b.ctrlChars == ControlCharsReject {
+				return fmt.Errorf("string value contains a control char at offset %d: %w", i, ErrControlChar)
+			}
+			continue
+		}
 		switch ch {
 		case ' ':
 			if !quoted {
@@ -370,15 +876,40 @@ func (b *buffer) writeStrValue(str string, quoted bool) error {
 	return nil
 }
 
+func isControlChar(ch byte) bool {
+	return ch < 0x20 || ch == 0x7f
+}
+
+// prepareColumn checks the column type against the registered
+// schema, if any, and prepares the buffer for the column value.
+func (b *buffer) prepareColumn(name string, t ilpType) bool {
+	return b.checkColumnType(name, t) && b.checkColumnCount() && b.prepareForField()
+}
+
+// checkColumnCount sets the last error if the pending message
+// already has the max number of symbols and columns.
+func (b *buffer) checkColumnCount() bool {
+	if b.maxColumns == 0 || b.lastErr != nil {
+		return true
+	}
+	if b.msgColumns >= b.maxColumns {
+		b.lastErr = fmt.Errorf("column count exceeds the limit: limit=%d: %w", b.maxColumns, ErrTooManyColumns)
+		return false
+	}
+	b.msgColumns++
+	return true
+}
+
 func (b *buffer) prepareForField() bool {
 	if b.lastErr != nil {
 		return false
 	}
 	if !b.hasTable {
-		b.lastErr = fmt.Errorf("table name was not provided: %w", errInvalidMsg)
+		b.lastErr = ErrMissingTable
 		return false
 	}
 	if !b.hasFields {
+		b.fieldsPos = b.Len()
 		b.WriteByte(' ')
 	} else {
 		b.WriteByte(',')
@@ -387,7 +918,7 @@ func (b *buffer) prepareForField() bool {
 }
 
 func (b *buffer) DiscardPendingMsg() {
-	b.Truncate(b.lastMsgPos)
+	b.Truncate(b.lastMsgPos())
 	b.resetMsgFlags()
 }
 
@@ -395,6 +926,8 @@ func (b *buffer) resetMsgFlags() {
 	b.hasTable = false
 	b.hasTags = false
 	b.hasFields = false
+	b.pendingTruncated = 0
+	b.msgColumns = 0
 }
 
 func (b *buffer) Messages() string {
@@ -406,29 +939,70 @@ func (b *buffer) Table(name string) *buffer {
 		return b
 	}
 	if b.hasTable {
-		b.lastErr = fmt.Errorf("table name already provided: %w", errInvalidMsg)
+		b.lastErr = ErrTableAlreadySet
 		return b
 	}
+	b.acquire()
 	b.lastErr = b.writeTableName(name)
 	if b.lastErr != nil {
 		return b
 	}
+	b.tableName = name
 	b.hasTable = true
+	if b.schemas != nil {
+		b.tableColumns = b.schemas.columns(name)
+	}
+	if len(b.globalSymbols) > 0 {
+		b.Write(b.globalSymbols)
+		b.hasTags = true
+		b.msgColumns = b.globalSymbolCount
+	}
 	return b
 }
 
+// encodeGlobalSymbols encodes the symbols to be written after
+// the table name, sorted by name.
+func encodeGlobalSymbols(symbols map[string]string, fileNameLimit int) ([]byte, error) {
+	if len(symbols) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(symbols))
+	for name := range symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := newBuffer(0, 0, fileNameLimit)
+	b.hasTable = true
+	for _, name := range names {
+		b.Symbol(name, symbols[name])
+		if b.lastErr != nil {
+			return nil, fmt.Errorf("invalid global symbol: %w", b.lastErr)
+		}
+	}
+	return b.Bytes(), nil
+}
+
 func (b *buffer) Symbol(name, val string) *buffer {
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, val, true)
+		return b
+	}
 	if b.lastErr != nil {
 		return b
 	}
 	if !b.hasTable {
-		b.lastErr = fmt.Errorf("table name was not provided: %w", errInvalidMsg)
+		b.lastErr = ErrMissingTable
 		return b
 	}
-	if b.hasFields {
-		b.lastErr = fmt.Errorf("symbols have to be written before any other column: %w", errInvalidMsg)
+	if b.hasFields && !b.reorderSymbols {
+		b.lastErr = ErrSymbolAfterField
 		return b
 	}
+	if !b.checkColumnType(name, ilpSymbol) || !b.checkColumnCount() {
+		return b
+	}
+	symbolPos := b.Len()
 	b.WriteByte(',')
 	b.lastErr = b.writeColumnName(name)
 	if b.lastErr != nil {
@@ -440,11 +1014,54 @@ func (b *buffer) Symbol(name, val string) *buffer {
 		return b
 	}
 	b.hasTags = true
+	if b.hasFields {
+		// Move the symbol in front of the fields.
+		b.moveToFieldsPos(symbolPos)
+	}
 	return b
 }
 
+func (b *buffer) SymbolStringer(name string, val fmt.Stringer) *buffer {
+	if isNil(val) {
+		return b
+	}
+	return b.Symbol(name, val.String())
+}
+
+// isNil reports whether v is nil or a nil pointer, so that methods
+// with value receivers are not called on it.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// moveToFieldsPos moves the bytes written starting from pos
+// in front of the fields of the pending message.
+func (b *buffer) moveToFieldsPos(pos int) {
+	buf := b.Bytes()
+	n := len(buf) - pos
+	// Rotate the tail of the buffer with the three reversals trick.
+	reverseBytes(buf[b.fieldsPos:pos])
+	reverseBytes(buf[pos:])
+	reverseBytes(buf[b.fieldsPos:])
+	b.fieldsPos += n
+}
+
+func reverseBytes(s []byte) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
 func (b *buffer) Int64Column(name string, val int64) *buffer {
-	if !b.prepareForField() {
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, val, false)
+		return b
+	}
+	if !b.prepareColumn(name, ilpLong) {
 		return b
 	}
 	b.lastErr = b.writeColumnName(name)
@@ -458,22 +1075,57 @@ func (b *buffer) Int64Column(name string, val int64) *buffer {
 	return b
 }
 
+func (b *buffer) Uint64Column(name string, val uint64) *buffer {
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, val, false)
+		return b
+	}
+	if b.uint64AsLong256 {
+		if !b.prepareColumn(name, ilpLong256) {
+			return b
+		}
+		b.lastErr = b.writeColumnName(name)
+		if b.lastErr != nil {
+			return b
+		}
+		// We need up to 16 bytes to fit a uint64 in hex.
+		var a [16]byte
+		b.WriteString("=0x")
+		b.Write(strconv.AppendUint(a[0:0], val, 16))
+		b.WriteByte('i')
+		b.hasFields = true
+		return b
+	}
+	if val > math.MaxInt64 {
+		if b.lastErr != nil {
+			return b
+		}
+		b.lastErr = fmt.Errorf("uint64 value does not fit into long column: %s: %d: %w", name, val, ErrValueOutOfRange)
+		return b
+	}
+	return b.Int64Column(name, int64(val))
+}
+
 func (b *buffer) Long256Column(name string, val *big.Int) *buffer {
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, val, false)
+		return b
+	}
 	if val.Sign() < 0 {
 		if b.lastErr != nil {
 			return b
 		}
-		b.lastErr = fmt.Errorf("long256 cannot be negative: %s", val.String())
+		b.lastErr = fmt.Errorf("long256 cannot be negative: %s: %w", val.String(), ErrValueOutOfRange)
 		return b
 	}
 	if val.BitLen() > 256 {
 		if b.lastErr != nil {
 			return b
 		}
-		b.lastErr = fmt.Errorf("long256 cannot be larger than 256-bit: %v", val.BitLen())
+		b.lastErr = fmt.Errorf("long256 cannot be larger than 256-bit: %v: %w", val.BitLen(), ErrValueOutOfRange)
 		return b
 	}
-	if !b.prepareForField() {
+	if !b.prepareColumn(name, ilpLong256) {
 		return b
 	}
 	b.lastErr = b.writeColumnName(name)
@@ -493,7 +1145,15 @@ func (b *buffer) Long256Column(name string, val *big.Int) *buffer {
 }
 
 func (b *buffer) TimestampColumn(name string, ts time.Time) *buffer {
-	if !b.prepareForField() {
+	return b.TimestampMicrosColumn(name, ts.UnixMicro())
+}
+
+func (b *buffer) TimestampMicrosColumn(name string, ts int64) *buffer {
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, time.UnixMicro(ts), false)
+		return b
+	}
+	if !b.prepareColumn(name, ilpTimestamp) {
 		return b
 	}
 	b.lastErr = b.writeColumnName(name)
@@ -501,14 +1161,27 @@ func (b *buffer) TimestampColumn(name string, ts time.Time) *buffer {
 		return b
 	}
 	b.WriteByte('=')
-	b.writeInt(ts.UnixMicro())
+	b.writeInt(ts)
 	b.WriteByte('t')
 	b.hasFields = true
 	return b
 }
 
+func (b *buffer) TimestampNanosColumn(name string, ts int64) *buffer {
+	// Round towards negative infinity, just like time.Time.UnixMicro.
+	micros := ts / 1000
+	if ts%1000 < 0 {
+		micros--
+	}
+	return b.TimestampMicrosColumn(name, micros)
+}
+
 func (b *buffer) Float64Column(name string, val float64) *buffer {
-	if !b.prepareForField() {
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, val, false)
+		return b
+	}
+	if !b.prepareColumn(name, ilpDouble) {
 		return b
 	}
 	b.lastErr = b.writeColumnName(name)
@@ -522,7 +1195,11 @@ func (b *buffer) Float64Column(name string, val float64) *buffer {
 }
 
 func (b *buffer) StringColumn(name, val string) *buffer {
-	if !b.prepareForField() {
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, val, false)
+		return b
+	}
+	if !b.prepareColumn(name, ilpString) {
 		return b
 	}
 	b.lastErr = b.writeColumnName(name)
@@ -531,7 +1208,80 @@ func (b *buffer) StringColumn(name, val string) *buffer {
 	}
 	b.WriteByte('=')
 	b.WriteByte('"')
-	b.lastErr = b.writeStrValue(val, true)
+	b.lastErr = b.writeCappedStrValue(val)
+	if b.lastErr != nil {
+		return b
+	}
+	b.WriteByte('"')
+	b.hasFields = true
+	return b
+}
+
+// setStringLimit copies the string length limit settings.
+func (b *buffer) setStringLimit(conf *lineSenderConfig) {
+	b.maxStrLen = conf.maxStrLen
+	b.truncateStr = conf.strLenPolicy == StringLengthTruncate
+	b.truncMarker = defaultTruncationMarker
+	if conf.truncMarkerSet {
+		b.truncMarker = conf.truncMarker
+	}
+}
+
+// writeCappedStrValue writes the string column value applying
+// the max string length limit.
+func (b *buffer) writeCappedStrValue(str string) error {
+	if b.maxStrLen == 0 || len(str) <= b.maxStrLen {
+		return b.writeStrValue(str, true)
+	}
+	if !b.truncateStr {
+		return fmt.Errorf("string value length exceeds the limit: length=%d, limit=%d: %w", len(str), b.maxStrLen, ErrValueOutOfRange)
+	}
+	// Cut the value at a UTF-8 char boundary, so that it fits in
+	// the limit along with the marker. A marker longer than the
+	// limit is cut as well.
+	marker := cutStr(b.truncMarker, b.maxStrLen)
+	if err := b.writeStrValue(cutStr(str, b.maxStrLen-len(marker)), true); err != nil {
+		return err
+	}
+	b.pendingTruncated++
+	return b.writeStrValue(marker, true)
+}
+
+// cutStr returns the longest prefix of str of at most n bytes that
+// ends at a UTF-8 char boundary.
+func cutStr(str string, n int) string {
+	if len(str) <= n {
+		return str
+	}
+	for n > 0 && !utf8.RuneStart(str[n]) {
+		n--
+	}
+	return str[:n]
+}
+
+func (b *buffer) StringColumnMarshaler(name string, val encoding.TextMarshaler) *buffer {
+	if isNil(val) || b.lastErr != nil {
+		return b
+	}
+	text, err := val.MarshalText()
+	if err != nil {
+		b.lastErr = fmt.Errorf("failed to marshal string column value: %s: %w", name, err)
+		return b
+	}
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, string(text), false)
+		return b
+	}
+	if !b.prepareColumn(name, ilpString) {
+		return b
+	}
+	b.lastErr = b.writeColumnName(name)
+	if b.lastErr != nil {
+		return b
+	}
+	b.WriteByte('=')
+	b.WriteByte('"')
+	b.lastErr = b.writeCappedStrValue(string(text))
 	if b.lastErr != nil {
 		return b
 	}
@@ -541,7 +1291,11 @@ func (b *buffer) StringColumn(name, val string) *buffer {
 }
 
 func (b *buffer) BoolColumn(name string, val bool) *buffer {
-	if !b.prepareForField() {
+	if b.redactor != nil && !b.redacting {
+		b.redact(name, val, false)
+		return b
+	}
+	if !b.prepareColumn(name, ilpBoolean) {
 		return b
 	}
 	b.lastErr = b.writeColumnName(name)
@@ -559,6 +1313,28 @@ func (b *buffer) BoolColumn(name string, val bool) *buffer {
 }
 
 func (b *buffer) At(ts time.Time, sendTs bool) error {
+	return b.at(ts.UnixNano(), sendTs)
+}
+
+func (b *buffer) AtMicros(ts int64) error {
+	return b.atScaled(ts, int64(time.Microsecond))
+}
+
+func (b *buffer) AtMillis(ts int64) error {
+	return b.atScaled(ts, int64(time.Millisecond))
+}
+
+func (b *buffer) atScaled(ts int64, nanosPerUnit int64) error {
+	if ts > math.MaxInt64/nanosPerUnit || ts < math.MinInt64/nanosPerUnit {
+		if b.lastErr == nil {
+			b.lastErr = fmt.Errorf("designated timestamp does not fit into Epoch nanoseconds: %d: %w", ts, ErrValueOutOfRange)
+		}
+		return b.at(0, false)
+	}
+	return b.at(ts*nanosPerUnit, true)
+}
+
+func (b *buffer) at(tsNanos int64, sendTs bool) error {
 	err := b.lastErr
 	b.lastErr = nil
 	if err != nil {
@@ -566,32 +1342,77 @@ func (b *buffer) At(ts time.Time, sendTs bool) error {
 		return err
 	}
 
+	if err := b.checkPendingRows(); err != nil {
+		b.DiscardPendingMsg()
+		return err
+	}
+
 	// Post-factum check for the max buffer size limit.
 	// Since we embed bytes.Buffer, it's impossible to hook into its
 	// grow() method properly to have the check before we write
 	// a value to the buffer.
 	if b.maxBufSize > 0 && b.Cap() > b.maxBufSize {
 		b.DiscardPendingMsg()
-		return fmt.Errorf("buffer size exceeded maximum limit: size=%d, limit=%d", b.Cap(), b.maxBufSize)
+		return fmt.Errorf("%w: size=%d, limit=%d", ErrBufferFull, b.Cap(), b.maxBufSize)
+	}
+
+	if !sendTs && b.clientTimestamps {
+		tsNanos = time.Now().UnixNano()
+		sendTs = true
 	}
 
 	if !b.hasTable {
 		b.DiscardPendingMsg()
-		return fmt.Errorf("table name was not provided: %w", errInvalidMsg)
+		return ErrMissingTable
+	}
+	if err := b.intercept(tsNanos, sendTs); err != nil {
+		b.lastErr = nil
+		b.DiscardPendingMsg()
+		return err
 	}
 	if !b.hasTags && !b.hasFields {
 		b.DiscardPendingMsg()
-		return fmt.Errorf("no symbols or columns were provided: %w", errInvalidMsg)
+		return ErrEmptyMessage
+	}
+
+	if sendTs && tsNanos < 0 && b.validation == ValidationServerParity {
+		b.DiscardPendingMsg()
+		return fmt.Errorf("designated timestamp is before 1970-01-01: %d: %w", tsNanos, ErrValueOutOfRange)
+	}
+
+	var tsErr error
+	if sendTs && b.tsGuard {
+		lastTs, ok := b.lastTs[b.tableName]
+		if ok && tsNanos < lastTs-b.tsTolerance {
+			tsErr = fmt.Errorf("designated timestamp goes backwards beyond the tolerance: table=%s, ts=%d, last=%d: %w",
+				b.tableName, tsNanos, lastTs, ErrTimestampOutOfOrder)
+			if b.tsWarn == nil {
+				b.DiscardPendingMsg()
+				return tsErr
+			}
+		}
 	}
+	table := b.tableName
 
 	if sendTs {
 		b.WriteByte(' ')
-		b.writeInt(ts.UnixNano())
+		b.writeInt(tsNanos)
 	}
 	b.WriteByte('\n')
 
-	b.lastMsgPos = b.Len()
-	b.msgCount++
-	b.resetMsgFlags()
+	if b.duplicateMsg() || !b.shed() {
+		b.DiscardPendingMsg()
+		return nil
+	}
+
+	b.commitMsg()
+	b.rememberMsg()
+	if sendTs && b.tsGuard {
+		// Dropped messages don't move the guard forward.
+		b.updateLastTs(table, tsNanos)
+		if tsErr != nil {
+			b.tsWarn(tsErr)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,119 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"bytes"
+	"sync"
+)
+
+// BufferPool is a pool of flush buffers shared by the senders
+// created with WithBufferPool. Such senders return their buffer to
+// the pool after each successful flush and take one from the pool
+// once they start a new batch, so that idle senders don't hold
+// high-water-mark buffers permanently.
+//
+// The pool keeps at most the given number of bytes in idle buffers.
+// Buffers beyond the cap are left to the garbage collector.
+//
+// BufferPool is safe for concurrent use.
+type BufferPool struct {
+	mu        sync.Mutex
+	maxBytes  int
+	idleBytes int
+	bufs      [][]byte
+}
+
+// NewBufferPool creates a pool keeping at most maxBytes in idle
+// buffers.
+func NewBufferPool(maxBytes int) *BufferPool {
+	return &BufferPool{maxBytes: maxBytes}
+}
+
+// IdleBytes returns the total capacity of the idle buffers kept
+// by the pool.
+func (p *BufferPool) IdleBytes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.idleBytes
+}
+
+// get returns an empty buffer, preferably a pooled one, of at least
+// the given capacity.
+func (p *BufferPool) get(size int) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := len(p.bufs) - 1; i >= 0; i-- {
+		buf := p.bufs[i]
+		if cap(buf) >= size {
+			p.bufs[i] = p.bufs[len(p.bufs)-1]
+			p.bufs[len(p.bufs)-1] = nil
+			p.bufs = p.bufs[:len(p.bufs)-1]
+			p.idleBytes -= cap(buf)
+			return buf
+		}
+	}
+	return make([]byte, 0, size)
+}
+
+// put returns the buffer to the pool, unless the pool is full.
+func (p *BufferPool) put(buf []byte) {
+	if cap(buf) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idleBytes+cap(buf) > p.maxBytes {
+		return
+	}
+	p.bufs = append(p.bufs, buf[:0])
+	p.idleBytes += cap(buf)
+}
+
+// usePool makes the buffer take its memory from the pool. The
+// memory is only held while there are messages in the buffer.
+func (b *buffer) usePool(p *BufferPool) {
+	if p == nil {
+		return
+	}
+	b.pool = p
+	b.Buffer = bytes.Buffer{}
+}
+
+// acquire takes a buffer from the pool, if the buffer has released
+// its memory.
+func (b *buffer) acquire() {
+	if b.pool != nil && b.Cap() == 0 {
+		b.Buffer = *bytes.NewBuffer(b.pool.get(b.initBufSize))
+	}
+}
+
+// release returns the memory of the empty buffer to the pool.
+func (b *buffer) release() {
+	if b.pool != nil && b.Len() == 0 {
+		b.pool.put(b.Bytes())
+		b.Buffer = bytes.Buffer{}
+	}
+}
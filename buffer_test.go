@@ -25,6 +25,8 @@
 package questdb_test
 
 import (
+	"context"
+	"errors"
 	"math"
 	"math/big"
 	"strconv"
@@ -202,6 +204,46 @@ func TestFloat64Serialization(t *testing.T) {
 	}
 }
 
+type testSide int
+
+func (s testSide) String() string {
+	if s == 0 {
+		return "buy"
+	}
+	return "sell side"
+}
+
+type testId struct {
+	val string
+	err error
+}
+
+func (id testId) MarshalText() ([]byte, error) {
+	return []byte(id.val), id.err
+}
+
+func TestStringerAndMarshalerColumns(t *testing.T) {
+	buf := newTestBuffer()
+
+	err := buf.Table(testTable).
+		SymbolStringer("s1", testSide(0)).
+		SymbolStringer("s2", testSide(1)).
+		SymbolStringer("s3", nil).
+		SymbolStringer("s4", (*time.Time)(nil)).
+		StringColumnMarshaler("c1", testId{val: "a\"b"}).
+		StringColumnMarshaler("c2", nil).
+		StringColumnMarshaler("c3", (*testId)(nil)).
+		At(time.Time{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+",s1=buy,s2=sell\\ side c1=\"a\\\"b\"\n", buf.Messages())
+
+	err = buf.Table(testTable).
+		StringColumnMarshaler("c1", testId{err: errors.New("boom")}).
+		At(time.Time{}, false)
+	assert.ErrorContains(t, err, "failed to marshal string column value: c1: boom")
+	assert.Equal(t, testTable+",s1=buy,s2=sell\\ side c1=\"a\\\"b\"\n", buf.Messages())
+}
+
 func TestErrorOnTooLargeBuffer(t *testing.T) {
 	const initBufSize = 1
 	const maxBufSize = 4
@@ -240,6 +282,71 @@ func TestErrorOnTooLargeBuffer(t *testing.T) {
 	}
 }
 
+func TestUtf8Names(t *testing.T) {
+	const nameLimit = 6
+
+	buf := qdb.NewBuffer(128*1024, 1024*1024, nameLimit)
+
+	// The names are longer than the limit in bytes, but not in chars.
+	err := buf.Table("таблца").Symbol("圖表", "a").Int64Column("çolön", 1).At(time.Time{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "таблца,圖表=a çolön=1i\n", buf.Messages())
+
+	l, err := qdb.ParseLine([]byte("таблца,圖表=a çolön=1i"))
+	assert.NoError(t, err)
+	assert.Equal(t, "таблца", l.Table)
+
+	testCases := []struct {
+		name     string
+		writerFn bufWriterFn
+		errMsg   string
+	}{
+		{
+			"lengthy table name",
+			func(s *qdb.Buffer) error {
+				return s.Table("таблица").Int64Column("a", 1).At(time.Time{}, false)
+			},
+			"table name length exceeds the limit",
+		},
+		{
+			"lengthy column name",
+			func(s *qdb.Buffer) error {
+				// Chars outside of the BMP count as two chars.
+				return s.Table("a").Int64Column("😀😀😀a", 1).At(time.Time{}, false)
+			},
+			"column name length exceeds the limit",
+		},
+		{
+			"invalid utf-8 table name",
+			func(s *qdb.Buffer) error {
+				return s.Table("a\xffb").Int64Column("a", 1).At(time.Time{}, false)
+			},
+			"table name contains invalid UTF-8",
+		},
+		{
+			"bom in column name",
+			func(s *qdb.Buffer) error {
+				return s.Table("a").Int64Column("\ufeffa", 1).At(time.Time{}, false)
+			},
+			"column name contains invalid UTF-8 or the zero width no-break space char",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := qdb.NewBuffer(128*1024, 1024*1024, nameLimit)
+
+			err := tc.writerFn(&buf)
+			assert.ErrorContains(t, err, tc.errMsg)
+			assert.ErrorIs(t, err, qdb.ErrInvalidName)
+			assert.Empty(t, buf.Messages())
+		})
+	}
+
+	_, err = qdb.ParseLine([]byte("a,\ufeffs=a b=1i"))
+	assert.ErrorContains(t, err, "column name contains an illegal char")
+}
+
 func TestErrorOnLengthyNames(t *testing.T) {
 	const nameLimit = 42
 
@@ -257,14 +364,14 @@ func TestErrorOnLengthyNames(t *testing.T) {
 			func(s *qdb.Buffer) error {
 				return s.Table(lengthyStr).StringColumn("str_col", "foo").At(time.Time{}, false)
 			},
-			"table name length exceeds the limit",
+			"table name length exceeds the limit: length=43, limit=42",
 		},
 		{
 			"lengthy column name",
 			func(s *qdb.Buffer) error {
 				return s.Table(testTable).StringColumn(lengthyStr, "foo").At(time.Time{}, false)
 			},
-			"column name length exceeds the limit",
+			"column name length exceeds the limit: length=43, limit=42",
 		},
 	}
 
@@ -335,6 +442,77 @@ func TestErrorOnMissingTableCall(t *testing.T) {
 			err := tc.writerFn(&buf)
 
 			assert.ErrorContains(t, err, "table name was not provided")
+			assert.ErrorIs(t, err, qdb.ErrMissingTable)
+			assert.Empty(t, buf.Messages())
+		})
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		writerFn    bufWriterFn
+		expectedErr error
+	}{
+		{
+			"table already set",
+			func(s *qdb.Buffer) error {
+				return s.Table("a").Table("b").At(time.Time{}, false)
+			},
+			qdb.ErrTableAlreadySet,
+		},
+		{
+			"symbol after field",
+			func(s *qdb.Buffer) error {
+				return s.Table("a").Int64Column("i", 42).Symbol("sym", "abc").At(time.Time{}, false)
+			},
+			qdb.ErrSymbolAfterField,
+		},
+		{
+			"empty message",
+			func(s *qdb.Buffer) error {
+				return s.Table("a").At(time.Time{}, false)
+			},
+			qdb.ErrEmptyMessage,
+		},
+		{
+			"illegal table name",
+			func(s *qdb.Buffer) error {
+				return s.Table("a?b").Int64Column("i", 42).At(time.Time{}, false)
+			},
+			qdb.ErrInvalidName,
+		},
+		{
+			"empty column name",
+			func(s *qdb.Buffer) error {
+				return s.Table("a").Int64Column("", 42).At(time.Time{}, false)
+			},
+			qdb.ErrInvalidName,
+		},
+		{
+			"uint64 overflow",
+			func(s *qdb.Buffer) error {
+				return s.Table("a").Uint64Column("u", math.MaxUint64).At(time.Time{}, false)
+			},
+			qdb.ErrValueOutOfRange,
+		},
+		{
+			"negative long256",
+			func(s *qdb.Buffer) error {
+				return s.Table("a").Long256Column("l", big.NewInt(-1)).At(time.Time{}, false)
+			},
+			qdb.ErrValueOutOfRange,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := newTestBuffer()
+
+			err := tc.writerFn(&buf)
+
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.ErrorIs(t, err, qdb.ErrInvalidMessage)
 			assert.Empty(t, buf.Messages())
 		})
 	}
@@ -432,6 +610,141 @@ func TestInvalidMessageGetsDiscarded(t *testing.T) {
 	assert.Equal(t, strings.Join(expectedLines, "\n")+"\n", buf.Messages())
 }
 
+// partialWriter accepts up to limit bytes and then fails, much
+// like a socket that gets closed in the middle of a write.
+type partialWriter struct {
+	limit int
+	err   error
+	got   []byte
+}
+
+func (w *partialWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if n > w.limit {
+		n = w.limit
+	}
+	w.got = append(w.got, p[:n]...)
+	w.limit -= n
+	if n < len(p) {
+		return n, w.err
+	}
+	return n, nil
+}
+
+func TestRecoveryAfterPartialWrite(t *testing.T) {
+	const line1 = testTable + " foo=1i\n"
+	const line2 = testTable + " foo=2i\n"
+	const line3 = testTable + " foo=3i\n"
+
+	testCases := []struct {
+		name   string
+		limit  int
+		err    error
+		errMsg string
+	}{
+		{"mid message", len(line1) + 3, errors.New("connection reset"), "connection reset"},
+		{"message boundary", len(line1), errors.New("connection reset"), "connection reset"},
+		{"short write", len(line1) + 3, nil, "short write"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := newTestBuffer()
+
+			err := buf.Table(testTable).Int64Column("foo", 1).At(time.Time{}, false)
+			assert.NoError(t, err)
+			err = buf.Table(testTable).Int64Column("foo", 2).At(time.Time{}, false)
+			assert.NoError(t, err)
+			// A row that fails validation in the middle.
+			err = buf.Table(testTable).Int64Column("foo", 3).Symbol("sym", "bar").At(time.Time{}, false)
+			assert.Error(t, err)
+			assert.Equal(t, 2, buf.MsgCount())
+			cp := buf.Checkpoint()
+
+			w := &partialWriter{limit: tc.limit, err: tc.err}
+			_, err = buf.WriteTo(w)
+			assert.ErrorContains(t, err, tc.errMsg)
+			assert.Equal(t, 0, buf.Len())
+			assert.Equal(t, 0, buf.MsgCount())
+
+			// New messages go to an empty buffer.
+			err = buf.Table(testTable).Int64Column("foo", 3).At(time.Time{}, false)
+			assert.NoError(t, err)
+			assert.Equal(t, line3, buf.Messages())
+			assert.Equal(t, 1, buf.MsgCount())
+
+			// The failed batch is restored in full, with no leftovers
+			// of the newer or invalid messages.
+			err = buf.Restore(cp)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, buf.MsgCount())
+			assert.Equal(t, line1+line2, buf.Messages())
+
+			// The restored batch can be sent once the connection is back.
+			w = &partialWriter{limit: 1024}
+			_, err = buf.WriteTo(w)
+			assert.NoError(t, err)
+			assert.Equal(t, line1+line2, string(w.got))
+
+			// The buffer was flushed after the checkpoint.
+			err = buf.Restore(cp)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRestoreFailedBatchToMessageBoundary(t *testing.T) {
+	buf := newTestBuffer()
+
+	err := buf.Table(testTable).Int64Column("foo", 1).At(time.Time{}, false)
+	assert.NoError(t, err)
+	cp := buf.Checkpoint()
+	err = buf.Table(testTable).Int64Column("foo", 2).At(time.Time{}, false)
+	assert.NoError(t, err)
+
+	_, err = buf.WriteTo(&partialWriter{limit: 5, err: errors.New("broken pipe")})
+	assert.Error(t, err)
+
+	err = buf.Restore(cp)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, buf.MsgCount())
+	assert.Equal(t, testTable+" foo=1i\n", buf.Messages())
+
+	// Discarding a pending message keeps the restored ones intact.
+	buf.Table(testTable).Int64Column("foo", 42)
+	buf.DiscardPendingMsg()
+	err = buf.Table(testTable).Int64Column("foo", 3).At(time.Time{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, buf.MsgCount())
+	assert.Equal(t, testTable+" foo=1i\n"+testTable+" foo=3i\n", buf.Messages())
+}
+
+func TestRestoreFailedBatchTimestampGuard(t *testing.T) {
+	buf := newTestBuffer()
+	buf.EnableTimestampGuard(0)
+
+	err := buf.Table(testTable).Int64Column("foo", 1).At(time.Unix(0, 100), true)
+	assert.NoError(t, err)
+	cp := buf.Checkpoint()
+	err = buf.Table(testTable).Int64Column("foo", 2).At(time.Unix(0, 300), true)
+	assert.NoError(t, err)
+
+	_, err = buf.WriteTo(&partialWriter{limit: 5, err: errors.New("broken pipe")})
+	assert.Error(t, err)
+	err = buf.Table(testTable).Int64Column("foo", 3).At(time.Unix(0, 400), true)
+	assert.NoError(t, err)
+
+	// Neither the message dropped by the restore nor the one written
+	// after the failed flush move the guard forward.
+	err = buf.Restore(cp)
+	assert.NoError(t, err)
+	err = buf.Table(testTable).Int64Column("foo", 4).At(time.Unix(0, 200), true)
+	assert.NoError(t, err)
+	err = buf.Table(testTable).Int64Column("foo", 5).At(time.Unix(0, 99), true)
+	assert.ErrorIs(t, err, qdb.ErrTimestampOutOfOrder)
+	assert.Equal(t, testTable+" foo=1i 100\n"+testTable+" foo=4i 200\n", buf.Messages())
+}
+
 func TestInvalidTableName(t *testing.T) {
 	buf := newTestBuffer()
 
@@ -447,3 +760,142 @@ func TestInvalidColumnName(t *testing.T) {
 	assert.ErrorContains(t, err, "column name contains an illegal char")
 	assert.Empty(t, buf.Messages())
 }
+
+func TestDesignatedTimestampUnits(t *testing.T) {
+	testCases := []struct {
+		name     string
+		writerFn bufWriterFn
+		expected string
+	}{
+		{
+			"micros",
+			func(b *qdb.Buffer) error {
+				return b.Table(testTable).Int64Column("a_col", 1).AtMicros(1712345678123456)
+			},
+			"my_test_table a_col=1i 1712345678123456000",
+		},
+		{
+			"millis",
+			func(b *qdb.Buffer) error {
+				return b.Table(testTable).Int64Column("a_col", 1).AtMillis(1712345678123)
+			},
+			"my_test_table a_col=1i 1712345678123000000",
+		},
+		{
+			"negative micros",
+			func(b *qdb.Buffer) error {
+				return b.Table(testTable).Int64Column("a_col", 1).AtMicros(-42)
+			},
+			"my_test_table a_col=1i -42000",
+		},
+		{
+			"zero millis",
+			func(b *qdb.Buffer) error {
+				return b.Table(testTable).Int64Column("a_col", 1).AtMillis(0)
+			},
+			"my_test_table a_col=1i 0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := newTestBuffer()
+
+			err := tc.writerFn(&buf)
+			assert.NoError(t, err)
+
+			// Check the buffer
+			assert.Equal(t, tc.expected+"\n", buf.Messages())
+		})
+	}
+}
+
+func TestErrorOnDesignatedTimestampOverflow(t *testing.T) {
+	testCases := []struct {
+		name     string
+		writerFn bufWriterFn
+	}{
+		{
+			"max micros",
+			func(b *qdb.Buffer) error {
+				return b.Table(testTable).Int64Column("a_col", 1).AtMicros(math.MaxInt64)
+			},
+		},
+		{
+			"min micros",
+			func(b *qdb.Buffer) error {
+				return b.Table(testTable).Int64Column("a_col", 1).AtMicros(math.MinInt64)
+			},
+		},
+		{
+			"max millis",
+			func(b *qdb.Buffer) error {
+				return b.Table(testTable).Int64Column("a_col", 1).AtMillis(math.MaxInt64 / 1000)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := newTestBuffer()
+
+			err := tc.writerFn(&buf)
+			assert.ErrorContains(t, err, "designated timestamp does not fit into Epoch nanoseconds")
+			assert.Empty(t, buf.Messages())
+		})
+	}
+}
+
+func TestAnyColumn(t *testing.T) {
+	buf := newTestBuffer()
+
+	type celsius float64
+	n := int16(-3)
+	ts := time.UnixMicro(6)
+	var nilPtr *int
+	var nilTs *time.Time
+
+	err := buf.Table(testTable).
+		AnyColumn("i", 1).
+		AnyColumn("i8", int8(-2)).
+		AnyColumn("p", &n).
+		AnyColumn("u", uint32(4)).
+		AnyColumn("f", float32(0.5)).
+		AnyColumn("c", celsius(21.5)).
+		AnyColumn("b", true).
+		AnyColumn("s", "x").
+		AnyColumn("bs", []byte("raw")).
+		AnyColumn("st", testSide(0)).
+		AnyColumn("ts", time.UnixMicro(5)).
+		AnyColumn("pts", &ts).
+		AnyColumn("zts", &time.Time{}).
+		AnyColumn("l", big.NewInt(255)).
+		AnyColumn("nil", nil).
+		AnyColumn("nilptr", nilPtr).
+		AnyColumn("nilts", nilTs).
+		At(time.Time{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+" i=1i,i8=-2i,p=-3i,u=4i,f=0.5,c=21.5,b=t,s=\"x\",bs=\"raw\",st=\"buy\",ts=5t,pts=6t,zts=-62135596800000000t,l=0xffi\n", buf.Messages())
+
+	err = buf.Table(testTable).AnyColumn("m", map[string]int{}).At(time.Time{}, false)
+	assert.ErrorIs(t, err, qdb.ErrUnsupportedType)
+	err = buf.Table(testTable).AnyColumn("u", uint64(math.MaxUint64)).At(time.Time{}, false)
+	assert.ErrorIs(t, err, qdb.ErrValueOutOfRange)
+}
+
+func TestAnyColumnRules(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(),
+		qdb.WithAnyColumnRules(qdb.AnyColumnRules{Bytes: qdb.BytesAsHex, RejectNil: true, Float32Shortest: true}))
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).AnyColumn("bs", []byte{0xca, 0xfe}).AnyColumn("f", float32(0.1)).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).AnyColumn("a", 1).AnyColumn("nil", nil).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrUnsupportedType)
+	assert.Equal(t, testTable+" bs=\"cafe\",f=0.1\n", qdb.Messages(sender))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAnyColumnRules(qdb.AnyColumnRules{Bytes: 42}))
+	assert.ErrorContains(t, err, "unknown bytes encoding")
+}
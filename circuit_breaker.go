@@ -0,0 +1,131 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"errors"
+	"time"
+)
+
+const defaultCircuitBreakerOpenTimeout = 5 * time.Second
+
+// ErrCircuitOpen is returned by flushes short-circuited by an open
+// circuit breaker. See WithCircuitBreaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open: flush skipped")
+
+// CircuitBreakerConfig configures the flush circuit breaker.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive flush failures
+	// that opens the circuit. Must be positive.
+	FailureThreshold int
+	// OpenTimeout is the time the circuit stays open before a probe
+	// flush is allowed. Defaults to 5 seconds.
+	OpenTimeout time.Duration
+	// OnReject, if set, is called with the ILP messages of each batch
+	// short-circuited while the circuit is open, e.g. to write them to
+	// a dead-letter file. The slice must not be retained after the call
+	// returns. Otherwise, short-circuited batches are dropped.
+	OnReject func(batch []byte)
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker keeps track of consecutive flush failures.
+// A nil circuitBreaker allows all flushes.
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	onReject    func(batch []byte)
+
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(conf *CircuitBreakerConfig) *circuitBreaker {
+	if conf == nil {
+		return nil
+	}
+	cb := &circuitBreaker{
+		threshold:   conf.FailureThreshold,
+		openTimeout: conf.OpenTimeout,
+		onReject:    conf.OnReject,
+	}
+	if cb.openTimeout == 0 {
+		cb.openTimeout = defaultCircuitBreakerOpenTimeout
+	}
+	return cb
+}
+
+// allow returns true if a flush may be sent to the server. Once the
+// open timeout has passed, a single probe flush is allowed.
+func (cb *circuitBreaker) allow() bool {
+	if cb == nil {
+		return true
+	}
+	switch cb.state {
+	case circuitOpen:
+		if time.Since(cb.openedAt) < cb.openTimeout {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		return true
+	default:
+		return true
+	}
+}
+
+// reject drops the buffer contents short-circuited by an open
+// circuit and passes them to the reject handler, if any.
+func (cb *circuitBreaker) reject(buf *buffer) error {
+	if cb.onReject != nil {
+		cb.onReject(buf.Bytes())
+	}
+	buf.dropFailed(ErrCircuitOpen)
+	return ErrCircuitOpen
+}
+
+// record updates the circuit state with the outcome of a flush.
+func (cb *circuitBreaker) record(err error) {
+	if cb == nil {
+		return
+	}
+	if err == nil {
+		cb.state = circuitClosed
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.state == circuitHalfOpen || cb.failures >= cb.threshold {
+		cb.state = circuitOpen
+		cb.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,180 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultClockSkewInterval = time.Minute
+
+// ClockSkew measures the difference between the server and the
+// client clocks by running a "SELECT now()" query. A positive value
+// means that the server clock is ahead of the client one.
+//
+// The server time is assumed to be taken in the middle of the
+// request round trip, so the result is only as accurate as the
+// latency is symmetric.
+func (c *RestClient) ClockSkew(ctx context.Context) (time.Duration, error) {
+	skew, _, err := c.probeClockSkew(ctx)
+	return skew, err
+}
+
+func (c *RestClient) probeClockSkew(ctx context.Context) (skew, rtt time.Duration, err error) {
+	start := time.Now()
+	res, err := c.Exec(ctx, "SELECT now()")
+	if err != nil {
+		return 0, 0, err
+	}
+	rtt = time.Since(start)
+
+	if len(res.Dataset) != 1 || len(res.Dataset[0]) != 1 {
+		return 0, 0, fmt.Errorf("unexpected server time query result: %v", res.Dataset)
+	}
+	raw, ok := res.Dataset[0][0].(string)
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected server time value: %v", res.Dataset[0][0])
+	}
+	serverTime, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse server time: %w", err)
+	}
+	return serverTime.Sub(start.Add(rtt / 2)), rtt, nil
+}
+
+// ClockSkewMonitorConfig configures a ClockSkewMonitor.
+type ClockSkewMonitorConfig struct {
+	// Interval between two consecutive probes. Defaults to 1 minute.
+	Interval time.Duration
+	// WarnThreshold is the absolute skew value starting from which
+	// OnWarn is called. Zero disables the warnings.
+	WarnThreshold time.Duration
+	// OnWarn is called from the monitor goroutine each time a probe
+	// measures a skew beyond WarnThreshold.
+	OnWarn func(skew time.Duration)
+}
+
+// ClockSkewStats holds the results of the latest clock skew probe.
+type ClockSkewStats struct {
+	// Skew is the latest successfully measured skew. See
+	// RestClient.ClockSkew for its meaning.
+	Skew time.Duration
+	// RoundTrip is the duration of the latest successful probe.
+	RoundTrip time.Duration
+	// LastProbe is the time of the latest successful probe. It's
+	// zero if no probe has succeeded so far.
+	LastProbe time.Time
+	// LastErr is the error of the latest probe, if it failed.
+	LastErr error
+}
+
+// ClockSkewMonitor periodically measures the clock skew between
+// the client and the server in a background goroutine. Since a skewed
+// client clock silently corrupts designated timestamps set with At,
+// it's worth monitoring the skew in long-running applications.
+type ClockSkewMonitor struct {
+	client *RestClient
+	conf   ClockSkewMonitorConfig
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu    sync.Mutex
+	stats ClockSkewStats
+}
+
+// StartClockSkewMonitor starts a monitor that probes the clock skew
+// right away and then with the configured interval. The monitor
+// must be stopped with the Stop method before the client is closed.
+func (c *RestClient) StartClockSkewMonitor(conf ClockSkewMonitorConfig) *ClockSkewMonitor {
+	if conf.Interval <= 0 {
+		conf.Interval = defaultClockSkewInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &ClockSkewMonitor{
+		client: c,
+		conf:   conf,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go m.run(ctx)
+	return m
+}
+
+func (m *ClockSkewMonitor) run(ctx context.Context) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.conf.Interval)
+	defer ticker.Stop()
+	for {
+		m.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *ClockSkewMonitor) probe(ctx context.Context) {
+	probeCtx, cancel := context.WithTimeout(ctx, m.conf.Interval)
+	skew, rtt, err := m.client.probeClockSkew(probeCtx)
+	cancel()
+	if ctx.Err() != nil {
+		// The monitor was stopped.
+		return
+	}
+
+	m.mu.Lock()
+	m.stats.LastErr = err
+	if err == nil {
+		m.stats.Skew = skew
+		m.stats.RoundTrip = rtt
+		m.stats.LastProbe = time.Now()
+	}
+	m.mu.Unlock()
+
+	if err == nil && m.conf.WarnThreshold > 0 && m.conf.OnWarn != nil {
+		if skew >= m.conf.WarnThreshold || skew <= -m.conf.WarnThreshold {
+			m.conf.OnWarn(skew)
+		}
+	}
+}
+
+// Stats returns the results of the latest probe.
+func (m *ClockSkewMonitor) Stats() ClockSkewStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Stop stops the monitor and waits for the background goroutine
+// to exit.
+func (m *ClockSkewMonitor) Stop() {
+	m.cancel()
+	<-m.done
+}
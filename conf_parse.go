@@ -44,19 +44,9 @@ func confFromStr(conf string) (*lineSenderConfig, error) {
 		return nil, err
 	}
 
-	switch data.Schema {
-	case "http":
-		senderConf.senderType = httpSenderType
-	case "https":
-		senderConf.senderType = httpSenderType
-		senderConf.tlsMode = tlsEnabled
-	case "tcp":
-		senderConf.senderType = tcpSenderType
-	case "tcps":
-		senderConf.senderType = tcpSenderType
-		senderConf.tlsMode = tlsEnabled
-	default:
-		return nil, fmt.Errorf("invalid schema: %s", data.Schema)
+	err = setSchema(senderConf, data.Schema)
+	if err != nil {
+		return nil, err
 	}
 
 	for k, v := range data.KeyValuePairs {
@@ -92,8 +82,7 @@ func confFromStr(conf string) (*lineSenderConfig, error) {
 			// But since Go sender doesn't need it, we ignore the values.
 		case "auto_flush":
 			if v == "off" {
-				senderConf.autoFlushRows = 0
-				senderConf.autoFlushInterval = 0
+				senderConf.autoFlushDisabled = true
 			} else if v != "on" {
 				return nil, NewInvalidConfigStrError("invalid %s value, %q is not 'on' or 'off'", k, v)
 			}
@@ -109,7 +98,7 @@ func confFromStr(conf string) (*lineSenderConfig, error) {
 				return nil, NewInvalidConfigStrError("invalid %s value, %q is not a valid int", k, v)
 			}
 			senderConf.autoFlushInterval = time.Duration(parsedVal)
-		case "min_throughput", "init_buf_size", "max_buf_size":
+		case "min_throughput", "init_buf_size", "max_buf_size", "max_name_len", "max_retries", "auto_flush_bytes":
 			parsedVal, err := strconv.Atoi(v)
 			if err != nil {
 				return nil, NewInvalidConfigStrError("invalid %s value, %q is not a valid int", k, v)
@@ -122,6 +111,12 @@ func confFromStr(conf string) (*lineSenderConfig, error) {
 				senderConf.initBufSize = parsedVal
 			case "max_buf_size":
 				senderConf.maxBufSize = parsedVal
+			case "max_name_len":
+				senderConf.fileNameLimit = parsedVal
+			case "max_retries":
+				senderConf.maxRetries = parsedVal
+			case "auto_flush_bytes":
+				senderConf.autoFlushBytes = parsedVal
 			default:
 				panic("add a case for " + k)
 			}
@@ -161,6 +156,26 @@ func confFromStr(conf string) (*lineSenderConfig, error) {
 	return senderConf, nil
 }
 
+// setSchema sets the sender type and TLS mode corresponding to
+// the given config string schema.
+func setSchema(conf *lineSenderConfig, schema string) error {
+	switch schema {
+	case "http":
+		conf.senderType = httpSenderType
+	case "https":
+		conf.senderType = httpSenderType
+		conf.tlsMode = tlsEnabled
+	case "tcp":
+		conf.senderType = tcpSenderType
+	case "tcps":
+		conf.senderType = tcpSenderType
+		conf.tlsMode = tlsEnabled
+	default:
+		return fmt.Errorf("invalid schema: %s", schema)
+	}
+	return nil
+}
+
 func parseConfigStr(conf string) (configData, error) {
 	var (
 		key    = &strings.Builder{}
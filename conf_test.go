@@ -25,7 +25,10 @@
 package questdb_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"testing"
 	"time"
 
@@ -72,6 +75,26 @@ func TestParserHappyCases(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:   "tcp and bracketed ipv6 address",
+			config: "tcp::addr=[::1]:9009;",
+			expected: qdb.ConfigData{
+				Schema: "tcp",
+				KeyValuePairs: map[string]string{
+					"addr": "[::1]:9009",
+				},
+			},
+		},
+		{
+			name:   "http and ipv6 address with zone",
+			config: "http::addr=[fe80::1%eth0]:9000;",
+			expected: qdb.ConfigData{
+				Schema: "http",
+				KeyValuePairs: map[string]string{
+					"addr": "[fe80::1%eth0]:9000",
+				},
+			},
+		},
 		{
 			name:   "tcp and address",
 			config: fmt.Sprintf("tcp::addr=%s;", addr),
@@ -331,6 +354,16 @@ func TestHappyCasesFromConf(t *testing.T) {
 				qdb.WithMaxBufferSize(maxBufSize),
 			},
 		},
+		{
+			name: "max_name_len",
+			config: fmt.Sprintf("tcp::addr=%s;max_name_len=64;",
+				addr),
+			expectedOpts: []qdb.LineSenderOption{
+				qdb.WithTcp(),
+				qdb.WithAddress(addr),
+				qdb.WithFileNameLimit(64),
+			},
+		},
 		{
 			name: "with tls",
 			config: fmt.Sprintf("tcp::addr=%s;tls_verify=on;",
@@ -382,6 +415,26 @@ func TestHappyCasesFromConf(t *testing.T) {
 				qdb.WithMinThroughput(minThroughput),
 			},
 		},
+		{
+			name: "auto_flush_bytes",
+			config: fmt.Sprintf("tcp::addr=%s;auto_flush_bytes=4096;",
+				addr),
+			expectedOpts: []qdb.LineSenderOption{
+				qdb.WithTcp(),
+				qdb.WithAddress(addr),
+				qdb.WithAutoFlushBytes(4096),
+			},
+		},
+		{
+			name: "max_retries",
+			config: fmt.Sprintf("http::addr=%s;max_retries=3;",
+				addr),
+			expectedOpts: []qdb.LineSenderOption{
+				qdb.WithHttp(),
+				qdb.WithAddress(addr),
+				qdb.WithMaxRetries(3),
+			},
+		},
 		{
 			name: "bearer token",
 			config: fmt.Sprintf("http::addr=%s;token=%s",
@@ -496,3 +549,222 @@ func TestPathologicalCasesFromConf(t *testing.T) {
 		})
 	}
 }
+
+func TestSenderConfig(t *testing.T) {
+	ctx := context.Background()
+
+	var conf qdb.SenderConfig
+	err := json.Unmarshal([]byte(`{"schema":"http","addr":"localhost:1111","username":"joe","password":"secret","auto_flush_rows":10}`), &conf)
+	assert.NoError(t, err)
+	assert.Equal(t, qdb.SenderConfig{
+		Schema:        "http",
+		Address:       "localhost:1111",
+		Username:      "joe",
+		Password:      "secret",
+		AutoFlushRows: 10,
+	}, conf)
+	assert.NoError(t, conf.Validate())
+
+	sender, err := conf.Build(ctx, qdb.WithDryRun())
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Close(ctx))
+
+	testCases := []struct {
+		name        string
+		conf        qdb.SenderConfig
+		expectedErr string
+	}{
+		{
+			name:        "invalid schema",
+			conf:        qdb.SenderConfig{Schema: "foobar"},
+			expectedErr: "invalid schema",
+		},
+		{
+			name:        "password for tcp",
+			conf:        qdb.SenderConfig{Schema: "tcp", Username: "joe", Password: "secret"},
+			expectedErr: "password is only supported for HTTP sender",
+		},
+		{
+			name:        "insecure skip verify without tls",
+			conf:        qdb.SenderConfig{Schema: "http", TlsInsecureSkipVerify: true},
+			expectedErr: "TLS certificate verification can only be disabled",
+		},
+		{
+			name:        "negative request timeout",
+			conf:        qdb.SenderConfig{Schema: "https", RequestTimeout: -1},
+			expectedErr: "request timeout is negative",
+		},
+		{
+			name:        "http settings for tcp",
+			conf:        qdb.SenderConfig{Schema: "tcps", AutoFlushRows: 10},
+			expectedErr: "autoFlushRows setting is not available in the TCP client",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.conf.Validate()
+			assert.ErrorContains(t, err, tc.expectedErr)
+			_, err = tc.conf.Build(ctx, qdb.WithDryRun())
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestConfigSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDryRun(), qdb.WithFloatPrecision(2), qdb.WithAutoFlushRows(42))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	clone, err := qdb.NewLineSenderFromConfig(ctx, sender.Config())
+	assert.NoError(t, err)
+	defer clone.Close(ctx)
+	assert.Equal(t, sender.Config(), clone.Config())
+
+	err = clone.Table(testTable).Float64Column("a", 1.234).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+" a=1.2\n", qdb.Messages(clone))
+
+	// Options are applied on top of the snapshot.
+	other, err := qdb.NewLineSenderFromConfig(ctx, sender.Config(), qdb.WithFloatPrecision(3))
+	assert.NoError(t, err)
+	defer other.Close(ctx)
+	assert.NotEqual(t, sender.Config(), other.Config())
+
+	_, err = qdb.NewLineSenderFromConfig(ctx, sender.Config(), qdb.WithTcp())
+	assert.ErrorContains(t, err, "both WithHttp and WithTcp options are provided")
+	_, err = qdb.NewLineSenderFromConfig(ctx, qdb.ConfigSnapshot{})
+	assert.ErrorContains(t, err, "config snapshot is empty")
+}
+
+func TestAddressScheme(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		addr         string
+		opts         []qdb.LineSenderOption
+		expectedAddr string
+		expectedHttp bool
+		expectedTls  bool
+	}{
+		{"http://db", nil, "db:9000", true, false},
+		{"https://db:9001/", nil, "db:9001", true, true},
+		{"tcp://db", nil, "db:9009", false, false},
+		{"tcps://[::1]", nil, "[::1]:9009", false, true},
+		{"https://db", []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithTlsInsecureSkipVerify()}, "db:9000", true, true},
+		{"db:9000", []qdb.LineSenderOption{qdb.WithHttp()}, "db:9000", true, false},
+		// TLS is enabled automatically for QuestDB Cloud addresses.
+		{"my-db.b04c.questdb.net:9000", []qdb.LineSenderOption{qdb.WithHttp()}, "my-db.b04c.questdb.net:9000", true, true},
+		{"my-db.ilp.b04c.QuestDB.net", []qdb.LineSenderOption{qdb.WithTcp()}, "my-db.ilp.b04c.QuestDB.net", false, true},
+		{"http://my-db.b04c.questdb.net", nil, "my-db.b04c.questdb.net:9000", true, false},
+		// IPv6 literals get the default port, if it's missing.
+		{"::1", []qdb.LineSenderOption{qdb.WithTcp()}, "[::1]:9009", false, false},
+		{"[::1]", []qdb.LineSenderOption{qdb.WithHttp()}, "[::1]:9000", true, false},
+		{"[::1]:9001", []qdb.LineSenderOption{qdb.WithHttp()}, "[::1]:9001", true, false},
+		{"fe80::1%eth0", []qdb.LineSenderOption{qdb.WithHttp()}, "[fe80::1%eth0]:9000", true, false},
+		{"https://[fe80::1%eth0]", nil, "[fe80::1%eth0]:9000", true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			opts := append([]qdb.LineSenderOption{qdb.WithDryRun(), qdb.WithAddress(tc.addr)}, tc.opts...)
+			sender, err := qdb.NewLineSender(ctx, opts...)
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			addr, http, tls := qdb.ConfigAddress(sender.Config())
+			assert.Equal(t, tc.expectedAddr, addr)
+			assert.Equal(t, tc.expectedHttp, http)
+			assert.Equal(t, tc.expectedTls, tls)
+		})
+	}
+
+	errCases := []struct {
+		addr   string
+		opts   []qdb.LineSenderOption
+		errMsg string
+	}{
+		{"ftp://db", nil, "invalid address scheme: ftp"},
+		{"http://db/path", nil, "invalid address: http://db/path"},
+		{"http://db", []qdb.LineSenderOption{qdb.WithTcp()}, "address scheme http conflicts with the configured sender type"},
+		{"tcp://db", []qdb.LineSenderOption{qdb.WithTls()}, "address scheme tcp conflicts with the configured TLS mode"},
+	}
+
+	for _, tc := range errCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			opts := append([]qdb.LineSenderOption{qdb.WithDryRun(), qdb.WithAddress(tc.addr)}, tc.opts...)
+			_, err := qdb.NewLineSender(ctx, opts...)
+			assert.ErrorContains(t, err, tc.errMsg)
+		})
+	}
+}
+
+func TestAddressSchemeOverNetwork(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithAddress("tcp://"+srv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+	expectLines(t, srv.BackCh, []string{testTable + " a_col=1i"})
+}
+
+func TestIpv6Address(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+	l.Close()
+
+	srv, err := newTestServerOnAddress(sendToBackChannel, "tcp", "[::1]:0")
+	assert.NoError(t, err)
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Addr())
+	assert.NoError(t, err)
+
+	httpSrv, err := newTestServerOnAddress(sendToBackChannel, "http", "[::1]:0")
+	assert.NoError(t, err)
+	defer httpSrv.Close()
+
+	testCases := []struct {
+		name string
+		conf string
+		ch   chan string
+	}{
+		{"tcp bracketed", "tcp::addr=" + srv.Addr() + ";", srv.BackCh},
+		{"tcp scheme", "tcp::addr=tcp://[::1]:" + port + ";", srv.BackCh},
+		{"http bracketed", "http::addr=" + httpSrv.Addr() + ";", httpSrv.BackCh},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, err := qdb.LineSenderFromConf(ctx, tc.conf)
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, sender.Flush(ctx))
+			expectLines(t, tc.ch, []string{testTable + " a_col=1i"})
+		})
+	}
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+	err = sender.Table(testTable).Int64Column("a_col", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+	expectLines(t, srv.BackCh, []string{testTable + " a_col=2i"})
+}
@@ -0,0 +1,360 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ColumnType is a QuestDB column type used in table schemas.
+type ColumnType string
+
+const (
+	ColumnTypeBoolean   ColumnType = "BOOLEAN"
+	ColumnTypeByte      ColumnType = "BYTE"
+	ColumnTypeShort     ColumnType = "SHORT"
+	ColumnTypeChar      ColumnType = "CHAR"
+	ColumnTypeInt       ColumnType = "INT"
+	ColumnTypeLong      ColumnType = "LONG"
+	ColumnTypeFloat     ColumnType = "FLOAT"
+	ColumnTypeDouble    ColumnType = "DOUBLE"
+	ColumnTypeDate      ColumnType = "DATE"
+	ColumnTypeTimestamp ColumnType = "TIMESTAMP"
+	ColumnTypeSymbol    ColumnType = "SYMBOL"
+	ColumnTypeString    ColumnType = "STRING"
+	ColumnTypeVarchar   ColumnType = "VARCHAR"
+	ColumnTypeLong256   ColumnType = "LONG256"
+	ColumnTypeUuid      ColumnType = "UUID"
+	ColumnTypeIpv4      ColumnType = "IPV4"
+)
+
+// PartitionBy is a table partitioning strategy.
+type PartitionBy string
+
+const (
+	PartitionByNone  PartitionBy = "NONE"
+	PartitionByHour  PartitionBy = "HOUR"
+	PartitionByDay   PartitionBy = "DAY"
+	PartitionByWeek  PartitionBy = "WEEK"
+	PartitionByMonth PartitionBy = "MONTH"
+	PartitionByYear  PartitionBy = "YEAR"
+)
+
+// WalMode determines whether a table uses write-ahead log (WAL).
+type WalMode int64
+
+const (
+	// WalDefault leaves the choice to the server configuration.
+	WalDefault WalMode = 0
+	// WalEnabled creates a WAL table. Requires partitioning.
+	WalEnabled WalMode = 1
+	// WalBypass creates a non-WAL table.
+	WalBypass WalMode = 2
+)
+
+// ColumnSchema describes a table column.
+type ColumnSchema struct {
+	Name string
+	Type ColumnType
+	// SymbolCapacity sets the expected number of distinct values
+	// of a symbol column. Zero means the server default.
+	SymbolCapacity int
+	// Indexed enables an index on a symbol column.
+	Indexed bool
+}
+
+// TableSchema describes a table to be created with CreateTable.
+type TableSchema struct {
+	Name    string
+	Columns []ColumnSchema
+	// DesignatedTimestamp is the name of the designated timestamp
+	// column. The column must be present in Columns and have
+	// the TIMESTAMP type.
+	DesignatedTimestamp string
+	// PartitionBy requires a designated timestamp unless set to
+	// PartitionByNone or left empty.
+	PartitionBy PartitionBy
+	Wal         WalMode
+	// DedupKeys enables deduplication with the given upsert keys.
+	// The keys must include the designated timestamp. Only available
+	// for WAL tables. See DedupKey for deterministic row IDs.
+	DedupKeys []string
+	// IfNotExists makes CreateTable a no-op for existing tables.
+	IfNotExists bool
+}
+
+// DDL returns the CREATE TABLE statement for the schema.
+func (s *TableSchema) DDL() (string, error) {
+	if s.Name == "" {
+		return "", errors.New("table name cannot be empty")
+	}
+	if len(s.Columns) == 0 {
+		return "", fmt.Errorf("table %s has no columns", s.Name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("CREATE TABLE ")
+	if s.IfNotExists {
+		sb.WriteString("IF NOT EXISTS ")
+	}
+	writeIdentifier(&sb, s.Name)
+	sb.WriteString(" (")
+
+	hasTs := false
+	for i, col := range s.Columns {
+		if col.Name == "" {
+			return "", fmt.Errorf("column name cannot be empty: table %s, column #%d", s.Name, i)
+		}
+		if col.Type == "" {
+			return "", fmt.Errorf("column type cannot be empty: column %s", col.Name)
+		}
+		if col.Type != ColumnTypeSymbol && (col.SymbolCapacity != 0 || col.Indexed) {
+			return "", fmt.Errorf("symbol capacity and index are only available for symbol columns: column %s", col.Name)
+		}
+		if col.SymbolCapacity < 0 {
+			return "", fmt.Errorf("symbol capacity is negative: column %s", col.Name)
+		}
+		if col.Name == s.DesignatedTimestamp {
+			if col.Type != ColumnTypeTimestamp {
+				return "", fmt.Errorf("designated timestamp column must be of TIMESTAMP type: column %s", col.Name)
+			}
+			hasTs = true
+		}
+
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		writeIdentifier(&sb, col.Name)
+		sb.WriteByte(' ')
+		sb.WriteString(string(col.Type))
+		if col.SymbolCapacity > 0 {
+			fmt.Fprintf(&sb, " CAPACITY %d", col.SymbolCapacity)
+		}
+		if col.Indexed {
+			sb.WriteString(" INDEX")
+		}
+	}
+	sb.WriteByte(')')
+
+	if s.DesignatedTimestamp != "" {
+		if !hasTs {
+			return "", fmt.Errorf("designated timestamp column not found: %s", s.DesignatedTimestamp)
+		}
+		sb.WriteString(" TIMESTAMP(")
+		writeIdentifier(&sb, s.DesignatedTimestamp)
+		sb.WriteByte(')')
+	}
+
+	partitioned := s.PartitionBy != "" && s.PartitionBy != PartitionByNone
+	if partitioned && s.DesignatedTimestamp == "" {
+		return "", errors.New("partitioning requires a designated timestamp")
+	}
+	if s.PartitionBy != "" {
+		sb.WriteString(" PARTITION BY ")
+		sb.WriteString(string(s.PartitionBy))
+	}
+
+	switch s.Wal {
+	case WalDefault:
+	case WalEnabled:
+		if !partitioned {
+			return "", errors.New("WAL requires partitioning")
+		}
+		sb.WriteString(" WAL")
+	case WalBypass:
+		sb.WriteString(" BYPASS WAL")
+	default:
+		return "", fmt.Errorf("unknown WAL mode: %d", s.Wal)
+	}
+
+	if len(s.DedupKeys) > 0 {
+		if s.Wal != WalEnabled {
+			return "", errors.New("deduplication requires WAL")
+		}
+		hasTs = false
+		sb.WriteString(" DEDUP UPSERT KEYS(")
+		for i, key := range s.DedupKeys {
+			if !s.hasColumn(key) {
+				return "", fmt.Errorf("dedup key column not found: %s", key)
+			}
+			hasTs = hasTs || key == s.DesignatedTimestamp
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeIdentifier(&sb, key)
+		}
+		sb.WriteByte(')')
+		if !hasTs {
+			return "", errors.New("dedup keys must include the designated timestamp")
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func (s *TableSchema) hasColumn(name string) bool {
+	for _, col := range s.Columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTable creates a table with the given schema.
+func (c *RestClient) CreateTable(ctx context.Context, schema TableSchema) error {
+	ddl, err := schema.DDL()
+	if err != nil {
+		return err
+	}
+	_, err = c.Exec(ctx, ddl)
+	return err
+}
+
+// TableExists checks whether a table with the given name exists.
+func (c *RestClient) TableExists(ctx context.Context, name string) (bool, error) {
+	res, err := c.Exec(ctx, "SELECT table_name FROM tables() WHERE table_name = "+quoteLiteral(name))
+	if err != nil {
+		return false, err
+	}
+	return res.Count > 0, nil
+}
+
+// DropPartitions drops the partitions of the table holding only
+// rows older than the given time. Use it to enforce retention
+// policies. The partition holding olderThan is kept, so the dropped
+// range is rounded down to the partition boundaries.
+func (c *RestClient) DropPartitions(ctx context.Context, table string, olderThan time.Time) error {
+	ts, by, err := c.partitioning(ctx, table)
+	if err != nil {
+		return err
+	}
+	// The server matches the partitions by their lower boundary,
+	// so the cutoff must be a boundary too.
+	cutoff, err := partitionFloor(olderThan.UTC(), by)
+	if err != nil {
+		return fmt.Errorf("table %s: %w", table, err)
+	}
+	var sb strings.Builder
+	sb.WriteString("ALTER TABLE ")
+	writeIdentifier(&sb, table)
+	sb.WriteString(" DROP PARTITION WHERE ")
+	writeIdentifier(&sb, ts)
+	sb.WriteString(" < ")
+	sb.WriteString(quoteLiteral(cutoff.Format("2006-01-02T15:04:05.000000Z")))
+	_, err = c.Exec(ctx, sb.String())
+	return err
+}
+
+// DetachPartitions detaches the given partitions from the table.
+// Partitions are named after their lower boundary in the table
+// partitioning format, e.g. "2024-01-01" for PartitionByDay.
+// Detached partitions are kept on the server disk and can be
+// attached back with AttachPartitions.
+func (c *RestClient) DetachPartitions(ctx context.Context, table string, partitions ...string) error {
+	return c.alterPartitions(ctx, table, "DETACH", partitions)
+}
+
+// AttachPartitions attaches the given partitions, previously
+// detached or copied to the table directory on the server with
+// the ".attachable" suffix, to the table.
+func (c *RestClient) AttachPartitions(ctx context.Context, table string, partitions ...string) error {
+	return c.alterPartitions(ctx, table, "ATTACH", partitions)
+}
+
+func (c *RestClient) alterPartitions(ctx context.Context, table, action string, partitions []string) error {
+	if len(partitions) == 0 {
+		return errors.New("no partitions given")
+	}
+	var sb strings.Builder
+	sb.WriteString("ALTER TABLE ")
+	writeIdentifier(&sb, table)
+	sb.WriteByte(' ')
+	sb.WriteString(action)
+	sb.WriteString(" PARTITION LIST ")
+	for i, p := range partitions {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(quoteLiteral(p))
+	}
+	_, err := c.Exec(ctx, sb.String())
+	return err
+}
+
+// partitioning returns the designated timestamp column name and
+// the partitioning strategy of the table.
+func (c *RestClient) partitioning(ctx context.Context, table string) (string, PartitionBy, error) {
+	res, err := c.Exec(ctx, "SELECT designatedTimestamp, partitionBy FROM tables() WHERE table_name = "+quoteLiteral(table))
+	if err != nil {
+		return "", "", err
+	}
+	if res.Count == 0 || len(res.Dataset) == 0 || len(res.Dataset[0]) < 2 {
+		return "", "", fmt.Errorf("table not found: %s", table)
+	}
+	ts, _ := res.Dataset[0][0].(string)
+	if ts == "" {
+		return "", "", fmt.Errorf("table %s has no designated timestamp", table)
+	}
+	by, _ := res.Dataset[0][1].(string)
+	return ts, PartitionBy(by), nil
+}
+
+// partitionFloor returns the lower boundary of the partition
+// holding t.
+func partitionFloor(t time.Time, by PartitionBy) (time.Time, error) {
+	y, m, d := t.Date()
+	switch by {
+	case PartitionByHour:
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, time.UTC), nil
+	case PartitionByDay:
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+	case PartitionByWeek:
+		// Weeks start on Monday.
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC), nil
+	case PartitionByMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC), nil
+	case PartitionByYear:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported partitioning: %q", by)
+	}
+}
+
+// writeIdentifier writes a double-quoted SQL identifier.
+func writeIdentifier(sb *strings.Builder, name string) {
+	sb.WriteByte('"')
+	sb.WriteString(strings.ReplaceAll(name, `"`, `""`))
+	sb.WriteByte('"')
+}
+
+// quoteLiteral returns a single-quoted SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
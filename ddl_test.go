@@ -0,0 +1,179 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"testing"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableSchemaDDL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schema   qdb.TableSchema
+		expected string
+	}{
+		{
+			"single column",
+			qdb.TableSchema{
+				Name:    "foo",
+				Columns: []qdb.ColumnSchema{{Name: "bar", Type: qdb.ColumnTypeLong}},
+			},
+			`CREATE TABLE "foo" ("bar" LONG)`,
+		},
+		{
+			"all features",
+			qdb.TableSchema{
+				Name: "trades",
+				Columns: []qdb.ColumnSchema{
+					{Name: "sym", Type: qdb.ColumnTypeSymbol, SymbolCapacity: 256, Indexed: true},
+					{Name: "price", Type: qdb.ColumnTypeDouble},
+					{Name: "ts", Type: qdb.ColumnTypeTimestamp},
+				},
+				DesignatedTimestamp: "ts",
+				PartitionBy:         qdb.PartitionByDay,
+				Wal:                 qdb.WalEnabled,
+				IfNotExists:         true,
+			},
+			`CREATE TABLE IF NOT EXISTS "trades" ("sym" SYMBOL CAPACITY 256 INDEX, "price" DOUBLE, "ts" TIMESTAMP) TIMESTAMP("ts") PARTITION BY DAY WAL`,
+		},
+		{
+			"bypass wal",
+			qdb.TableSchema{
+				Name:        "foo",
+				Columns:     []qdb.ColumnSchema{{Name: "ts", Type: qdb.ColumnTypeTimestamp}},
+				PartitionBy: qdb.PartitionByNone,
+				Wal:         qdb.WalBypass,
+			},
+			`CREATE TABLE "foo" ("ts" TIMESTAMP) PARTITION BY NONE BYPASS WAL`,
+		},
+		{
+			"quoted identifiers",
+			qdb.TableSchema{
+				Name:    `my "table"`,
+				Columns: []qdb.ColumnSchema{{Name: "a b", Type: qdb.ColumnTypeString}},
+			},
+			`CREATE TABLE "my ""table""" ("a b" STRING)`,
+		},
+		{
+			"dedup",
+			qdb.TableSchema{
+				Name: "foo",
+				Columns: []qdb.ColumnSchema{
+					{Name: "id", Type: qdb.ColumnTypeLong},
+					{Name: "ts", Type: qdb.ColumnTypeTimestamp},
+				},
+				DesignatedTimestamp: "ts",
+				PartitionBy:         qdb.PartitionByDay,
+				Wal:                 qdb.WalEnabled,
+				DedupKeys:           []string{"ts", "id"},
+			},
+			`CREATE TABLE "foo" ("id" LONG, "ts" TIMESTAMP) TIMESTAMP("ts") PARTITION BY DAY WAL DEDUP UPSERT KEYS("ts", "id")`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ddl, err := tc.schema.DDL()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ddl)
+		})
+	}
+}
+
+func TestTableSchemaDDLErrors(t *testing.T) {
+	tsCol := qdb.ColumnSchema{Name: "ts", Type: qdb.ColumnTypeTimestamp}
+
+	testCases := []struct {
+		name        string
+		schema      qdb.TableSchema
+		expectedErr string
+	}{
+		{
+			"empty table name",
+			qdb.TableSchema{Columns: []qdb.ColumnSchema{tsCol}},
+			"table name cannot be empty",
+		},
+		{
+			"no columns",
+			qdb.TableSchema{Name: "foo"},
+			"table foo has no columns",
+		},
+		{
+			"empty column type",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{{Name: "bar"}}},
+			"column type cannot be empty",
+		},
+		{
+			"capacity on non-symbol",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{{Name: "bar", Type: qdb.ColumnTypeLong, SymbolCapacity: 1}}},
+			"only available for symbol columns",
+		},
+		{
+			"missing designated timestamp",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{tsCol}, DesignatedTimestamp: "bar"},
+			"designated timestamp column not found",
+		},
+		{
+			"non-timestamp designated timestamp",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{{Name: "bar", Type: qdb.ColumnTypeLong}}, DesignatedTimestamp: "bar"},
+			"must be of TIMESTAMP type",
+		},
+		{
+			"partitioning without designated timestamp",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{tsCol}, PartitionBy: qdb.PartitionByDay},
+			"partitioning requires a designated timestamp",
+		},
+		{
+			"dedup without wal",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{tsCol}, DesignatedTimestamp: "ts", DedupKeys: []string{"ts"}},
+			"deduplication requires WAL",
+		},
+		{
+			"dedup without designated timestamp",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{tsCol, {Name: "id", Type: qdb.ColumnTypeLong}}, DesignatedTimestamp: "ts", PartitionBy: qdb.PartitionByDay, Wal: qdb.WalEnabled, DedupKeys: []string{"id"}},
+			"dedup keys must include the designated timestamp",
+		},
+		{
+			"unknown dedup key",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{tsCol}, DesignatedTimestamp: "ts", PartitionBy: qdb.PartitionByDay, Wal: qdb.WalEnabled, DedupKeys: []string{"ts", "id"}},
+			"dedup key column not found: id",
+		},
+		{
+			"wal without partitioning",
+			qdb.TableSchema{Name: "foo", Columns: []qdb.ColumnSchema{tsCol}, DesignatedTimestamp: "ts", Wal: qdb.WalEnabled},
+			"WAL requires partitioning",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.schema.DDL()
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
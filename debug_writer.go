@@ -0,0 +1,60 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"fmt"
+	"io"
+)
+
+// debugWriter copies flushed payloads to a user-provided writer.
+// A nil debugWriter does nothing.
+type debugWriter struct {
+	w io.Writer
+	// maxBytes is the max number of bytes written per payload;
+	// 0 means no limit.
+	maxBytes int
+}
+
+func newDebugWriter(w io.Writer, maxBytes int) *debugWriter {
+	if w == nil {
+		return nil
+	}
+	return &debugWriter{w: w, maxBytes: maxBytes}
+}
+
+// dump writes the payload, truncating it if necessary. Write
+// errors are ignored, since they shouldn't affect the flush.
+func (d *debugWriter) dump(payload []byte) {
+	if d == nil {
+		return
+	}
+	if d.maxBytes == 0 || len(payload) <= d.maxBytes {
+		d.w.Write(payload)
+		return
+	}
+	d.w.Write(payload[:d.maxBytes])
+	fmt.Fprintf(d.w, "\n... %d bytes truncated\n", len(payload)-d.maxBytes)
+}
@@ -0,0 +1,158 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"time"
+)
+
+// DedupKey derives a deterministic ID for each row from the values
+// of the selected symbols and columns and the designated timestamp.
+// The ID is written as a LONG column, so it can be used along with
+// the designated timestamp as DEDUP UPSERT KEYS of a WAL table
+// (see TableSchema.DedupKeys). This way, re-sent batches, e.g.
+// after a retry with unknown outcome, don't create duplicate rows.
+//
+//	key := qdb.DedupKey{Column: "id", Fields: []string{"sym", "side"}}
+//	err := sender.WriteRows(ctx, key.ApplyAll(rows))
+type DedupKey struct {
+	// Column is the name of the ID column.
+	Column string
+	// Fields are the names of the symbols and columns to derive
+	// the ID from, in addition to the designated timestamp. If empty,
+	// all symbols and columns of the row are used.
+	Fields []string
+}
+
+// ID returns the ID of the row. Missing fields are hashed as
+// absent, so the ID is stable for rows with optional columns.
+func (k DedupKey) ID(row Row) int64 {
+	h := fnv.New64a()
+	if len(k.Fields) == 0 {
+		for _, kv := range row.Symbols {
+			hashField(h, kv.Name, kv.Value, true)
+		}
+		for _, col := range row.Columns {
+			if col.Name != k.Column {
+				hashField(h, col.Name, col.Value, true)
+			}
+		}
+	} else {
+		for _, name := range k.Fields {
+			val, ok := rowField(&row, name)
+			hashField(h, name, val, ok)
+		}
+	}
+	var ts [8]byte
+	if !row.Ts.IsZero() {
+		binary.LittleEndian.PutUint64(ts[:], uint64(row.Ts.UnixNano()))
+	}
+	h.Write(ts[:])
+	return int64(h.Sum64())
+}
+
+// Apply returns a copy of the row with the ID column appended.
+// The original row is not modified.
+func (k DedupKey) Apply(row Row) Row {
+	cols := make([]TypedValue, len(row.Columns), len(row.Columns)+1)
+	copy(cols, row.Columns)
+	row.Columns = append(cols, TypedValue{Name: k.Column, Value: k.ID(row)})
+	return row
+}
+
+// ApplyAll returns copies of the rows with the ID column appended.
+func (k DedupKey) ApplyAll(rows []Row) []Row {
+	res := make([]Row, len(rows))
+	for i := range rows {
+		res[i] = k.Apply(rows[i])
+	}
+	return res
+}
+
+func rowField(row *Row, name string) (interface{}, bool) {
+	for _, kv := range row.Symbols {
+		if kv.Name == name {
+			return kv.Value, true
+		}
+	}
+	for _, col := range row.Columns {
+		if col.Name == name {
+			return col.Value, true
+		}
+	}
+	return nil, false
+}
+
+// hashField writes the field to the hash. Each value is prefixed
+// with a type tag and its length, if variable, so that different
+// rows can't produce the same hash input.
+func hashField(h hash.Hash64, name string, val interface{}, present bool) {
+	var b [8]byte
+	writeStr := func(s string) {
+		binary.LittleEndian.PutUint64(b[:], uint64(len(s)))
+		h.Write(b[:])
+		h.Write([]byte(s))
+	}
+	writeUint := func(tag byte, v uint64) {
+		h.Write([]byte{tag})
+		binary.LittleEndian.PutUint64(b[:], v)
+		h.Write(b[:])
+	}
+
+	writeStr(name)
+	if !present {
+		h.Write([]byte{0})
+		return
+	}
+	switch v := val.(type) {
+	case string:
+		h.Write([]byte{1})
+		writeStr(v)
+	case int64:
+		writeUint(2, uint64(v))
+	case uint64:
+		writeUint(3, v)
+	case float64:
+		writeUint(4, math.Float64bits(v))
+	case bool:
+		if v {
+			writeUint(5, 1)
+		} else {
+			writeUint(5, 0)
+		}
+	case time.Time:
+		writeUint(6, uint64(v.UnixNano()))
+	case *big.Int:
+		h.Write([]byte{7})
+		writeStr(v.Text(16))
+	default:
+		h.Write([]byte{8})
+	}
+}
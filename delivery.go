@@ -0,0 +1,81 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeliveryMode defines whether the senders re-send failed batches.
+// See WithDeliveryMode.
+type DeliveryMode int
+
+const (
+	// DeliveryAtLeastOnce makes the senders retry failed flushes,
+	// so a batch may be applied by the server more than once, e.g.
+	// when the connection breaks before the response is received.
+	// Use a table with deduplication enabled to avoid duplicates.
+	// This is the default.
+	DeliveryAtLeastOnce DeliveryMode = iota
+	// DeliveryAtMostOnce makes the senders drop failed batches
+	// without retrying them, so no batch is applied twice, but some
+	// may be lost. Dropped rows are counted in MetricRowsDropped.
+	DeliveryAtMostOnce
+)
+
+// deliveryDeadline bounds the total time spent in delivery attempts
+// of a single batch. A zero deliveryDeadline has no timeout.
+type deliveryDeadline struct {
+	timeout    time.Duration
+	deadLetter func(batch []byte, err error)
+}
+
+// withTimeout returns a context that is done once the delivery
+// timeout passes.
+func (d deliveryDeadline) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d.timeout)
+}
+
+// check wraps the error of a delivery attempt with
+// ErrDeliveryTimeout if the delivery context, but not the parent
+// one, is done.
+func (d deliveryDeadline) check(ctx, deliveryCtx context.Context, err error) error {
+	if err == nil || d.timeout <= 0 || ctx.Err() != nil || deliveryCtx.Err() == nil {
+		return err
+	}
+	return fmt.Errorf("%w after %s: %v", ErrDeliveryTimeout, d.timeout, err)
+}
+
+// drop passes the expired batch to the dead-letter handler, if any.
+func (d deliveryDeadline) drop(batch []byte, err error) {
+	if d.deadLetter != nil {
+		d.deadLetter(batch, err)
+	}
+}
@@ -0,0 +1,296 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+)
+
+// DryRunSender is implemented by senders created with the
+// WithDryRun option.
+type DryRunSender interface {
+	LineSender
+
+	// Lines returns an iterator over the ILP messages flushed
+	// so far.
+	Lines() *LineIterator
+}
+
+// LineIterator iterates over ILP messages.
+//
+//	it := sender.(qdb.DryRunSender).Lines()
+//	for it.Next() {
+//		fmt.Println(it.Line())
+//	}
+type LineIterator struct {
+	scanner *bufio.Scanner
+}
+
+// Next advances the iterator to the next message. It returns false
+// when there are no more messages.
+func (it *LineIterator) Next() bool {
+	return it.scanner.Scan()
+}
+
+// Line returns the current message without the trailing newline.
+func (it *LineIterator) Line() string {
+	return string(trimNewline(it.scanner.Bytes()))
+}
+
+// dryRunLineSender encodes and validates ILP messages in the same
+// way as the HTTP and TCP senders do, but never opens a connection.
+// Flushed messages are accumulated in memory instead.
+type dryRunLineSender struct {
+	buf     buffer
+	flushed bytes.Buffer
+	raw     *rawWriter
+	closed  bool
+	conf    lineSenderConfig
+}
+
+func newDryRunLineSender(conf *lineSenderConfig) (*dryRunLineSender, error) {
+	buf, err := newBufferFromConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	// Dry-run senders never flush, so they are not accounted
+	// in the memory limit.
+	buf.memLimit = 0
+	return &dryRunLineSender{buf: buf, conf: *conf}, nil
+}
+
+func (s *dryRunLineSender) Table(name string) LineSender {
+	s.buf.Table(name)
+	return s
+}
+
+func (s *dryRunLineSender) Symbol(name, val string) LineSender {
+	s.buf.Symbol(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) SymbolStringer(name string, val fmt.Stringer) LineSender {
+	s.buf.SymbolStringer(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) Int64Column(name string, val int64) LineSender {
+	s.buf.Int64Column(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) Uint64Column(name string, val uint64) LineSender {
+	s.buf.Uint64Column(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) Long256Column(name string, val *big.Int) LineSender {
+	s.buf.Long256Column(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) TimestampColumn(name string, ts time.Time) LineSender {
+	s.buf.TimestampColumn(name, ts)
+	return s
+}
+
+func (s *dryRunLineSender) TimestampMicrosColumn(name string, ts int64) LineSender {
+	s.buf.TimestampMicrosColumn(name, ts)
+	return s
+}
+
+func (s *dryRunLineSender) TimestampNanosColumn(name string, ts int64) LineSender {
+	s.buf.TimestampNanosColumn(name, ts)
+	return s
+}
+
+func (s *dryRunLineSender) Float64Column(name string, val float64) LineSender {
+	s.buf.Float64Column(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) StringColumn(name, val string) LineSender {
+	s.buf.StringColumn(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) StringColumnMarshaler(name string, val encoding.TextMarshaler) LineSender {
+	s.buf.StringColumnMarshaler(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) BoolColumn(name string, val bool) LineSender {
+	s.buf.BoolColumn(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) AnyColumn(name string, val interface{}) LineSender {
+	s.buf.AnyColumn(name, val)
+	return s
+}
+
+func (s *dryRunLineSender) AtNow(ctx context.Context) error {
+	return s.At(ctx, time.Time{})
+}
+
+func (s *dryRunLineSender) At(_ context.Context, ts time.Time) error {
+	if s.closed {
+		return fmt.Errorf("cannot queue new messages: %w", ErrClosed)
+	}
+	return s.buf.At(ts, !ts.IsZero())
+}
+
+func (s *dryRunLineSender) AtMicros(_ context.Context, ts int64) error {
+	if s.closed {
+		return fmt.Errorf("cannot queue new messages: %w", ErrClosed)
+	}
+	return s.buf.AtMicros(ts)
+}
+
+func (s *dryRunLineSender) AtMillis(_ context.Context, ts int64) error {
+	if s.closed {
+		return fmt.Errorf("cannot queue new messages: %w", ErrClosed)
+	}
+	return s.buf.AtMillis(ts)
+}
+
+func (s *dryRunLineSender) AtRaw(_ context.Context, line []byte) error {
+	if s.closed {
+		return fmt.Errorf("cannot queue new messages: %w", ErrClosed)
+	}
+	return s.buf.AtRaw(line)
+}
+
+func (s *dryRunLineSender) Flush(_ context.Context) error {
+	if s.closed {
+		return fmt.Errorf("cannot flush: %w", ErrClosed)
+	}
+
+	err := s.buf.LastErr()
+	s.buf.ClearLastErr()
+	if err != nil {
+		s.buf.DiscardPendingMsg()
+		return err
+	}
+	if s.buf.HasTable() {
+		s.buf.DiscardPendingMsg()
+		return fmt.Errorf("%w before calling Flush", ErrPendingMessage)
+	}
+
+	_, err = s.buf.WriteTo(&s.flushed)
+	return err
+}
+
+func (s *dryRunLineSender) FlushWithStats(ctx context.Context) (FlushStats, error) {
+	return flushWithStats(&s.buf, func() error {
+		return s.Flush(ctx)
+	})
+}
+
+func (s *dryRunLineSender) Close(ctx context.Context) error {
+	if s.closed {
+		return nil
+	}
+	err := s.Flush(ctx)
+	s.closed = true
+	s.buf.resolveFlush(errClosedBeforeFlush)
+	return err
+}
+
+func (s *dryRunLineSender) Lines() *LineIterator {
+	data := make([]byte, s.flushed.Len())
+	copy(data, s.flushed.Bytes())
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	scanner.Split(scanIlpLines)
+	return &LineIterator{scanner: scanner}
+}
+
+func (s *dryRunLineSender) WriteRows(ctx context.Context, rows []Row) error {
+	return writeRows(ctx, s, rows)
+}
+
+func (s *dryRunLineSender) Write(ctx context.Context, row Row) error {
+	return writeRow(ctx, s, &row)
+}
+
+func (s *dryRunLineSender) WriteStruct(ctx context.Context, table string, v interface{}) error {
+	return writeStruct(ctx, s, table, v)
+}
+
+func (s *dryRunLineSender) RawWriter() io.Writer {
+	if s.raw == nil {
+		s.raw = newRawWriter(&s.buf, nil)
+	}
+	return s.raw
+}
+
+func (s *dryRunLineSender) Checkpoint() Checkpoint {
+	return s.buf.checkpoint()
+}
+
+func (s *dryRunLineSender) Restore(cp Checkpoint) error {
+	return s.buf.restore(cp)
+}
+
+func (s *dryRunLineSender) Config() ConfigSnapshot {
+	return ConfigSnapshot{conf: s.conf}
+}
+
+func (s *dryRunLineSender) PendingFlush() *FlushToken {
+	return s.buf.pendingFlush()
+}
+
+func (s *dryRunLineSender) ServerInfo(_ context.Context) (ServerInfo, error) {
+	return ServerInfo{}, fmt.Errorf("server info is not available in the dry run mode: %w", ErrUnsupportedBySender)
+}
+
+func (s *dryRunLineSender) lineBuffer() *buffer {
+	return &s.buf
+}
+
+// Messages returns a copy of accumulated ILP messages that are not
+// flushed yet. Useful for debugging purposes.
+func (s *dryRunLineSender) Messages() string {
+	return s.buf.Messages()
+}
+
+// MsgCount returns the number of buffered messages
+func (s *dryRunLineSender) MsgCount() int {
+	return s.buf.msgCount()
+}
+
+// BufLen returns the number of bytes written to the buffer.
+func (s *dryRunLineSender) BufLen() int {
+	return s.buf.Len()
+}
@@ -0,0 +1,93 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunSender(t *testing.T) {
+	ctx := context.Background()
+
+	for _, transport := range []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithTcp()} {
+		// No server is listening on the default address.
+		sender, err := qdb.NewLineSender(ctx, transport, qdb.WithDryRun())
+		assert.NoError(t, err)
+
+		err = sender.Table(testTable).Symbol("sym", "foo").Int64Column("a_col", 1).At(ctx, time.Unix(0, 42))
+		assert.NoError(t, err)
+		err = sender.Flush(ctx)
+		assert.NoError(t, err)
+		err = sender.Table(testTable).StringColumn("b_col", "bar").AtNow(ctx)
+		assert.NoError(t, err)
+
+		// Only flushed messages are visible.
+		var lines []string
+		it := sender.(qdb.DryRunSender).Lines()
+		for it.Next() {
+			lines = append(lines, it.Line())
+		}
+		assert.Equal(t, []string{testTable + ",sym=foo a_col=1i 42"}, lines)
+
+		// Close flushes pending messages.
+		err = sender.Close(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, qdb.Messages(sender))
+
+		lines = nil
+		it = sender.(qdb.DryRunSender).Lines()
+		for it.Next() {
+			lines = append(lines, it.Line())
+		}
+		assert.Equal(t, []string{testTable + ",sym=foo a_col=1i 42", testTable + " b_col=\"bar\""}, lines)
+	}
+}
+
+func TestDryRunSenderValidation(t *testing.T) {
+	ctx := context.Background()
+
+	// Transport settings are still validated.
+	_, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithAutoFlushRows(5))
+	assert.ErrorContains(t, err, "autoFlushRows setting is not available")
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDryRun(), qdb.WithMaxBufferSize(8), qdb.WithInitBufferSize(4))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Symbol("sym", "foobar").AtNow(ctx)
+	assert.ErrorContains(t, err, "buffer size exceeded maximum limit")
+
+	sender.Table(testTable)
+	err = sender.Flush(ctx)
+	assert.ErrorContains(t, err, "pending ILP message must be finalized")
+
+	it := sender.(qdb.DryRunSender).Lines()
+	assert.False(t, it.Next())
+}
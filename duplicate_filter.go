@@ -0,0 +1,119 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// DuplicateFilter drops rows that are byte-identical to a row
+// buffered since the last flush, e.g. the ones produced by retried
+// upstream webhooks. Rows are compared by their 64-bit content hash,
+// including the designated timestamp. The suppressed rows are
+// counted.
+//
+// A DuplicateFilter may be shared by multiple senders, see
+// WithDuplicateFilter. Each sender only drops the duplicates of its
+// own buffered rows.
+type DuplicateFilter struct {
+	suppressed int64
+}
+
+// NewDuplicateFilter creates a DuplicateFilter.
+func NewDuplicateFilter() *DuplicateFilter {
+	return &DuplicateFilter{}
+}
+
+// Suppressed returns the number of dropped duplicate rows.
+func (f *DuplicateFilter) Suppressed() int64 {
+	return atomic.LoadInt64(&f.suppressed)
+}
+
+// duplicateMsg reports whether the pending message duplicates one
+// of the buffered messages.
+func (b *buffer) duplicateMsg() bool {
+	if b.dupFilter == nil {
+		return false
+	}
+	if _, ok := b.dupHashes[msgHash(b.Bytes()[b.lastMsgPos():])]; ok {
+		atomic.AddInt64(&b.dupFilter.suppressed, 1)
+		return true
+	}
+	return false
+}
+
+// rememberMsg remembers the hash of the last completed message
+// until the message is flushed or removed from the buffer.
+func (b *buffer) rememberMsg() {
+	if b.dupFilter == nil {
+		return
+	}
+	if b.dupHashes == nil {
+		b.dupHashes = make(map[uint64]struct{})
+	}
+	b.dupHashes[msgHash(b.Bytes()[b.lastMsgStart():b.lastMsgPos()])] = struct{}{}
+}
+
+// forgetMsgs forgets the hashes of the completed messages from i
+// up to, but not including, j. It must be called before the messages
+// are removed from the buffer.
+func (b *buffer) forgetMsgs(i, j int) {
+	if len(b.dupHashes) == 0 {
+		return
+	}
+	data := b.Bytes()
+	for ; i < j; i++ {
+		delete(b.dupHashes, msgHash(data[b.msgStart(i):b.msgStart(i+1)]))
+	}
+}
+
+// rebuildDuplicates remembers the hashes of the completed messages
+// only, e.g. after the buffer is restored from a checkpoint.
+func (b *buffer) rebuildDuplicates() {
+	if b.dupFilter == nil {
+		return
+	}
+	b.clearDuplicates()
+	if b.dupHashes == nil {
+		b.dupHashes = make(map[uint64]struct{})
+	}
+	data := b.Bytes()
+	for i := 0; i < b.msgCount(); i++ {
+		b.dupHashes[msgHash(data[b.msgStart(i):b.msgStart(i+1)])] = struct{}{}
+	}
+}
+
+func (b *buffer) clearDuplicates() {
+	for sum := range b.dupHashes {
+		delete(b.dupHashes, sum)
+	}
+}
+
+func msgHash(msg []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(msg)
+	return h.Sum64()
+}
@@ -0,0 +1,304 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+type encoderConfig struct {
+	table      string
+	transforms map[string]columnTransform
+}
+
+// EncoderOption defines Encoder option.
+type EncoderOption func(*encoderConfig)
+
+// WithEncoderTable sets the table name used by the encoder.
+// Defaults to the struct type name.
+func WithEncoderTable(name string) EncoderOption {
+	return func(c *encoderConfig) {
+		c.table = name
+	}
+}
+
+// fieldWriter writes the field value located at p to the buffer.
+type fieldWriter func(b *buffer, name string, p unsafe.Pointer)
+
+type encoderField struct {
+	name   string
+	offset uintptr
+	kind   fieldKind
+	rkind  reflect.Kind
+	write  fieldWriter
+}
+
+// structEncoder writes values of a struct type. It does not depend
+// on the type parameter of Encoder, so it can be shared via the plan
+// cache.
+type structEncoder struct {
+	typeName   string
+	symbols    []encoderField
+	columns    []encoderField
+	designated *encoderField
+}
+
+func newStructEncoder(typ reflect.Type) (*structEncoder, error) {
+	plan, err := newStructPlan(typ)
+	if err != nil {
+		return nil, err
+	}
+	typ = plan.typ
+	e := &structEncoder{typeName: typ.Name()}
+	for _, f := range plan.symbols {
+		e.symbols = append(e.symbols, newEncoderField(typ, f))
+	}
+	for i, f := range plan.columns {
+		ef := newEncoderField(typ, f)
+		if i == plan.designated {
+			e.designated = &ef
+			continue
+		}
+		e.columns = append(e.columns, ef)
+	}
+	return e, nil
+}
+
+// encode writes the struct located at p as an ILP message.
+func (e *structEncoder) encode(ctx context.Context, s LineSender, table string, p unsafe.Pointer) error {
+	bs, ok := s.(bufferedSender)
+	if !ok {
+		return errors.New("encoder is not supported by the given sender")
+	}
+
+	buf := bs.lineBuffer()
+	buf.Table(table)
+	for i := range e.symbols {
+		f := &e.symbols[i]
+		f.write(buf, f.name, unsafe.Add(p, f.offset))
+	}
+	for i := range e.columns {
+		f := &e.columns[i]
+		f.write(buf, f.name, unsafe.Add(p, f.offset))
+	}
+	if e.designated != nil {
+		return s.At(ctx, *(*time.Time)(unsafe.Add(p, e.designated.offset)))
+	}
+	return s.AtNow(ctx)
+}
+
+// Encoder writes values of a struct type T as ILP messages. The
+// field to column mapping is defined by the "qdb" struct tags, see
+// SchemaFromStruct for the tag format.
+//
+// The encoding plan is built once, when the encoder is created, so
+// that no reflection is involved in Encode calls. An Encoder is safe
+// for concurrent use, but the senders passed to it are not.
+//
+// Example usage:
+//
+//	enc, err := qdb.NewEncoder[Trade](qdb.WithEncoderTable("trades"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	err = enc.Encode(ctx, sender, Trade{Symbol: "ETH-USD", Price: 2615.54, Ts: time.Now()})
+type Encoder[T any] struct {
+	table string
+	ptr   bool
+	enc   *structEncoder
+}
+
+// NewEncoder creates an encoder for T, which must be a struct type
+// or a pointer to a struct type. Encoding plans are shared with other
+// encoders and WriteStruct calls via the plan cache.
+func NewEncoder[T any](opts ...EncoderOption) (*Encoder[T], error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	enc, err := globalPlanCache.get(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := encoderConfig{table: enc.typeName}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if conf.table == "" {
+		return nil, errors.New("table name is not specified: use WithEncoderTable")
+	}
+	enc, err = enc.withTransforms(conf.transforms)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder[T]{
+		table: conf.table,
+		ptr:   typ.Kind() == reflect.Pointer,
+		enc:   enc,
+	}, nil
+}
+
+func newEncoderField(typ reflect.Type, f structField) encoderField {
+	sf := typ.Field(f.index)
+	return encoderField{
+		name:   f.name,
+		offset: sf.Offset,
+		kind:   f.kind,
+		rkind:  sf.Type.Kind(),
+		write:  newFieldWriter(f.kind, sf.Type.Kind()),
+	}
+}
+
+// newFieldWriter returns a writer for the given field kind. The
+// pointer casts are safe, since the kinds are validated by
+// newStructPlan.
+func newFieldWriter(kind fieldKind, k reflect.Kind) fieldWriter {
+	switch kind {
+	case fieldSymbol:
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.Symbol(name, *(*string)(p))
+		}
+	case fieldString:
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.StringColumn(name, *(*string)(p))
+		}
+	case fieldBool:
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.BoolColumn(name, *(*bool)(p))
+		}
+	case fieldTimestamp:
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.TimestampColumn(name, *(*time.Time)(p))
+		}
+	case fieldLong256:
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			// nil values are treated as nulls.
+			if v := *(**big.Int)(p); v != nil {
+				b.Long256Column(name, v)
+			}
+		}
+	case fieldFloat:
+		if k == reflect.Float32 {
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Float64Column(name, float64(*(*float32)(p)))
+			}
+		}
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.Float64Column(name, *(*float64)(p))
+		}
+	case fieldUint:
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.Int64Column(name, int64(*(*uint32)(p)))
+		}
+	case fieldInt:
+		switch k {
+		case reflect.Int8:
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Int64Column(name, int64(*(*int8)(p)))
+			}
+		case reflect.Int16:
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Int64Column(name, int64(*(*int16)(p)))
+			}
+		case reflect.Uint8:
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Int64Column(name, int64(*(*uint8)(p)))
+			}
+		case reflect.Int32:
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Int64Column(name, int64(*(*int32)(p)))
+			}
+		case reflect.Uint16:
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Int64Column(name, int64(*(*uint16)(p)))
+			}
+		case reflect.Int:
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Int64Column(name, int64(*(*int)(p)))
+			}
+		case reflect.Int64:
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Int64Column(name, *(*int64)(p))
+			}
+		}
+	}
+	panic(fmt.Sprintf("unexpected field kind: %d, %s", kind, k))
+}
+
+// Encode writes v as an ILP message to the sender's buffer and
+// finalizes it with the designated timestamp field, if any, or
+// without a timestamp otherwise.
+//
+// If the underlying buffer reaches configured capacity or the
+// number of buffered messages exceeds the auto-flush trigger, this
+// method also sends the accumulated messages.
+func (e *Encoder[T]) Encode(ctx context.Context, s LineSender, v T) error {
+	p := unsafe.Pointer(&v)
+	if e.ptr {
+		p = *(*unsafe.Pointer)(p)
+		if p == nil {
+			return errors.New("cannot encode a nil pointer")
+		}
+	}
+	return e.enc.encode(ctx, s, e.table, p)
+}
+
+// writeStruct writes an arbitrary struct value, or a pointer to it,
+// using the cached encoding plan of its type.
+func writeStruct(ctx context.Context, s LineSender, table string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return errors.New("expected a struct, got nil")
+	}
+	enc, err := globalPlanCache.get(rv.Type())
+	if err != nil {
+		return err
+	}
+	if table == "" {
+		table = enc.typeName
+	}
+	if table == "" {
+		return errors.New("table name is not specified")
+	}
+
+	var p unsafe.Pointer
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return errors.New("cannot encode a nil pointer")
+		}
+		p = rv.UnsafePointer()
+	} else {
+		// Struct values boxed into an interface are not addressable,
+		// so the value has to be copied.
+		cp := reflect.New(rv.Type())
+		cp.Elem().Set(rv)
+		p = cp.UnsafePointer()
+	}
+	return enc.encode(ctx, s, table, p)
+}
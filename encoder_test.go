@@ -0,0 +1,251 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	ctx := context.Background()
+
+	trade := testTrade{
+		Price:   2615.54,
+		Symbol:  "ETH-USD",
+		Amount:  42,
+		Side:    "buy",
+		Ts:      time.Unix(0, 1000),
+		Filled:  true,
+		Hash:    big.NewInt(255),
+		Created: time.UnixMicro(2),
+		Ignored: "foo",
+	}
+
+	expected, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	err = expected.Table("trades").
+		Symbol("symbol", "ETH-USD").
+		Symbol("side", "buy").
+		Float64Column("price", 2615.54).
+		Int64Column("amount", 42).
+		BoolColumn("Filled", true).
+		Long256Column("hash", big.NewInt(255)).
+		TimestampColumn("created", time.UnixMicro(2)).
+		At(ctx, time.Unix(0, 1000))
+	assert.NoError(t, err)
+
+	enc, err := qdb.NewEncoder[testTrade](qdb.WithEncoderTable("trades"))
+	assert.NoError(t, err)
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	err = enc.Encode(ctx, sender, trade)
+	assert.NoError(t, err)
+	assert.Equal(t, qdb.Messages(expected), qdb.Messages(sender))
+
+	ptrEnc, err := qdb.NewEncoder[*testTrade](qdb.WithEncoderTable("trades"))
+	assert.NoError(t, err)
+	sender, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	err = ptrEnc.Encode(ctx, sender, &trade)
+	assert.NoError(t, err)
+	assert.Equal(t, qdb.Messages(expected), qdb.Messages(sender))
+
+	err = ptrEnc.Encode(ctx, sender, nil)
+	assert.ErrorContains(t, err, "cannot encode a nil pointer")
+}
+
+func TestEncoderDefaultsAndErrors(t *testing.T) {
+	ctx := context.Background()
+
+	type sensor struct {
+		Id     string  `qdb:"id,symbol"`
+		Temp   float32 `qdb:"temp"`
+		Uptime uint32  `qdb:"uptime"`
+		Level  int8    `qdb:"level"`
+	}
+
+	enc, err := qdb.NewEncoder[sensor]()
+	assert.NoError(t, err)
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	err = enc.Encode(ctx, sender, sensor{Id: "a", Temp: 1.5, Uptime: 3, Level: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, "sensor,id=a temp=1.5,uptime=3i,level=-1i\n", qdb.Messages(sender))
+
+	// Validation errors are reported by Encode.
+	badEnc, err := qdb.NewEncoder[sensor](qdb.WithEncoderTable("bad?table"))
+	assert.NoError(t, err)
+	err = badEnc.Encode(ctx, sender, sensor{Id: "a"})
+	assert.ErrorContains(t, err, "table name contains an illegal char")
+
+	_, err = qdb.NewEncoder[int]()
+	assert.ErrorContains(t, err, "expected a struct")
+
+	_, err = qdb.NewEncoder[struct {
+		A int `qdb:"a"`
+	}]()
+	assert.ErrorContains(t, err, "table name is not specified")
+}
+
+func TestWriteStruct(t *testing.T) {
+	ctx := context.Background()
+
+	type point struct {
+		X int64 `qdb:"x"`
+		Y int64 `qdb:"y"`
+	}
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	before := qdb.GetPlanCacheStats()
+
+	err = sender.WriteStruct(ctx, "", point{X: 1, Y: 2})
+	assert.NoError(t, err)
+	err = sender.WriteStruct(ctx, "points", &point{X: 3, Y: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, "point x=1i,y=2i\npoints x=3i,y=4i\n", qdb.Messages(sender))
+
+	after := qdb.GetPlanCacheStats()
+	assert.Equal(t, before.Misses+1, after.Misses)
+	assert.Equal(t, before.Hits+1, after.Hits)
+
+	err = sender.WriteStruct(ctx, "points", (*point)(nil))
+	assert.ErrorContains(t, err, "cannot encode a nil pointer")
+	err = sender.WriteStruct(ctx, "points", 42)
+	assert.ErrorContains(t, err, "expected a struct")
+	err = sender.WriteStruct(ctx, "points", nil)
+	assert.ErrorContains(t, err, "expected a struct")
+}
+
+func TestWriteStructConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+			for j := 0; j < 100; j++ {
+				err = sender.WriteStruct(ctx, "trades", testTrade{Symbol: "ETH-USD", Price: 1})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPlanCacheCapacity(t *testing.T) {
+	ctx := context.Background()
+	defer qdb.SetPlanCacheCapacity(qdb.GetPlanCacheStats().Capacity)
+
+	type a struct {
+		V int64 `qdb:"v"`
+	}
+	type b struct {
+		V int64 `qdb:"v"`
+	}
+
+	assert.Error(t, qdb.SetPlanCacheCapacity(0))
+	assert.NoError(t, qdb.SetPlanCacheCapacity(1))
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	before := qdb.GetPlanCacheStats()
+	assert.NoError(t, sender.WriteStruct(ctx, "", a{V: 1}))
+	assert.NoError(t, sender.WriteStruct(ctx, "", b{V: 2}))
+
+	after := qdb.GetPlanCacheStats()
+	assert.Equal(t, 1, after.Size)
+	assert.Equal(t, 1, after.Capacity)
+	assert.Less(t, before.Evictions, after.Evictions)
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	ctx := context.Background()
+	enc, _ := qdb.NewEncoder[testTrade](qdb.WithEncoderTable("trades"))
+	sender, _ := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	trade := testTrade{Price: 2615.54, Symbol: "ETH-USD", Amount: 42, Side: "buy", Ts: time.Now()}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		enc.Encode(ctx, sender, trade)
+		if i%1000 == 0 {
+			sender.Flush(ctx)
+		}
+	}
+}
+
+func TestEncoderTransforms(t *testing.T) {
+	ctx := context.Background()
+
+	type sensor struct {
+		Id     string  `qdb:"id,symbol"`
+		Temp   float32 `qdb:"temp"`
+		Uptime uint32  `qdb:"uptime"`
+		Level  int8    `qdb:"level"`
+	}
+
+	enc, err := qdb.NewEncoder[sensor](
+		qdb.WithEncoderStringTransform("id", strings.ToLower),
+		qdb.WithEncoderFloatTransform("temp", func(c float64) float64 { return c*9/5 + 32 }),
+		qdb.WithEncoderIntTransform("uptime", func(s int64) int64 { return s * 1000 }),
+	)
+	assert.NoError(t, err)
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	err = enc.Encode(ctx, sender, sensor{Id: "ABC", Temp: 100, Uptime: 3, Level: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, "sensor,id=abc temp=212,uptime=3000i,level=-1i\n", qdb.Messages(sender))
+
+	// Encoders without transforms share the plan and are not affected.
+	plain, err := qdb.NewEncoder[sensor]()
+	assert.NoError(t, err)
+	sender, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	err = plain.Encode(ctx, sender, sensor{Id: "ABC", Temp: 100, Uptime: 3, Level: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, "sensor,id=ABC temp=100,uptime=3i,level=-1i\n", qdb.Messages(sender))
+
+	_, err = qdb.NewEncoder[sensor](qdb.WithEncoderFloatTransform("id", math.Round))
+	assert.ErrorContains(t, err, "transformer type doesn't match the column type: id")
+	_, err = qdb.NewEncoder[sensor](qdb.WithEncoderFloatTransform("foo", math.Round))
+	assert.ErrorContains(t, err, "transformed column is not found: foo")
+}
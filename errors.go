@@ -0,0 +1,116 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidMessage is wrapped by all errors caused by an attempt
+// to construct an invalid ILP message, e.g. duplicate calls to the
+// Table method or illegal chars found in a table or column name.
+// The more specific errors below wrap it as well, so callers can
+// branch on the error kind with errors.Is.
+var ErrInvalidMessage = errors.New("invalid message")
+
+var (
+	// ErrMissingTable is returned when a message has no table name.
+	ErrMissingTable = fmt.Errorf("table name was not provided: %w", ErrInvalidMessage)
+	// ErrTableAlreadySet is returned when Table is called twice for
+	// the same message.
+	ErrTableAlreadySet = fmt.Errorf("table name already provided: %w", ErrInvalidMessage)
+	// ErrSymbolAfterField is returned when a symbol is added after
+	// a column and symbol reordering is off.
+	ErrSymbolAfterField = fmt.Errorf("symbols have to be written before any other column: %w", ErrInvalidMessage)
+	// ErrEmptyMessage is returned when a message has neither symbols
+	// nor columns.
+	ErrEmptyMessage = fmt.Errorf("no symbols or columns were provided: %w", ErrInvalidMessage)
+	// ErrInvalidName is returned for empty, too long or otherwise
+	// illegal table and column names.
+	ErrInvalidName = fmt.Errorf("invalid name: %w", ErrInvalidMessage)
+	// ErrValueOutOfRange is returned for values that can't be
+	// represented by the column type.
+	ErrValueOutOfRange = fmt.Errorf("value is out of range: %w", ErrInvalidMessage)
+	// ErrUnsupportedType is returned for row values of unsupported
+	// Go types.
+	ErrUnsupportedType = fmt.Errorf("unsupported type: %w", ErrInvalidMessage)
+	// ErrTimestampOutOfOrder is returned by senders created with
+	// WithMonotonicTimestamps for timestamps going backwards.
+	ErrTimestampOutOfOrder = fmt.Errorf("timestamp is out of order: %w", ErrInvalidMessage)
+	// ErrSymbolNotAllowed is returned by SymbolSet for values
+	// outside of the allowed set.
+	ErrSymbolNotAllowed = fmt.Errorf("symbol is not in the allowed set: %w", ErrInvalidMessage)
+	// ErrControlChar is returned by senders created with
+	// ControlCharsReject for string values with control chars.
+	ErrControlChar = fmt.Errorf("control char in string value: %w", ErrInvalidMessage)
+	// ErrTooManyColumns is returned for rows exceeding the column
+	// count limit reported by the server, see WithFeatureNegotiation.
+	ErrTooManyColumns = fmt.Errorf("too many columns: %w", ErrInvalidMessage)
+	// ErrInvalidLine is returned for malformed raw ILP lines.
+	ErrInvalidLine = fmt.Errorf("invalid ILP line: %w", ErrInvalidMessage)
+	// ErrColumnTypeMismatch is returned by senders created with
+	// WithSchemaRegistry for values conflicting with the registered
+	// column types.
+	ErrColumnTypeMismatch = fmt.Errorf("column type mismatch: %w", ErrInvalidMessage)
+	// ErrUnknownColumn is returned by senders created with
+	// WithStrictSchema for columns missing in the registered schema.
+	ErrUnknownColumn = fmt.Errorf("column is not in the registered schema: %w", ErrInvalidMessage)
+)
+
+var (
+	// ErrPendingMessage is returned when a message is left
+	// unfinished before a call that requires complete messages,
+	// such as Flush.
+	ErrPendingMessage = errors.New("pending ILP message must be finalized with At or AtNow")
+	// ErrClosed is returned when a closed sender is used.
+	ErrClosed = errors.New("LineSender is closed")
+	// ErrBufferFull is returned when the buffer grows beyond
+	// the max buffer size.
+	ErrBufferFull = errors.New("buffer size exceeded maximum limit")
+	// ErrMaxPendingRows is returned by senders created with
+	// WithMaxPendingRows and PendingRowsPolicyError when the limit
+	// is reached.
+	ErrMaxPendingRows = errors.New("max pending rows limit reached")
+	// ErrDeliveryTimeout is returned by senders created with
+	// WithDeliveryTimeout for batches that couldn't be delivered
+	// in time.
+	ErrDeliveryTimeout = errors.New("delivery timeout reached")
+	// ErrServerDisconnected is returned by the TCP sender once it
+	// detects that the server has closed the connection, e.g. due to
+	// an ILP parse error. The buffered messages are kept and sent
+	// over a new connection on the next flush. Messages flushed
+	// before the disconnect may have been lost.
+	ErrServerDisconnected = errors.New("server closed the connection")
+	// ErrMemoryLimit is returned by senders created with
+	// WithMemoryLimit when the process-wide memory limit is
+	// exceeded, see WithMemoryOverflowPolicy.
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+	// ErrUnsupportedBySender is returned when a feature is not
+	// available in the sender type, e.g. ServerInfo of the TCP
+	// sender. Unlike ErrUnsupportedByServer, it doesn't depend on
+	// the server.
+	ErrUnsupportedBySender = errors.New("feature is not supported by the sender")
+)
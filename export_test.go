@@ -24,6 +24,12 @@
 
 package questdb
 
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
 type (
 	Buffer           = buffer
 	ConfigData       = configData
@@ -48,31 +54,50 @@ func ConfFromStr(conf string) (*LineSenderConfig, error) {
 }
 
 func Messages(s LineSender) string {
-	if hs, ok := s.(*httpLineSender); ok {
-		return hs.Messages()
-	}
-	if ts, ok := s.(*tcpLineSender); ok {
-		return ts.Messages()
-	}
-	panic("unexpected struct")
+	return s.(bufferedSender).lineBuffer().Messages()
 }
 
 func MsgCount(s LineSender) int {
-	if hs, ok := s.(*httpLineSender); ok {
-		return hs.MsgCount()
-	}
-	if ts, ok := s.(*tcpLineSender); ok {
-		return ts.MsgCount()
-	}
-	panic("unexpected struct")
+	return s.(bufferedSender).lineBuffer().msgCount()
 }
 
 func BufLen(s LineSender) int {
-	if hs, ok := s.(*httpLineSender); ok {
-		return hs.BufLen()
-	}
-	if ts, ok := s.(*tcpLineSender); ok {
-		return ts.BufLen()
-	}
-	panic("unexpected struct")
+	return s.(bufferedSender).lineBuffer().Len()
+}
+
+func BufCap(s LineSender) int {
+	return s.(bufferedSender).lineBuffer().Cap()
+}
+
+func BackoffDelay(b Backoff, attempt int) time.Duration {
+	return b.delay(attempt)
+}
+
+func HttpTransport(s LineSender) *http.Transport {
+	return s.(*httpLineSender).client.Transport.(*http.Transport)
+}
+
+func ConfigAddress(cfg ConfigSnapshot) (addr string, http, tls bool) {
+	return cfg.conf.address, cfg.conf.senderType == httpSenderType, cfg.conf.tlsMode != tlsDisabled
+}
+
+func (b *Buffer) MsgCount() int {
+	return b.msgCount()
+}
+
+func (b *Buffer) Checkpoint() Checkpoint {
+	return b.checkpoint()
+}
+
+func (b *Buffer) Restore(cp Checkpoint) error {
+	return b.restore(cp)
+}
+
+func (b *Buffer) EnableTimestampGuard(tolerance time.Duration) {
+	b.enableTimestampGuard(tolerance, nil)
+}
+
+func ResetDefault() {
+	defaultSender = nil
+	defaultSenderOnce = sync.Once{}
 }
@@ -0,0 +1,84 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import "context"
+
+// SenderFactory creates line senders with the same configuration.
+// The configuration is validated once, when the factory is created,
+// so pools, sharded senders and test harnesses can create senders
+// on demand without dealing with the options.
+//
+// SenderFactory is immutable, so it's safe for concurrent use.
+type SenderFactory struct {
+	conf lineSenderConfig
+}
+
+// NewSenderFactory creates a factory of line senders configured
+// with the given options. See NewLineSender for the details.
+func NewSenderFactory(opts ...LineSenderOption) (*SenderFactory, error) {
+	conf := &lineSenderConfig{}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	return newSenderFactory(conf)
+}
+
+// SenderFactoryFromConf creates a factory of line senders configured
+// with the given config string. See LineSenderFromConf for the config
+// string format.
+func SenderFactoryFromConf(conf string) (*SenderFactory, error) {
+	c, err := confFromStr(conf)
+	if err != nil {
+		return nil, err
+	}
+	return newSenderFactory(c)
+}
+
+func newSenderFactory(conf *lineSenderConfig) (*SenderFactory, error) {
+	err := sanitizeConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &SenderFactory{conf: *conf}, nil
+}
+
+// NewSender creates a new sender and connects it to the server,
+// if the transport requires so.
+func (f *SenderFactory) NewSender(ctx context.Context) (LineSender, error) {
+	conf := f.conf
+	return newLineSender(ctx, &conf)
+}
+
+// NewPool creates a pool of at most maxSenders senders created
+// by the factory.
+func (f *SenderFactory) NewPool(maxSenders int) (*LineSenderPool, error) {
+	return newLineSenderPool(maxSenders, f.NewSender)
+}
+
+// Config returns the configuration of the created senders.
+func (f *SenderFactory) Config() ConfigSnapshot {
+	return ConfigSnapshot{conf: f.conf}
+}
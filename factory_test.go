@@ -0,0 +1,73 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSenderFactory(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	f, err := qdb.SenderFactoryFromConf("tcp::addr=" + srv.Addr() + ";")
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		sender, err := f.NewSender(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, f.Config(), sender.Config())
+
+		err = sender.Table(testTable).Int64Column("a_col", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+		err = sender.Flush(ctx)
+		assert.NoError(t, err)
+		err = sender.Close(ctx)
+		assert.NoError(t, err)
+		expectLines(t, srv.BackCh, []string{fmt.Sprintf("%s a_col=%di", testTable, i)})
+	}
+
+	pool, err := f.NewPool(1)
+	assert.NoError(t, err)
+	sender, err := pool.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, f.Config(), sender.Config())
+	pool.Release(sender)
+	assert.NoError(t, pool.Close(ctx))
+
+	// The config is validated eagerly.
+	_, err = qdb.NewSenderFactory(qdb.WithHttp(), qdb.WithInitBufferSize(-1))
+	assert.ErrorContains(t, err, "initial buffer size is negative")
+	_, err = qdb.NewSenderFactory()
+	assert.ErrorContains(t, err, "sender type is not specified")
+}
@@ -0,0 +1,126 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+)
+
+var errClosedBeforeFlush = errors.New("sender was closed before the messages were flushed")
+
+// FlushToken is resolved once the messages it covers are flushed,
+// whether it's done with an explicit Flush call or by auto-flush.
+// It allows waiting for specific messages to be delivered without
+// forcing a flush.
+//
+//	sender.Table("trades").Float64Column("price", 42.5).AtNow(ctx)
+//	token := sender.PendingFlush()
+//	// ...
+//	if err := token.Result(ctx); err != nil {
+//		// the messages were not delivered
+//	}
+type FlushToken struct {
+	done chan struct{}
+	err  error
+	// Tokens resolved along with this one.
+	chained []*FlushToken
+}
+
+func newFlushToken() *FlushToken {
+	return &FlushToken{done: make(chan struct{})}
+}
+
+// Done returns a channel that is closed once the token is resolved.
+func (t *FlushToken) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the flush error. It returns nil until the token
+// is resolved.
+func (t *FlushToken) Err() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// Result waits until the token is resolved and returns the flush
+// error, if any. If the context is done first, the context error
+// is returned.
+func (t *FlushToken) Result(ctx context.Context) error {
+	select {
+	case <-t.done:
+		return t.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *FlushToken) resolve(err error) {
+	t.err = err
+	close(t.done)
+	for _, c := range t.chained {
+		c.resolve(err)
+	}
+	t.chained = nil
+}
+
+// chain makes the other token resolve along with this one. Must be
+// called by the goroutine owning the sender that resolves the token.
+func (t *FlushToken) chain(other *FlushToken) {
+	select {
+	case <-t.done:
+		other.resolve(t.err)
+	default:
+		t.chained = append(t.chained, other)
+	}
+}
+
+// pendingFlush returns the token covering the completed messages
+// in the buffer. A resolved token is returned if there are none.
+func (b *buffer) pendingFlush() *FlushToken {
+	if b.flushToken == nil {
+		b.flushToken = newFlushToken()
+		if b.msgCount() == 0 {
+			t := b.flushToken
+			b.flushToken = nil
+			t.resolve(nil)
+			return t
+		}
+	}
+	return b.flushToken
+}
+
+// resolveFlush resolves the pending flush token, if any, with
+// the outcome of a flush.
+func (b *buffer) resolveFlush(err error) {
+	if b.flushToken != nil {
+		b.flushToken.resolve(err)
+		b.flushToken = nil
+	}
+}
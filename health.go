@@ -0,0 +1,258 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthInterval = 5 * time.Second
+	// DefaultHealthPath is the health check path of the QuestDB
+	// minimal HTTP server, which listens on port 9003 by default.
+	DefaultHealthPath = "/status"
+)
+
+// HealthState is the server health as seen by a HealthMonitor.
+type HealthState int64
+
+const (
+	// HealthUnknown means that no probe has completed so far.
+	HealthUnknown HealthState = 0
+	// HealthUp means that the latest probe succeeded.
+	HealthUp HealthState = 1
+	// HealthDown means that the failure threshold was reached.
+	HealthDown HealthState = 2
+)
+
+// String returns the state name.
+func (s HealthState) String() string {
+	switch s {
+	case HealthUnknown:
+		return "unknown"
+	case HealthUp:
+		return "up"
+	case HealthDown:
+		return "down"
+	default:
+		return fmt.Sprintf("HealthState(%d)", int64(s))
+	}
+}
+
+// HealthProbe checks the server health. A nil error means that
+// the server is healthy.
+type HealthProbe func(ctx context.Context) error
+
+// HttpHealthProbe returns a probe sending GET requests to the given
+// path with the client's address, authentication and TLS settings.
+// Any 2xx response means that the server is healthy. Use
+// DefaultHealthPath when the client points to the minimal HTTP
+// server or "/ping" for the main HTTP server.
+func HttpHealthProbe(c *RestClient, path string) HealthProbe {
+	return func(ctx context.Context) error {
+		resp, err := c.get(ctx, path, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("health check failed: %d: %s", resp.StatusCode, resp.Status)
+		}
+		return nil
+	}
+}
+
+// TcpHealthProbe returns a probe that opens and closes a TCP
+// connection to the given address, e.g. the ILP/TCP port.
+func TcpHealthProbe(address string) HealthProbe {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HealthMonitorConfig configures a HealthMonitor.
+type HealthMonitorConfig struct {
+	// Interval between two consecutive probes. Defaults to 5 seconds.
+	Interval time.Duration
+	// Timeout of a single probe. Defaults to Interval.
+	Timeout time.Duration
+	// FailureThreshold is the number of consecutive failed probes
+	// after which the server is considered down. Defaults to 1.
+	FailureThreshold int
+}
+
+// HealthStats holds the current health and the latest probe results.
+type HealthStats struct {
+	State HealthState
+	// Since is the time of the latest state change.
+	Since time.Time
+	// LastProbe is the time of the latest probe.
+	LastProbe time.Time
+	// LastErr is the error of the latest probe, if it failed.
+	LastErr error
+	// Failures is the number of consecutive failed probes.
+	Failures int
+}
+
+// HealthMonitor periodically probes the server in a background
+// goroutine and notifies the subscribers on health state changes.
+type HealthMonitor struct {
+	probe  HealthProbe
+	conf   HealthMonitorConfig
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	stats   HealthStats
+	subs    map[int]func(from, to HealthState)
+	nextSub int
+}
+
+// StartHealthMonitor starts a monitor that runs the probe right away
+// and then with the configured interval. The monitor must be stopped
+// with the Stop method.
+func StartHealthMonitor(probe HealthProbe, conf HealthMonitorConfig) *HealthMonitor {
+	if conf.Interval <= 0 {
+		conf.Interval = defaultHealthInterval
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = conf.Interval
+	}
+	if conf.FailureThreshold <= 0 {
+		conf.FailureThreshold = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &HealthMonitor{
+		probe:  probe,
+		conf:   conf,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		stats:  HealthStats{Since: time.Now()},
+		subs:   make(map[int]func(from, to HealthState)),
+	}
+	go m.run(ctx)
+	return m
+}
+
+func (m *HealthMonitor) run(ctx context.Context) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.conf.Interval)
+	defer ticker.Stop()
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *HealthMonitor) check(ctx context.Context) {
+	probeCtx, cancel := context.WithTimeout(ctx, m.conf.Timeout)
+	err := m.probe(probeCtx)
+	cancel()
+	if ctx.Err() != nil {
+		// The monitor was stopped.
+		return
+	}
+
+	m.mu.Lock()
+	from := m.stats.State
+	to := from
+	m.stats.LastProbe = time.Now()
+	m.stats.LastErr = err
+	if err == nil {
+		m.stats.Failures = 0
+		to = HealthUp
+	} else {
+		m.stats.Failures++
+		if m.stats.Failures >= m.conf.FailureThreshold {
+			to = HealthDown
+		}
+	}
+	var subs []func(from, to HealthState)
+	if to != from {
+		m.stats.State = to
+		m.stats.Since = m.stats.LastProbe
+		for _, fn := range m.subs {
+			subs = append(subs, fn)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(from, to)
+	}
+}
+
+// State returns the current health state.
+func (m *HealthMonitor) State() HealthState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats.State
+}
+
+// Stats returns the current health and the latest probe results.
+func (m *HealthMonitor) Stats() HealthStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Subscribe registers a function called from the monitor goroutine
+// on each state change. The function should return quickly, as it
+// delays the next probe. The returned function unsubscribes it.
+func (m *HealthMonitor) Subscribe(fn func(from, to HealthState)) (unsubscribe func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.nextSub
+	m.nextSub++
+	m.subs[id] = fn
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subs, id)
+	}
+}
+
+// Stop stops the monitor and waits for the background goroutine
+// to exit.
+func (m *HealthMonitor) Stop() {
+	m.cancel()
+	<-m.done
+}
@@ -37,17 +37,25 @@ type HttpError struct {
 	Message string `json:"message"`
 	Line    int    `json:"line,omitempty"`
 	ErrorId string `json:"errorId"`
+	// Row is the rejected ILP line, as sent and without the trailing
+	// newline. Lines longer than 256 bytes are truncated and end
+	// with "...". Empty if the server didn't report the line number.
+	Row string `json:"-"`
 }
 
 // Error returns full error message string.
 func (e *HttpError) Error() string {
-	return fmt.Sprintf("%d %s id: %s, code: %s, line: %d",
+	msg := fmt.Sprintf("%d %s id: %s, code: %s, line: %d",
 		e.httpStatus,
 		e.Message,
 		e.ErrorId,
 		e.Code,
 		e.Line,
 	)
+	if e.Row != "" {
+		msg += ", row: " + e.Row
+	}
+	return msg
 }
 
 // HttpStatus returns error HTTP status code.
@@ -55,6 +63,101 @@ func (e *HttpError) HttpStatus() int {
 	return e.httpStatus
 }
 
+// QueryError is a server-sent error message for a rejected
+// SQL statement.
+type QueryError struct {
+	httpStatus int
+
+	Query    string `json:"query"`
+	Message  string `json:"error"`
+	Position int    `json:"position"`
+}
+
+// Error returns full error message string.
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%d %s position: %d, query: %s",
+		e.httpStatus,
+		e.Message,
+		e.Position,
+		e.Query,
+	)
+}
+
+// HttpStatus returns error HTTP status code.
+func (e *QueryError) HttpStatus() int {
+	return e.httpStatus
+}
+
+// FlushReport describes a batch partially accepted by the server.
+type FlushReport struct {
+	// Accepted is the number of rows committed by the server.
+	Accepted int
+	// Rejected holds the errors of the rejected rows in the order
+	// of their indexes. Indexes are positions in the flushed batch.
+	Rejected []RowError
+}
+
+// PartialFlushError is returned by the HTTP sender created with
+// WithPartialFlush when the server reports per-line errors for a
+// batch, i.e. it has committed the valid rows and rejected the
+// invalid ones. The accepted rows are not retried, while the
+// rejected ones are passed to the dead-letter handler, if any, see
+// WithDeadLetterHandler.
+//
+// No current QuestDB server sends per-line errors: it reports the
+// first error as an *HttpError and rejects the whole batch.
+type PartialFlushError struct {
+	Report FlushReport
+	// Err is the server-sent error.
+	Err *HttpError
+}
+
+// Error returns full error message string.
+func (e *PartialFlushError) Error() string {
+	return fmt.Sprintf("%d of %d rows rejected, first: %v: %v",
+		len(e.Report.Rejected),
+		len(e.Report.Rejected)+e.Report.Accepted,
+		&e.Report.Rejected[0],
+		e.Err,
+	)
+}
+
+// Unwrap returns the server-sent error.
+func (e *PartialFlushError) Unwrap() error {
+	return e.Err
+}
+
+// httpLineErrors holds the per-line errors of a response.
+type httpLineErrors struct {
+	Errors []struct {
+		Line    int    `json:"line"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// ImportError is a server-sent error message for a rejected
+// file import.
+type ImportError struct {
+	httpStatus int
+
+	Table   string
+	Message string
+}
+
+// Error returns full error message string.
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%d %s table: %s",
+		e.httpStatus,
+		e.Message,
+		e.Table,
+	)
+}
+
+// HttpStatus returns error HTTP status code.
+func (e *ImportError) HttpStatus() int {
+	return e.httpStatus
+}
+
 // RetryTimeoutError is error indicating failed flush retry attempt.
 type RetryTimeoutError struct {
 	LastErr error
@@ -69,6 +172,29 @@ func NewRetryTimeoutError(timeout time.Duration, lastError error) *RetryTimeoutE
 	}
 }
 
+// MaxRetriesError is error indicating that a flush failed after
+// the maximum number of retries.
+type MaxRetriesError struct {
+	LastErr error
+	// Attempts is the number of sent requests, including
+	// the first one.
+	Attempts int
+}
+
+// Error returns full error message string.
+func (e *MaxRetriesError) Error() string {
+	msg := fmt.Sprintf("max retries reached after %d attempts.", e.Attempts)
+	if e.LastErr != nil {
+		msg += " " + e.LastErr.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *MaxRetriesError) Unwrap() error {
+	return e.LastErr
+}
+
 // Error returns full error message string.
 func (e *RetryTimeoutError) Error() string {
 	msg := fmt.Sprintf("retry timeout reached: %s.", e.Timeout)
@@ -0,0 +1,112 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// httpKeepAlive pings the server from a background goroutine once
+// no request was sent for the interval, so that the pooled
+// connection stays open and warm between infrequent flushes.
+type httpKeepAlive struct {
+	interval time.Duration
+	// lastRequest is the time of the latest request in Unix nanos.
+	lastRequest atomic.Int64
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+func newHttpKeepAlive(interval time.Duration) *httpKeepAlive {
+	if interval <= 0 {
+		return nil
+	}
+	ka := &httpKeepAlive{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	ka.touch()
+	return ka
+}
+
+// touch records a request sent to the server.
+func (ka *httpKeepAlive) touch() {
+	if ka != nil {
+		ka.lastRequest.Store(time.Now().UnixNano())
+	}
+}
+
+func (ka *httpKeepAlive) run(ping func()) {
+	defer close(ka.done)
+
+	ticker := time.NewTicker(ka.interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ka.stop:
+			return
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, ka.lastRequest.Load())) >= ka.interval {
+			ping()
+			ka.touch()
+		}
+	}
+}
+
+// close stops the background goroutine and waits for it to exit.
+func (ka *httpKeepAlive) close() {
+	if ka != nil {
+		close(ka.stop)
+		<-ka.done
+	}
+}
+
+// ping sends a GET /ping request over a pooled connection. Errors
+// are ignored, since a failed ping only means that the next flush
+// opens a new connection.
+func (s *httpLineSender) ping() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(s.trace.withClientTrace(ctx), http.MethodGet, s.pingUri, nil)
+	if err != nil {
+		return
+	}
+	setAuthHeader(req, s.user, s.pass, s.token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.trace.event("keep-alive ping failed: %v", err)
+		return
+	}
+	// Drain the body, so that the connection is reused.
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	s.trace.event("keep-alive ping: %s", resp.Status)
+}
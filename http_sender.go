@@ -25,15 +25,21 @@
 package questdb
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
-	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -66,8 +72,23 @@ var (
 	// We use a shared http transport to pool connections
 	// across HttpLineSenders
 	globalTransport *globalHttpTransport = &globalHttpTransport{transport: newHttpTransport()}
+
+	// Senders with custom connection pool settings or HTTP/2
+	// share transports with the same settings.
+	tunedTransportsMu sync.Mutex
+	tunedTransports   = make(map[httpPoolKey]*globalHttpTransport)
 )
 
+// httpPoolKey identifies transports with the same connection
+// pool settings.
+type httpPoolKey struct {
+	http2           bool
+	maxIdleConns    int
+	maxConnsPerHost int
+	idleConnTimeout time.Duration
+	fallbackDelay   time.Duration
+}
+
 func newHttpTransport() *http.Transport {
 	return &http.Transport{
 		Proxy:               http.ProxyFromEnvironment,
@@ -80,6 +101,52 @@ func newHttpTransport() *http.Transport {
 	}
 }
 
+// sharedHttpTransport returns the global transport matching
+// the connection pool settings.
+func sharedHttpTransport(conf *lineSenderConfig) *globalHttpTransport {
+	key := httpPoolKey{
+		http2:           conf.http2,
+		maxIdleConns:    conf.httpMaxIdleConns,
+		maxConnsPerHost: conf.httpMaxConnsPerHost,
+		idleConnTimeout: conf.httpIdleConnTimeout,
+		fallbackDelay:   conf.dialFallbackDelay,
+	}
+	if key == (httpPoolKey{}) {
+		return globalTransport
+	}
+
+	tunedTransportsMu.Lock()
+	defer tunedTransportsMu.Unlock()
+	t, ok := tunedTransports[key]
+	if !ok {
+		t = &globalHttpTransport{transport: newHttpTransport()}
+		applyHttpPoolConf(t.transport, conf)
+		tunedTransports[key] = t
+	}
+	return t
+}
+
+func applyHttpPoolConf(t *http.Transport, conf *lineSenderConfig) {
+	if conf.http2 {
+		// A custom TLS config disables HTTP/2 unless it's forced.
+		t.ForceAttemptHTTP2 = true
+	}
+	if conf.httpMaxIdleConns > 0 {
+		t.MaxIdleConns = conf.httpMaxIdleConns
+		t.MaxIdleConnsPerHost = conf.httpMaxIdleConns
+	}
+	if conf.httpMaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = conf.httpMaxConnsPerHost
+	}
+	if conf.httpIdleConnTimeout > 0 {
+		t.IdleConnTimeout = conf.httpIdleConnTimeout
+	}
+	if conf.dialFallbackDelay != 0 {
+		d := &net.Dialer{FallbackDelay: conf.dialFallbackDelay}
+		t.DialContext = d.DialContext
+	}
+}
+
 // HttpLineSender allows you to insert rows into QuestDB by sending ILP
 // messages over HTTP(S).
 //
@@ -93,13 +160,22 @@ type httpLineSender struct {
 
 	// Retry/timeout-related fields
 	retryTimeout                time.Duration
+	maxRetries                  int
 	minThroughputBytesPerSecond int
 	requestTimeout              time.Duration
 
+	// Batches of at least this size are sent with chunked
+	// transfer encoding; 0 means never.
+	chunkedThreshold int
+
 	// Auto-flush fields
 	autoFlushRows     int
 	autoFlushInterval time.Duration
-	flushDeadline     time.Time
+	autoFlushBytes    int
+
+	// Rows larger than this are sent right away in their own request.
+	oversizedRowSize int
+	flushDeadline    time.Time
 
 	// Authentication-related fields
 	user  string
@@ -109,27 +185,44 @@ type httpLineSender struct {
 	client http.Client
 	uri    string
 	closed bool
+	// sendMu serializes the flushes with the spool replay,
+	// since both use the sender's state.
+	sendMu  sync.Mutex
+	breaker *circuitBreaker
+	spool   *diskSpool
+	raw     *rawWriter
+	metrics MetricsHook
+	debug   *debugWriter
+	trace   *wireTracer
+	tee     io.Writer
+
+	delivery     deliveryDeadline
+	partialFlush bool
+	backoff      Backoff
+	deliveryMode DeliveryMode
+
+	// Server settings learned with feature negotiation, if any.
+	settings *serverSettings
+
+	// Idle keep-alive fields
+	keepAlive *httpKeepAlive
+	pingUri   string
 
 	// Global transport is used unless a custom transport was provided.
 	globalTransport *globalHttpTransport
-}
 
-func newHttpLineSender(conf *lineSenderConfig) (*httpLineSender, error) {
-	var transport *http.Transport
-
-	s := &httpLineSender{
-		address:                     conf.address,
-		minThroughputBytesPerSecond: conf.minThroughput,
-		requestTimeout:              conf.requestTimeout,
-		retryTimeout:                conf.retryTimeout,
-		autoFlushRows:               conf.autoFlushRows,
-		autoFlushInterval:           conf.autoFlushInterval,
-		user:                        conf.httpUser,
-		pass:                        conf.httpPass,
-		token:                       conf.httpToken,
+	conf lineSenderConfig
+}
 
-		buf: newBuffer(conf.initBufSize, conf.maxBufSize, conf.fileNameLimit),
-	}
+// newHttpClient creates an HTTP client for the given config.
+// The returned global transport is non-nil if the client uses
+// the global transport, in which case the caller is responsible
+// for registering and unregistering itself.
+func newHttpClient(conf *lineSenderConfig) (http.Client, *globalHttpTransport) {
+	var (
+		transport *http.Transport
+		global    *globalHttpTransport
+	)
 
 	if conf.httpTransport != nil {
 		// Use custom transport.
@@ -140,26 +233,122 @@ func newHttpLineSender(conf *lineSenderConfig) (*httpLineSender, error) {
 		transport = newHttpTransport()
 		transport.DisableKeepAlives = true
 		transport.TLSClientConfig.InsecureSkipVerify = true
+		applyHttpPoolConf(transport, conf)
 	} else {
 		// Otherwise, use the global transport.
-		s.globalTransport = globalTransport
-		transport = globalTransport.transport
+		global = sharedHttpTransport(conf)
+		transport = global.transport
 	}
 
-	s.client = http.Client{
+	client := http.Client{
 		Transport: transport,
 		Timeout:   0,
 	}
+	return client, global
+}
 
+// httpBaseUri returns the scheme and the address part of QuestDB
+// endpoint URIs, e.g. "https://localhost:9000".
+func httpBaseUri(conf *lineSenderConfig) string {
+	u := url.URL{Scheme: "http", Host: conf.address}
+	if conf.tlsMode != tlsDisabled {
+		u.Scheme = "https"
+	}
+	// url.URL escapes IPv6 zones, e.g. "[fe80::1%25eth0]:9000".
+	return u.String()
+}
+
+// setAuthHeader sets the Authorization header of the request
+// if basic or token authentication is configured.
+func setAuthHeader(req *http.Request, user, pass, token string) {
+	if user != "" && pass != "" {
+		req.SetBasicAuth(user, pass)
+	} else if token != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+}
+
+func newHttpLineSender(ctx context.Context, conf *lineSenderConfig) (*httpLineSender, error) {
+	s := &httpLineSender{
+		address:                     conf.address,
+		minThroughputBytesPerSecond: conf.minThroughput,
+		requestTimeout:              conf.requestTimeout,
+		retryTimeout:                conf.retryTimeout,
+		maxRetries:                  conf.maxRetries,
+		chunkedThreshold:            conf.chunkedThreshold,
+		autoFlushRows:               conf.autoFlushRows,
+		autoFlushInterval:           conf.autoFlushInterval,
+		autoFlushBytes:              conf.autoFlushBytes,
+		oversizedRowSize:            conf.oversizedRowSize,
+		user:                        conf.httpUser,
+		pass:                        conf.httpPass,
+		token:                       conf.httpToken,
+		conf:                        *conf,
+	}
+	var err error
+	s.buf, err = newBufferFromConf(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	s.client, s.globalTransport = newHttpClient(conf)
 	if s.globalTransport != nil {
 		s.globalTransport.RegisterClient()
 	}
 
-	s.uri = "http"
-	if conf.tlsMode != tlsDisabled {
-		s.uri += "s"
+	s.uri = httpBaseUri(conf) + "/write"
+	s.breaker = newCircuitBreaker(conf.circuitBreaker)
+	s.metrics = newMetricsHook(conf.metrics)
+	s.debug = newDebugWriter(conf.debugWriter, conf.debugMaxBytes)
+	s.trace = newWireTracer(conf.wireTrace)
+	s.tee = conf.tee
+	s.delivery = deliveryDeadline{timeout: conf.deliveryTimeout, deadLetter: conf.deadLetter}
+	s.partialFlush = conf.partialFlush
+	s.backoff = conf.backoff
+	s.deliveryMode = conf.deliveryMode
+
+	if conf.negotiate {
+		// Keep the configured settings if the server
+		// can't tell.
+		if settings, err := fetchServerSettings(ctx, &s.client, conf); err == nil {
+			s.settings = settings
+			settings.apply(&s.buf, conf.initBufSize)
+			if settings.maxFileNameLength > 0 {
+				// Re-check the global symbols against the server limit.
+				s.buf.globalSymbols, err = encodeGlobalSymbols(conf.globalSymbols, s.buf.fileNameLimit)
+				if err != nil {
+					if s.globalTransport != nil {
+						s.globalTransport.UnregisterClient()
+					}
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if conf.spoolDir != "" {
+		spool, err := newDiskSpool(conf.spoolDir, conf.spoolThreshold)
+		if err != nil {
+			if s.globalTransport != nil {
+				s.globalTransport.UnregisterClient()
+			}
+			return nil, err
+		}
+		s.spool = spool
+	}
+
+	s.keepAlive = newHttpKeepAlive(conf.httpKeepAlivePing)
+	if s.keepAlive != nil {
+		s.pingUri = httpBaseUri(conf) + "/ping"
+		go s.keepAlive.run(s.ping)
+	}
+
+	// The replay runs in the background, so it's started once
+	// the sender is fully initialized.
+	if s.spool != nil {
+		// Replay the files left by a previous sender, if any.
+		s.spool.recordSuccess(s.replay)
 	}
-	s.uri += fmt.Sprintf("://%s/write", s.address)
 
 	return s, nil
 }
@@ -168,16 +357,15 @@ func (s *httpLineSender) Flush(ctx context.Context) error {
 	return s.flush0(ctx, false)
 }
 
-func (s *httpLineSender) flush0(ctx context.Context, closing bool) error {
-	var (
-		req           *http.Request
-		retryInterval time.Duration
-
-		maxRetryInterval = time.Second
-	)
+func (s *httpLineSender) FlushWithStats(ctx context.Context) (FlushStats, error) {
+	return flushWithStats(&s.buf, func() error {
+		return s.flush0(ctx, false)
+	})
+}
 
+func (s *httpLineSender) flush0(ctx context.Context, closing bool) error {
 	if s.closed {
-		return errors.New("cannot flush a closed LineSender")
+		return fmt.Errorf("cannot flush: %w", ErrClosed)
 	}
 
 	err := s.buf.LastErr()
@@ -188,64 +376,204 @@ func (s *httpLineSender) flush0(ctx context.Context, closing bool) error {
 	}
 	if s.buf.HasTable() {
 		s.buf.DiscardPendingMsg()
-		return errors.New("pending ILP message must be finalized with At or AtNow before calling Flush")
+		return fmt.Errorf("%w before calling Flush", ErrPendingMessage)
 	}
 
-	if s.buf.msgCount == 0 {
+	if s.buf.msgCount() == 0 {
 		return nil
 	}
 
-	// We rely on the following HTTP client implicit behavior:
-	// s.buf implements WriteTo method which is used by the client.
-	req, err = http.NewRequest(
-		http.MethodPost,
-		s.uri,
-		&s.buf,
-	)
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.spool != nil && s.spool.spilling() {
+		return s.spill(true)
+	}
+	if !s.breaker.allow() {
+		return s.breaker.reject(&s.buf)
+	}
+
+	s.debug.dump(s.buf.Bytes())
+	start := time.Now()
+	if err = teeBatch(s.tee, s.buf.Bytes()); err != nil {
+		reportFlush(s.metrics, s.deliveryMode, s.buf.msgCount(), s.buf.Len(), start, err)
+		s.buf.dropFailed(err)
+		s.refreshFlushDeadline(err)
+		return err
+	}
+	err = s.sendBatch(ctx, closing)
+	reportFlush(s.metrics, s.deliveryMode, s.buf.msgCount(), s.buf.Len(), start, err)
+	var httpErr *HttpError
+	serverDown := err != nil && !errors.As(err, &httpErr)
+	if serverDown {
+		s.breaker.record(err)
+	} else {
+		// The server is up, even if it rejected the batch.
+		s.breaker.record(nil)
+	}
+	if s.spool != nil {
+		if !serverDown {
+			s.spool.recordSuccess(s.replay)
+		} else if s.spool.recordFailure() && !errors.Is(err, ErrDeliveryTimeout) {
+			// The batch has been already written to the tee.
+			return s.spill(false)
+		}
+	}
+	var partial *PartialFlushError
+	if errors.As(err, &partial) {
+		// The accepted rows must not be sent again.
+		s.dropRejected(partial)
+		s.buf.resolveFlush(err)
+		s.buf.reset()
+	} else if err != nil {
+		if errors.Is(err, ErrDeliveryTimeout) {
+			s.delivery.drop(s.buf.Bytes(), err)
+		}
+		s.buf.dropFailed(err)
+	} else {
+		s.buf.reset()
+	}
+	s.metrics.Gauge(MetricBufferCapacity, float64(s.buf.Cap()))
+	s.refreshFlushDeadline(err)
+	return err
+}
+
+// sendBatch sends the buffer contents. An oversized last message
+// is sent in its own request after the preceding ones. The per-line
+// errors of the requests are merged into a single PartialFlushError.
+// If a request fails after the preceding ones were accepted, their
+// messages are removed from the buffer, so that they are not sent
+// again.
+func (s *httpLineSender) sendBatch(ctx context.Context, closing bool) error {
+	rows := s.buf.msgCount()
+	splits := []int{0, rows}
+	if rows > 1 && s.buf.oversizedLastMsg(s.oversizedRowSize) {
+		splits = []int{0, rows - 1, rows}
+	}
+
+	data := s.buf.Bytes()
+	var partial *PartialFlushError
+	accepted := 0
+	for i := 1; i < len(splits); i++ {
+		from, to := splits[i-1], splits[i]
+		start, end := s.buf.msgStart(from), s.buf.msgStart(to)
+		err := s.send(ctx, bytes.NewReader(data[start:end]), int64(end-start), closing)
+		var pe *PartialFlushError
+		if errors.As(err, &pe) {
+			if partial == nil {
+				partial = &PartialFlushError{Err: pe.Err}
+			}
+			for _, re := range pe.Report.Rejected {
+				re.Index += from
+				partial.Report.Rejected = append(partial.Report.Rejected, re)
+			}
+			accepted += to - from - len(pe.Report.Rejected)
+			continue
+		}
+		if err != nil {
+			if from > 0 {
+				if partial != nil {
+					s.dropRejected(partial)
+				}
+				s.buf.dropFirstMsgs(from)
+			}
+			return err
+		}
+		accepted += to - from
+	}
+	if partial != nil {
+		partial.Report.Accepted = accepted
+		return partial
+	}
+	return nil
+}
+
+// dropRejected passes the rows rejected by the server to the
+// dead-letter handler, if any.
+func (s *httpLineSender) dropRejected(partial *PartialFlushError) {
+	if s.delivery.deadLetter == nil {
+		return
+	}
+	data := s.buf.Bytes()
+	var batch []byte
+	for _, re := range partial.Report.Rejected {
+		if re.Index >= 0 && re.Index < s.buf.msgCount() {
+			batch = append(batch, data[s.buf.msgStart(re.Index):s.buf.msgStart(re.Index+1)]...)
+		}
+	}
+	if len(batch) > 0 {
+		s.delivery.deadLetter(batch, partial)
+	}
+}
+
+// spill writes the buffer contents to the disk spool and, if tee is
+// true, to the tee writer.
+func (s *httpLineSender) spill(tee bool) error {
+	var err error
+	if tee {
+		err = teeBatch(s.tee, s.buf.Bytes())
+	}
+	if err == nil {
+		err = s.spool.write(s.buf.Bytes())
+	}
 	if err != nil {
+		s.buf.dropFailed(err)
 		return err
 	}
+	s.buf.reset()
+	return nil
+}
 
-	if s.user != "" && s.pass != "" {
-		req.SetBasicAuth(s.user, s.pass)
-	} else if s.token != "" {
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", s.token))
+// replay sends a batch of spooled ILP messages. Batches rejected
+// by the server are not retried.
+func (s *httpLineSender) replay(ctx context.Context, body io.ReadSeeker, size int64) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	err := s.send(ctx, body, size, false)
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return nil
 	}
+	return err
+}
 
-	retry, err := s.makeRequest(ctx, req)
+// send sends the ILP messages to the server, retrying on
+// retryable errors until the delivery timeout, if any.
+func (s *httpLineSender) send(ctx context.Context, body io.ReadSeeker, size int64, closing bool) error {
+	deliveryCtx, cancel := s.delivery.withTimeout(ctx)
+	defer cancel()
+	err := s.send0(deliveryCtx, body, size, closing)
+	return s.delivery.check(ctx, deliveryCtx, err)
+}
+
+func (s *httpLineSender) send0(ctx context.Context, body io.ReadSeeker, size int64, closing bool) error {
+	retry, err := s.makeRequest(ctx, body, size)
 	if !retry {
-		s.refreshFlushDeadline(err)
 		return err
 	}
 
-	if !closing && s.retryTimeout > 0 {
+	if !closing && s.retryTimeout > 0 && s.deliveryMode == DeliveryAtLeastOnce {
 		retryStartTime := time.Now()
 
-		retryInterval = 10 * time.Millisecond
-		for err != nil {
+		for retries := 0; err != nil; retries++ {
 			if time.Since(retryStartTime) > s.retryTimeout {
 				return NewRetryTimeoutError(s.retryTimeout, err)
 			}
+			if s.maxRetries > 0 && retries >= s.maxRetries {
+				return &MaxRetriesError{LastErr: err, Attempts: retries + 1}
+			}
 
-			jitter := time.Duration(rand.Intn(10)) * time.Millisecond
-			time.Sleep(retryInterval + jitter)
-
-			retry, err = s.makeRequest(ctx, req)
-			if !retry {
-				s.refreshFlushDeadline(err)
+			if sleepCtx(ctx, s.backoff.delay(retries)) != nil {
 				return err
 			}
 
-			// Retry with exponentially-increasing timeout
-			// up to a global maximum (1 second)
-			retryInterval = retryInterval * 2
-			if retryInterval > maxRetryInterval {
-				retryInterval = maxRetryInterval
+			s.metrics.Counter(MetricRetries, 1)
+			retry, err = s.makeRequest(ctx, body, size)
+			if !retry {
+				return err
 			}
 		}
 	}
-
-	s.refreshFlushDeadline(err)
 	return err
 }
 
@@ -269,11 +597,21 @@ func (s *httpLineSender) Symbol(name, val string) LineSender {
 	return s
 }
 
+func (s *httpLineSender) SymbolStringer(name string, val fmt.Stringer) LineSender {
+	s.buf.SymbolStringer(name, val)
+	return s
+}
+
 func (s *httpLineSender) Int64Column(name string, val int64) LineSender {
 	s.buf.Int64Column(name, val)
 	return s
 }
 
+func (s *httpLineSender) Uint64Column(name string, val uint64) LineSender {
+	s.buf.Uint64Column(name, val)
+	return s
+}
+
 func (s *httpLineSender) Long256Column(name string, val *big.Int) LineSender {
 	s.buf.Long256Column(name, val)
 	return s
@@ -284,6 +622,16 @@ func (s *httpLineSender) TimestampColumn(name string, ts time.Time) LineSender {
 	return s
 }
 
+func (s *httpLineSender) TimestampMicrosColumn(name string, ts int64) LineSender {
+	s.buf.TimestampMicrosColumn(name, ts)
+	return s
+}
+
+func (s *httpLineSender) TimestampNanosColumn(name string, ts int64) LineSender {
+	s.buf.TimestampNanosColumn(name, ts)
+	return s
+}
+
 func (s *httpLineSender) Float64Column(name string, val float64) LineSender {
 	s.buf.Float64Column(name, val)
 	return s
@@ -294,11 +642,21 @@ func (s *httpLineSender) StringColumn(name, val string) LineSender {
 	return s
 }
 
+func (s *httpLineSender) StringColumnMarshaler(name string, val encoding.TextMarshaler) LineSender {
+	s.buf.StringColumnMarshaler(name, val)
+	return s
+}
+
 func (s *httpLineSender) BoolColumn(name string, val bool) LineSender {
 	s.buf.BoolColumn(name, val)
 	return s
 }
 
+func (s *httpLineSender) AnyColumn(name string, val interface{}) LineSender {
+	s.buf.AnyColumn(name, val)
+	return s
+}
+
 func (s *httpLineSender) Close(ctx context.Context) error {
 	if s.closed {
 		return nil
@@ -308,9 +666,19 @@ func (s *httpLineSender) Close(ctx context.Context) error {
 
 	if s.autoFlushRows > 0 {
 		err = s.flush0(ctx, true)
+	} else {
+		// With auto-flush disabled, the rows are only sent by Flush.
+		s.buf.dropFailed(errClosedBeforeFlush)
 	}
 
 	s.closed = true
+	s.keepAlive.close()
+	s.buf.resolveFlush(errClosedBeforeFlush)
+	s.buf.releaseMem()
+
+	if s.spool != nil {
+		s.spool.close()
+	}
 
 	if s.globalTransport != nil {
 		s.globalTransport.UnregisterClient()
@@ -325,7 +693,7 @@ func (s *httpLineSender) AtNow(ctx context.Context) error {
 
 func (s *httpLineSender) At(ctx context.Context, ts time.Time) error {
 	if s.closed {
-		return errors.New("cannot queue new messages on a closed LineSender")
+		return fmt.Errorf("cannot queue new messages: %w", ErrClosed)
 	}
 
 	sendTs := true
@@ -336,9 +704,67 @@ func (s *httpLineSender) At(ctx context.Context, ts time.Time) error {
 	if err != nil {
 		return err
 	}
+	return s.autoFlush(ctx)
+}
+
+func (s *httpLineSender) AtMicros(ctx context.Context, ts int64) error {
+	if s.closed {
+		return fmt.Errorf("cannot queue new messages: %w", ErrClosed)
+	}
+
+	err := s.buf.AtMicros(ts)
+	if err != nil {
+		return err
+	}
+	return s.autoFlush(ctx)
+}
+
+func (s *httpLineSender) AtMillis(ctx context.Context, ts int64) error {
+	if s.closed {
+		return fmt.Errorf("cannot queue new messages: %w", ErrClosed)
+	}
+
+	err := s.buf.AtMillis(ts)
+	if err != nil {
+		return err
+	}
+	return s.autoFlush(ctx)
+}
+
+func (s *httpLineSender) AtRaw(ctx context.Context, line []byte) error {
+	if s.closed {
+		return fmt.Errorf("cannot queue new messages: %w", ErrClosed)
+	}
+
+	err := s.buf.AtRaw(line)
+	if err != nil {
+		return err
+	}
+	return s.autoFlush(ctx)
+}
 
-	// Check row count-based auto flush.
-	if s.buf.msgCount == s.autoFlushRows {
+func (s *httpLineSender) autoFlush(ctx context.Context) error {
+	if err := s.buf.checkMemory(ctx, s.Flush); err != nil {
+		return err
+	}
+	if s.buf.oversizedLastMsg(s.oversizedRowSize) {
+		err := s.Flush(ctx)
+		if err == nil {
+			// Don't keep the capacity grown by the row.
+			s.buf.ResetSize()
+		}
+		return err
+	}
+	if s.buf.pendingRowsFull() {
+		return s.buf.flushPendingRows(ctx, s.Flush, s.deliveryMode == DeliveryAtLeastOnce)
+	}
+	// Check row count-based auto flush. A raw write may commit
+	// several rows at once, so the count can pass the limit.
+	if s.autoFlushRows > 0 && s.buf.msgCount() >= s.autoFlushRows {
+		return s.Flush(ctx)
+	}
+	// Check size-based auto flush.
+	if s.autoFlushBytes > 0 && s.buf.Len() > s.autoFlushBytes {
 		return s.Flush(ctx)
 	}
 	// Check time-based auto flush.
@@ -354,16 +780,50 @@ func (s *httpLineSender) At(ctx context.Context, ts time.Time) error {
 }
 
 // makeRequest returns a boolean if we need to retry the request
-func (s *httpLineSender) makeRequest(ctx context.Context, req *http.Request) (bool, error) {
+func (s *httpLineSender) makeRequest(ctx context.Context, body io.ReadSeeker, size int64) (bool, error) {
 	// reqTimeout = ( request.len() / min_throughput ) + request_timeout
 	// nb: conversion from int to time.Duration is in milliseconds
-	reqTimeout := time.Duration(s.buf.Len()/s.minThroughputBytesPerSecond)*time.Second + s.requestTimeout
+	reqTimeout := time.Duration(size/int64(s.minThroughputBytesPerSecond))*time.Second + s.requestTimeout
 	reqCtx, cancel := context.WithTimeout(ctx, reqTimeout)
 	defer cancel()
 
-	req = req.WithContext(reqCtx)
+	// Each attempt reads the data from the start,
+	// so that retries send the whole batch.
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	if s.trace != nil {
+		prefix := make([]byte, wireTracePrefixSize)
+		n, _ := io.ReadFull(body, prefix)
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		s.trace.payload(prefix[:n], "flush: POST %s, %d bytes, auth=%s",
+			s.uri, size, httpAuthScheme(s.user, s.pass, s.token))
+	}
+	// The body is wrapped, so that the client neither infers
+	// the length, nor closes the underlying file.
+	req, err := http.NewRequestWithContext(
+		s.trace.withClientTrace(reqCtx),
+		http.MethodPost,
+		s.uri,
+		struct{ io.Reader }{body},
+	)
+	if err != nil {
+		return false, err
+	}
+	if s.chunkedThreshold == 0 || size < int64(s.chunkedThreshold) {
+		req.ContentLength = size
+	} else {
+		// Unknown length makes the client use chunked encoding.
+		req.ContentLength = -1
+	}
+	setAuthHeader(req, s.user, s.pass, s.token)
+
+	s.keepAlive.touch()
 	resp, err := s.client.Do(req)
 	if err != nil {
+		s.trace.event("flush failed: %v", err)
 		return true, err
 	}
 
@@ -371,8 +831,10 @@ func (s *httpLineSender) makeRequest(ctx context.Context, req *http.Request) (bo
 
 	// Don't retry on successful responses
 	if resp.StatusCode < 300 {
+		s.trace.event("flush done: %s", resp.Status)
 		return false, nil
 	}
+	s.trace.event("flush rejected: %s", resp.Status)
 
 	// Retry on known 500-related errors
 	if isRetryableError(resp.StatusCode) {
@@ -388,6 +850,7 @@ func (s *httpLineSender) makeRequest(ctx context.Context, req *http.Request) (bo
 	if err != nil {
 		return false, fmt.Errorf("%d: %s", resp.StatusCode, resp.Status)
 	}
+	s.trace.payload(buf, "response body: %d bytes", len(buf))
 	httpErr := &HttpError{
 		httpStatus: resp.StatusCode,
 	}
@@ -395,11 +858,53 @@ func (s *httpLineSender) makeRequest(ctx context.Context, req *http.Request) (bo
 	if err != nil {
 		return false, fmt.Errorf("%d: %s -- %s", resp.StatusCode, resp.Status, buf)
 	}
+	httpErr.Row = rejectedRow(body, httpErr.Line)
+
+	var lineErrs httpLineErrors
+	if s.partialFlush && json.Unmarshal(buf, &lineErrs) == nil && len(lineErrs.Errors) > 0 {
+		// Line numbers are 1-based.
+		partial := &PartialFlushError{Err: httpErr}
+		for _, le := range lineErrs.Errors {
+			partial.Report.Rejected = append(partial.Report.Rejected, RowError{
+				Index: le.Line - 1,
+				Err:   errors.New(le.Message),
+			})
+		}
+		return false, partial
+	}
 
 	return false, httpErr
 
 }
 
+// httpErrorRowLimit is the max length of HttpError.Row.
+const httpErrorRowLimit = 256
+
+// rejectedRow returns the given 1-based line of the request body,
+// truncated to httpErrorRowLimit bytes.
+func rejectedRow(body io.ReadSeeker, line int) string {
+	if line <= 0 {
+		return ""
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 4096), math.MaxInt32)
+	sc.Split(scanIlpLines)
+	for n := 1; sc.Scan(); n++ {
+		if n < line {
+			continue
+		}
+		row := trimNewline(sc.Bytes())
+		if len(row) > httpErrorRowLimit {
+			return string(row[:httpErrorRowLimit]) + "..."
+		}
+		return string(row)
+	}
+	return ""
+}
+
 func isRetryableError(statusCode int) bool {
 	switch statusCode {
 	case 500, // Internal Server Error
@@ -417,6 +922,56 @@ func isRetryableError(statusCode int) bool {
 	}
 }
 
+func (s *httpLineSender) WriteRows(ctx context.Context, rows []Row) error {
+	return writeRows(ctx, s, rows)
+}
+
+func (s *httpLineSender) Write(ctx context.Context, row Row) error {
+	return writeRow(ctx, s, &row)
+}
+
+func (s *httpLineSender) WriteStruct(ctx context.Context, table string, v interface{}) error {
+	return writeStruct(ctx, s, table, v)
+}
+
+func (s *httpLineSender) RawWriter() io.Writer {
+	if s.raw == nil {
+		s.raw = newRawWriter(&s.buf, s.autoFlush)
+	}
+	return s.raw
+}
+
+func (s *httpLineSender) Checkpoint() Checkpoint {
+	return s.buf.checkpoint()
+}
+
+func (s *httpLineSender) Restore(cp Checkpoint) error {
+	return s.buf.restore(cp)
+}
+
+func (s *httpLineSender) Config() ConfigSnapshot {
+	return ConfigSnapshot{conf: s.conf}
+}
+
+func (s *httpLineSender) PendingFlush() *FlushToken {
+	return s.buf.pendingFlush()
+}
+
+func (s *httpLineSender) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	if s.settings == nil {
+		settings, err := fetchServerSettings(ctx, &s.client, &s.conf)
+		if err != nil {
+			return ServerInfo{}, fmt.Errorf("failed to query server settings: %w", err)
+		}
+		s.settings = settings
+	}
+	return s.settings.info(s.buf.fileNameLimit), nil
+}
+
+func (s *httpLineSender) lineBuffer() *buffer {
+	return &s.buf
+}
+
 // Messages returns a copy of accumulated ILP messages that are not
 // flushed to the TCP connection yet. Useful for debugging purposes.
 func (s *httpLineSender) Messages() string {
@@ -425,7 +980,7 @@ func (s *httpLineSender) Messages() string {
 
 // MsgCount returns the number of buffered messages
 func (s *httpLineSender) MsgCount() int {
-	return s.buf.msgCount
+	return s.buf.msgCount()
 }
 
 // BufLen returns the number of bytes written to the buffer.
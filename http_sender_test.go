@@ -28,8 +28,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -222,6 +229,100 @@ func TestErrorWhenSenderTypeIsNotSpecified(t *testing.T) {
 	assert.ErrorContains(t, err, "sender type is not specified: use WithHttp or WithTcp")
 }
 
+func TestOptionValidation(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name        string
+		opts        []qdb.LineSenderOption
+		expectedErr string
+	}{
+		{
+			name:        "both transports",
+			opts:        []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithTcp()},
+			expectedErr: "both WithHttp and WithTcp options are provided",
+		},
+		{
+			name:        "init buffer size greater than max",
+			opts:        []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithInitBufferSize(1024), qdb.WithMaxBufferSize(512)},
+			expectedErr: "initial buffer size is greater than max buffer size: 1024 > 512",
+		},
+		{
+			name:        "tcp auth over http",
+			opts:        []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithAuth("id", "key")},
+			expectedErr: "tcpKeyId and tcpKey settings are not available in the HTTP client",
+		},
+		{
+			name:        "basic auth over tcp",
+			opts:        []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithBasicAuth("user", "pass")},
+			expectedErr: "basic and token authentication is not available in the TCP client",
+		},
+		{
+			name:        "token auth over tcp",
+			opts:        []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithBearerToken("token")},
+			expectedErr: "basic and token authentication is not available in the TCP client",
+		},
+		{
+			name:        "http transport over tcp",
+			opts:        []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithHttpTransport(&http.Transport{})},
+			expectedErr: "httpTransport setting is not available in the TCP client",
+		},
+		{
+			name:        "chunked uploads over tcp",
+			opts:        []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithChunkedUploads(1024)},
+			expectedErr: "chunked uploads are not available in the TCP client",
+		},
+		{
+			name:        "http2 over tcp",
+			opts:        []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithHttp2()},
+			expectedErr: "HTTP/2 is not available in the TCP client",
+		},
+		{
+			name:        "connection pool settings over tcp",
+			opts:        []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithHttpMaxConnsPerHost(4)},
+			expectedErr: "HTTP connection pool settings are not available in the TCP client",
+		},
+		{
+			name:        "keep-alive ping over tcp",
+			opts:        []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithHttpKeepAlivePing(time.Second)},
+			expectedErr: "keep-alive ping setting is not available in the TCP client",
+		},
+		{
+			name:        "negative keep-alive ping interval",
+			opts:        []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithHttpKeepAlivePing(-1)},
+			expectedErr: "keep-alive ping interval is negative: -1",
+		},
+		{
+			name:        "negative max idle connections",
+			opts:        []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithHttpMaxIdleConns(-1)},
+			expectedErr: "max idle connections is negative: -1",
+		},
+		{
+			name:        "tcp idle timeout over http",
+			opts:        []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithIdleTimeout(time.Second)},
+			expectedErr: "idleTimeout setting is not available in the HTTP client",
+		},
+		{
+			name:        "feature negotiation over tcp",
+			opts:        []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithFeatureNegotiation()},
+			expectedErr: "feature negotiation is not available in the TCP client",
+		},
+		{
+			name:        "negative chunked upload threshold",
+			opts:        []qdb.LineSenderOption{qdb.WithHttp(), qdb.WithChunkedUploads(-1)},
+			expectedErr: "chunked upload threshold is negative: -1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append(tc.opts, qdb.WithDryRun())
+			_, err := qdb.NewLineSender(ctx, opts...)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
 func TestHttpErrorWhenMaxBufferSizeIsReached(t *testing.T) {
 	ctx := context.Background()
 
@@ -334,6 +435,165 @@ func TestRetryOn500(t *testing.T) {
 	assert.ErrorContains(t, retryErr.LastErr, "500")
 }
 
+func TestMaxRetries(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(returning500)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	hook := newTestMetricsHook()
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithRequestTimeout(10*time.Millisecond),
+		qdb.WithMaxRetries(2),
+		qdb.WithMetrics(hook),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).StringColumn("bar", "baz").AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Flush(ctx)
+	maxRetriesErr := &qdb.MaxRetriesError{}
+	assert.ErrorAs(t, err, &maxRetriesErr)
+	assert.Equal(t, 3, maxRetriesErr.Attempts)
+	assert.ErrorContains(t, err, "max retries reached after 3 attempts")
+	assert.ErrorContains(t, maxRetriesErr.LastErr, "500")
+	assert.Equal(t, int64(2), hook.counter(qdb.MetricRetries))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithMaxRetries(2))
+	assert.ErrorContains(t, err, "maxRetries setting is not available in the TCP client")
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithMaxRetries(-1))
+	assert.ErrorContains(t, err, "max retries is negative")
+}
+
+func TestBackoff(t *testing.T) {
+	ctx := context.Background()
+
+	b := qdb.Backoff{InitialInterval: 10 * time.Millisecond, Multiplier: 3, MaxInterval: 100 * time.Millisecond, Jitter: qdb.JitterNone}
+	for i, expected := range []time.Duration{10, 30, 90, 100, 100} {
+		assert.Equal(t, expected*time.Millisecond, qdb.BackoffDelay(b, i))
+	}
+	for i := 0; i < 100; i++ {
+		b.Jitter = qdb.JitterFull
+		d := qdb.BackoffDelay(b, 3)
+		assert.True(t, d >= 0 && d <= 100*time.Millisecond, d)
+		b.Jitter = qdb.JitterEqual
+		d = qdb.BackoffDelay(b, 3)
+		assert.True(t, d >= 50*time.Millisecond && d <= 100*time.Millisecond, d)
+	}
+
+	srv, err := newTestHttpServer(returning500)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	var attempts []int
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithMaxRetries(3),
+		qdb.WithBackoff(qdb.Backoff{Delay: func(attempt int) time.Duration {
+			attempts = append(attempts, attempt)
+			return time.Millisecond
+		}}),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).StringColumn("bar", "baz").AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Flush(ctx)
+	assert.ErrorContains(t, err, "max retries reached")
+	assert.Equal(t, []int{0, 1, 2}, attempts)
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithBackoff(qdb.Backoff{Multiplier: 0.5}))
+	assert.ErrorContains(t, err, "backoff multiplier is less than 1")
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithBackoff(qdb.Backoff{Jitter: 42}))
+	assert.ErrorContains(t, err, "unknown backoff jitter: 42")
+}
+
+func TestAtMostOnceDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(returning500)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	hook := newTestMetricsHook()
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithDeliveryMode(qdb.DeliveryAtMostOnce),
+		qdb.WithMetrics(hook),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for i := 0; i < 2; i++ {
+		err = sender.Table(testTable).Int64Column("a", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	err = sender.Flush(ctx)
+	assert.ErrorContains(t, err, "500")
+	assert.Zero(t, qdb.BufLen(sender))
+	assert.Zero(t, hook.counter(qdb.MetricRetries))
+	assert.Equal(t, int64(2), hook.counter(qdb.MetricRowsDropped))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDeliveryMode(qdb.DeliveryAtMostOnce), qdb.WithMaxRetries(1))
+	assert.ErrorContains(t, err, "maxRetries setting is not available in the at-most-once delivery mode")
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDeliveryMode(qdb.DeliveryAtMostOnce), qdb.WithSpillToDisk(t.TempDir(), 1))
+	assert.ErrorContains(t, err, "spill to disk is not available in the at-most-once delivery mode")
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDeliveryMode(42))
+	assert.ErrorContains(t, err, "unknown delivery mode: 42")
+}
+
+func TestDeliveryTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(returning500)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	var (
+		deadLetters []string
+		deadErr     error
+	)
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithRetryTimeout(time.Minute),
+		// Long enough for the first response to arrive on a busy
+		// machine, so that the 500 is reported.
+		qdb.WithDeliveryTimeout(time.Second),
+		qdb.WithDeadLetterHandler(func(batch []byte, err error) {
+			deadLetters = append(deadLetters, string(batch))
+			deadErr = err
+		}),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).StringColumn("bar", "baz").AtNow(ctx)
+	assert.NoError(t, err)
+	start := time.Now()
+	err = sender.Flush(ctx)
+	assert.ErrorIs(t, err, qdb.ErrDeliveryTimeout)
+	assert.ErrorContains(t, err, "500")
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, []string{testTable + " bar=\"baz\"\n"}, deadLetters)
+	assert.Equal(t, err, deadErr)
+	assert.Zero(t, qdb.BufLen(sender))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDeliveryTimeout(-1))
+	assert.ErrorContains(t, err, "delivery timeout is negative")
+}
+
 func TestNoRetryOn400FromProxy(t *testing.T) {
 	ctx := context.Background()
 
@@ -390,6 +650,144 @@ func TestNoRetryOn400FromServer(t *testing.T) {
 	assert.Equal(t, 42, httpErr.Line)
 }
 
+func TestHttpErrorRow(t *testing.T) {
+	ctx := context.Background()
+
+	line := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"code":"invalid","message":"cast error","line":%d,"errorId":"a"}`, line)
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	flush := func() *qdb.HttpError {
+		err := sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+		assert.NoError(t, err)
+		err = sender.Table(testTable).StringColumn("b", strings.Repeat("x", 300)).AtNow(ctx)
+		assert.NoError(t, err)
+		err = sender.Flush(ctx)
+		httpErr := &qdb.HttpError{}
+		assert.ErrorAs(t, err, &httpErr)
+		return httpErr
+	}
+
+	httpErr := flush()
+	expected := fmt.Sprintf("%s b=\"%s", testTable, strings.Repeat("x", 256-len(testTable)-4)) + "..."
+	assert.Equal(t, expected, httpErr.Row)
+	assert.ErrorContains(t, httpErr, "line: 2, row: "+expected)
+
+	line = 1
+	httpErr = flush()
+	assert.Equal(t, testTable+" a=1i", httpErr.Row)
+
+	// Unknown lines are not reported.
+	line = 0
+	httpErr = flush()
+	assert.Empty(t, httpErr.Row)
+	assert.NotContains(t, httpErr.Error(), "row:")
+}
+
+func TestPartialFlush(t *testing.T) {
+	ctx := context.Background()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"code":"invalid","message":"2 lines rejected","line":2,"errorId":"a",`+
+			`"errors":[{"line":2,"message":"cast error"},{"line":4,"message":"bad symbol"}]}`)
+	}))
+	defer srv.Close()
+
+	var (
+		deadLetters []string
+		deadErr     error
+	)
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")),
+		qdb.WithPartialFlush(),
+		qdb.WithDeadLetterHandler(func(batch []byte, err error) {
+			deadLetters = append(deadLetters, string(batch))
+			deadErr = err
+		}))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for i := 0; i < 4; i++ {
+		err = sender.Table(testTable).Int64Column("a", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	err = sender.Flush(ctx)
+
+	partial := &qdb.PartialFlushError{}
+	assert.ErrorAs(t, err, &partial)
+	assert.Equal(t, 2, partial.Report.Accepted)
+	assert.Len(t, partial.Report.Rejected, 2)
+	assert.Equal(t, 1, partial.Report.Rejected[0].Index)
+	assert.EqualError(t, partial.Report.Rejected[0].Err, "cast error")
+	assert.Equal(t, 3, partial.Report.Rejected[1].Index)
+	assert.ErrorContains(t, err, "2 of 4 rows rejected, first: row 1: cast error")
+
+	// The server-sent error is still available.
+	httpErr := &qdb.HttpError{}
+	assert.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusBadRequest, httpErr.HttpStatus())
+
+	assert.Equal(t, []string{testTable + " a=1i\n" + testTable + " a=3i\n"}, deadLetters)
+	assert.ErrorIs(t, deadErr, partial)
+
+	// The accepted rows are not sent again.
+	assert.Equal(t, 0, qdb.MsgCount(sender))
+	assert.NoError(t, sender.Flush(ctx))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestPartialFlushNotEnabled(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"code":"invalid","message":"2 lines rejected","line":2,"errorId":"a",`+
+			`"errors":[{"line":2,"message":"cast error"},{"line":4,"message":"bad symbol"}]}`)
+	}))
+	defer srv.Close()
+
+	var deadLetters []string
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")),
+		qdb.WithDeadLetterHandler(func(batch []byte, err error) {
+			deadLetters = append(deadLetters, string(batch))
+		}))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for i := 0; i < 4; i++ {
+		err = sender.Table(testTable).Int64Column("a", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	err = sender.Flush(ctx)
+
+	// The per-line errors are ignored, so no rows are taken as
+	// committed.
+	partial := &qdb.PartialFlushError{}
+	assert.False(t, errors.As(err, &partial))
+	httpErr := &qdb.HttpError{}
+	assert.ErrorAs(t, err, &httpErr)
+	assert.Empty(t, deadLetters)
+
+	// Not available in the TCP client.
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithPartialFlush())
+	assert.ErrorContains(t, err, "partialFlush setting is not available")
+}
+
 func TestRowBasedAutoFlush(t *testing.T) {
 	ctx := context.Background()
 	autoFlushRows := 10
@@ -422,6 +820,35 @@ func TestRowBasedAutoFlush(t *testing.T) {
 	assert.Equal(t, 0, qdb.MsgCount(sender))
 }
 
+func TestSizeBasedAutoFlush(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithInitBufferSize(1024*1024),
+		qdb.WithAutoFlushBytes(2*len(testTable+" bar=\"baz\"\n")),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	// The buffer is flushed once it's larger than the threshold.
+	for i := 0; i < 2; i++ {
+		err = sender.Table(testTable).StringColumn("bar", "baz").AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, qdb.MsgCount(sender))
+
+	err = sender.Table(testTable).StringColumn("bar", "baz").AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, qdb.MsgCount(sender))
+}
+
 func TestTimeBasedAutoFlush(t *testing.T) {
 	ctx := context.Background()
 	autoFlushInterval := 10 * time.Millisecond
@@ -486,6 +913,42 @@ func TestNoFlushWhenAutoFlushDisabled(t *testing.T) {
 	assert.Equal(t, autoFlushRows+1, qdb.MsgCount(sender))
 }
 
+func TestNoFlushAtDefaultRowsWhenAutoFlushDisabled(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	// The default auto-flush settings must not be applied.
+	newSenders := map[string]func() (qdb.LineSender, error){
+		"option": func() (qdb.LineSender, error) {
+			return qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithAutoFlushDisabled())
+		},
+		"config string": func() (qdb.LineSender, error) {
+			return qdb.LineSenderFromConf(ctx, fmt.Sprintf("http::addr=%s;auto_flush=off;", srv.Addr()))
+		},
+		"sender config": func() (qdb.LineSender, error) {
+			cfg := qdb.SenderConfig{Schema: "http", Address: srv.Addr(), AutoFlushDisabled: true}
+			return cfg.Build(ctx)
+		},
+	}
+	for name, newSender := range newSenders {
+		t.Run(name, func(t *testing.T) {
+			sender, err := newSender()
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			rows := 75000 + 1
+			for i := 0; i < rows; i++ {
+				err = sender.Table(testTable).Int64Column("a", int64(i)).AtNow(ctx)
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, rows, qdb.MsgCount(sender))
+		})
+	}
+}
+
 func TestSenderDoubleClose(t *testing.T) {
 	ctx := context.Background()
 	autoFlushRows := 10
@@ -527,7 +990,7 @@ func TestErrorOnFlushWhenSenderIsClosed(t *testing.T) {
 	sender.Table(testTable)
 	err = sender.Flush(ctx)
 
-	assert.ErrorContains(t, err, "cannot flush a closed LineSender")
+	assert.ErrorIs(t, err, qdb.ErrClosed)
 }
 
 func TestAutoFlushWhenSenderIsClosed(t *testing.T) {
@@ -602,51 +1065,510 @@ func TestBufferClearAfterFlush(t *testing.T) {
 	expectLines(t, srv.BackCh, []string{fmt.Sprintf("%s,ghi=jkl", testTable)})
 }
 
-func TestCustomTransportAndTlsInit(t *testing.T) {
+func TestFlushWithStats(t *testing.T) {
 	ctx := context.Background()
 
-	s1, err := qdb.NewLineSender(ctx, qdb.WithHttp())
+	srv, err := newTestHttpServer(sendToBackChannel)
 	assert.NoError(t, err)
+	defer srv.Close()
 
-	s2, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithTls())
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithAutoFlushDisabled())
 	assert.NoError(t, err)
+	defer sender.Close(ctx)
 
-	s3, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithTlsInsecureSkipVerify())
+	stats, err := sender.FlushWithStats(ctx)
 	assert.NoError(t, err)
+	assert.Zero(t, stats.Rows)
+	assert.Zero(t, stats.Bytes)
 
-	transport := http.Transport{}
-	s4, err := qdb.NewLineSender(
-		ctx,
-		qdb.WithHttp(),
-		qdb.WithHttpTransport(&transport),
-		qdb.WithTls(),
-	)
+	err = sender.Table(testTable).Symbol("abc", "def").AtNow(ctx)
 	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a", 42).AtNow(ctx)
+	assert.NoError(t, err)
+	bufLen := qdb.BufLen(sender)
 
-	// s1 and s2 have successfully instantiated a sender
-	// using the global transport and should be registered in the
-	// global transport client count
-	assert.Equal(t, int64(2), qdb.GlobalTransport.ClientCount())
-
-	// Closing the client with the custom transport should not impact
-	// the global transport client count
-	s4.Close(ctx)
-
-	// Now close all remaining clients
-	s1.Close(ctx)
-	s2.Close(ctx)
-	s3.Close(ctx)
-	assert.Equal(t, int64(0), qdb.GlobalTransport.ClientCount())
+	stats, err = sender.FlushWithStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Rows)
+	assert.Equal(t, bufLen, stats.Bytes)
+	assert.Greater(t, stats.Duration, time.Duration(0))
+
+	expectLines(t, srv.BackCh, []string{
+		fmt.Sprintf("%s,abc=def", testTable),
+		fmt.Sprintf("%s a=42i", testTable),
+	})
+	assert.Zero(t, qdb.BufLen(sender))
 }
 
-func BenchmarkHttpLineSenderBatch1000(b *testing.B) {
+func TestCheckpointRestore(t *testing.T) {
 	ctx := context.Background()
 
-	srv, err := newTestHttpServer(readAndDiscard)
-	assert.NoError(b, err)
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
 	defer srv.Close()
 
-	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()))
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithAutoFlushDisabled())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+
+	cp := sender.Checkpoint()
+	err = sender.Table(testTable).Int64Column("a", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	sender.Table(testTable).Int64Column("a", 3)
+
+	err = sender.Restore(cp)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+	assert.Equal(t, fmt.Sprintf("%s a=1i\n", testTable), qdb.Messages(sender))
+
+	// Restoring the same checkpoint again is fine.
+	err = sender.Restore(cp)
+	assert.NoError(t, err)
+
+	err = sender.Flush(ctx)
+	assert.NoError(t, err)
+	expectLines(t, srv.BackCh, []string{fmt.Sprintf("%s a=1i", testTable)})
+
+	err = sender.Restore(cp)
+	assert.ErrorContains(t, err, "checkpoint is no longer valid")
+}
+
+func TestRestoreAfterFailedFlush(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(returning403)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithAutoFlushDisabled())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+
+	cp := sender.Checkpoint()
+	err = sender.Flush(ctx)
+	assert.ErrorContains(t, err, "Forbidden")
+	assert.Zero(t, qdb.BufLen(sender))
+
+	// Messages written after the failed flush are dropped on restore.
+	err = sender.Table(testTable).Int64Column("a", 2).AtNow(ctx)
+	assert.NoError(t, err)
+
+	err = sender.Restore(cp)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+	assert.Equal(t, fmt.Sprintf("%s a=1i\n", testTable), qdb.Messages(sender))
+}
+
+func TestRetrySendsWholeBatch(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu       sync.Mutex
+		requests int
+		bodies   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		bodies = append(bodies, string(body))
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Listener.Addr().String()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Flush(ctx)
+	assert.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	line := fmt.Sprintf("%s a=1i\n", testTable)
+	assert.Equal(t, []string{line, line}, bodies)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		requests int32
+		status   int32 = http.StatusInternalServerError
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer srv.Close()
+
+	var rejected []string
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Listener.Addr().String()),
+		qdb.WithRetryTimeout(time.Millisecond),
+		qdb.WithCircuitBreaker(qdb.CircuitBreakerConfig{
+			FailureThreshold: 2,
+			OpenTimeout:      100 * time.Millisecond,
+			OnReject: func(batch []byte) {
+				rejected = append(rejected, string(batch))
+			},
+		}),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	flush := func() error {
+		err := sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+		assert.NoError(t, err)
+		return sender.Flush(ctx)
+	}
+
+	// Two consecutive failures open the circuit.
+	for i := 0; i < 2; i++ {
+		err = flush()
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, qdb.ErrCircuitOpen)
+	}
+	sentRequests := atomic.LoadInt32(&requests)
+
+	err = flush()
+	assert.ErrorIs(t, err, qdb.ErrCircuitOpen)
+	assert.Equal(t, sentRequests, atomic.LoadInt32(&requests))
+	assert.Equal(t, []string{fmt.Sprintf("%s a=1i\n", testTable)}, rejected)
+	assert.Zero(t, qdb.BufLen(sender))
+
+	// A failed probe opens the circuit again.
+	time.Sleep(150 * time.Millisecond)
+	err = flush()
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, qdb.ErrCircuitOpen)
+	err = flush()
+	assert.ErrorIs(t, err, qdb.ErrCircuitOpen)
+
+	// A successful probe closes the circuit.
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	time.Sleep(150 * time.Millisecond)
+	err = flush()
+	assert.NoError(t, err)
+	err = flush()
+	assert.NoError(t, err)
+}
+
+func TestCircuitBreakerValidation(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithCircuitBreaker(qdb.CircuitBreakerConfig{}))
+	assert.ErrorContains(t, err, "circuit breaker failure threshold is not positive")
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithCircuitBreaker(qdb.CircuitBreakerConfig{
+		FailureThreshold: 1,
+		OpenTimeout:      -1,
+	}))
+	assert.ErrorContains(t, err, "circuit breaker open timeout is negative")
+}
+
+func TestOversizedRowHttp(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Listener.Addr().String()),
+		qdb.WithInitBufferSize(64),
+		qdb.WithOversizedRowSize(64),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+
+	// The oversized row is sent right away in its own request.
+	big := strings.Repeat("x", 1024)
+	err = sender.Table(testTable).StringColumn("b", big).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, qdb.MsgCount(sender))
+	assert.Equal(t, 64, qdb.BufCap(sender))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		testTable + " a=1i\n",
+		testTable + " b=\"" + big + "\"\n",
+	}, bodies)
+}
+
+func TestOversizedRowHttpFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		if strings.Contains(string(body), "b=") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Listener.Addr().String()),
+		qdb.WithOversizedRowSize(64),
+		qdb.WithRetryTimeout(time.Millisecond),
+		qdb.WithSpillToDisk(dir, 1),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	big := strings.Repeat("x", 1024)
+	err = sender.Table(testTable).StringColumn("b", big).AtNow(ctx)
+	assert.NoError(t, err)
+
+	// Only the rejected oversized row is spooled, since the
+	// preceding one was accepted.
+	files, err := filepath.Glob(filepath.Join(dir, "*.ilp"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+" b=\""+big+"\"\n", string(data))
+}
+
+func TestSpillToDisk(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	var (
+		mu     sync.Mutex
+		bodies []string
+		status int32 = http.StatusInternalServerError
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := int(atomic.LoadInt32(&status))
+		if code < 300 {
+			body, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			mu.Lock()
+			bodies = append(bodies, string(body))
+			mu.Unlock()
+		}
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Listener.Addr().String()),
+		qdb.WithRetryTimeout(time.Millisecond),
+		qdb.WithSpillToDisk(dir, 1),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	flush := func(val int64) error {
+		err := sender.Table(testTable).Int64Column("a", val).AtNow(ctx)
+		assert.NoError(t, err)
+		return sender.Flush(ctx)
+	}
+	spooledFiles := func() int {
+		files, err := filepath.Glob(filepath.Join(dir, "*.ilp"))
+		assert.NoError(t, err)
+		return len(files)
+	}
+
+	// The server is down, so the batches go to the spool.
+	assert.NoError(t, flush(1))
+	assert.NoError(t, flush(2))
+	assert.Equal(t, 2, spooledFiles())
+	assert.Zero(t, qdb.BufLen(sender))
+
+	// Once the server recovers, the probe flush is sent and
+	// the spooled batches are replayed in the background.
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	time.Sleep(1100 * time.Millisecond)
+	assert.NoError(t, flush(3))
+
+	assert.Eventually(t, func() bool {
+		return spooledFiles() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{
+		fmt.Sprintf("%s a=1i\n", testTable),
+		fmt.Sprintf("%s a=2i\n", testTable),
+		fmt.Sprintf("%s a=3i\n", testTable),
+	}, bodies)
+}
+
+func TestSpillToDiskReplaysLeftovers(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	err = os.WriteFile(filepath.Join(dir, "00000000000000000001.ilp"), []byte(testTable+" a=1i\n"), 0o644)
+	assert.NoError(t, err)
+
+	// The replay starts in the constructor, so it must not race
+	// with the initialization of the keep-alive pings.
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithSpillToDisk(dir, 3),
+		qdb.WithHttpKeepAlivePing(time.Minute),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	expectLines(t, srv.BackCh, []string{fmt.Sprintf("%s a=1i", testTable)})
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithSpillToDisk(dir, 3))
+	assert.ErrorContains(t, err, "spill to disk is not available in the TCP client")
+}
+
+func TestSpillToDiskResumesReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	var (
+		mu     sync.Mutex
+		bodies []string
+		status int32 = http.StatusInternalServerError
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := int(atomic.LoadInt32(&status))
+		if code < 300 {
+			body, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			mu.Lock()
+			bodies = append(bodies, string(body))
+			mu.Unlock()
+		}
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	leftover := filepath.Join(dir, "00000000000000000001.ilp")
+	err := os.WriteFile(leftover, []byte(testTable+" a=1i\n"), 0o644)
+	assert.NoError(t, err)
+
+	// The replay of the leftover file fails, since the server is down.
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Listener.Addr().String()),
+		qdb.WithRetryTimeout(time.Millisecond),
+		qdb.WithSpillToDisk(dir, 3),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+	time.Sleep(100 * time.Millisecond)
+	assert.FileExists(t, leftover)
+
+	// The next successful flush resumes the replay.
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	err = sender.Table(testTable).Int64Column("a", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(leftover)
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{testTable + " a=2i\n", testTable + " a=1i\n"}, bodies)
+}
+
+func TestCustomTransportAndTlsInit(t *testing.T) {
+	ctx := context.Background()
+
+	s1, err := qdb.NewLineSender(ctx, qdb.WithHttp())
+	assert.NoError(t, err)
+
+	s2, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithTls())
+	assert.NoError(t, err)
+
+	s3, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithTlsInsecureSkipVerify())
+	assert.NoError(t, err)
+
+	transport := http.Transport{}
+	s4, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithHttpTransport(&transport),
+		qdb.WithTls(),
+	)
+	assert.NoError(t, err)
+
+	// s1 and s2 have successfully instantiated a sender
+	// using the global transport and should be registered in the
+	// global transport client count
+	assert.Equal(t, int64(2), qdb.GlobalTransport.ClientCount())
+
+	// Closing the client with the custom transport should not impact
+	// the global transport client count
+	s4.Close(ctx)
+
+	// Now close all remaining clients
+	s1.Close(ctx)
+	s2.Close(ctx)
+	s3.Close(ctx)
+	assert.Equal(t, int64(0), qdb.GlobalTransport.ClientCount())
+}
+
+func BenchmarkHttpLineSenderBatch1000(b *testing.B) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(b, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()))
 	assert.NoError(b, err)
 
 	b.ResetTimer()
@@ -692,3 +1614,618 @@ func BenchmarkHttpLineSenderNoFlush(b *testing.B) {
 	sender.Flush(ctx)
 	sender.Close(ctx)
 }
+
+func TestPendingFlush(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithAutoFlushRows(2))
+	assert.NoError(t, err)
+
+	token := sender.PendingFlush()
+	assert.NoError(t, token.Result(ctx), "token must be resolved when there are no messages")
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	token = sender.PendingFlush()
+	assert.Same(t, token, sender.PendingFlush())
+	select {
+	case <-token.Done():
+		t.Fatal("token must not be resolved before flush")
+	default:
+	}
+
+	// The second message triggers auto-flush.
+	err = sender.Table(testTable).Int64Column("a_col", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, token.Result(ctx))
+
+	err = sender.Table(testTable).Int64Column("a_col", 3).AtNow(ctx)
+	assert.NoError(t, err)
+	token = sender.PendingFlush()
+	sender.Close(ctx)
+	assert.NoError(t, token.Result(ctx))
+
+	srv500, err := newTestHttpServer(returning500)
+	assert.NoError(t, err)
+	defer srv500.Close()
+
+	sender, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv500.Addr()), qdb.WithRetryTimeout(time.Millisecond))
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	token = sender.PendingFlush()
+	flushErr := sender.Flush(ctx)
+	assert.Error(t, flushErr)
+	assert.Equal(t, flushErr, token.Result(ctx))
+
+	sender.Close(ctx)
+
+	tcpSrv, err := newTestTcpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer tcpSrv.Close()
+
+	sender, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(tcpSrv.Addr()))
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	token = sender.PendingFlush()
+	assert.NoError(t, sender.Close(ctx))
+	assert.ErrorContains(t, token.Result(ctx), "sender was closed before the messages were flushed")
+}
+
+func TestChunkedUploads(t *testing.T) {
+	ctx := context.Background()
+
+	type request struct {
+		chunked bool
+		body    string
+	}
+	requests := make(chan request, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		chunked := len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked"
+		requests <- request{chunked: chunked, body: string(body)}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")),
+		qdb.WithChunkedUploads(64),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+	req := <-requests
+	assert.False(t, req.chunked)
+	assert.Equal(t, testTable+" a_col=1i\n", req.body)
+
+	for i := 0; i < 5; i++ {
+		err = sender.Table(testTable).Int64Column("a_col", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, sender.Flush(ctx))
+	req = <-requests
+	assert.True(t, req.chunked)
+	assert.Equal(t, 5, strings.Count(req.body, "\n"))
+}
+
+func TestHttp2(t *testing.T) {
+	ctx := context.Background()
+
+	protos := make(chan int, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos <- r.ProtoMajor
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, http2 := range []bool{false, true} {
+		opts := []qdb.LineSenderOption{
+			qdb.WithHttp(),
+			qdb.WithAddress(strings.TrimPrefix(srv.URL, "https://")),
+			qdb.WithTlsInsecureSkipVerify(),
+		}
+		expected := 1
+		if http2 {
+			opts = append(opts, qdb.WithHttp2())
+			expected = 2
+		}
+		sender, err := qdb.NewLineSender(ctx, opts...)
+		assert.NoError(t, err)
+
+		err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, sender.Flush(ctx))
+		assert.Equal(t, expected, <-protos)
+		sender.Close(ctx)
+	}
+}
+
+func TestHttpConnPoolOptions(t *testing.T) {
+	ctx := context.Background()
+
+	newSender := func(opts ...qdb.LineSenderOption) qdb.LineSender {
+		sender, err := qdb.NewLineSender(ctx, append([]qdb.LineSenderOption{qdb.WithHttp()}, opts...)...)
+		assert.NoError(t, err)
+		return sender
+	}
+
+	s1 := newSender()
+	defer s1.Close(ctx)
+	s0 := newSender()
+	defer s0.Close(ctx)
+	assert.Same(t, qdb.HttpTransport(s0), qdb.HttpTransport(s1))
+
+	opts := []qdb.LineSenderOption{
+		qdb.WithHttpMaxIdleConns(8),
+		qdb.WithHttpMaxConnsPerHost(4),
+		qdb.WithHttpIdleConnTimeout(time.Minute),
+	}
+	s2 := newSender(opts...)
+	defer s2.Close(ctx)
+	s3 := newSender(opts...)
+	defer s3.Close(ctx)
+
+	transport := qdb.HttpTransport(s2)
+	assert.NotSame(t, qdb.HttpTransport(s1), transport)
+	assert.Same(t, transport, qdb.HttpTransport(s3))
+	assert.Equal(t, 8, transport.MaxIdleConns)
+	assert.Equal(t, 8, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 4, transport.MaxConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+}
+
+func TestHttpKeepAlivePing(t *testing.T) {
+	ctx := context.Background()
+
+	var pings, conns atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ping":
+			pings.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		case "/write":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")),
+		qdb.WithHttpKeepAlivePing(20*time.Millisecond),
+	)
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+
+	assert.Eventually(t, func() bool {
+		return pings.Load() >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The pings reuse the pooled connection.
+	connsBefore := conns.Load()
+	assert.Eventually(t, func() bool {
+		return pings.Load() >= 6
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, connsBefore, conns.Load())
+
+	assert.NoError(t, sender.Close(ctx))
+	pingsAfterClose := pings.Load()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, pingsAfterClose, pings.Load())
+}
+
+func TestFeatureNegotiation(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name          string
+		settings      string
+		expectedLimit int
+	}{
+		{
+			name:          "nested settings",
+			settings:      `{"config":{"release.version":"8.1.0","line.proto.support.versions":[1,2],"cairo.max.file.name.length":16}}`,
+			expectedLimit: 16,
+		},
+		{
+			name:          "flat settings",
+			settings:      `{"release.type":"OSS","release.version":"7.3.10"}`,
+			expectedLimit: 127,
+		},
+		{
+			name:          "no settings endpoint",
+			expectedLimit: 127,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/settings" && tc.settings != "":
+					w.Header().Set("Content-Type", "application/json")
+					io.WriteString(w, tc.settings)
+				case r.URL.Path == "/write":
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			sender, err := qdb.NewLineSender(
+				ctx,
+				qdb.WithHttp(),
+				qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")),
+				qdb.WithFeatureNegotiation(),
+			)
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			err = sender.Table(strings.Repeat("a", tc.expectedLimit)).Int64Column("a_col", 1).AtNow(ctx)
+			assert.NoError(t, err)
+			err = sender.Table(strings.Repeat("a", tc.expectedLimit+1)).Int64Column("a_col", 1).AtNow(ctx)
+			assert.ErrorContains(t, err, "table name length exceeds the limit")
+		})
+	}
+}
+
+func TestFeatureNegotiationLimits(t *testing.T) {
+	ctx := context.Background()
+
+	settings := `{"config":{"cairo.max.file.name.length":16,"line.max.columns":2,"line.http.max.recv.buffer.size":2048}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/settings":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, settings)
+		case "/write":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")),
+		qdb.WithFeatureNegotiation(),
+		qdb.WithInitBufferSize(1024),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	info, err := sender.ServerInfo(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.MaxColumns)
+	assert.Equal(t, 2048, info.MaxRequestSize)
+
+	err = sender.Table(testTable).Symbol("a", "foo").Int64Column("b", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Symbol("a", "foo").Int64Column("b", 1).Int64Column("c", 2).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrTooManyColumns)
+	assert.ErrorContains(t, err, "column count exceeds the limit: limit=2")
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+
+	// The buffer limit follows the server request size.
+	err = sender.Table(testTable).StringColumn("a", strings.Repeat("a", 2048)).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrBufferFull)
+
+	// The global symbols count towards the columns.
+	sender2, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")),
+		qdb.WithFeatureNegotiation(),
+		qdb.WithGlobalSymbols(map[string]string{"env": "prod"}),
+	)
+	assert.NoError(t, err)
+	defer sender2.Close(ctx)
+
+	err = sender2.Table(testTable).Int64Column("b", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender2.Table(testTable).Symbol("a", "foo").Int64Column("b", 1).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrTooManyColumns)
+	assert.Equal(t, 1, qdb.MsgCount(sender2))
+}
+
+func TestServerInfo(t *testing.T) {
+	ctx := context.Background()
+
+	settings := `{"config":{"release.version":"8.1.0","line.proto.support.versions":[1,2],"cairo.max.file.name.length":64}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/settings" {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, settings)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	newSender := func() qdb.LineSender {
+		sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")))
+		assert.NoError(t, err)
+		return sender
+	}
+
+	sender := newSender()
+	defer sender.Close(ctx)
+	info, err := sender.ServerInfo(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, qdb.ServerInfo{
+		Version:          "8.1.0",
+		ProtocolVersions: []int{1, 2},
+		MaxNameLength:    64,
+		Arrays:           true,
+		BinaryDoubles:    true,
+	}, info)
+	assert.NoError(t, info.Require(2))
+	assert.ErrorIs(t, info.Require(3), qdb.ErrUnsupportedByServer)
+
+	settings = `{"release.type":"OSS","release.version":"7.3.10"}`
+	sender = newSender()
+	defer sender.Close(ctx)
+	info, err = sender.ServerInfo(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "7.3.10", info.Version)
+	assert.Equal(t, 127, info.MaxNameLength)
+	assert.False(t, info.Arrays)
+	assert.NoError(t, info.Require(1))
+	assert.ErrorIs(t, info.Require(2), qdb.ErrUnsupportedByServer)
+
+	sender, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	_, err = sender.ServerInfo(ctx)
+	assert.ErrorIs(t, err, qdb.ErrUnsupportedBySender)
+	assert.NotErrorIs(t, err, qdb.ErrUnsupportedByServer)
+
+	tcpSrv, err := newTestTcpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer tcpSrv.Close()
+	sender, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(tcpSrv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+	_, err = sender.ServerInfo(ctx)
+	assert.ErrorIs(t, err, qdb.ErrUnsupportedBySender)
+}
+
+func TestMetricsHook(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	hook := newTestMetricsHook()
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithMetrics(hook))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for i := 0; i < 3; i++ {
+		err = sender.Table(testTable).Int64Column("a_col", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	size := len(qdb.Messages(sender))
+	assert.NoError(t, sender.Flush(ctx))
+
+	assert.Equal(t, int64(1), hook.counter(qdb.MetricFlushes))
+	assert.Equal(t, int64(0), hook.counter(qdb.MetricFlushErrors))
+	assert.Equal(t, int64(3), hook.counter(qdb.MetricRowsSent))
+	assert.Equal(t, int64(size), hook.counter(qdb.MetricBytesSent))
+	assert.Equal(t, 1, hook.histograms[qdb.MetricFlushDuration])
+	assert.Contains(t, hook.gauges, qdb.MetricBufferCapacity)
+}
+
+func TestMetricsHookOnFailedFlush(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(returning500)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	hook := newTestMetricsHook()
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithRetryTimeout(50*time.Millisecond),
+		qdb.WithMetrics(hook),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Error(t, sender.Flush(ctx))
+
+	assert.Equal(t, int64(1), hook.counter(qdb.MetricFlushes))
+	assert.Equal(t, int64(1), hook.counter(qdb.MetricFlushErrors))
+	assert.Equal(t, int64(0), hook.counter(qdb.MetricRowsSent))
+	assert.Greater(t, hook.counter(qdb.MetricRetries), int64(0))
+}
+
+func TestDebugWriterHttp(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	var dump strings.Builder
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithDebugWriter(&dump, 0))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+
+	assert.Equal(t, testTable+" a_col=1i\n"+testTable+" a_col=2i\n", dump.String())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk is full")
+}
+
+func TestTee(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	var audit strings.Builder
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithTee(&audit))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+
+	expectLines(t, srv.BackCh, []string{testTable + " a_col=1i"})
+	assert.Equal(t, testTable+" a_col=1i\n", audit.String())
+}
+
+func TestTeeSpillToDisk(t *testing.T) {
+	ctx := context.Background()
+
+	// Nothing listens on the address, so that the batches are spilled.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	var audit strings.Builder
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithHttp(),
+		qdb.WithAddress(addr),
+		qdb.WithRetryTimeout(time.Millisecond),
+		qdb.WithSpillToDisk(t.TempDir(), 1),
+		qdb.WithTee(&audit),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	// The first batch is spilled after the failed send, the second
+	// one right away. Both are written to the tee once.
+	for i := 1; i <= 2; i++ {
+		err = sender.Table(testTable).Int64Column("a_col", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, sender.Flush(ctx))
+	}
+	assert.Equal(t, testTable+" a_col=1i\n"+testTable+" a_col=2i\n", audit.String())
+}
+
+func TestTeeToSecondarySender(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	secondary, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer secondary.Close(ctx)
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithTee(secondary.RawWriter()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+
+	assert.Equal(t, 2, qdb.MsgCount(secondary))
+	assert.Equal(t, testTable+" a_col=1i\n"+testTable+" a_col=2i\n", qdb.Messages(secondary))
+}
+
+func TestTeeWriteFailure(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithTee(failingWriter{}))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Flush(ctx)
+	assert.ErrorContains(t, err, "tee write failed: disk is full")
+	assert.Equal(t, 0, qdb.MsgCount(sender))
+
+	select {
+	case l := <-srv.BackCh:
+		t.Fatalf("unexpected line sent to the server: %s", l)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestHttpWireTrace(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"code":"invalid","message":"failed to parse line protocol","line":1,"errorId":"a"}`)
+	}))
+	defer srv.Close()
+
+	var trace strings.Builder
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")),
+		qdb.WithBasicAuth("joe", "secret"), qdb.WithWireTrace(&trace))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Error(t, sender.Flush(ctx))
+
+	out := trace.String()
+	assert.Contains(t, out, fmt.Sprintf("flush: POST %s/write, %d bytes, auth=basic", srv.URL, len(testTable)+6))
+	assert.Contains(t, out, "|my_test_table a=|")
+	assert.Contains(t, out, "connected: tcp ")
+	assert.Contains(t, out, "flush rejected: 400 Bad Request")
+	assert.Contains(t, out, "response body: ")
+	assert.NotContains(t, out, "secret")
+}
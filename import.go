@@ -0,0 +1,247 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// ImportAtomicity determines how the server handles rows that fail
+// to parse during a file import.
+type ImportAtomicity int64
+
+const (
+	// ImportSkipColumn imports the rows with the invalid values
+	// set to null. This is the server default.
+	ImportSkipColumn ImportAtomicity = 0
+	// ImportSkipRow skips the rows with invalid values.
+	ImportSkipRow ImportAtomicity = 1
+	// ImportAbort aborts the whole import on the first invalid row.
+	ImportAbort ImportAtomicity = 2
+)
+
+// ImportColumn is a schema hint for a column of an imported file.
+type ImportColumn struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+	// Pattern is the date format of DATE and TIMESTAMP columns,
+	// e.g. "yyyy-MM-dd HH:mm:ss". The server detects the format
+	// if empty.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// ImportOptions holds the settings of a file import.
+type ImportOptions struct {
+	// Schema overrides the column types detected by the server.
+	// Columns not listed here keep the detected types.
+	Schema []ImportColumn
+	// Timestamp is the name of the designated timestamp column
+	// of the created table.
+	Timestamp string
+	// PartitionBy is the partitioning strategy of the created
+	// table. Requires a designated timestamp unless set to
+	// PartitionByNone.
+	PartitionBy PartitionBy
+	// Overwrite replaces the table contents with the file ones.
+	Overwrite bool
+	// Delimiter is the CSV delimiter. The server detects it
+	// if zero.
+	Delimiter rune
+	// ForceHeader makes the server treat the first line as
+	// the header.
+	ForceHeader bool
+	// Atomicity determines how the invalid rows are handled.
+	Atomicity ImportAtomicity
+	// Progress, if set, is called with the total number of file
+	// bytes uploaded so far.
+	Progress func(bytes int64)
+}
+
+// ImportColumnResult describes a column of an imported table.
+type ImportColumnResult struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Errors is the number of the column values that failed
+	// to parse.
+	Errors int64 `json:"errors"`
+}
+
+// ImportResult holds the outcome of a file import.
+type ImportResult struct {
+	Table        string               `json:"location"`
+	RowsImported int64                `json:"rowsImported"`
+	RowsRejected int64                `json:"rowsRejected"`
+	Header       bool                 `json:"header"`
+	Columns      []ImportColumnResult `json:"columns"`
+}
+
+type importResponse struct {
+	ImportResult
+	Status string `json:"status"`
+}
+
+// ImportFile imports a CSV file to the given table via the /imp
+// endpoint. The table is created if it doesn't exist. The file is
+// streamed, so large backfills don't need to fit in memory.
+//
+// Rows that fail to parse are handled according to the atomicity
+// setting and counted in the result. If the server rejects the
+// import, an *ImportError is returned.
+//
+// Parquet files are not accepted by the /imp endpoint, use the
+// read_parquet() SQL function instead.
+func (c *RestClient) ImportFile(ctx context.Context, table string, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if table == "" {
+		return nil, errors.New("table name cannot be empty")
+	}
+	params, err := opts.params(table)
+	if err != nil {
+		return nil, err
+	}
+	var schema []byte
+	if len(opts.Schema) > 0 {
+		schema, err = json.Marshal(opts.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode import schema: %w", err)
+		}
+	}
+
+	if opts.Progress != nil {
+		r = &progressReader{r: r, progress: opts.Progress}
+	}
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeImportBody(mw, table, schema, r))
+	}()
+	defer pr.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uri+"/imp?"+params.Encode(), pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	setAuthHeader(req, c.user, c.pass, c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	res := &importResponse{}
+	if err := json.Unmarshal(body, res); err != nil {
+		if resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("%d: %s -- %s", resp.StatusCode, resp.Status, body)
+		}
+		return nil, fmt.Errorf("failed to decode import result: %w", err)
+	}
+	if resp.StatusCode >= 300 || res.Status != "OK" {
+		return nil, &ImportError{
+			httpStatus: resp.StatusCode,
+			Table:      table,
+			Message:    res.Status,
+		}
+	}
+	return &res.ImportResult, nil
+}
+
+func (o *ImportOptions) params(table string) (url.Values, error) {
+	params := url.Values{
+		"name": {table},
+		"fmt":  {"json"},
+	}
+	if o.Timestamp != "" {
+		params.Set("timestamp", o.Timestamp)
+	}
+	if o.PartitionBy != "" {
+		if o.PartitionBy != PartitionByNone && o.Timestamp == "" {
+			return nil, errors.New("partitioning requires a designated timestamp")
+		}
+		params.Set("partitionBy", string(o.PartitionBy))
+	}
+	if o.Overwrite {
+		params.Set("overwrite", "true")
+	}
+	if o.Delimiter != 0 {
+		params.Set("delimiter", string(o.Delimiter))
+	}
+	if o.ForceHeader {
+		params.Set("forceHeader", "true")
+	}
+	switch o.Atomicity {
+	case ImportSkipColumn:
+	case ImportSkipRow:
+		params.Set("atomicity", "skipRow")
+	case ImportAbort:
+		params.Set("atomicity", "abort")
+	default:
+		return nil, fmt.Errorf("unknown import atomicity: %d", o.Atomicity)
+	}
+	return params, nil
+}
+
+func writeImportBody(mw *multipart.Writer, table string, schema []byte, r io.Reader) error {
+	if schema != nil {
+		if err := mw.WriteField("schema", string(schema)); err != nil {
+			return err
+		}
+	}
+	part, err := mw.CreateFormFile("data", table)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return fmt.Errorf("failed to read import data: %w", err)
+	}
+	return mw.Close()
+}
+
+// progressReader reports the total number of read bytes.
+type progressReader struct {
+	r        io.Reader
+	n        int64
+	progress func(bytes int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.n += int64(n)
+		r.progress(r.n)
+	}
+	return n, err
+}
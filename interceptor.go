@@ -0,0 +1,114 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import "time"
+
+// RowView gives row interceptors access to the row being finalized
+// by At or AtNow. It's only valid during the interceptor call.
+//
+// Columns added by an interceptor are appended to the row, so
+// symbols may only be added if the row has no columns yet.
+type RowView struct {
+	buf     *buffer
+	tsNanos int64
+	hasTs   bool
+}
+
+// Table returns the table name of the row.
+func (v *RowView) Table() string {
+	return v.buf.tableName
+}
+
+// Timestamp returns the designated timestamp of the row. It returns
+// false if the server assigns the timestamp.
+func (v *RowView) Timestamp() (time.Time, bool) {
+	if !v.hasTs {
+		return time.Time{}, false
+	}
+	return time.Unix(0, v.tsNanos).UTC(), true
+}
+
+// Line returns the ILP line of the row without the timestamp and
+// the trailing newline. The returned slice must not be modified or
+// retained.
+func (v *RowView) Line() []byte {
+	return v.buf.Bytes()[v.buf.lastMsgPos():]
+}
+
+// Symbol adds a symbol to the row.
+func (v *RowView) Symbol(name, val string) *RowView {
+	v.buf.Symbol(name, val)
+	return v
+}
+
+// StringColumn adds a string column to the row.
+func (v *RowView) StringColumn(name, val string) *RowView {
+	v.buf.StringColumn(name, val)
+	return v
+}
+
+// Int64Column adds an integer column to the row.
+func (v *RowView) Int64Column(name string, val int64) *RowView {
+	v.buf.Int64Column(name, val)
+	return v
+}
+
+// Float64Column adds a double column to the row.
+func (v *RowView) Float64Column(name string, val float64) *RowView {
+	v.buf.Float64Column(name, val)
+	return v
+}
+
+// BoolColumn adds a boolean column to the row.
+func (v *RowView) BoolColumn(name string, val bool) *RowView {
+	v.buf.BoolColumn(name, val)
+	return v
+}
+
+// TimestampColumn adds a timestamp column to the row.
+func (v *RowView) TimestampColumn(name string, ts time.Time) *RowView {
+	v.buf.TimestampColumn(name, ts)
+	return v
+}
+
+// intercept calls the row interceptors in the order they were
+// configured. It stops at the first error, including the ones of
+// the columns added by the interceptors.
+func (b *buffer) intercept(tsNanos int64, hasTs bool) error {
+	if len(b.interceptors) == 0 {
+		return nil
+	}
+	v := RowView{buf: b, tsNanos: tsNanos, hasTs: hasTs}
+	for _, fn := range b.interceptors {
+		if err := fn(&v); err != nil {
+			return err
+		}
+		if b.lastErr != nil {
+			return b.lastErr
+		}
+	}
+	return nil
+}
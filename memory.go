@@ -0,0 +1,123 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// globalMemory accounts the buffered ILP messages of all senders
+// configured with WithMemoryLimit.
+var globalMemory memoryAccount
+
+type memoryAccount struct {
+	inUse    int64
+	peak     int64
+	rejected int64
+}
+
+func (m *memoryAccount) add(delta int64) int64 {
+	n := atomic.AddInt64(&m.inUse, delta)
+	for {
+		peak := atomic.LoadInt64(&m.peak)
+		if n <= peak || atomic.CompareAndSwapInt64(&m.peak, peak, n) {
+			return n
+		}
+	}
+}
+
+// MemoryStats holds statistics of the memory used by the buffers of
+// senders configured with WithMemoryLimit. Only the completed messages
+// held by the sender buffers are accounted.
+type MemoryStats struct {
+	// InUse is the number of bytes currently buffered.
+	InUse int64
+	// Peak is the maximum number of bytes buffered at once.
+	Peak int64
+	// Rejected is the number of messages rejected due to the limit.
+	Rejected int64
+}
+
+// GetMemoryStats returns the process-wide memory statistics shared
+// by the senders configured with WithMemoryLimit.
+func GetMemoryStats() MemoryStats {
+	return MemoryStats{
+		InUse:    atomic.LoadInt64(&globalMemory.inUse),
+		Peak:     atomic.LoadInt64(&globalMemory.peak),
+		Rejected: atomic.LoadInt64(&globalMemory.rejected),
+	}
+}
+
+// syncMem updates the process-wide memory usage with the size of the
+// completed messages held by the buffer.
+func (b *buffer) syncMem() {
+	if b.memLimit <= 0 {
+		return
+	}
+	n := int64(b.lastMsgPos())
+	if n != b.memAccounted {
+		globalMemory.add(n - b.memAccounted)
+		b.memAccounted = n
+	}
+}
+
+// releaseMem removes the buffer from the process-wide memory usage.
+func (b *buffer) releaseMem() {
+	if b.memAccounted != 0 {
+		globalMemory.add(-b.memAccounted)
+		b.memAccounted = 0
+	}
+}
+
+// checkMemory applies the overflow policy if the process-wide memory
+// usage exceeds the limit after the last message. With OverflowReject
+// the message is dropped and ErrMemoryLimit is returned. With
+// OverflowBlock the buffer is flushed, and ErrMemoryLimit is returned
+// if the usage of other senders still exceeds the limit. The call
+// doesn't wait for other senders, since they may be idle or owned
+// by the same goroutine.
+func (b *buffer) checkMemory(ctx context.Context, flush func(context.Context) error) error {
+	if b.memLimit <= 0 || atomic.LoadInt64(&globalMemory.inUse) <= b.memLimit {
+		return nil
+	}
+	if b.memPolicy == OverflowReject && b.msgCount() > 0 {
+		b.forgetMsgs(b.msgCount()-1, b.msgCount())
+		b.tsUndo = b.undoLastTs(b.tsUndo, b.msgCount()-1)
+		b.msgEnds = b.msgEnds[:len(b.msgEnds)-1]
+		b.Truncate(b.lastMsgPos())
+		b.syncMem()
+		atomic.AddInt64(&globalMemory.rejected, 1)
+		return ErrMemoryLimit
+	}
+	if err := flush(ctx); err != nil {
+		return err
+	}
+	if atomic.LoadInt64(&globalMemory.inUse) > b.memLimit {
+		return fmt.Errorf("%w: the message was flushed, but other senders keep the usage over the limit", ErrMemoryLimit)
+	}
+	return nil
+}
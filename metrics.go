@@ -0,0 +1,99 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import "time"
+
+// Metric names reported by the senders into MetricsHook.
+const (
+	// MetricFlushes is the counter of flushed batches.
+	MetricFlushes = "questdb_client_flushes_total"
+	// MetricFlushErrors is the counter of failed flushes.
+	MetricFlushErrors = "questdb_client_flush_errors_total"
+	// MetricRowsSent is the counter of successfully flushed rows.
+	MetricRowsSent = "questdb_client_rows_sent_total"
+	// MetricBytesSent is the counter of successfully flushed bytes.
+	MetricBytesSent = "questdb_client_bytes_sent_total"
+	// MetricRowsDropped is the counter of rows of failed flushes
+	// dropped in the at-most-once delivery mode, see WithDeliveryMode.
+	MetricRowsDropped = "questdb_client_rows_dropped_total"
+	// MetricRetries is the counter of retried HTTP requests.
+	MetricRetries = "questdb_client_retries_total"
+	// MetricFlushDuration is the histogram of flush durations
+	// in seconds, including retries.
+	MetricFlushDuration = "questdb_client_flush_duration_seconds"
+	// MetricBufferCapacity is the gauge of the buffer capacity
+	// in bytes, measured after each flush.
+	MetricBufferCapacity = "questdb_client_buffer_capacity_bytes"
+)
+
+// MetricsHook receives metrics reported by the senders. It's meant
+// to be a thin layer on top of the metrics stack used by the
+// application, e.g. Prometheus, OpenTelemetry or statsd, so that
+// the client doesn't depend on any of them.
+//
+// Metric names are the Metric* constants. Since a hook may be
+// shared by multiple senders, implementations must be safe for
+// concurrent use. The calls are made synchronously on the flush
+// path, so they should be cheap.
+type MetricsHook interface {
+	// Counter adds delta to the counter with the given name.
+	Counter(name string, delta int64)
+	// Gauge sets the gauge with the given name to value.
+	Gauge(name string, value float64)
+	// Histogram records value in the histogram with the given name.
+	Histogram(name string, value float64)
+}
+
+type nopMetricsHook struct{}
+
+func (nopMetricsHook) Counter(string, int64)     {}
+func (nopMetricsHook) Gauge(string, float64)     {}
+func (nopMetricsHook) Histogram(string, float64) {}
+
+// newMetricsHook returns the given hook or a no-op one, if nil.
+func newMetricsHook(h MetricsHook) MetricsHook {
+	if h == nil {
+		return nopMetricsHook{}
+	}
+	return h
+}
+
+// reportFlush reports the metrics of a flushed batch. In the
+// at-most-once delivery mode, rows of failed batches are counted
+// as dropped since they're never sent again.
+func reportFlush(h MetricsHook, mode DeliveryMode, rows, bytes int, start time.Time, err error) {
+	h.Counter(MetricFlushes, 1)
+	h.Histogram(MetricFlushDuration, time.Since(start).Seconds())
+	if err != nil {
+		h.Counter(MetricFlushErrors, 1)
+		if mode == DeliveryAtMostOnce {
+			h.Counter(MetricRowsDropped, int64(rows))
+		}
+		return
+	}
+	h.Counter(MetricRowsSent, int64(rows))
+	h.Counter(MetricBytesSent, int64(bytes))
+}
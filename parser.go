@@ -0,0 +1,388 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ParseLine decodes a single ILP line, such as the ones produced
+// by LineSender or Telegraf. The trailing newline is optional.
+//
+// Table and column names are validated with the same rules as
+// in LineSender, except for the name length limit.
+func ParseLine(line []byte) (Row, error) {
+	p := lineParser{line: trimNewline(line)}
+	return p.parse()
+}
+
+// LineDecoder reads and decodes newline-delimited ILP messages
+// from an input stream. Empty lines are skipped.
+//
+//	d := NewLineDecoder(r)
+//	for d.Next() {
+//		row := d.Row()
+//		// ...
+//	}
+//	if err := d.Err(); err != nil {
+//		// ...
+//	}
+type LineDecoder struct {
+	scanner *bufio.Scanner
+	row     Row
+	err     error
+	lineNum int
+}
+
+// NewLineDecoder creates a decoder reading from r.
+func NewLineDecoder(r io.Reader) *LineDecoder {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), defaultMaxBufferSize)
+	s.Split(scanIlpLines)
+	return &LineDecoder{scanner: s}
+}
+
+// Next decodes the next row. It returns false when the end of
+// input is reached or an error occurs. After Next returns false,
+// Err returns the error, if any.
+func (d *LineDecoder) Next() bool {
+	if d.err != nil {
+		return false
+	}
+	for d.scanner.Scan() {
+		d.lineNum++
+		line := d.scanner.Bytes()
+		if len(trimNewline(line)) == 0 {
+			continue
+		}
+		row, err := ParseLine(line)
+		if err != nil {
+			d.err = fmt.Errorf("line %d: %w", d.lineNum, err)
+			return false
+		}
+		d.row = row
+		return true
+	}
+	d.err = d.scanner.Err()
+	return false
+}
+
+// Row returns the most recent row decoded by Next.
+func (d *LineDecoder) Row() Row {
+	return d.row
+}
+
+// Err returns the first error encountered by the decoder.
+func (d *LineDecoder) Err() error {
+	return d.err
+}
+
+// scanIlpLines is a bufio.SplitFunc that splits the input into ILP
+// lines, including the trailing newline. Unlike bufio.ScanLines,
+// it takes escaped newlines into account.
+func scanIlpLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			// Skip the escaped char.
+			i++
+		case '\n':
+			return i + 1, data[:i+1], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func trimNewline(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		// Make sure that the newline is not escaped.
+		escapes := 0
+		for i := n - 2; i >= 0 && line[i] == '\\'; i-- {
+			escapes++
+		}
+		if escapes%2 == 0 {
+			line = line[:n-1]
+			if n := len(line); n > 0 && line[n-1] == '\r' {
+				line = line[:n-1]
+			}
+		}
+	}
+	return line
+}
+
+type lineParser struct {
+	line []byte
+	pos  int
+}
+
+func (p *lineParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid ILP line at offset %d: %s: %w", p.pos, fmt.Sprintf(format, args...), ErrInvalidLine)
+}
+
+func (p *lineParser) parse() (Row, error) {
+	var (
+		row Row
+		err error
+	)
+
+	row.Table, err = p.readTableName()
+	if err != nil {
+		return row, err
+	}
+
+	for p.pos < len(p.line) && p.line[p.pos] == ',' {
+		p.pos++
+		var kv KV
+		kv.Name, err = p.readColumnName()
+		if err != nil {
+			return row, err
+		}
+		kv.Value = p.readUntil(',', ' ')
+		row.Symbols = append(row.Symbols, kv)
+	}
+
+	if p.pos < len(p.line) {
+		p.pos++ // ' '
+		if p.hasFields() {
+			for {
+				col, err := p.readField()
+				if err != nil {
+					return row, err
+				}
+				row.Columns = append(row.Columns, col)
+				if p.pos >= len(p.line) || p.line[p.pos] != ',' {
+					break
+				}
+				p.pos++
+			}
+			if p.pos < len(p.line) {
+				if p.line[p.pos] != ' ' {
+					return row, p.errorf("unexpected char after column value: %q", p.line[p.pos])
+				}
+				p.pos++
+			}
+		}
+	}
+
+	if p.pos < len(p.line) {
+		ts, err := strconv.ParseInt(string(p.line[p.pos:]), 10, 64)
+		if err != nil {
+			return row, p.errorf("invalid designated timestamp %q", p.line[p.pos:])
+		}
+		row.Ts = time.Unix(0, ts).UTC()
+	}
+
+	if len(row.Symbols) == 0 && len(row.Columns) == 0 {
+		return row, p.errorf("no symbols or columns found")
+	}
+	return row, nil
+}
+
+// hasFields checks whether the next token is a field set rather
+// than a designated timestamp.
+func (p *lineParser) hasFields() bool {
+	for i := p.pos; i < len(p.line); i++ {
+		switch p.line[i] {
+		case '\\':
+			i++
+		case '=':
+			return true
+		case ' ', ',':
+			return false
+		}
+	}
+	return false
+}
+
+// readUntil reads and unescapes the input until one of the unescaped
+// separators or the end of the line.
+func (p *lineParser) readUntil(sep1, sep2 byte) string {
+	var sb strings.Builder
+	for ; p.pos < len(p.line); p.pos++ {
+		ch := p.line[p.pos]
+		if ch == sep1 || ch == sep2 {
+			break
+		}
+		if ch == '\\' && p.pos+1 < len(p.line) {
+			p.pos++
+			ch = p.line[p.pos]
+		}
+		sb.WriteByte(ch)
+	}
+	return sb.String()
+}
+
+func (p *lineParser) readTableName() (string, error) {
+	start := p.pos
+	name := p.readUntil(',', ' ')
+	if name == "" {
+		return "", p.errorf("table name cannot be empty")
+	}
+	if name[0] == '.' || name[len(name)-1] == '.' {
+		p.pos = start
+		return "", p.errorf("table name contains '.' char at the start or end: %s", name)
+	}
+	for i := 0; i < len(name); i++ {
+		illegal := illegalTableNameChar(name[i])
+		if name[i] >= utf8.RuneSelf {
+			var size int
+			size, illegal = illegalNameRune(name[i:])
+			i += size - 1
+		}
+		if illegal {
+			p.pos = start
+			return "", p.errorf("table name contains an illegal char: %s", name)
+		}
+	}
+	return name, nil
+}
+
+func (p *lineParser) readColumnName() (string, error) {
+	start := p.pos
+	name := p.readUntil('=', ' ')
+	if p.pos >= len(p.line) || p.line[p.pos] != '=' {
+		return "", p.errorf("missing '=' after column name %q", name)
+	}
+	p.pos++
+	if name == "" {
+		p.pos = start
+		return "", p.errorf("column name cannot be empty")
+	}
+	for i := 0; i < len(name); i++ {
+		illegal := illegalColumnNameChar(name[i])
+		if name[i] >= utf8.RuneSelf {
+			var size int
+			size, illegal = illegalNameRune(name[i:])
+			i += size - 1
+		}
+		if illegal {
+			p.pos = start
+			return "", p.errorf("column name contains an illegal char: %s", name)
+		}
+	}
+	return name, nil
+}
+
+func (p *lineParser) readField() (TypedValue, error) {
+	var (
+		col TypedValue
+		err error
+	)
+	col.Name, err = p.readColumnName()
+	if err != nil {
+		return col, err
+	}
+
+	if p.pos < len(p.line) && p.line[p.pos] == '"' {
+		col.Value, err = p.readQuotedString()
+		return col, err
+	}
+
+	start := p.pos
+	raw := p.readUntil(',', ' ')
+	col.Value, err = parseFieldValue(raw)
+	if err != nil {
+		p.pos = start
+		return col, p.errorf("%s: column %s", err, col.Name)
+	}
+	return col, nil
+}
+
+func (p *lineParser) readQuotedString() (string, error) {
+	start := p.pos
+	p.pos++ // opening '"'
+	var sb bytes.Buffer
+	for ; p.pos < len(p.line); p.pos++ {
+		ch := p.line[p.pos]
+		if ch == '"' {
+			p.pos++
+			return sb.String(), nil
+		}
+		if ch == '\\' && p.pos+1 < len(p.line) {
+			p.pos++
+			ch = p.line[p.pos]
+		}
+		sb.WriteByte(ch)
+	}
+	p.pos = start
+	return "", p.errorf("unterminated string value")
+}
+
+func parseFieldValue(raw string) (interface{}, error) {
+	switch raw {
+	case "":
+		return nil, fmt.Errorf("empty value")
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	num := raw[:len(raw)-1]
+	switch raw[len(raw)-1] {
+	case 'i':
+		if strings.HasPrefix(num, "0x") {
+			val, ok := new(big.Int).SetString(num[2:], 16)
+			if !ok || val.BitLen() > 256 {
+				return nil, fmt.Errorf("invalid long256 value %q", raw)
+			}
+			return val, nil
+		}
+		val, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer value %q", raw)
+		}
+		return val, nil
+	case 'u':
+		val, err := strconv.ParseUint(num, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unsigned integer value %q", raw)
+		}
+		return val, nil
+	case 't':
+		val, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp value %q", raw)
+		}
+		return time.UnixMicro(val).UTC(), nil
+	}
+
+	val, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", raw)
+	}
+	return val, nil
+}
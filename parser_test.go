@@ -0,0 +1,203 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		expected qdb.Row
+	}{
+		{
+			"symbols only",
+			"my_test_table,sym1=foo,sym2=bar\n",
+			qdb.Row{
+				Table:   testTable,
+				Symbols: []qdb.KV{{Name: "sym1", Value: "foo"}, {Name: "sym2", Value: "bar"}},
+			},
+		},
+		{
+			"symbols and designated timestamp",
+			"my_test_table,sym=foo 42",
+			qdb.Row{
+				Table:   testTable,
+				Symbols: []qdb.KV{{Name: "sym", Value: "foo"}},
+				Ts:      time.Unix(0, 42).UTC(),
+			},
+		},
+		{
+			"all column types",
+			"my_test_table,sym=foo long=-42i,long256=0x2ai,double=4.2,nan=NaN,inf=-Infinity,str=\"a b\",bool=t,ts=42t,unsigned=42u 1000\n",
+			qdb.Row{
+				Table:   testTable,
+				Symbols: []qdb.KV{{Name: "sym", Value: "foo"}},
+				Columns: []qdb.TypedValue{
+					{Name: "long", Value: int64(-42)},
+					{Name: "long256", Value: big.NewInt(42)},
+					{Name: "double", Value: 4.2},
+					{Name: "nan", Value: math.NaN()},
+					{Name: "inf", Value: math.Inf(-1)},
+					{Name: "str", Value: "a b"},
+					{Name: "bool", Value: true},
+					{Name: "ts", Value: time.UnixMicro(42).UTC()},
+					{Name: "unsigned", Value: uint64(42)},
+				},
+				Ts: time.Unix(0, 1000).UTC(),
+			},
+		},
+		{
+			"telegraf booleans and exponents",
+			"cpu a=TRUE,b=False,c=1e-3",
+			qdb.Row{
+				Table: "cpu",
+				Columns: []qdb.TypedValue{
+					{Name: "a", Value: true},
+					{Name: "b", Value: false},
+					{Name: "c", Value: 0.001},
+				},
+			},
+		},
+		{
+			"escaped chars",
+			"my\\ table,sym\\ name=a\\,b\\=c\\\\d\\\ne str=\"x\\\"y\\\\z\\\nw\"\r\n",
+			qdb.Row{
+				Table:   "my table",
+				Symbols: []qdb.KV{{Name: "sym name", Value: "a,b=c\\d\ne"}},
+				Columns: []qdb.TypedValue{{Name: "str", Value: "x\"y\\z\nw"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			row, err := qdb.ParseLine([]byte(tc.line))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.Table, row.Table)
+			assert.Equal(t, tc.expected.Symbols, row.Symbols)
+			assert.Equal(t, tc.expected.Ts, row.Ts)
+			assert.Len(t, row.Columns, len(tc.expected.Columns))
+			for i, col := range tc.expected.Columns {
+				if f, ok := col.Value.(float64); ok && math.IsNaN(f) {
+					assert.True(t, math.IsNaN(row.Columns[i].Value.(float64)))
+					continue
+				}
+				assert.Equal(t, col, row.Columns[i])
+			}
+		})
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		line        string
+		expectedErr string
+	}{
+		{"empty", "", "table name cannot be empty"},
+		{"table only", "foo", "no symbols or columns found"},
+		{"illegal table name char", "fo?o a=1i", "table name contains an illegal char"},
+		{"leading dot in table name", ".foo a=1i", "table name contains '.' char at the start or end"},
+		{"illegal column name char", "foo a-b=1i", "column name contains an illegal char"},
+		{"missing value separator", "foo,a b=1i", "missing '=' after column name"},
+		{"empty value", "foo a=", "empty value"},
+		{"invalid integer", "foo a=1.5i", "invalid integer value"},
+		{"invalid long256", "foo a=0xzzi", "invalid long256 value"},
+		{"invalid float", "foo a=abc", "invalid value"},
+		{"unterminated string", "foo a=\"abc", "unterminated string value"},
+		{"garbage after string", "foo a=\"abc\"d", "unexpected char after column value"},
+		{"invalid timestamp", "foo a=1i abc", "invalid designated timestamp"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := qdb.ParseLine([]byte(tc.line))
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestParseLineRoundTrip(t *testing.T) {
+	buf := newTestBuffer()
+
+	err := buf.Table(testTable).
+		Symbol("sym", "a b,c=d\\e\nf").
+		Int64Column("long", math.MinInt64).
+		Long256Column("long256", big.NewInt(7423093023234231)).
+		Float64Column("double", -4.2e-99).
+		StringColumn("str", "\"quoted\"\r\n\\").
+		BoolColumn("bool", false).
+		TimestampColumn("ts", time.UnixMicro(42)).
+		At(time.Unix(0, 1000), true)
+	assert.NoError(t, err)
+
+	row, err := qdb.ParseLine([]byte(buf.Messages()))
+	assert.NoError(t, err)
+	assert.Equal(t, qdb.Row{
+		Table:   testTable,
+		Symbols: []qdb.KV{{Name: "sym", Value: "a b,c=d\\e\nf"}},
+		Columns: []qdb.TypedValue{
+			{Name: "long", Value: int64(math.MinInt64)},
+			{Name: "long256", Value: big.NewInt(7423093023234231)},
+			{Name: "double", Value: -4.2e-99},
+			{Name: "str", Value: "\"quoted\"\r\n\\"},
+			{Name: "bool", Value: false},
+			{Name: "ts", Value: time.UnixMicro(42).UTC()},
+		},
+		Ts: time.Unix(0, 1000).UTC(),
+	}, row)
+}
+
+func TestLineDecoder(t *testing.T) {
+	input := "foo a=1i\n\nbar,sym=x\\\ny b=2i 42\nbaz c=3i"
+
+	d := qdb.NewLineDecoder(strings.NewReader(input))
+	var tables []string
+	for d.Next() {
+		tables = append(tables, d.Row().Table)
+	}
+	assert.NoError(t, d.Err())
+	assert.Equal(t, []string{"foo", "bar", "baz"}, tables)
+}
+
+func TestLineDecoderError(t *testing.T) {
+	input := "foo a=1i\nbar b=x\nbaz c=3i\n"
+
+	d := qdb.NewLineDecoder(strings.NewReader(input))
+	assert.True(t, d.Next())
+	assert.False(t, d.Next())
+	assert.ErrorContains(t, d.Err(), "line 2: invalid ILP line")
+	assert.False(t, d.Next())
+}
@@ -0,0 +1,68 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package pg_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/questdb/go-questdb-client/v3/pg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLong256Scan(t *testing.T) {
+	maxVal, _ := new(big.Int).SetString("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16)
+
+	testCases := []struct {
+		name     string
+		src      interface{}
+		expected pg.Long256
+	}{
+		{"null", nil, pg.Long256{}},
+		{"hex string", "0x1a5f4386c8d8b7", pg.Long256{Int: big.NewInt(7423093023234231), Valid: true}},
+		{"hex bytes", []byte("0x2a"), pg.Long256{Int: big.NewInt(42), Valid: true}},
+		{"decimal string", "42", pg.Long256{Int: big.NewInt(42), Valid: true}},
+		{"max value", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", pg.Long256{Int: maxVal, Valid: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var l pg.Long256
+			err := l.Scan(tc.src)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, l)
+		})
+	}
+}
+
+func TestLong256ScanErrors(t *testing.T) {
+	var l pg.Long256
+
+	err := l.Scan(42)
+	assert.ErrorContains(t, err, "cannot scan int into Long256")
+
+	err = l.Scan("0xzz")
+	assert.ErrorContains(t, err, "invalid long256 value")
+}
@@ -0,0 +1,152 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultPlanCacheCapacity = 1024
+
+// globalPlanCache keeps struct encoding plans shared by all encoders
+// and WriteStruct calls.
+var globalPlanCache = newPlanCache(defaultPlanCacheCapacity)
+
+// PlanCacheStats holds statistics of the struct encoding plan cache.
+type PlanCacheStats struct {
+	// Hits is the number of lookups served from the cache.
+	Hits uint64
+	// Misses is the number of lookups that built a new plan.
+	Misses uint64
+	// Evictions is the number of plans evicted due to the capacity.
+	Evictions uint64
+	// Size is the number of cached plans.
+	Size int
+	// Capacity is the maximum number of cached plans.
+	Capacity int
+}
+
+// GetPlanCacheStats returns statistics of the struct encoding plan
+// cache shared by Encoder instances and WriteStruct calls.
+func GetPlanCacheStats() PlanCacheStats {
+	return globalPlanCache.stats()
+}
+
+// SetPlanCacheCapacity sets the maximum number of struct encoding
+// plans kept in the cache. Defaults to 1024. Plans of types that are
+// used by existing Encoder instances are not affected by evictions.
+func SetPlanCacheCapacity(capacity int) error {
+	if capacity <= 0 {
+		return errors.New("plan cache capacity must be positive")
+	}
+	globalPlanCache.setCapacity(capacity)
+	return nil
+}
+
+type planCacheEntry struct {
+	enc *structEncoder
+	err error
+}
+
+// planCache is a concurrent, bounded type to encoding plan cache.
+// Lookups only take the read lock. When the cache is full, an
+// arbitrary plan is evicted.
+type planCache struct {
+	mu       sync.RWMutex
+	capacity int
+	entries  map[reflect.Type]planCacheEntry
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+func newPlanCache(capacity int) *planCache {
+	return &planCache{
+		capacity: capacity,
+		entries:  make(map[reflect.Type]planCacheEntry),
+	}
+}
+
+// get returns the encoding plan for the given struct type or
+// a pointer to struct type. Errors are cached as well.
+func (c *planCache) get(typ reflect.Type) (*structEncoder, error) {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	c.mu.RLock()
+	e, ok := c.entries[typ]
+	c.mu.RUnlock()
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+		return e.enc, e.err
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	e.enc, e.err = newStructEncoder(typ)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[typ]; !ok {
+		c.evict(c.capacity - 1)
+		c.entries[typ] = e
+	}
+	return e.enc, e.err
+}
+
+// evict removes arbitrary entries until the cache size
+// doesn't exceed the given size. Must be called under the lock.
+func (c *planCache) evict(size int) {
+	for typ := range c.entries {
+		if len(c.entries) <= size {
+			return
+		}
+		delete(c.entries, typ)
+		c.evictions++
+	}
+}
+
+func (c *planCache) setCapacity(capacity int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capacity = capacity
+	c.evict(capacity)
+}
+
+func (c *planCache) stats() PlanCacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return PlanCacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: c.evictions,
+		Size:      len(c.entries),
+		Capacity:  c.capacity,
+	}
+}
@@ -0,0 +1,221 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// LineSenderPool is a pool of line senders created with the same
+// options. Since LineSender is not safe for concurrent use, the pool
+// lets concurrent goroutines share a bounded number of senders.
+//
+// Example usage:
+//
+//	pool, err := qdb.NewLineSenderPool(4, qdb.WithHttp())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer pool.Close(ctx)
+//
+//	sender, err := pool.Acquire(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	err = sender.Table("trades").Float64Column("price", 2615.54).AtNow(ctx)
+//	if err != nil {
+//		pool.Discard(sender)
+//		log.Fatal(err)
+//	}
+//	pool.Release(sender)
+//
+// LineSenderPool is safe for concurrent use.
+type LineSenderPool struct {
+	newSender func(ctx context.Context) (LineSender, error)
+	// sem limits the number of senders handed out by the pool.
+	sem chan struct{}
+
+	mu            sync.Mutex
+	idle          []LineSender
+	inUse         int
+	waiters       int
+	created       int64
+	closedOnError int64
+	closed        bool
+}
+
+// PoolStats holds LineSenderPool statistics.
+type PoolStats struct {
+	// Idle is the number of senders available in the pool.
+	Idle int
+	// InUse is the number of acquired senders.
+	InUse int
+	// Waiters is the number of Acquire calls waiting for a sender.
+	Waiters int
+	// Created is the total number of senders created by the pool.
+	Created int64
+	// ClosedOnError is the total number of senders closed with
+	// the Discard method.
+	ClosedOnError int64
+}
+
+var errPoolClosed = errors.New("line sender pool is closed")
+
+// NewLineSenderPool creates a pool of at most maxSenders senders.
+// Senders are created lazily with the given options.
+func NewLineSenderPool(maxSenders int, opts ...LineSenderOption) (*LineSenderPool, error) {
+	return newLineSenderPool(maxSenders, func(ctx context.Context) (LineSender, error) {
+		return NewLineSender(ctx, opts...)
+	})
+}
+
+func newLineSenderPool(maxSenders int, newSender func(ctx context.Context) (LineSender, error)) (*LineSenderPool, error) {
+	if maxSenders <= 0 {
+		return nil, errors.New("max senders is not positive")
+	}
+	return &LineSenderPool{
+		newSender: newSender,
+		sem:       make(chan struct{}, maxSenders),
+	}, nil
+}
+
+// Acquire returns an idle sender or creates a new one. If the pool
+// is exhausted, the call blocks until another goroutine releases
+// a sender or the context is done.
+//
+// The sender must be returned to the pool with Release or Discard.
+func (p *LineSenderPool) Acquire(ctx context.Context) (LineSender, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+	p.waiters++
+	p.mu.Unlock()
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.waiters--
+		p.mu.Unlock()
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	p.waiters--
+	if p.closed {
+		p.mu.Unlock()
+		<-p.sem
+		return nil, errPoolClosed
+	}
+	p.inUse++
+	if n := len(p.idle); n > 0 {
+		s := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return s, nil
+	}
+	p.mu.Unlock()
+
+	s, err := p.newSender(ctx)
+	p.mu.Lock()
+	if err != nil {
+		p.inUse--
+	} else {
+		p.created++
+	}
+	p.mu.Unlock()
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	return s, nil
+}
+
+// Release returns the sender to the pool. Pending messages are
+// kept in the sender's buffer, so it's up to the caller to flush
+// them, if necessary.
+func (p *LineSenderPool) Release(s LineSender) {
+	p.mu.Lock()
+	p.inUse--
+	closed := p.closed
+	if !closed {
+		p.idle = append(p.idle, s)
+	}
+	p.mu.Unlock()
+	<-p.sem
+
+	if closed {
+		s.Close(context.Background())
+	}
+}
+
+// Discard closes the sender instead of returning it to the pool.
+// Should be called when the sender failed, e.g. after a network
+// error, so that the next Acquire call creates a new sender.
+func (p *LineSenderPool) Discard(s LineSender) {
+	p.mu.Lock()
+	p.inUse--
+	p.closedOnError++
+	p.mu.Unlock()
+	<-p.sem
+
+	s.Close(context.Background())
+}
+
+// Stats returns the pool statistics.
+func (p *LineSenderPool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		Idle:          len(p.idle),
+		InUse:         p.inUse,
+		Waiters:       p.waiters,
+		Created:       p.created,
+		ClosedOnError: p.closedOnError,
+	}
+}
+
+// Close closes all idle senders, flushing their pending messages.
+// Acquired senders are closed once they are released. The first
+// error returned by the senders, if any, is returned.
+func (p *LineSenderPool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	var err error
+	for _, s := range idle {
+		if closeErr := s.Close(ctx); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
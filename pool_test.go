@@ -0,0 +1,145 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineSenderPool(t *testing.T) {
+	ctx := context.Background()
+
+	pool, err := qdb.NewLineSenderPool(2, qdb.WithHttp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+
+	s1, err := pool.Acquire(ctx)
+	assert.NoError(t, err)
+	s2, err := pool.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, qdb.PoolStats{InUse: 2, Created: 2}, pool.Stats())
+
+	// The pool is exhausted.
+	acquired := make(chan qdb.LineSender)
+	go func() {
+		s, err := pool.Acquire(ctx)
+		assert.NoError(t, err)
+		acquired <- s
+	}()
+	assert.Eventually(t, func() bool {
+		return pool.Stats().Waiters == 1
+	}, 5*time.Second, time.Millisecond)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.Acquire(timeoutCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The waiter gets the released sender.
+	pool.Release(s1)
+	s3 := <-acquired
+	assert.Same(t, s1, s3)
+	assert.Equal(t, qdb.PoolStats{InUse: 2, Created: 2}, pool.Stats())
+
+	// A discarded sender is replaced with a new one.
+	pool.Discard(s2)
+	s4, err := pool.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.NotSame(t, s2, s4)
+	pool.Release(s4)
+	assert.Equal(t, qdb.PoolStats{Idle: 1, InUse: 1, Created: 3, ClosedOnError: 1}, pool.Stats())
+
+	err = pool.Close(ctx)
+	assert.NoError(t, err)
+	_, err = pool.Acquire(ctx)
+	assert.ErrorContains(t, err, "line sender pool is closed")
+	pool.Release(s3)
+	assert.Equal(t, qdb.PoolStats{Created: 3, ClosedOnError: 1}, pool.Stats())
+}
+
+func TestLineSenderPoolErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := qdb.NewLineSenderPool(0, qdb.WithHttp())
+	assert.ErrorContains(t, err, "max senders is not positive")
+
+	pool, err := qdb.NewLineSenderPool(1, qdb.WithHttp(), qdb.WithInitBufferSize(-1))
+	assert.NoError(t, err)
+	defer pool.Close(ctx)
+
+	// Failed senders don't occupy the pool.
+	for i := 0; i < 2; i++ {
+		_, err = pool.Acquire(ctx)
+		assert.ErrorContains(t, err, "initial buffer size is negative")
+	}
+	assert.Equal(t, qdb.PoolStats{}, pool.Stats())
+}
+
+func TestBufferPool(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	bufPool := qdb.NewBufferPool(1024 * 1024)
+	opts := []qdb.LineSenderOption{qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithInitBufferSize(1024), qdb.WithBufferPool(bufPool)}
+	s1, err := qdb.NewLineSender(ctx, opts...)
+	assert.NoError(t, err)
+	defer s1.Close(ctx)
+	s2, err := qdb.NewLineSender(ctx, opts...)
+	assert.NoError(t, err)
+	defer s2.Close(ctx)
+
+	// The flushed buffer goes back to the pool.
+	err = s1.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, s1.Flush(ctx))
+	assert.Equal(t, 1024, bufPool.IdleBytes())
+	expectLines(t, srv.BackCh, []string{testTable + " a=1i"})
+
+	// The other sender takes it for its batch.
+	err = s2.Table(testTable).Int64Column("a", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, bufPool.IdleBytes())
+	assert.NoError(t, s2.Flush(ctx))
+	assert.Equal(t, 1024, bufPool.IdleBytes())
+	expectLines(t, srv.BackCh, []string{testTable + " a=2i"})
+
+	// Buffers beyond the cap are not pooled.
+	smallPool := qdb.NewBufferPool(512)
+	s3, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithInitBufferSize(1024), qdb.WithBufferPool(smallPool))
+	assert.NoError(t, err)
+	defer s3.Close(ctx)
+	err = s3.Table(testTable).Int64Column("a", 3).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, s3.Flush(ctx))
+	assert.Zero(t, smallPool.IdleBytes())
+	expectLines(t, srv.BackCh, []string{testTable + " a=3i"})
+}
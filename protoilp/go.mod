@@ -0,0 +1,17 @@
+module github.com/questdb/go-questdb-client/v3/protoilp
+
+go 1.19
+
+require (
+	github.com/questdb/go-questdb-client/v3 v3.0.0
+	github.com/stretchr/testify v1.9.0
+	google.golang.org/protobuf v1.31.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/questdb/go-questdb-client/v3 => ../
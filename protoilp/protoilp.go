@@ -0,0 +1,258 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+// Package protoilp maps protobuf messages to ILP rows, so that event
+// streams, e.g. gRPC ones, can be ingested without hand-written
+// conversion layers. Messages are read with protoreflect, so both
+// generated and dynamic messages are supported.
+//
+// Fields are mapped to columns by their proto names. The mapping
+// rules are:
+//
+//   - bool fields are written as boolean columns.
+//   - Signed integer, uint32 and fixed32 fields are written as long
+//     columns, uint64 and fixed64 fields as unsigned long columns.
+//   - float and double fields are written as double columns.
+//   - string fields are written as string columns while enum fields
+//     are written as string columns holding the value name.
+//   - bytes fields are written as base64-encoded string columns.
+//   - google.protobuf.Timestamp fields are written as timestamp
+//     columns and wrapper type fields, e.g. google.protobuf.Int64Value,
+//     as their wrapped values.
+//   - Other message fields are flattened, i.e. their fields are written
+//     with the "parent_" name prefix.
+//   - Repeated and map fields are not supported and must be skipped.
+//
+// Unset fields with explicit presence, e.g. optional or message
+// fields, are omitted, so their columns are null.
+//
+// The package is a separate module, so that the client doesn't
+// depend on protobuf.
+package protoilp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const timestampName = "google.protobuf.Timestamp"
+
+// Mapping is a message to row mapping spec. Fields are referred by
+// their dot-separated proto name paths, e.g. "meta.source" stands for
+// the source field of the meta message field.
+type Mapping struct {
+	// Table is the table name. The message name is used if empty.
+	Table string
+	// Symbols lists the string or enum fields written as symbols.
+	Symbols []string
+	// Timestamp is the google.protobuf.Timestamp field used as the
+	// designated timestamp. The server assigns the timestamp on
+	// insertion if empty or if the field is unset.
+	Timestamp string
+	// Columns renames the fields. The default column names are
+	// the field paths with dots replaced by underscores.
+	Columns map[string]string
+	// Skip lists the fields, including the message fields, that are
+	// not written.
+	Skip []string
+}
+
+// Adapter converts protobuf messages to rows according to a Mapping.
+// An Adapter is safe for concurrent use.
+type Adapter struct {
+	table     string
+	symbols   map[string]bool
+	timestamp string
+	columns   map[string]string
+	skip      map[string]bool
+}
+
+// NewAdapter creates an Adapter for the given mapping spec.
+func NewAdapter(m Mapping) *Adapter {
+	a := &Adapter{
+		table:     m.Table,
+		symbols:   make(map[string]bool, len(m.Symbols)),
+		timestamp: m.Timestamp,
+		columns:   make(map[string]string, len(m.Columns)),
+		skip:      make(map[string]bool, len(m.Skip)),
+	}
+	for _, s := range m.Symbols {
+		a.symbols[s] = true
+	}
+	for k, v := range m.Columns {
+		a.columns[k] = v
+	}
+	for _, s := range m.Skip {
+		a.skip[s] = true
+	}
+	return a
+}
+
+// Row converts the message to a row.
+func (a *Adapter) Row(msg proto.Message) (qdb.Row, error) {
+	m := msg.ProtoReflect()
+	row := qdb.Row{Table: a.table}
+	if row.Table == "" {
+		row.Table = string(m.Descriptor().Name())
+	}
+	if err := a.appendFields(&row, m, ""); err != nil {
+		return qdb.Row{}, err
+	}
+	return row, nil
+}
+
+// Write converts the message to a row and writes it to the sender.
+func (a *Adapter) Write(ctx context.Context, s qdb.LineSender, msg proto.Message) error {
+	row, err := a.Row(msg)
+	if err != nil {
+		return err
+	}
+	return s.Write(ctx, row)
+}
+
+func (a *Adapter) appendFields(row *qdb.Row, m protoreflect.Message, prefix string) error {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+		if a.skip[path] {
+			continue
+		}
+		if fd.HasPresence() && !m.Has(fd) {
+			continue
+		}
+		if fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("protoilp: unsupported repeated field: %s", path)
+		}
+		if err := a.appendField(row, fd, m.Get(fd), path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Adapter) appendField(row *qdb.Row, fd protoreflect.FieldDescriptor, v protoreflect.Value, path string) error {
+	if path == a.timestamp {
+		ts, ok := timestampValue(fd, v)
+		if !ok {
+			return fmt.Errorf("protoilp: designated timestamp field is not a %s: %s", timestampName, path)
+		}
+		row.Ts = ts
+		return nil
+	}
+
+	if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		if ts, ok := timestampValue(fd, v); ok {
+			row.Columns = append(row.Columns, qdb.TypedValue{Name: a.columnName(path), Value: ts})
+			return nil
+		}
+		if wfd, ok := wrappedField(v.Message()); ok {
+			return a.appendField(row, wfd, v.Message().Get(wfd), path)
+		}
+		return a.appendFields(row, v.Message(), path+".")
+	}
+
+	if a.symbols[path] {
+		var val string
+		switch fd.Kind() {
+		case protoreflect.StringKind:
+			val = v.String()
+		case protoreflect.EnumKind:
+			val = enumName(fd, v)
+		default:
+			return fmt.Errorf("protoilp: symbol field is not a string or enum: %s: %s", path, fd.Kind())
+		}
+		row.Symbols = append(row.Symbols, qdb.KV{Name: a.columnName(path), Value: val})
+		return nil
+	}
+
+	var val interface{}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		val = v.Bool()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		val = v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		val = int64(v.Uint())
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		val = v.Uint()
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		val = v.Float()
+	case protoreflect.StringKind:
+		val = v.String()
+	case protoreflect.EnumKind:
+		val = enumName(fd, v)
+	case protoreflect.BytesKind:
+		val = base64.StdEncoding.EncodeToString(v.Bytes())
+	default:
+		return fmt.Errorf("protoilp: unsupported field kind: %s: %s", path, fd.Kind())
+	}
+	row.Columns = append(row.Columns, qdb.TypedValue{Name: a.columnName(path), Value: val})
+	return nil
+}
+
+func (a *Adapter) columnName(path string) string {
+	if name, ok := a.columns[path]; ok {
+		return name
+	}
+	return strings.ReplaceAll(path, ".", "_")
+}
+
+// timestampValue converts a google.protobuf.Timestamp field value.
+func timestampValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) (time.Time, bool) {
+	if fd.Kind() != protoreflect.MessageKind || fd.Message().FullName() != timestampName {
+		return time.Time{}, false
+	}
+	m := v.Message()
+	fields := fd.Message().Fields()
+	secs := m.Get(fields.ByName("seconds")).Int()
+	nanos := m.Get(fields.ByName("nanos")).Int()
+	return time.Unix(secs, nanos).UTC(), true
+}
+
+// wrappedField returns the value field of a wrapper type message,
+// e.g. google.protobuf.Int64Value.
+func wrappedField(m protoreflect.Message) (protoreflect.FieldDescriptor, bool) {
+	d := m.Descriptor()
+	if d.ParentFile() == nil || d.ParentFile().Path() != "google/protobuf/wrappers.proto" {
+		return nil, false
+	}
+	fd := d.Fields().ByName("value")
+	return fd, fd != nil
+}
+
+func enumName(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+		return string(ev.Name())
+	}
+	return fmt.Sprint(int32(v.Enum()))
+}
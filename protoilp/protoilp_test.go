@@ -0,0 +1,225 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package protoilp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/questdb/go-questdb-client/v3/protoilp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// eventDescriptor describes the following message:
+//
+//	enum Level { INFO = 0; WARN = 1; }
+//	message Meta { string source = 1; uint64 seq = 2; }
+//	message Event {
+//	  string host = 1;
+//	  Level level = 2;
+//	  int32 code = 3;
+//	  double value = 4;
+//	  bool ok = 5;
+//	  bytes payload = 6;
+//	  google.protobuf.Timestamp ts = 7;
+//	  google.protobuf.Int64Value count = 8;
+//	  Meta meta = 9;
+//	  repeated string tags = 10;
+//	}
+func eventDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(num),
+			Type:   typ.Enum(),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	tags := field("tags", 10, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	tags.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("event.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto", "google/protobuf/wrappers.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Level"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("INFO"), Number: proto.Int32(0)},
+				{Name: proto.String("WARN"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Meta"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("source", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("seq", 2, descriptorpb.FieldDescriptorProto_TYPE_UINT64, ""),
+				},
+			},
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("host", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("level", 2, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Level"),
+					field("code", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+					field("value", 4, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+					field("ok", 5, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+					field("payload", 6, descriptorpb.FieldDescriptorProto_TYPE_BYTES, ""),
+					field("ts", 7, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+					field("count", 8, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Int64Value"),
+					field("meta", 9, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Meta"),
+					tags,
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	assert.NoError(t, err)
+	return fd.Messages().ByName("Event")
+}
+
+func newEvent(t *testing.T) *dynamicpb.Message {
+	desc := eventDescriptor(t)
+	msg := dynamicpb.NewMessage(desc)
+	set := func(name string, v protoreflect.Value) {
+		msg.Set(desc.Fields().ByName(protoreflect.Name(name)), v)
+	}
+	set("host", protoreflect.ValueOfString("h1"))
+	set("level", protoreflect.ValueOfEnum(1))
+	set("code", protoreflect.ValueOfInt32(42))
+	set("value", protoreflect.ValueOfFloat64(1.5))
+	set("payload", protoreflect.ValueOfBytes([]byte("hi")))
+	set("ts", protoreflect.ValueOfMessage(timestamppb.New(time.UnixMicro(1000)).ProtoReflect()))
+	set("count", protoreflect.ValueOfMessage(wrapperspb.Int64(7).ProtoReflect()))
+
+	meta := dynamicpb.NewMessage(desc.Fields().ByName("meta").Message())
+	meta.Set(meta.Descriptor().Fields().ByName("source"), protoreflect.ValueOfString("api"))
+	meta.Set(meta.Descriptor().Fields().ByName("seq"), protoreflect.ValueOfUint64(3))
+	set("meta", protoreflect.ValueOfMessage(meta))
+	return msg
+}
+
+func TestAdapterRow(t *testing.T) {
+	a := protoilp.NewAdapter(protoilp.Mapping{
+		Symbols:   []string{"host", "meta.source"},
+		Timestamp: "ts",
+		Columns:   map[string]string{"meta.seq": "seq"},
+		Skip:      []string{"tags"},
+	})
+
+	row, err := a.Row(newEvent(t))
+	assert.NoError(t, err)
+	assert.Equal(t, qdb.Row{
+		Table: "Event",
+		Symbols: []qdb.KV{
+			{Name: "host", Value: "h1"},
+			{Name: "meta_source", Value: "api"},
+		},
+		Columns: []qdb.TypedValue{
+			{Name: "level", Value: "WARN"},
+			{Name: "code", Value: int64(42)},
+			{Name: "value", Value: 1.5},
+			// Implicit presence fields are written with zero values.
+			{Name: "ok", Value: false},
+			{Name: "payload", Value: "aGk="},
+			{Name: "count", Value: int64(7)},
+			{Name: "seq", Value: uint64(3)},
+		},
+		Ts: time.UnixMicro(1000).UTC(),
+	}, row)
+}
+
+func TestAdapterWrite(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	msg := newEvent(t)
+	msg.Clear(msg.Descriptor().Fields().ByName("meta"))
+	a := protoilp.NewAdapter(protoilp.Mapping{
+		Table:     "events",
+		Symbols:   []string{"level"},
+		Timestamp: "ts",
+		Skip:      []string{"tags", "payload"},
+	})
+	err = a.Write(ctx, sender, msg)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+
+	it := sender.(qdb.DryRunSender).Lines()
+	assert.True(t, it.Next())
+	assert.Equal(t, "events,level=WARN host=\"h1\",code=42i,value=1.5,ok=f,count=7i 1000000", it.Line())
+	assert.False(t, it.Next())
+}
+
+func TestAdapterErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mapping  protoilp.Mapping
+		expected string
+	}{
+		{
+			name:     "repeated field",
+			mapping:  protoilp.Mapping{},
+			expected: "unsupported repeated field: tags",
+		},
+		{
+			name:     "non-string symbol",
+			mapping:  protoilp.Mapping{Symbols: []string{"code"}, Skip: []string{"tags"}},
+			expected: "symbol field is not a string or enum: code",
+		},
+		{
+			name:     "non-timestamp designated timestamp",
+			mapping:  protoilp.Mapping{Timestamp: "code", Skip: []string{"tags"}},
+			expected: "designated timestamp field is not a google.protobuf.Timestamp: code",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := newEvent(t)
+			_, err := protoilp.NewAdapter(tc.mapping).Row(msg)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
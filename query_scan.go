@@ -0,0 +1,163 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Scan decodes the result set rows into dst, which must be a pointer
+// to a slice of structs or struct pointers. Columns are mapped to
+// struct fields with the same "qdb" tags that are used by WriteStruct,
+// so the written rows can be read back into the same types.
+//
+// Result set columns that have no corresponding field are ignored.
+// Fields with no corresponding column and null values are left zeroed.
+//
+// Since the dataset is decoded from JSON, integer values beyond 2^53
+// lose precision.
+func (r *QueryResult) Scan(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("expected a pointer to a slice, got %T", dst)
+	}
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	structType := elemType
+	if elemType.Kind() == reflect.Pointer {
+		structType = elemType.Elem()
+	}
+
+	plan, err := newStructPlan(structType)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]structField, len(plan.symbols)+len(plan.columns))
+	for _, f := range plan.symbols {
+		byName[f.name] = f
+	}
+	for _, f := range plan.columns {
+		byName[f.name] = f
+	}
+	// Fields corresponding to result set columns; nil for
+	// the columns without a field.
+	fields := make([]*structField, len(r.Columns))
+	for i, col := range r.Columns {
+		if f, ok := byName[col.Name]; ok {
+			fields[i] = &f
+		}
+	}
+
+	rows := reflect.MakeSlice(slice.Type(), 0, len(r.Dataset))
+	for i, values := range r.Dataset {
+		if len(values) != len(fields) {
+			return fmt.Errorf("row %d: expected %d values, got %d", i, len(fields), len(values))
+		}
+		row := reflect.New(structType).Elem()
+		for j, f := range fields {
+			if f == nil || values[j] == nil {
+				continue
+			}
+			if err := scanValue(row.Field(f.index), f.kind, values[j]); err != nil {
+				return fmt.Errorf("row %d: column %s: %w", i, f.name, err)
+			}
+		}
+		if elemType.Kind() == reflect.Pointer {
+			row = row.Addr()
+		}
+		rows = reflect.Append(rows, row)
+	}
+	slice.Set(rows)
+	return nil
+}
+
+func scanValue(field reflect.Value, kind fieldKind, val interface{}) error {
+	switch kind {
+	case fieldSymbol, fieldString:
+		s, ok := val.(string)
+		if !ok {
+			return unexpectedValue(val)
+		}
+		field.SetString(s)
+	case fieldBool:
+		b, ok := val.(bool)
+		if !ok {
+			return unexpectedValue(val)
+		}
+		field.SetBool(b)
+	case fieldInt, fieldUint:
+		n, ok := val.(float64)
+		if !ok {
+			return unexpectedValue(val)
+		}
+		if field.CanInt() {
+			if field.OverflowInt(int64(n)) {
+				return fmt.Errorf("value %v overflows %s", n, field.Type())
+			}
+			field.SetInt(int64(n))
+		} else {
+			if n < 0 || field.OverflowUint(uint64(n)) {
+				return fmt.Errorf("value %v overflows %s", n, field.Type())
+			}
+			field.SetUint(uint64(n))
+		}
+	case fieldFloat:
+		n, ok := val.(float64)
+		if !ok {
+			return unexpectedValue(val)
+		}
+		field.SetFloat(n)
+	case fieldTimestamp:
+		s, ok := val.(string)
+		if !ok {
+			return unexpectedValue(val)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(ts))
+	case fieldLong256:
+		s, ok := val.(string)
+		if !ok {
+			return unexpectedValue(val)
+		}
+		n, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+		if !ok {
+			return errors.New("invalid long256 value: " + s)
+		}
+		field.Set(reflect.ValueOf(n))
+	}
+	return nil
+}
+
+func unexpectedValue(val interface{}) error {
+	return fmt.Errorf("unexpected value type: %T", val)
+}
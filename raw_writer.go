@@ -0,0 +1,201 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// lineSplitter splits the written bytes into ILP lines. An incomplete
+// trailing line is kept aside until its newline is written.
+type lineSplitter struct {
+	partial []byte
+}
+
+// write passes the complete lines of p, including the one started by
+// the previous writes, to writeLine. If writeLine fails, it returns
+// the number of bytes of p of the lines written so far, and the
+// failed line is dropped unless it started in the previous writes.
+// In that case the started line is kept, so that the write can be
+// retried with the rest of p.
+func (s *lineSplitter) write(p []byte, writeLine func(line []byte) error) (int, error) {
+	prev := len(s.partial)
+	data := p
+	if prev > 0 {
+		s.partial = append(s.partial, p...)
+		data = s.partial
+	}
+
+	pos := 0
+	for {
+		advance, line, _ := scanIlpLines(data[pos:], false)
+		if advance == 0 {
+			break
+		}
+		if err := writeLine(line); err != nil {
+			if pos < prev {
+				s.partial = s.partial[:copy(s.partial, data[pos:prev])]
+				return 0, err
+			}
+			s.partial = s.partial[:0]
+			return pos - prev, err
+		}
+		pos += advance
+	}
+
+	if prev > 0 {
+		s.partial = s.partial[:copy(s.partial, data[pos:])]
+	} else {
+		s.partial = append(s.partial, data[pos:]...)
+	}
+	return len(p), nil
+}
+
+// rawWriter is an io.Writer that appends pre-formatted ILP lines to
+// the sender's buffer. An incomplete trailing line is kept aside until
+// its newline is written, so the buffer always holds complete lines.
+type rawWriter struct {
+	buf       *buffer
+	autoFlush func(ctx context.Context) error
+	lines     lineSplitter
+}
+
+func newRawWriter(buf *buffer, autoFlush func(ctx context.Context) error) *rawWriter {
+	return &rawWriter{
+		buf:       buf,
+		autoFlush: autoFlush,
+	}
+}
+
+func (w *rawWriter) Write(p []byte) (int, error) {
+	if w.buf.HasTable() {
+		return 0, fmt.Errorf("%w before writing raw ILP", ErrPendingMessage)
+	}
+
+	if n, err := w.lines.write(p, w.buf.writeRawLine); err != nil {
+		return n, err
+	}
+
+	if w.autoFlush != nil {
+		if err := w.autoFlush(context.Background()); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// AtRaw appends a complete ILP line to the buffer as is.
+func (b *buffer) AtRaw(line []byte) error {
+	if b.hasTable {
+		return fmt.Errorf("%w before calling AtRaw", ErrPendingMessage)
+	}
+	if len(line) == 0 {
+		return fmt.Errorf("raw ILP line is empty: %w", ErrInvalidLine)
+	}
+	return b.writeRawLine(line)
+}
+
+var errRawLineRedactor = errors.New("raw ILP lines are not available with a redactor")
+
+// writeRawLine appends a complete ILP line to the buffer. The
+// trailing newline is added if it's missing.
+func (b *buffer) writeRawLine(line []byte) error {
+	if b.redactor != nil {
+		// Raw lines can't be redacted, so they could leak the
+		// values the redactor is meant to mask.
+		return errRawLineRedactor
+	}
+	if err := b.checkPendingRows(); err != nil {
+		return err
+	}
+	size := len(line)
+	newline := line[size-1] != '\n'
+	if newline {
+		size++
+	}
+	if b.maxBufSize > 0 && b.Len()+size > b.maxBufSize {
+		return fmt.Errorf("%w: size=%d, limit=%d", ErrBufferFull, b.Len()+size, b.maxBufSize)
+	}
+	b.Write(line)
+	if newline {
+		b.WriteByte('\n')
+	}
+	b.commitMsg()
+	return nil
+}
+
+// BatchWriter is an io.WriteCloser that appends pre-formatted ILP
+// lines to a LineSender with AtRaw. Each Write is expected to hold
+// complete lines, but a line split across writes, e.g. by a
+// bufio.Writer or io.Copy, is kept aside until its newline is
+// written. Close sends the trailing line, if any, and flushes the
+// sender. The sender itself is not closed.
+//
+// BatchWriter is not safe for concurrent use.
+type BatchWriter struct {
+	ctx    context.Context
+	sender LineSender
+	lines  lineSplitter
+	closed bool
+}
+
+// NewBatchWriter creates a BatchWriter on top of the given sender.
+// The context is used for the auto-flushes and the final flush.
+func NewBatchWriter(ctx context.Context, sender LineSender) *BatchWriter {
+	return &BatchWriter{
+		ctx:    ctx,
+		sender: sender,
+	}
+}
+
+// Write appends the complete lines of p to the sender. On error, it
+// returns the number of bytes of p of the lines appended so far.
+func (w *BatchWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("cannot write to BatchWriter: %w", ErrClosed)
+	}
+	return w.lines.write(p, func(line []byte) error {
+		return w.sender.AtRaw(w.ctx, line)
+	})
+}
+
+// Close sends the trailing line that misses the newline, if any,
+// and flushes the sender.
+func (w *BatchWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.lines.partial) > 0 {
+		line := w.lines.partial
+		w.lines.partial = nil
+		if err := w.sender.AtRaw(w.ctx, line); err != nil {
+			return err
+		}
+	}
+	return w.sender.Flush(w.ctx)
+}
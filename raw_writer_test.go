@@ -0,0 +1,216 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawWriter(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	w := sender.RawWriter()
+	_, err = io.WriteString(w, fmt.Sprintf("%s a=1i\n%s b=\"foo", testTable, testTable))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+
+	// The incomplete line is completed by the next write. Escaped
+	// newlines don't terminate the line.
+	_, err = io.WriteString(w, "\\\nbar\"\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, qdb.MsgCount(sender))
+
+	// Raw lines can be mixed with the regular API.
+	err = sender.Table(testTable).Int64Column("c", 3).AtNow(ctx)
+	assert.NoError(t, err)
+
+	err = sender.Flush(ctx)
+	assert.NoError(t, err)
+
+	expectLines(t, srv.BackCh, []string{
+		fmt.Sprintf("%s a=1i", testTable),
+		fmt.Sprintf("%s b=\"foo\\", testTable),
+		"bar\"",
+		fmt.Sprintf("%s c=3i", testTable),
+	})
+}
+
+func TestRawWriterRowBasedAutoFlush(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithAutoFlushRows(2))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	// A single write of several lines passes the limit.
+	w := sender.RawWriter()
+	for i := 0; i < 10; i++ {
+		_, err = io.WriteString(w, strings.Repeat(testTable+" a=1i\n", 3))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, qdb.MsgCount(sender))
+	}
+
+	// The regular API keeps auto-flushing afterwards.
+	for i := 0; i < 2; i++ {
+		err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 0, qdb.MsgCount(sender))
+}
+
+func TestRawWriterErrors(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDryRun(), qdb.WithMaxBufferSize(64), qdb.WithInitBufferSize(32))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	sender.Table(testTable)
+	_, err = sender.RawWriter().Write([]byte(testTable + " a=1i\n"))
+	assert.ErrorContains(t, err, "pending ILP message must be finalized")
+	err = sender.Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+
+	_, err = sender.RawWriter().Write([]byte(fmt.Sprintf("%s a=%064di\n", testTable, 1)))
+	assert.ErrorContains(t, err, "buffer size exceeded maximum limit")
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+
+	// The bytes of the lines written before the failed one are
+	// reported.
+	line := testTable + " b=2i\n"
+	n, err := sender.RawWriter().Write([]byte(line + fmt.Sprintf("%s a=%064di\n", testTable, 1)))
+	assert.ErrorContains(t, err, "buffer size exceeded maximum limit")
+	assert.Equal(t, len(line), n)
+	assert.Equal(t, 2, qdb.MsgCount(sender))
+}
+
+func TestAtRaw(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Addr()), qdb.WithAutoFlushRows(3))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.AtRaw(ctx, []byte(testTable+" a=1i\n"))
+	assert.NoError(t, err)
+	// The trailing newline is optional.
+	err = sender.AtRaw(ctx, []byte(testTable+" a=2i"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, qdb.MsgCount(sender))
+
+	err = sender.AtRaw(ctx, nil)
+	assert.ErrorContains(t, err, "raw ILP line is empty")
+	sender.Table(testTable)
+	err = sender.AtRaw(ctx, []byte(testTable+" a=3i\n"))
+	assert.ErrorContains(t, err, "pending ILP message must be finalized")
+
+	// Raw lines count towards the auto-flush trigger.
+	err = sender.Int64Column("a", 3).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, qdb.MsgCount(sender))
+
+	expectLines(t, srv.BackCh, []string{
+		testTable + " a=1i",
+		testTable + " a=2i",
+		testTable + " a=3i",
+	})
+}
+
+func TestBatchWriter(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	bw := qdb.NewBatchWriter(ctx, sender)
+	var _ io.WriteCloser = bw
+
+	// The small bufio buffer splits the lines across writes.
+	w := bufio.NewWriterSize(bw, 16)
+	input := fmt.Sprintf("%s a=1i\n%s b=\"foo bar baz\"\n%s c=3i", testTable, testTable, testTable)
+	_, err = io.Copy(w, strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, 2, qdb.MsgCount(sender))
+
+	assert.NoError(t, bw.Close())
+	assert.Equal(t, 0, qdb.MsgCount(sender))
+
+	_, err = bw.Write([]byte(testTable + " d=4i\n"))
+	assert.ErrorIs(t, err, qdb.ErrClosed)
+
+	// The line started in a previous write is kept if the sender
+	// rejects it, so that the write can be retried.
+	sender.Table(testTable)
+	bw = qdb.NewBatchWriter(ctx, sender)
+	n, err := bw.Write([]byte(testTable + " e="))
+	assert.NoError(t, err)
+	assert.Equal(t, len(testTable)+3, n)
+	n, err = bw.Write([]byte("5i\n"))
+	assert.ErrorIs(t, err, qdb.ErrPendingMessage)
+	assert.Zero(t, n)
+	assert.NoError(t, sender.Int64Column("e", 4).AtNow(ctx))
+	n, err = bw.Write([]byte("5i\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.NoError(t, bw.Close())
+
+	expectLines(t, srv.BackCh, []string{
+		fmt.Sprintf("%s a=1i", testTable),
+		fmt.Sprintf("%s b=\"foo bar baz\"", testTable),
+		fmt.Sprintf("%s c=3i", testTable),
+		fmt.Sprintf("%s e=4i", testTable),
+		fmt.Sprintf("%s e=5i", testTable),
+	})
+}
@@ -0,0 +1,82 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Redactor is called for each symbol and column value written to
+// the sender's buffer, see WithRedactor. It returns the value to be
+// written instead, or false if the column should be left out.
+type Redactor func(table, column string, value interface{}) (interface{}, bool)
+
+// redact writes the symbol or column value returned by the redactor.
+// The value is passed on with the type of the column method, e.g.
+// int64 for Int64Column and time.Time for timestamp columns. The
+// redactor may return a value of any type supported by Row, so that
+// e.g. an integer may be replaced with a hash string.
+func (b *buffer) redact(name string, val interface{}, symbol bool) {
+	if b.lastErr != nil {
+		return
+	}
+	v, keep := b.redactor(b.tableName, name, val)
+	if !keep {
+		return
+	}
+	b.redacting = true
+	defer func() {
+		b.redacting = false
+	}()
+	if symbol {
+		s, ok := v.(string)
+		if !ok {
+			b.lastErr = fmt.Errorf("redacted symbol value is not a string: %s: %T: %w", name, v, ErrUnsupportedType)
+			return
+		}
+		b.Symbol(name, s)
+		return
+	}
+	switch v := v.(type) {
+	case int64:
+		b.Int64Column(name, v)
+	case uint64:
+		b.Uint64Column(name, v)
+	case *big.Int:
+		b.Long256Column(name, v)
+	case float64:
+		b.Float64Column(name, v)
+	case string:
+		b.StringColumn(name, v)
+	case bool:
+		b.BoolColumn(name, v)
+	case time.Time:
+		b.TimestampColumn(name, v)
+	default:
+		b.lastErr = fmt.Errorf("unsupported redacted column value type: %s: %T: %w", name, v, ErrUnsupportedType)
+	}
+}
@@ -0,0 +1,123 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// The process-wide registry of named senders.
+var registry = struct {
+	mu      sync.Mutex
+	entries map[string]*registryEntry
+}{
+	entries: make(map[string]*registryEntry),
+}
+
+type registryEntry struct {
+	conf SenderConfig
+
+	// mu guards the sender, so that it's created once without
+	// holding the registry lock.
+	mu     sync.Mutex
+	sender *SyncSender
+	closed bool
+}
+
+// Register adds a named sender configuration to the process-wide
+// registry. Applications with multiple QuestDB destinations can then
+// resolve the senders by name with Get from anywhere.
+//
+// The config is validated right away, but the sender is only created
+// on the first Get call.
+func Register(name string, cfg SenderConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config of sender %s: %w", name, err)
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.entries[name]; ok {
+		return fmt.Errorf("sender is already registered: %s", name)
+	}
+	registry.entries[name] = &registryEntry{conf: cfg}
+	return nil
+}
+
+// Get returns the registered sender with the given name, creating
+// it on the first call. The context bounds the creation, e.g. the
+// TCP connection setup. If the creation fails, the next call tries
+// again. Concurrent calls for other names don't wait for it.
+func Get(ctx context.Context, name string) (*SyncSender, error) {
+	registry.mu.Lock()
+	e, ok := registry.entries[name]
+	registry.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("sender is not registered: %s", name)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil, fmt.Errorf("sender %s: %w", name, ErrClosed)
+	}
+	if e.sender == nil {
+		s, err := e.conf.Build(ctx)
+		if err != nil {
+			return nil, err
+		}
+		e.sender = NewSyncSender(s)
+	}
+	return e.sender, nil
+}
+
+// Shutdown closes all registered senders, flushing their pending
+// rows, and clears the registry. The first error returned by the
+// senders, if any, is returned.
+func Shutdown(ctx context.Context) error {
+	registry.mu.Lock()
+	entries := registry.entries
+	registry.entries = make(map[string]*registryEntry)
+	registry.mu.Unlock()
+
+	var err error
+	for _, e := range entries {
+		// Wait for a sender being created and make sure that no
+		// sender is created afterwards.
+		e.mu.Lock()
+		s := e.sender
+		e.closed = true
+		e.mu.Unlock()
+		if s == nil {
+			continue
+		}
+		if closeErr := s.Close(ctx); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
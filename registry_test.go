@@ -0,0 +1,93 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"testing"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	err = qdb.Register("billing", qdb.SenderConfig{Schema: "http", Address: srv.Addr()})
+	assert.NoError(t, err)
+	defer qdb.Shutdown(ctx)
+
+	err = qdb.Register("billing", qdb.SenderConfig{Schema: "http"})
+	assert.ErrorContains(t, err, "sender is already registered: billing")
+	err = qdb.Register("metrics", qdb.SenderConfig{Schema: "foobar"})
+	assert.ErrorContains(t, err, "invalid config of sender metrics: invalid schema")
+	_, err = qdb.Get(ctx, "metrics")
+	assert.ErrorContains(t, err, "sender is not registered: metrics")
+
+	s1, err := qdb.Get(ctx, "billing")
+	assert.NoError(t, err)
+	s2, err := qdb.Get(ctx, "billing")
+	assert.NoError(t, err)
+	assert.Same(t, s1, s2)
+
+	err = s1.WriteRows(ctx, []qdb.Row{{
+		Table:   testTable,
+		Columns: []qdb.TypedValue{{Name: "a", Value: int64(1)}},
+	}})
+	assert.NoError(t, err)
+
+	err = qdb.Shutdown(ctx)
+	assert.NoError(t, err)
+	expectLines(t, srv.BackCh, []string{testTable + " a=1i"})
+
+	_, err = qdb.Get(ctx, "billing")
+	assert.ErrorContains(t, err, "sender is not registered: billing")
+}
+
+func TestRegistryGetContext(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	err = qdb.Register("events", qdb.SenderConfig{Schema: "tcp", Address: srv.Addr()})
+	assert.NoError(t, err)
+	defer qdb.Shutdown(ctx)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = qdb.Get(cancelled, "events")
+	assert.ErrorContains(t, err, "failed to connect to server")
+
+	// The failed creation is not cached.
+	s, err := qdb.Get(ctx, "events")
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+}
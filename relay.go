@@ -0,0 +1,198 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type relayConfig struct {
+	validate  bool
+	batchSize int
+	rateLimit int
+	progress  func(lines int, bytes int64)
+}
+
+// RelayOption defines Relay option.
+type RelayOption func(*relayConfig)
+
+// WithRelayValidation makes Relay parse each line with ParseLine
+// and stop on the first invalid line. By default, lines are
+// forwarded as is.
+func WithRelayValidation() RelayOption {
+	return func(c *relayConfig) {
+		c.validate = true
+	}
+}
+
+// WithRelayBatchSize makes Relay flush the sender after each
+// batch of the given number of lines. By default, the sender's
+// auto-flush settings are used.
+func WithRelayBatchSize(lines int) RelayOption {
+	return func(c *relayConfig) {
+		c.batchSize = lines
+	}
+}
+
+// WithRelayRateLimit limits the number of lines forwarded by Relay
+// per second, e.g. to avoid overloading the server when replaying
+// a large file. Zero means no limit.
+func WithRelayRateLimit(linesPerSecond int) RelayOption {
+	return func(c *relayConfig) {
+		c.rateLimit = linesPerSecond
+	}
+}
+
+// WithRelayProgress makes Relay call fn with the number of forwarded
+// lines and bytes after each flush. Use it with WithRelayBatchSize to
+// get periodic progress reports.
+func WithRelayProgress(fn func(lines int, bytes int64)) RelayOption {
+	return func(c *relayConfig) {
+		c.progress = fn
+	}
+}
+
+// Relay reads newline-delimited ILP messages from r and forwards
+// them to the server via the given sender, which makes it a building
+// block for ILP proxies and file replayers. Empty lines are skipped.
+//
+// Relay flushes the sender once the end of input is reached and
+// returns the number of forwarded lines. In case of an error, the
+// returned count includes the lines written to the sender's buffer,
+// which may be not flushed yet.
+func Relay(ctx context.Context, s LineSender, r io.Reader, opts ...RelayOption) (int, error) {
+	var conf relayConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if conf.batchSize < 0 {
+		return 0, fmt.Errorf("relay batch size is negative: %d", conf.batchSize)
+	}
+	if conf.rateLimit < 0 {
+		return 0, fmt.Errorf("relay rate limit is negative: %d", conf.rateLimit)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), defaultMaxBufferSize)
+	scanner.Split(scanIlpLines)
+
+	var (
+		w       = s.RawWriter()
+		lineNum int
+		count   int
+		size    int64
+		batch   int
+		start   = time.Now()
+	)
+	flush := func() error {
+		if err := s.Flush(ctx); err != nil {
+			return err
+		}
+		if conf.progress != nil && batch > 0 {
+			conf.progress(count, size)
+		}
+		return nil
+	}
+	for scanner.Scan() {
+		lineNum++
+		line := trimNewline(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		if conf.validate {
+			if _, err := ParseLine(line); err != nil {
+				return count, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+		}
+		if conf.rateLimit > 0 {
+			if err := waitRateLimit(ctx, start, count, conf.rateLimit); err != nil {
+				return count, err
+			}
+		}
+
+		// Appending in place overwrites the trimmed line terminator
+		// in the scanner's buffer, which is fine as the line is consumed.
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return count, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		count++
+		size += int64(len(line) + 1)
+		batch++
+
+		if conf.batchSize > 0 && batch >= conf.batchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+			batch = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+	return count, flush()
+}
+
+// waitRateLimit blocks until the given number of lines may be
+// forwarded without exceeding the rate limit.
+func waitRateLimit(ctx context.Context, start time.Time, lines, linesPerSecond int) error {
+	due := start.Add(time.Duration(lines) * time.Second / time.Duration(linesPerSecond))
+	d := time.Until(due)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// ReplayFile forwards the ILP messages stored in the file at the
+// given path, e.g. a spool file or a file written with WithTee or
+// WithDebugWriter, to the server via the given sender. See Relay for
+// the details and the supported options.
+//
+// Payloads truncated by WithDebugWriter contain a truncation note
+// that isn't valid ILP, so only dumps written with no max bytes
+// limit can be replayed.
+func ReplayFile(ctx context.Context, s LineSender, path string, opts ...RelayOption) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return Relay(ctx, s, f, opts...)
+}
@@ -0,0 +1,135 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	input := fmt.Sprintf("%s a=1i\n\n%s a=2i\r\n%s a=3i", testTable, testTable, testTable)
+	n, err := qdb.Relay(ctx, sender, strings.NewReader(input), qdb.WithRelayValidation(), qdb.WithRelayBatchSize(2))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Zero(t, qdb.BufLen(sender))
+
+	expectLines(t, srv.BackCh, []string{
+		fmt.Sprintf("%s a=1i", testTable),
+		fmt.Sprintf("%s a=2i", testTable),
+		fmt.Sprintf("%s a=3i", testTable),
+	})
+}
+
+func TestRelayValidation(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	input := fmt.Sprintf("%s a=1i\n%s a=\n", testTable, testTable)
+
+	n, err := qdb.Relay(ctx, sender, strings.NewReader(input), qdb.WithRelayValidation())
+	assert.ErrorContains(t, err, "line 2: invalid ILP line")
+	assert.Equal(t, 1, n)
+
+	// Without validation, lines are forwarded as is.
+	n, err = qdb.Relay(ctx, sender, strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestReplayFile(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	line := testTable + " a=1i\n"
+	path := filepath.Join(t.TempDir(), "capture.ilp")
+	err = os.WriteFile(path, []byte(strings.Repeat(line, 4)), 0o644)
+	assert.NoError(t, err)
+
+	type progress struct {
+		lines int
+		bytes int64
+	}
+	var reports []progress
+	start := time.Now()
+	n, err := qdb.ReplayFile(
+		ctx,
+		sender,
+		path,
+		qdb.WithRelayBatchSize(2),
+		qdb.WithRelayRateLimit(20),
+		qdb.WithRelayProgress(func(lines int, bytes int64) {
+			reports = append(reports, progress{lines, bytes})
+		}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	// 4 lines at 20 lines per second take at least 150ms.
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	assert.Equal(t, []progress{
+		{2, int64(2 * len(line))},
+		{4, int64(4 * len(line))},
+	}, reports)
+
+	expectLines(t, srv.BackCh, []string{
+		testTable + " a=1i",
+		testTable + " a=1i",
+		testTable + " a=1i",
+		testTable + " a=1i",
+	})
+
+	_, err = qdb.ReplayFile(ctx, sender, filepath.Join(t.TempDir(), "missing.ilp"))
+	assert.Error(t, err)
+	_, err = qdb.ReplayFile(ctx, sender, path, qdb.WithRelayRateLimit(-1))
+	assert.ErrorContains(t, err, "relay rate limit is negative")
+}
@@ -0,0 +1,211 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// RestClient allows you to run SQL queries and manage tables
+// via QuestDB's REST API.
+//
+// The client accepts the same address, authentication, TLS and
+// HTTP transport options as the HTTP sender, so both can be
+// configured with a single set of options. Unlike LineSender,
+// RestClient is safe for concurrent use by multiple goroutines.
+type RestClient struct {
+	uri string
+
+	// Authentication-related fields
+	user  string
+	pass  string
+	token string
+
+	client http.Client
+
+	// Global transport is used unless a custom transport was provided.
+	globalTransport *globalHttpTransport
+}
+
+// QueryColumn describes a column of a query result.
+type QueryColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// QueryResult holds the result of a SQL statement executed via
+// the REST API.
+type QueryResult struct {
+	// Query is the executed SQL statement.
+	Query string `json:"query"`
+	// Columns describes the result set columns.
+	Columns []QueryColumn `json:"columns"`
+	// Dataset holds result set rows as decoded from JSON, i.e.
+	// numbers are float64 values and timestamps are strings.
+	Dataset [][]interface{} `json:"dataset"`
+	// Count is the number of rows in the result set.
+	Count int `json:"count"`
+	// DDL is set to "OK" for successfully executed DDL statements.
+	DDL string `json:"ddl"`
+}
+
+// NewRestClient creates a client for QuestDB's REST API.
+//
+// Only address, authentication, TLS and HTTP transport options are
+// taken into account. Defaults to "127.0.0.1:9000" address.
+func NewRestClient(opts ...LineSenderOption) (*RestClient, error) {
+	conf := &lineSenderConfig{}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	if conf.senderType == noSenderType {
+		conf.senderType = httpSenderType
+	}
+	return newRestClient(conf)
+}
+
+// RestClientFromConf creates a client for QuestDB's REST API using
+// the QuestDB config string format. See LineSenderFromConf for
+// the config string format. Only "http" and "https" schemas
+// are supported.
+func RestClientFromConf(conf string) (*RestClient, error) {
+	c, err := confFromStr(conf)
+	if err != nil {
+		return nil, err
+	}
+	return newRestClient(c)
+}
+
+func newRestClient(conf *lineSenderConfig) (*RestClient, error) {
+	if conf.senderType != httpSenderType {
+		return nil, errors.New("REST client is only available over HTTP")
+	}
+	err := sanitizeHttpConf(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &RestClient{
+		uri:   httpBaseUri(conf),
+		user:  conf.httpUser,
+		pass:  conf.httpPass,
+		token: conf.httpToken,
+	}
+	c.client, c.globalTransport = newHttpClient(conf)
+	if c.globalTransport != nil {
+		c.globalTransport.RegisterClient()
+	}
+	return c, nil
+}
+
+// Exec executes the given SQL statement via the /exec endpoint.
+//
+// If the server rejects the statement, a *QueryError is returned.
+func (c *RestClient) Exec(ctx context.Context, query string) (*QueryResult, error) {
+	resp, err := c.get(ctx, "/exec", url.Values{"query": {query}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, newQueryError(resp, body)
+	}
+
+	result := &QueryResult{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("failed to decode query result: %w", err)
+	}
+	return result, nil
+}
+
+// ExportQuery runs the given SQL query via the /exp endpoint and
+// writes the result set to w as CSV, including the header line.
+//
+// If the server rejects the query, a *QueryError is returned.
+// The result set is streamed, so the data written to w before
+// a failure, e.g. a network one, may be incomplete.
+func (c *RestClient) ExportQuery(ctx context.Context, query string, w io.Writer) error {
+	resp, err := c.get(ctx, "/exp", url.Values{"query": {query}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response body: %w", err)
+		}
+		return newQueryError(resp, body)
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to export query result: %w", err)
+	}
+	return nil
+}
+
+// Close releases resources held by the client.
+func (c *RestClient) Close() {
+	if c.globalTransport != nil {
+		c.globalTransport.UnregisterClient()
+		c.globalTransport = nil
+	}
+}
+
+func newQueryError(resp *http.Response, body []byte) error {
+	queryErr := &QueryError{
+		httpStatus: resp.StatusCode,
+	}
+	if err := json.Unmarshal(body, queryErr); err != nil || queryErr.Message == "" {
+		return fmt.Errorf("%d: %s -- %s", resp.StatusCode, resp.Status, body)
+	}
+	return queryErr
+}
+
+func (c *RestClient) get(ctx context.Context, path string, params url.Values) (*http.Response, error) {
+	uri := c.uri + path
+	if len(params) > 0 {
+		uri += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	setAuthHeader(req, c.user, c.pass, c.token)
+	return c.client.Do(req)
+}
@@ -0,0 +1,517 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRestServer starts a server handling /exec requests with
+// the given function. The function returns the HTTP status and
+// the response body to be marshalled to JSON.
+func newTestRestServer(t *testing.T, handler func(query string) (int, interface{})) (*httptest.Server, *qdb.RestClient) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/exec" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		status, body := handler(r.URL.Query().Get("query"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+
+	client, err := qdb.NewRestClient(qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")))
+	assert.NoError(t, err)
+	return srv, client
+}
+
+func TestRestClientExec(t *testing.T) {
+	ctx := context.Background()
+
+	srv, client := newTestRestServer(t, func(query string) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{
+			"query":   query,
+			"columns": []map[string]string{{"name": "x", "type": "LONG"}},
+			"dataset": [][]interface{}{{1}, {2}},
+			"count":   2,
+		}
+	})
+	defer srv.Close()
+	defer client.Close()
+
+	res, err := client.Exec(ctx, "SELECT x FROM long_sequence(2)")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT x FROM long_sequence(2)", res.Query)
+	assert.Equal(t, []qdb.QueryColumn{{Name: "x", Type: "LONG"}}, res.Columns)
+	assert.Equal(t, [][]interface{}{{1.0}, {2.0}}, res.Dataset)
+	assert.Equal(t, 2, res.Count)
+}
+
+func TestRestClientQueryError(t *testing.T) {
+	ctx := context.Background()
+
+	srv, client := newTestRestServer(t, func(query string) (int, interface{}) {
+		return http.StatusBadRequest, map[string]interface{}{
+			"query":    query,
+			"error":    "table does not exist [table=foo]",
+			"position": 14,
+		}
+	})
+	defer srv.Close()
+	defer client.Close()
+
+	_, err := client.Exec(ctx, "SELECT * FROM foo")
+	queryErr := &qdb.QueryError{}
+	assert.ErrorAs(t, err, &queryErr)
+	assert.Equal(t, http.StatusBadRequest, queryErr.HttpStatus())
+	assert.Equal(t, "table does not exist [table=foo]", queryErr.Message)
+	assert.Equal(t, 14, queryErr.Position)
+}
+
+func TestRestClientCreateTable(t *testing.T) {
+	ctx := context.Background()
+
+	var queries []string
+	srv, client := newTestRestServer(t, func(query string) (int, interface{}) {
+		queries = append(queries, query)
+		return http.StatusOK, map[string]interface{}{"ddl": "OK"}
+	})
+	defer srv.Close()
+	defer client.Close()
+
+	err := client.CreateTable(ctx, qdb.TableSchema{
+		Name:    "foo",
+		Columns: []qdb.ColumnSchema{{Name: "bar", Type: qdb.ColumnTypeLong}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`CREATE TABLE "foo" ("bar" LONG)`}, queries)
+
+	// Invalid schemas are not sent to the server.
+	err = client.CreateTable(ctx, qdb.TableSchema{Name: "foo"})
+	assert.Error(t, err)
+	assert.Len(t, queries, 1)
+}
+
+func TestRestClientTableExists(t *testing.T) {
+	ctx := context.Background()
+
+	srv, client := newTestRestServer(t, func(query string) (int, interface{}) {
+		count := 0
+		if strings.HasSuffix(query, "'existing'") {
+			count = 1
+		}
+		return http.StatusOK, map[string]interface{}{"query": query, "count": count}
+	})
+	defer srv.Close()
+	defer client.Close()
+
+	exists, err := client.TableExists(ctx, "existing")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = client.TableExists(ctx, "missing")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestRestClientPartitions(t *testing.T) {
+	ctx := context.Background()
+
+	var queries []string
+	srv, client := newTestRestServer(t, func(query string) (int, interface{}) {
+		queries = append(queries, query)
+		if strings.HasPrefix(query, "SELECT designatedTimestamp") {
+			partitionBy := "DAY"
+			switch {
+			case strings.HasSuffix(query, "'missing'"):
+				return http.StatusOK, map[string]interface{}{"count": 0}
+			case strings.HasSuffix(query, "'weekly'"):
+				partitionBy = "WEEK"
+			case strings.HasSuffix(query, "'flat'"):
+				partitionBy = "NONE"
+			}
+			return http.StatusOK, map[string]interface{}{
+				"dataset": [][]interface{}{{"ts", partitionBy}},
+				"count":   1,
+			}
+		}
+		return http.StatusOK, map[string]interface{}{"ddl": "OK"}
+	})
+	defer srv.Close()
+	defer client.Close()
+
+	// The mid-partition cutoff is rounded down, so that the
+	// partition holding it is kept.
+	err := client.DropPartitions(ctx, "foo", time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC))
+	assert.NoError(t, err)
+	err = client.DropPartitions(ctx, "weekly", time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	err = client.DetachPartitions(ctx, "foo", "2024-01-01", "2024-01-02")
+	assert.NoError(t, err)
+	err = client.AttachPartitions(ctx, "foo", "2024-01-01")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`SELECT designatedTimestamp, partitionBy FROM tables() WHERE table_name = 'foo'`,
+		`ALTER TABLE "foo" DROP PARTITION WHERE "ts" < '2024-01-02T00:00:00.000000Z'`,
+		`SELECT designatedTimestamp, partitionBy FROM tables() WHERE table_name = 'weekly'`,
+		`ALTER TABLE "weekly" DROP PARTITION WHERE "ts" < '2024-01-01T00:00:00.000000Z'`,
+		`ALTER TABLE "foo" DETACH PARTITION LIST '2024-01-01', '2024-01-02'`,
+		`ALTER TABLE "foo" ATTACH PARTITION LIST '2024-01-01'`,
+	}, queries)
+
+	err = client.DropPartitions(ctx, "flat", time.Now())
+	assert.ErrorContains(t, err, `table flat: unsupported partitioning: "NONE"`)
+	err = client.DropPartitions(ctx, "missing", time.Now())
+	assert.ErrorContains(t, err, "table not found: missing")
+	err = client.AttachPartitions(ctx, "foo")
+	assert.ErrorContains(t, err, "no partitions given")
+}
+
+func TestRestClientRequiresHttp(t *testing.T) {
+	_, err := qdb.NewRestClient(qdb.WithTcp())
+	assert.ErrorContains(t, err, "REST client is only available over HTTP")
+
+	_, err = qdb.RestClientFromConf("tcp::addr=localhost:9009;")
+	assert.ErrorContains(t, err, "REST client is only available over HTTP")
+}
+
+func TestRestClientClockSkew(t *testing.T) {
+	ctx := context.Background()
+
+	srv, client := newTestRestServer(t, func(query string) (int, interface{}) {
+		now := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+		return http.StatusOK, map[string]interface{}{
+			"query":   query,
+			"columns": []map[string]string{{"name": "now", "type": "TIMESTAMP"}},
+			"dataset": [][]interface{}{{now}},
+			"count":   1,
+		}
+	})
+	defer srv.Close()
+	defer client.Close()
+
+	skew, err := client.ClockSkew(ctx)
+	assert.NoError(t, err)
+	assert.InDelta(t, time.Hour, skew, float64(time.Second))
+
+	warnings := make(chan time.Duration, 1)
+	m := client.StartClockSkewMonitor(qdb.ClockSkewMonitorConfig{
+		Interval:      10 * time.Millisecond,
+		WarnThreshold: time.Minute,
+		OnWarn: func(skew time.Duration) {
+			select {
+			case warnings <- skew:
+			default:
+			}
+		},
+	})
+	defer m.Stop()
+
+	select {
+	case skew = <-warnings:
+		assert.InDelta(t, time.Hour, skew, float64(time.Second))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no clock skew warning received")
+	}
+	stats := m.Stats()
+	assert.NoError(t, stats.LastErr)
+	assert.InDelta(t, time.Hour, stats.Skew, float64(time.Second))
+	assert.False(t, stats.LastProbe.IsZero())
+}
+
+type scanTrade struct {
+	Symbol string    `qdb:"symbol,symbol"`
+	Price  float64   `qdb:"price"`
+	Amount int32     `qdb:"amount"`
+	Filled bool      `qdb:"filled"`
+	Hash   *big.Int  `qdb:"hash"`
+	Ts     time.Time `qdb:"ts,designated"`
+}
+
+func TestQueryResultScan(t *testing.T) {
+	ctx := context.Background()
+
+	srv, client := newTestRestServer(t, func(query string) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{
+			"query": query,
+			"columns": []map[string]string{
+				{"name": "symbol", "type": "SYMBOL"},
+				{"name": "price", "type": "DOUBLE"},
+				{"name": "amount", "type": "INT"},
+				{"name": "filled", "type": "BOOLEAN"},
+				{"name": "hash", "type": "LONG256"},
+				{"name": "extra", "type": "LONG"},
+				{"name": "ts", "type": "TIMESTAMP"},
+			},
+			"dataset": [][]interface{}{
+				{"BTC-USD", 42.5, 3, true, "0x0a", 1, "2024-01-02T03:04:05.123456Z"},
+				{nil, nil, nil, false, nil, 2, "2024-01-02T03:04:06.000000Z"},
+			},
+			"count": 2,
+		}
+	})
+	defer srv.Close()
+	defer client.Close()
+
+	res, err := client.Exec(ctx, "SELECT * FROM trades")
+	assert.NoError(t, err)
+
+	var trades []scanTrade
+	assert.NoError(t, res.Scan(&trades))
+	assert.Equal(t, []scanTrade{
+		{
+			Symbol: "BTC-USD",
+			Price:  42.5,
+			Amount: 3,
+			Filled: true,
+			Hash:   big.NewInt(10),
+			Ts:     time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC),
+		},
+		{
+			Ts: time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC),
+		},
+	}, trades)
+
+	var ptrs []*scanTrade
+	assert.NoError(t, res.Scan(&ptrs))
+	assert.Len(t, ptrs, 2)
+	assert.Equal(t, "BTC-USD", ptrs[0].Symbol)
+
+	assert.ErrorContains(t, res.Scan(trades), "expected a pointer to a slice")
+
+	var mismatched []struct {
+		Symbol int64 `qdb:"symbol"`
+	}
+	assert.ErrorContains(t, res.Scan(&mismatched), "row 0: column symbol: unexpected value type: string")
+}
+
+func TestRestClientImportFile(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		params url.Values
+		schema string
+		data   string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/imp" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		params = r.URL.Query()
+		schema = r.FormValue("schema")
+		f, _, err := r.FormFile("data")
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(f)
+		data = string(b)
+
+		w.Header().Set("Content-Type", "application/json")
+		if params.Get("name") == "bad" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "cannot determine text structure"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":       "OK",
+			"location":     params.Get("name"),
+			"rowsImported": 2,
+			"rowsRejected": 1,
+			"header":       true,
+			"columns": []map[string]interface{}{
+				{"name": "ts", "type": "TIMESTAMP", "size": 8, "errors": 0},
+				{"name": "x", "type": "LONG", "size": 8, "errors": 1},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	client, err := qdb.NewRestClient(qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	csv := "ts,x\n2024-01-01 00:00:00,1\n2024-01-02 00:00:00,foo\n2024-01-03 00:00:00,3\n"
+	var progress int64
+	res, err := client.ImportFile(ctx, "foo", strings.NewReader(csv), qdb.ImportOptions{
+		Schema:      []qdb.ImportColumn{{Name: "ts", Type: qdb.ColumnTypeTimestamp, Pattern: "yyyy-MM-dd HH:mm:ss"}},
+		Timestamp:   "ts",
+		PartitionBy: qdb.PartitionByDay,
+		Delimiter:   ',',
+		Atomicity:   qdb.ImportSkipRow,
+		Progress:    func(n int64) { progress = n },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &qdb.ImportResult{
+		Table:        "foo",
+		RowsImported: 2,
+		RowsRejected: 1,
+		Header:       true,
+		Columns: []qdb.ImportColumnResult{
+			{Name: "ts", Type: "TIMESTAMP"},
+			{Name: "x", Type: "LONG", Errors: 1},
+		},
+	}, res)
+	assert.Equal(t, int64(len(csv)), progress)
+	assert.Equal(t, csv, data)
+	assert.Equal(t, `[{"name":"ts","type":"TIMESTAMP","pattern":"yyyy-MM-dd HH:mm:ss"}]`, schema)
+	assert.Equal(t, url.Values{
+		"name":        {"foo"},
+		"fmt":         {"json"},
+		"timestamp":   {"ts"},
+		"partitionBy": {"DAY"},
+		"delimiter":   {","},
+		"atomicity":   {"skipRow"},
+	}, params)
+
+	_, err = client.ImportFile(ctx, "bad", strings.NewReader(csv), qdb.ImportOptions{})
+	importErr := &qdb.ImportError{}
+	assert.ErrorAs(t, err, &importErr)
+	assert.Equal(t, "cannot determine text structure", importErr.Message)
+	assert.Equal(t, "", schema)
+
+	_, err = client.ImportFile(ctx, "foo", strings.NewReader(csv), qdb.ImportOptions{PartitionBy: qdb.PartitionByDay})
+	assert.ErrorContains(t, err, "partitioning requires a designated timestamp")
+}
+
+func TestRestClientExportQuery(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/exp" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query().Get("query")
+		if query != "SELECT x FROM long_sequence(2)" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"query":    query,
+				"error":    "table does not exist [table=foo]",
+				"position": 14,
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		io.WriteString(w, "\"x\"\r\n1\r\n2\r\n")
+	}))
+	defer srv.Close()
+
+	client, err := qdb.NewRestClient(qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	var sb strings.Builder
+	err = client.ExportQuery(ctx, "SELECT x FROM long_sequence(2)", &sb)
+	assert.NoError(t, err)
+	assert.Equal(t, "\"x\"\r\n1\r\n2\r\n", sb.String())
+
+	err = client.ExportQuery(ctx, "SELECT * FROM foo", &sb)
+	queryErr := &qdb.QueryError{}
+	assert.ErrorAs(t, err, &queryErr)
+	assert.Equal(t, http.StatusBadRequest, queryErr.HttpStatus())
+	assert.Equal(t, 14, queryErr.Position)
+}
+
+func TestHealthMonitor(t *testing.T) {
+	var healthy int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != qdb.DefaultHealthPath || atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "Status: Healthy")
+	}))
+	defer srv.Close()
+
+	client, err := qdb.NewRestClient(qdb.WithAddress(strings.TrimPrefix(srv.URL, "http://")))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	type change struct{ from, to qdb.HealthState }
+	changes := make(chan change, 10)
+	m := qdb.StartHealthMonitor(qdb.HttpHealthProbe(client, qdb.DefaultHealthPath), qdb.HealthMonitorConfig{
+		Interval:         10 * time.Millisecond,
+		FailureThreshold: 2,
+	})
+	defer m.Stop()
+	m.Subscribe(func(from, to qdb.HealthState) {
+		changes <- change{from, to}
+	})
+
+	expectChange := func(expected change) {
+		for {
+			select {
+			case c := <-changes:
+				// The first probe may complete before the subscription,
+				// so the initial change is optional.
+				if c.from == qdb.HealthUnknown && expected.from != qdb.HealthUnknown {
+					continue
+				}
+				assert.Equal(t, expected, c)
+				return
+			case <-time.After(5 * time.Second):
+				t.Fatalf("no state change to %s", expected.to)
+			}
+		}
+	}
+	assert.Eventually(t, func() bool { return m.State() == qdb.HealthUp }, 5*time.Second, time.Millisecond)
+
+	atomic.StoreInt32(&healthy, 0)
+	expectChange(change{qdb.HealthUp, qdb.HealthDown})
+	stats := m.Stats()
+	assert.Equal(t, qdb.HealthDown, stats.State)
+	assert.GreaterOrEqual(t, stats.Failures, 2)
+	assert.ErrorContains(t, stats.LastErr, "health check failed: 503")
+
+	atomic.StoreInt32(&healthy, 1)
+	expectChange(change{qdb.HealthDown, qdb.HealthUp})
+}
+
+func TestTcpHealthProbe(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+
+	probe := qdb.TcpHealthProbe(addr)
+	assert.NoError(t, probe(ctx))
+	l.Close()
+	assert.Error(t, probe(ctx))
+}
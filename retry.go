@@ -0,0 +1,200 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryInitialInterval = 10 * time.Millisecond
+	defaultRetryMaxInterval     = time.Second
+	defaultRetryMultiplier      = 2
+	defaultRetryJitter          = 10 * time.Millisecond
+)
+
+// BackoffJitter defines how the delays between retries are
+// randomized.
+type BackoffJitter int
+
+const (
+	// JitterSmall adds a random delay of up to 10 milliseconds.
+	// This is the default.
+	JitterSmall BackoffJitter = iota
+	// JitterNone disables randomization.
+	JitterNone
+	// JitterFull picks a random delay between zero and
+	// the computed one.
+	JitterFull
+	// JitterEqual keeps half of the computed delay and randomizes
+	// the other half.
+	JitterEqual
+)
+
+// Backoff configures the delays between retries of failed flushes
+// and reconnects. The delay is multiplied after each retry until
+// it reaches the cap. See WithBackoff.
+type Backoff struct {
+	// InitialInterval is the delay before the first retry.
+	// Defaults to 10 milliseconds.
+	InitialInterval time.Duration
+	// Multiplier is the factor applied to the delay after each
+	// retry. Must not be less than 1. Defaults to 2.
+	Multiplier float64
+	// MaxInterval caps the delay between retries. Defaults to
+	// 1 second.
+	MaxInterval time.Duration
+	// Jitter defines how the delays are randomized. Defaults to
+	// JitterSmall.
+	Jitter BackoffJitter
+	// Delay, if set, returns the delay before the given retry,
+	// starting with 0. It overrides all other fields.
+	Delay func(attempt int) time.Duration
+}
+
+// delay returns the delay before the given retry, starting with 0.
+func (b Backoff) delay(attempt int) time.Duration {
+	if b.Delay != nil {
+		return b.Delay(attempt)
+	}
+	initial, mult, max := b.InitialInterval, b.Multiplier, b.MaxInterval
+	if initial == 0 {
+		initial = defaultRetryInitialInterval
+	}
+	if mult == 0 {
+		mult = defaultRetryMultiplier
+	}
+	if max == 0 {
+		max = defaultRetryMaxInterval
+	}
+	d := float64(initial) * math.Pow(mult, float64(attempt))
+	if d > float64(max) {
+		d = float64(max)
+	}
+	delay := time.Duration(d)
+
+	switch b.Jitter {
+	case JitterNone:
+		return delay
+	case JitterFull:
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	case JitterEqual:
+		return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	default:
+		return delay + time.Duration(rand.Int63n(int64(defaultRetryJitter)))
+	}
+}
+
+func validateBackoff(b Backoff) error {
+	if b.InitialInterval < 0 {
+		return fmt.Errorf("backoff initial interval is negative: %d", b.InitialInterval)
+	}
+	if b.MaxInterval < 0 {
+		return fmt.Errorf("backoff max interval is negative: %d", b.MaxInterval)
+	}
+	if b.Multiplier != 0 && b.Multiplier < 1 {
+		return fmt.Errorf("backoff multiplier is less than 1: %v", b.Multiplier)
+	}
+	if b.Jitter < JitterSmall || b.Jitter > JitterEqual {
+		return fmt.Errorf("unknown backoff jitter: %d", b.Jitter)
+	}
+	return nil
+}
+
+// RetryPolicy configures retries of failed flushes.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of retries after the first
+	// attempt. Zero means no retries.
+	MaxRetries int
+	// InitialInterval is the delay before the first retry. The delay
+	// is doubled after each retry. When set, it overrides the sender's
+	// backoff setting. Defaults to 10 milliseconds.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between retries. When set, it
+	// overrides the sender's backoff setting. Defaults to 1 second.
+	MaxInterval time.Duration
+}
+
+// backoff returns the sender's backoff with the intervals of
+// the policy applied on top of it.
+func (p RetryPolicy) backoff(b Backoff) Backoff {
+	if p.InitialInterval > 0 {
+		b.InitialInterval = p.InitialInterval
+	}
+	if p.MaxInterval > 0 {
+		b.MaxInterval = p.MaxInterval
+	}
+	return b
+}
+
+// RetryFlusher is implemented by TCP senders. It allows flushing
+// with automatic reconnects on transient network errors.
+//
+// Example usage:
+//
+//	if rf, ok := sender.(qdb.RetryFlusher); ok {
+//		err = rf.FlushRetry(ctx, qdb.RetryPolicy{MaxRetries: 5})
+//	}
+type RetryFlusher interface {
+	// FlushRetry works in the same way as Flush, but on a transient
+	// network error, such as EPIPE, ECONNRESET or a timeout, it
+	// reconnects to the server and re-sends the whole batch according
+	// to the given policy.
+	//
+	// Since there is no acknowledgement in the TCP protocol, part of
+	// the batch may be delivered twice. Use a deduplication-enabled
+	// table if duplicates are not acceptable.
+	FlushRetry(ctx context.Context, policy RetryPolicy) error
+}
+
+// isTransientNetError returns true if the error is likely to be
+// caused by a broken connection, so a reconnect may help.
+func isTransientNetError(err error) bool {
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// sleepCtx sleeps for the given duration or until the context
+// is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
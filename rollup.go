@@ -0,0 +1,327 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Aggregation is an aggregate function applied by Rollup.
+type Aggregation int
+
+const (
+	// AggSum sums up the values.
+	AggSum Aggregation = iota
+	// AggMin keeps the minimum value.
+	AggMin
+	// AggMax keeps the maximum value.
+	AggMax
+	// AggCount counts the values. It's written as an integer column.
+	AggCount
+)
+
+func (a Aggregation) String() string {
+	switch a {
+	case AggSum:
+		return "sum"
+	case AggMin:
+		return "min"
+	case AggMax:
+		return "max"
+	case AggCount:
+		return "count"
+	default:
+		return fmt.Sprintf("Aggregation(%d)", int(a))
+	}
+}
+
+// RollupAggregation defines an aggregate of a sample column.
+type RollupAggregation struct {
+	// Column is the name of the sample column. Its values must be
+	// int64 or float64.
+	Column string
+	// Agg is the aggregate function.
+	Agg Aggregation
+	// As is the name of the aggregated column. Defaults to the
+	// column name followed by the aggregate name, e.g. "price_max".
+	As string
+}
+
+func (a RollupAggregation) name() string {
+	if a.As != "" {
+		return a.As
+	}
+	return a.Column + "_" + a.Agg.String()
+}
+
+// Rollup pre-aggregates high-frequency samples into one row per
+// table, symbol set and time window before they're written to the
+// sender, which cuts the row volume for counter-style metrics.
+//
+// Samples are added with Add, while the aggregated rows are written
+// by FlushBefore and Flush. The designated timestamp of an aggregated
+// row is the start of its window.
+//
+//	r, err := qdb.NewRollup(sender, time.Minute, []qdb.RollupAggregation{
+//		{Column: "latency", Agg: qdb.AggMax},
+//		{Column: "latency", Agg: qdb.AggCount},
+//	})
+//	// ...
+//	r.Add(qdb.Row{
+//		Table:   "requests",
+//		Symbols: []qdb.KV{{Name: "endpoint", Value: "/api"}},
+//		Columns: []qdb.TypedValue{{Name: "latency", Value: 12.5}},
+//		Ts:      time.Now(),
+//	})
+//	// Periodically:
+//	err = r.FlushBefore(ctx, time.Now())
+//
+// Add is safe for concurrent use, while FlushBefore and Flush must
+// be called by the goroutine owning the sender.
+type Rollup struct {
+	sender LineSender
+	window time.Duration
+	aggs   []RollupAggregation
+
+	mu     sync.Mutex
+	groups map[string]*rollupGroup
+}
+
+type rollupGroup struct {
+	table   string
+	symbols []KV
+	start   time.Time
+	values  []rollupValue
+}
+
+type rollupValue struct {
+	count int64
+	val   float64
+}
+
+// NewRollup creates a Rollup writing the aggregated rows to the
+// sender.
+func NewRollup(sender LineSender, window time.Duration, aggs []RollupAggregation) (*Rollup, error) {
+	if window <= 0 {
+		return nil, errors.New("rollup window is not positive")
+	}
+	if len(aggs) == 0 {
+		return nil, errors.New("no rollup aggregations defined")
+	}
+	for _, a := range aggs {
+		if a.Agg < AggSum || a.Agg > AggCount {
+			return nil, fmt.Errorf("unknown aggregation: %d", a.Agg)
+		}
+		if a.Column == "" {
+			return nil, errors.New("rollup column name cannot be empty")
+		}
+	}
+	return &Rollup{
+		sender: sender,
+		window: window,
+		aggs:   aggs,
+		groups: make(map[string]*rollupGroup),
+	}, nil
+}
+
+// Add aggregates the sample into its window. Samples with a zero
+// timestamp get the current time. Columns that are not aggregated
+// are ignored.
+func (r *Rollup) Add(sample Row) error {
+	ts := sample.Ts
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	start := ts.Truncate(r.window)
+
+	vals := make([]float64, len(r.aggs))
+	present := make([]bool, len(r.aggs))
+	for _, col := range sample.Columns {
+		for i, a := range r.aggs {
+			if a.Column != col.Name {
+				continue
+			}
+			switch v := col.Value.(type) {
+			case int64:
+				vals[i] = float64(v)
+			case float64:
+				vals[i] = v
+			default:
+				return fmt.Errorf("rollup column value is not int64 or float64: %s: %T: %w", col.Name, v, ErrUnsupportedType)
+			}
+			present[i] = true
+		}
+	}
+
+	key := rollupKey(sample.Table, sample.Symbols, start)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g, ok := r.groups[key]
+	if !ok {
+		g = &rollupGroup{
+			table:   sample.Table,
+			symbols: sortedSymbols(sample.Symbols),
+			start:   start,
+			values:  make([]rollupValue, len(r.aggs)),
+		}
+		r.groups[key] = g
+	}
+	for i, a := range r.aggs {
+		if present[i] {
+			g.values[i].add(a.Agg, vals[i])
+		}
+	}
+	return nil
+}
+
+func (v *rollupValue) add(agg Aggregation, val float64) {
+	v.merge(agg, rollupValue{count: 1, val: val})
+}
+
+func (v *rollupValue) merge(agg Aggregation, other rollupValue) {
+	switch {
+	case other.count == 0:
+		return
+	case v.count == 0:
+		v.val = other.val
+	case agg == AggSum:
+		v.val += other.val
+	case agg == AggMin:
+		v.val = math.Min(v.val, other.val)
+	case agg == AggMax:
+		v.val = math.Max(v.val, other.val)
+	}
+	v.count += other.count
+}
+
+// FlushBefore writes the rows of the windows ending at or before the
+// given time to the sender and removes them from the rollup. The
+// rows are sent according to the sender's auto-flush settings. If a
+// row fails to be written, the rows of the remaining windows are
+// kept in the rollup.
+func (r *Rollup) FlushBefore(ctx context.Context, t time.Time) error {
+	return r.flush(ctx, func(g *rollupGroup) bool {
+		return !g.start.Add(r.window).After(t)
+	})
+}
+
+// Flush writes the rows of all windows, including the open ones, to
+// the sender, e.g. before it's closed.
+func (r *Rollup) Flush(ctx context.Context) error {
+	return r.flush(ctx, func(*rollupGroup) bool {
+		return true
+	})
+}
+
+func (r *Rollup) flush(ctx context.Context, done func(g *rollupGroup) bool) error {
+	r.mu.Lock()
+	var groups []*rollupGroup
+	for key, g := range r.groups {
+		if done(g) {
+			groups = append(groups, g)
+			delete(r.groups, key)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].start.Equal(groups[j].start) {
+			return groups[i].start.Before(groups[j].start)
+		}
+		return rollupKey(groups[i].table, groups[i].symbols, time.Time{}) <
+			rollupKey(groups[j].table, groups[j].symbols, time.Time{})
+	})
+	for i, g := range groups {
+		row := Row{Table: g.table, Symbols: g.symbols, Ts: g.start}
+		for i, a := range r.aggs {
+			v := g.values[i]
+			if v.count == 0 {
+				continue
+			}
+			var val interface{} = v.val
+			if a.Agg == AggCount {
+				val = v.count
+			}
+			row.Columns = append(row.Columns, TypedValue{Name: a.name(), Value: val})
+		}
+		if len(row.Columns) == 0 {
+			continue
+		}
+		if err := r.sender.Write(ctx, row); err != nil {
+			r.restore(groups[i+1:])
+			return err
+		}
+	}
+	return nil
+}
+
+// restore brings back the groups that were not written due to an
+// error, merging them with the ones added in the meantime.
+func (r *Rollup) restore(groups []*rollupGroup) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range groups {
+		key := rollupKey(g.table, g.symbols, g.start)
+		cur, ok := r.groups[key]
+		if !ok {
+			r.groups[key] = g
+			continue
+		}
+		for i, a := range r.aggs {
+			cur.values[i].merge(a.Agg, g.values[i])
+		}
+	}
+}
+
+func sortedSymbols(symbols []KV) []KV {
+	sorted := append([]KV(nil), symbols...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// rollupKey identifies the group of samples of a window. Symbols
+// are sorted, so that their order in the samples doesn't matter.
+func rollupKey(table string, symbols []KV, start time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(table)
+	for _, kv := range sortedSymbols(symbols) {
+		sb.WriteByte(0)
+		sb.WriteString(kv.Name)
+		sb.WriteByte('=')
+		sb.WriteString(kv.Value)
+	}
+	sb.WriteByte(0)
+	fmt.Fprint(&sb, start.UnixNano())
+	return sb.String()
+}
@@ -0,0 +1,84 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollup(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+
+	r, err := qdb.NewRollup(sender, time.Second, []qdb.RollupAggregation{
+		{Column: "v", Agg: qdb.AggSum},
+		{Column: "v", Agg: qdb.AggMin},
+		{Column: "v", Agg: qdb.AggMax},
+		{Column: "v", Agg: qdb.AggCount, As: "n"},
+	})
+	assert.NoError(t, err)
+
+	base := time.Unix(100, 0)
+	add := func(host string, ms int, v interface{}) {
+		err := r.Add(qdb.Row{
+			Table:   testTable,
+			Symbols: []qdb.KV{{Name: "host", Value: host}},
+			Columns: []qdb.TypedValue{{Name: "v", Value: v}, {Name: "other", Value: "x"}},
+			Ts:      base.Add(time.Duration(ms) * time.Millisecond),
+		})
+		assert.NoError(t, err)
+	}
+	add("a", 0, 1.5)
+	add("a", 500, int64(3))
+	add("b", 999, -1.0)
+	add("a", 1200, 10.0)
+
+	// Only the closed windows are written.
+	assert.NoError(t, r.FlushBefore(ctx, base.Add(1500*time.Millisecond)))
+	assert.Equal(t,
+		testTable+",host=a v_sum=4.5,v_min=1.5,v_max=3,n=2i 100000000000\n"+
+			testTable+",host=b v_sum=-1,v_min=-1,v_max=-1,n=1i 100000000000\n",
+		qdb.Messages(sender))
+
+	assert.NoError(t, r.Flush(ctx))
+	assert.Contains(t, qdb.Messages(sender), testTable+",host=a v_sum=10,v_min=10,v_max=10,n=1i 101000000000\n")
+
+	err = r.Add(qdb.Row{Table: testTable, Columns: []qdb.TypedValue{{Name: "v", Value: "x"}}})
+	assert.ErrorIs(t, err, qdb.ErrUnsupportedType)
+
+	_, err = qdb.NewRollup(sender, 0, []qdb.RollupAggregation{{Column: "v"}})
+	assert.ErrorContains(t, err, "rollup window is not positive")
+	_, err = qdb.NewRollup(sender, time.Second, nil)
+	assert.ErrorContains(t, err, "no rollup aggregations defined")
+	_, err = qdb.NewRollup(sender, time.Second, []qdb.RollupAggregation{{Column: "v", Agg: 42}})
+	assert.ErrorContains(t, err, "unknown aggregation")
+}
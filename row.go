@@ -0,0 +1,185 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// KV is a symbol name and value pair.
+type KV struct {
+	Name  string
+	Value string
+}
+
+// TypedValue is a named column value. Value holds one of the
+// following types:
+//
+//	int64     - integer (long) column
+//	uint64    - unsigned integer column
+//	*big.Int  - long256 column
+//	float64   - double column
+//	string    - string column
+//	bool      - boolean column
+//	time.Time - timestamp column
+type TypedValue struct {
+	Name  string
+	Value interface{}
+}
+
+// Row is a single ILP message.
+type Row struct {
+	Table   string
+	Symbols []KV
+	Columns []TypedValue
+	// Ts is the designated timestamp. If Ts.IsZero(), the server
+	// assigns the timestamp on insertion.
+	Ts time.Time
+}
+
+// RowError is returned by bulk APIs for an invalid row.
+type RowError struct {
+	// Index is the index of the invalid row.
+	Index int
+	// Err is the validation error.
+	Err error
+}
+
+// Error returns full error message string.
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the validation error.
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// MultiRowError is returned by bulk APIs when one or more rows are
+// invalid. The invalid rows are skipped while the valid ones are
+// written.
+type MultiRowError struct {
+	// Errors holds the errors for the invalid rows in the order
+	// of their indexes.
+	Errors []*RowError
+}
+
+// Error returns full error message string.
+func (e *MultiRowError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d invalid rows: ", len(e.Errors))
+	for i, err := range e.Errors {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap returns the first row error, so that errors.Is and
+// errors.As can be used with the returned error.
+func (e *MultiRowError) Unwrap() error {
+	return e.Errors[0]
+}
+
+// writeRows writes the rows to the sender's buffer one by one.
+// Invalid rows are discarded and reported with a MultiRowError
+// once all rows are processed. Other errors are returned
+// immediately, while the preceding rows stay in the buffer.
+func writeRows(ctx context.Context, s LineSender, rows []Row) error {
+	var rowErrs []*RowError
+	for i := range rows {
+		if err := writeRow(ctx, s, &rows[i]); err != nil {
+			if errors.Is(err, ErrInvalidMessage) {
+				rowErrs = append(rowErrs, &RowError{Index: i, Err: err})
+				continue
+			}
+			return err
+		}
+	}
+	if len(rowErrs) > 0 {
+		return &MultiRowError{Errors: rowErrs}
+	}
+	return nil
+}
+
+func writeRow(ctx context.Context, s LineSender, row *Row) error {
+	encodeRow(s.(bufferedSender).lineBuffer(), row)
+	// Auto-flush is handled by the sender.
+	return s.At(ctx, row.Ts)
+}
+
+// encodeRow writes the row to the buffer, leaving the message
+// pending.
+func encodeRow(buf *buffer, row *Row) {
+	buf.Table(row.Table)
+	for _, kv := range row.Symbols {
+		buf.Symbol(kv.Name, kv.Value)
+	}
+	for _, col := range row.Columns {
+		switch v := col.Value.(type) {
+		case int64:
+			buf.Int64Column(col.Name, v)
+		case uint64:
+			buf.Uint64Column(col.Name, v)
+		case *big.Int:
+			buf.Long256Column(col.Name, v)
+		case float64:
+			buf.Float64Column(col.Name, v)
+		case string:
+			buf.StringColumn(col.Name, v)
+		case bool:
+			buf.BoolColumn(col.Name, v)
+		case time.Time:
+			buf.TimestampColumn(col.Name, v)
+		default:
+			if buf.lastErr == nil {
+				buf.lastErr = fmt.Errorf("unsupported column value type: %s: %T: %w", col.Name, v, ErrUnsupportedType)
+			}
+		}
+	}
+}
+
+// AppendILP appends the row encoded as an ILP line without the
+// trailing newline to dst and returns the extended slice. It
+// validates the row the same way as a sender with the default
+// settings does, so rows can be checked and stored without a sender.
+func (r Row) AppendILP(dst []byte) ([]byte, error) {
+	buf := newBuffer(0, 0, defaultFileNameLimit)
+	encodeRow(&buf, &r)
+	if err := buf.At(r.Ts, !r.Ts.IsZero()); err != nil {
+		return dst, err
+	}
+	return append(dst, trimNewline(buf.Bytes())...), nil
+}
@@ -0,0 +1,157 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// bufferedSender is implemented by all senders of this package.
+// It gives access to the underlying ILP message buffer.
+type bufferedSender interface {
+	lineBuffer() *buffer
+}
+
+// RowBuilder is an alternative to the chained LineSender API with
+// fail-fast semantics: each method returns the error caused by it
+// immediately, instead of deferring it to the At/AtNow call.
+//
+// In case of an error, the pending row is discarded, so that the next
+// row can be started with a Table call.
+//
+// Example usage:
+//
+//	row, err := qdb.NewRowBuilder(sender)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := row.Table("trades"); err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := row.Float("price", 2615.54); err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := row.AtNow(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// RowBuilder shares the buffer with the sender, so it may be mixed with
+// the chained API, but only between the rows. Just like LineSender,
+// RowBuilder is not safe for concurrent use.
+type RowBuilder struct {
+	sender LineSender
+	buf    *buffer
+}
+
+// NewRowBuilder returns a RowBuilder which writes rows to the buffer
+// of the given sender. The sender must be created by this package.
+func NewRowBuilder(s LineSender) (*RowBuilder, error) {
+	bs, ok := s.(bufferedSender)
+	if !ok {
+		return nil, errors.New("row builder is not supported by the given sender")
+	}
+	return &RowBuilder{
+		sender: s,
+		buf:    bs.lineBuffer(),
+	}, nil
+}
+
+// Table starts a new row for the given table.
+func (r *RowBuilder) Table(name string) error {
+	r.buf.Table(name)
+	return r.check()
+}
+
+// Symbol adds a symbol column value to the row.
+func (r *RowBuilder) Symbol(name, val string) error {
+	r.buf.Symbol(name, val)
+	return r.check()
+}
+
+// Int adds a 64-bit integer (long) column value to the row.
+func (r *RowBuilder) Int(name string, val int64) error {
+	r.buf.Int64Column(name, val)
+	return r.check()
+}
+
+// Long256 adds a 256-bit unsigned integer (long256) column value
+// to the row.
+func (r *RowBuilder) Long256(name string, val *big.Int) error {
+	r.buf.Long256Column(name, val)
+	return r.check()
+}
+
+// Timestamp adds a timestamp column value to the row.
+func (r *RowBuilder) Timestamp(name string, ts time.Time) error {
+	r.buf.TimestampColumn(name, ts)
+	return r.check()
+}
+
+// Float adds a 64-bit float (double) column value to the row.
+func (r *RowBuilder) Float(name string, val float64) error {
+	r.buf.Float64Column(name, val)
+	return r.check()
+}
+
+// String adds a string column value to the row.
+func (r *RowBuilder) String(name, val string) error {
+	r.buf.StringColumn(name, val)
+	return r.check()
+}
+
+// Bool adds a boolean column value to the row.
+func (r *RowBuilder) Bool(name string, val bool) error {
+	r.buf.BoolColumn(name, val)
+	return r.check()
+}
+
+// At completes the row with the given designated timestamp.
+// See LineSender.At for details.
+func (r *RowBuilder) At(ctx context.Context, ts time.Time) error {
+	return r.sender.At(ctx, ts)
+}
+
+// AtNow completes the row without a designated timestamp.
+// See LineSender.AtNow for details.
+func (r *RowBuilder) AtNow(ctx context.Context) error {
+	return r.sender.AtNow(ctx)
+}
+
+// Discard drops the pending row, if any.
+func (r *RowBuilder) Discard() {
+	r.buf.ClearLastErr()
+	r.buf.DiscardPendingMsg()
+}
+
+func (r *RowBuilder) check() error {
+	err := r.buf.LastErr()
+	if err != nil {
+		r.Discard()
+	}
+	return err
+}
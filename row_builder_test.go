@@ -0,0 +1,95 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSender struct {
+	qdb.LineSender
+}
+
+func TestRowBuilder(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	row, err := qdb.NewRowBuilder(sender)
+	assert.NoError(t, err)
+
+	assert.NoError(t, row.Table(testTable))
+	assert.NoError(t, row.Symbol("sym", "foo"))
+	assert.NoError(t, row.Int("a_col", 1))
+	assert.NoError(t, row.Float("b_col", 1.5))
+	assert.NoError(t, row.String("c_col", "bar"))
+	assert.NoError(t, row.Bool("d_col", true))
+	assert.NoError(t, row.Timestamp("e_col", time.UnixMicro(42)))
+	assert.NoError(t, row.At(ctx, time.Unix(0, 43)))
+
+	assert.Equal(t, testTable+",sym=foo a_col=1i,b_col=1.5,c_col=\"bar\",d_col=t,e_col=42t 43\n", qdb.Messages(sender))
+}
+
+func TestRowBuilderFailsFast(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	row, err := qdb.NewRowBuilder(sender)
+	assert.NoError(t, err)
+
+	err = row.Int("a_col", 1)
+	assert.ErrorContains(t, err, "table name was not provided")
+
+	assert.NoError(t, row.Table(testTable))
+	assert.NoError(t, row.Int("a_col", 1))
+	err = row.Symbol("sym", "foo")
+	assert.ErrorContains(t, err, "symbols have to be written before any other column")
+
+	// The failed row is discarded and the next one can be written.
+	assert.Empty(t, qdb.Messages(sender))
+	assert.NoError(t, row.Table(testTable))
+	assert.NoError(t, row.Int("a_col", 2))
+	assert.NoError(t, row.AtNow(ctx))
+	assert.Equal(t, testTable+" a_col=2i\n", qdb.Messages(sender))
+
+	err = row.Table("bad?table")
+	assert.ErrorContains(t, err, "table name contains an illegal char")
+	assert.Equal(t, testTable+" a_col=2i\n", qdb.Messages(sender))
+}
+
+func TestRowBuilderUnsupportedSender(t *testing.T) {
+	_, err := qdb.NewRowBuilder(fakeSender{})
+	assert.ErrorContains(t, err, "row builder is not supported")
+}
@@ -0,0 +1,254 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteRows(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	rows := []qdb.Row{
+		{
+			Table:   testTable,
+			Symbols: []qdb.KV{{Name: "sym", Value: "foo"}},
+			Columns: []qdb.TypedValue{
+				{Name: "a", Value: int64(1)},
+				{Name: "b", Value: uint64(2)},
+				{Name: "c", Value: big.NewInt(3)},
+				{Name: "d", Value: 4.5},
+				{Name: "e", Value: "bar"},
+				{Name: "f", Value: true},
+				{Name: "g", Value: time.UnixMicro(6)},
+			},
+			Ts: time.Unix(0, 7),
+		},
+		{
+			Table:   testTable,
+			Columns: []qdb.TypedValue{{Name: "a", Value: int64(8)}},
+		},
+	}
+	err = sender.WriteRows(ctx, rows)
+	assert.NoError(t, err)
+
+	assert.Equal(t,
+		testTable+",sym=foo a=1i,b=2i,c=0x3i,d=4.5,e=\"bar\",f=t,g=6t 7\n"+
+			testTable+" a=8i\n",
+		qdb.Messages(sender))
+}
+
+func TestWriteRowsReportsRowIndex(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name   string
+		row    qdb.Row
+		errMsg string
+	}{
+		{
+			"invalid table name",
+			qdb.Row{Table: "bad?table", Columns: []qdb.TypedValue{{Name: "a", Value: int64(1)}}},
+			"table name contains an illegal char",
+		},
+		{
+			"unsupported type",
+			qdb.Row{Table: testTable, Columns: []qdb.TypedValue{{Name: "a", Value: int32(1)}}},
+			"unsupported column value type: a: int32",
+		},
+		{
+			"uint64 overflow",
+			qdb.Row{Table: testTable, Columns: []qdb.TypedValue{{Name: "a", Value: uint64(math.MaxUint64)}}},
+			"uint64 value does not fit into long column",
+		},
+		{
+			"no columns",
+			qdb.Row{Table: testTable},
+			"no symbols or columns were provided",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			rows := []qdb.Row{
+				{Table: testTable, Columns: []qdb.TypedValue{{Name: "a", Value: int64(1)}}},
+				tc.row,
+				{Table: testTable, Columns: []qdb.TypedValue{{Name: "a", Value: int64(2)}}},
+			}
+			err = sender.WriteRows(ctx, rows)
+
+			var rowErr *qdb.RowError
+			if assert.True(t, errors.As(err, &rowErr)) {
+				assert.Equal(t, 1, rowErr.Index)
+				assert.ErrorContains(t, rowErr, tc.errMsg)
+			}
+			// The invalid row is skipped, while the valid ones are written.
+			assert.Equal(t, testTable+" a=1i\n"+testTable+" a=2i\n", qdb.Messages(sender))
+		})
+	}
+}
+
+func TestWriteRowsCollectsAllRowErrors(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	rows := []qdb.Row{
+		{Table: "bad?table", Columns: []qdb.TypedValue{{Name: "a", Value: int64(0)}}},
+		{Table: testTable, Columns: []qdb.TypedValue{{Name: "a", Value: int64(1)}}},
+		{Table: testTable, Columns: []qdb.TypedValue{{Name: "a", Value: int32(2)}}},
+		{Table: testTable, Columns: []qdb.TypedValue{{Name: "a", Value: int64(3)}}},
+		{Table: testTable},
+	}
+	err = sender.WriteRows(ctx, rows)
+
+	var multiErr *qdb.MultiRowError
+	if assert.True(t, errors.As(err, &multiErr)) {
+		assert.Len(t, multiErr.Errors, 3)
+		assert.Equal(t, 0, multiErr.Errors[0].Index)
+		assert.ErrorIs(t, multiErr.Errors[0], qdb.ErrInvalidName)
+		assert.Equal(t, 2, multiErr.Errors[1].Index)
+		assert.ErrorIs(t, multiErr.Errors[1], qdb.ErrUnsupportedType)
+		assert.Equal(t, 4, multiErr.Errors[2].Index)
+		assert.ErrorIs(t, multiErr.Errors[2], qdb.ErrEmptyMessage)
+	}
+	assert.ErrorContains(t, err, "3 invalid rows: row 0: ")
+	assert.ErrorIs(t, err, qdb.ErrInvalidMessage)
+	assert.Equal(t, testTable+" a=1i\n"+testTable+" a=3i\n", qdb.Messages(sender))
+}
+
+func TestWriteRow(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	rows := make(chan qdb.Row, 2)
+	rows <- qdb.Row{
+		Table:   testTable,
+		Symbols: []qdb.KV{{Name: "sym", Value: "foo"}},
+		Columns: []qdb.TypedValue{{Name: "a", Value: int64(1)}},
+		Ts:      time.Unix(0, 2),
+	}
+	rows <- qdb.Row{
+		Table:   testTable,
+		Columns: []qdb.TypedValue{{Name: "a", Value: int32(3)}},
+	}
+	close(rows)
+
+	var errs []error
+	for row := range rows {
+		if err := sender.Write(ctx, row); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "unsupported column value type: a: int32")
+	assert.Equal(t, testTable+",sym=foo a=1i 2\n", qdb.Messages(sender))
+}
+
+func TestRowAppendILP(t *testing.T) {
+	row := qdb.Row{
+		Table:   testTable,
+		Symbols: []qdb.KV{{Name: "sym", Value: "foo"}},
+		Columns: []qdb.TypedValue{{Name: "a", Value: int64(1)}, {Name: "b", Value: "bar"}},
+		Ts:      time.Unix(0, 2),
+	}
+	text, err := row.AppendILP([]byte("prefix "))
+	assert.NoError(t, err)
+	assert.Equal(t, "prefix "+testTable+",sym=foo a=1i,b=\"bar\" 2", string(text))
+
+	// The row doesn't marshal as text, e.g. when embedded in JSON.
+	_, ok := interface{}(row).(encoding.TextMarshaler)
+	assert.False(t, ok)
+
+	row.Table = "a?b"
+	text, err = row.AppendILP([]byte("prefix "))
+	assert.ErrorContains(t, err, "table name contains an illegal char")
+	assert.Equal(t, "prefix ", string(text))
+}
+
+func TestDedupKey(t *testing.T) {
+	ts := time.UnixMicro(1)
+	row := qdb.Row{
+		Table:   testTable,
+		Symbols: []qdb.KV{{Name: "sym", Value: "AAPL"}},
+		Columns: []qdb.TypedValue{
+			{Name: "price", Value: 1.5},
+			{Name: "note", Value: "foo"},
+		},
+		Ts: ts,
+	}
+	key := qdb.DedupKey{Column: "id", Fields: []string{"sym", "price"}}
+
+	id := key.ID(row)
+	assert.Equal(t, id, key.ID(row))
+
+	// Only the selected fields and the timestamp matter.
+	other := row
+	other.Columns = []qdb.TypedValue{{Name: "price", Value: 1.5}, {Name: "note", Value: "bar"}}
+	assert.Equal(t, id, key.ID(other))
+	other.Ts = ts.Add(time.Microsecond)
+	assert.NotEqual(t, id, key.ID(other))
+	other.Ts = ts
+	other.Columns = []qdb.TypedValue{{Name: "price", Value: 2.5}}
+	assert.NotEqual(t, id, key.ID(other))
+
+	// All fields are used by default.
+	all := qdb.DedupKey{Column: "id"}
+	assert.NotEqual(t, all.ID(row), all.ID(qdb.Row{Table: testTable, Symbols: row.Symbols, Columns: row.Columns[:1], Ts: ts}))
+
+	rows := key.ApplyAll([]qdb.Row{row})
+	assert.Len(t, row.Columns, 2)
+	assert.Equal(t, qdb.TypedValue{Name: "id", Value: id}, rows[0].Columns[2])
+	// The ID column itself doesn't change the ID.
+	assert.Equal(t, all.ID(row), all.ID(all.Apply(row)))
+
+	sender, err := qdb.NewLineSender(context.Background(), qdb.WithHttp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	assert.NoError(t, sender.WriteRows(context.Background(), rows))
+	assert.Equal(t, fmt.Sprintf("%s,sym=AAPL price=1.5,note=\"foo\",id=%di 1000\n", testTable, id), qdb.Messages(sender))
+}
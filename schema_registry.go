@@ -0,0 +1,165 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ilpType is the type of a value in an ILP message.
+type ilpType int
+
+const (
+	ilpSymbol ilpType = iota
+	ilpLong
+	ilpDouble
+	ilpString
+	ilpBoolean
+	ilpTimestamp
+	ilpLong256
+)
+
+func (t ilpType) String() string {
+	switch t {
+	case ilpSymbol:
+		return "symbol"
+	case ilpLong:
+		return "long"
+	case ilpDouble:
+		return "double"
+	case ilpString:
+		return "string"
+	case ilpBoolean:
+		return "boolean"
+	case ilpTimestamp:
+		return "timestamp"
+	default:
+		return "long256"
+	}
+}
+
+// compatible reports whether the server accepts the ILP value type
+// for the column type.
+func (t ilpType) compatible(colType ColumnType) bool {
+	switch t {
+	case ilpSymbol:
+		return colType == ColumnTypeSymbol
+	case ilpLong:
+		switch colType {
+		case ColumnTypeByte, ColumnTypeShort, ColumnTypeInt, ColumnTypeLong,
+			ColumnTypeDate, ColumnTypeTimestamp:
+			return true
+		}
+	case ilpDouble:
+		return colType == ColumnTypeDouble || colType == ColumnTypeFloat
+	case ilpString:
+		switch colType {
+		case ColumnTypeString, ColumnTypeVarchar, ColumnTypeSymbol, ColumnTypeChar,
+			ColumnTypeUuid, ColumnTypeIpv4:
+			return true
+		}
+	case ilpBoolean:
+		return colType == ColumnTypeBoolean
+	case ilpTimestamp:
+		return colType == ColumnTypeTimestamp || colType == ColumnTypeDate
+	case ilpLong256:
+		return colType == ColumnTypeLong256
+	}
+	return false
+}
+
+// SchemaRegistry holds the expected schemas of tables. Senders
+// created with WithSchemaRegistry reject values whose types conflict
+// with the registered column types, e.g. a double written to a LONG
+// column, instead of having the server drop the rows mid-stream.
+// Tables that are not registered are not checked, while columns
+// missing in a registered schema are only rejected with
+// WithStrictSchema.
+//
+// SchemaRegistry is safe for concurrent use, so it may be shared by
+// multiple senders.
+type SchemaRegistry struct {
+	mu     sync.RWMutex
+	tables map[string]map[string]ColumnType
+}
+
+// NewSchemaRegistry creates an empty SchemaRegistry.
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{tables: make(map[string]map[string]ColumnType)}
+}
+
+// Register adds the table schema to the registry, replacing the
+// previous schema of the table, if any. Schemas may be obtained with
+// SchemaFromStruct or written by hand.
+func (r *SchemaRegistry) Register(schema TableSchema) error {
+	if schema.Name == "" {
+		return errors.New("table name cannot be empty")
+	}
+	cols := make(map[string]ColumnType, len(schema.Columns))
+	for _, col := range schema.Columns {
+		if col.Name == "" || col.Type == "" {
+			return fmt.Errorf("column name and type cannot be empty: table %s", schema.Name)
+		}
+		cols[col.Name] = col.Type
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tables[schema.Name] = cols
+	return nil
+}
+
+// columns returns the registered column types of the table, if any.
+// The returned map must not be modified.
+func (r *SchemaRegistry) columns(table string) map[string]ColumnType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tables[table]
+}
+
+// checkColumnType sets the last error if the value type conflicts
+// with the registered type of the column, or if the column is not
+// registered and the strict schema mode is on.
+func (b *buffer) checkColumnType(name string, t ilpType) bool {
+	if b.tableColumns == nil || b.lastErr != nil {
+		return true
+	}
+	colType, ok := b.tableColumns[name]
+	if !ok {
+		if b.strictSchema {
+			b.lastErr = fmt.Errorf("table %s, column %s: %w", b.tableName, name, ErrUnknownColumn)
+			return false
+		}
+		return true
+	}
+	if t.compatible(colType) {
+		return true
+	}
+	b.lastErr = fmt.Errorf("%s value conflicts with the registered column type: table %s, column %s, type %s: %w",
+		t, b.tableName, name, colType, ErrColumnTypeMismatch)
+	return false
+}
@@ -26,9 +26,12 @@ package questdb
 
 import (
 	"context"
+	"encoding"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -61,6 +64,16 @@ type LineSender interface {
 	// '-', '*' '%%', '~', or a non-printable char.
 	Symbol(name, val string) LineSender
 
+	// SymbolStringer adds a symbol column value to the ILP message,
+	// taking the value from the String method of val. A nil val,
+	// including a nil pointer, is omitted. Should be called before
+	// any Column method.
+	//
+	// Symbol name cannot contain any of the following characters:
+	// '\n', '\r', '?', '.', ',', ”', '"', '\\', '/', ':', ')', '(', '+',
+	// '-', '*' '%%', '~', or a non-printable char.
+	SymbolStringer(name string, val fmt.Stringer) LineSender
+
 	// Int64Column adds a 64-bit integer (long) column value to the ILP
 	// message.
 	//
@@ -69,6 +82,18 @@ type LineSender interface {
 	// '-', '*' '%%', '~', or a non-printable char.
 	Int64Column(name string, val int64) LineSender
 
+	// Uint64Column adds a 64-bit unsigned integer column value to
+	// the ILP message.
+	//
+	// By default, the value is sent as a long column and values larger
+	// than math.MaxInt64 lead to an error. With WithUint64AsLong256
+	// option, all values are sent as long256 instead.
+	//
+	// Column name cannot contain any of the following characters:
+	// '\n', '\r', '?', '.', ',', ”', '"', '\\', '/', ':', ')', '(', '+',
+	// '-', '*' '%%', '~', or a non-printable char.
+	Uint64Column(name string, val uint64) LineSender
+
 	// Long256Column adds a 256-bit unsigned integer (long256) column
 	// value to the ILP message.
 	//
@@ -88,6 +113,25 @@ type LineSender interface {
 	// '-', '*' '%%', '~', or a non-printable char.
 	TimestampColumn(name string, ts time.Time) LineSender
 
+	// TimestampMicrosColumn adds a timestamp column value to the ILP
+	// message. The value is the number of microseconds since
+	// the Unix epoch.
+	//
+	// Column name cannot contain any of the following characters:
+	// '\n', '\r', '?', '.', ',', ”', '"', '\\', '/', ':', ')', '(', '+',
+	// '-', '*' '%%', '~', or a non-printable char.
+	TimestampMicrosColumn(name string, ts int64) LineSender
+
+	// TimestampNanosColumn adds a timestamp column value to the ILP
+	// message. The value is the number of nanoseconds since the Unix
+	// epoch. Timestamp columns have microsecond precision, so the
+	// value is truncated to microseconds.
+	//
+	// Column name cannot contain any of the following characters:
+	// '\n', '\r', '?', '.', ',', ”', '"', '\\', '/', ':', ')', '(', '+',
+	// '-', '*' '%%', '~', or a non-printable char.
+	TimestampNanosColumn(name string, ts int64) LineSender
+
 	// Float64Column adds a 64-bit float (double) column value to the ILP
 	// message.
 	//
@@ -98,11 +142,25 @@ type LineSender interface {
 
 	// StringColumn adds a string column value to the ILP message.
 	//
+	// ILP has a single encoding for STRING and VARCHAR values, so
+	// the type of auto-created columns is chosen by the server.
+	// To get a specific type, create the table upfront, e.g. with
+	// the "varchar" struct tag option and RestClient.CreateTable.
+	//
 	// Column name cannot contain any of the following characters:
 	// '\n', '\r', '?', '.', ',', ”', '"', '\', '/', ':', ')', '(', '+',
 	// '-', '*' '%%', '~', or a non-printable char.
 	StringColumn(name, val string) LineSender
 
+	// StringColumnMarshaler adds a string column value to the ILP
+	// message, taking the value from the MarshalText method of val.
+	// A nil val, including a nil pointer, is omitted.
+	//
+	// Column name cannot contain any of the following characters:
+	// '\n', '\r', '?', '.', ',', ”', '"', '\\', '/', ':', ')', '(', '+',
+	// '-', '*' '%%', '~', or a non-printable char.
+	StringColumnMarshaler(name string, val encoding.TextMarshaler) LineSender
+
 	// BoolColumn adds a boolean column value to the ILP message.
 	//
 	// Column name cannot contain any of the following characters:
@@ -110,6 +168,19 @@ type LineSender interface {
 	// '-', '*' '%%', '~', or a non-printable char.
 	BoolColumn(name string, val bool) LineSender
 
+	// AnyColumn adds a column value of an arbitrary Go type to the
+	// ILP message. The ILP encoding is chosen by the value type:
+	// integers of all widths are written as integer columns, floats
+	// as double columns, time.Time as a timestamp column, *big.Int as
+	// a long256 column, and []byte and fmt.Stringer values as string
+	// columns. Nil values are omitted. The coercion rules may be
+	// tuned with WithAnyColumnRules.
+	//
+	// Column name cannot contain any of the following characters:
+	// '\n', '\r', '?', '.', ',', ”', '"', '\', '/', ':', ')', '(', '+',
+	// '-', '*' '%%', '~', or a non-printable char.
+	AnyColumn(name string, val interface{}) LineSender
+
 	// At sets the timestamp in Epoch nanoseconds and finalizes
 	// the ILP message.
 	//
@@ -122,13 +193,52 @@ type LineSender interface {
 
 	// AtNow omits the timestamp and finalizes the ILP message.
 	// The server will insert each message using the system clock
-	// as the row timestamp.
+	// as the row timestamp. With WithClientTimestamps option, the
+	// client clock is used instead.
 	//
 	// If the underlying buffer reaches configured capacity or the
 	// number of buffered messages exceeds the auto-flush trigger, this
 	// method also sends the accumulated messages.
 	AtNow(ctx context.Context) error
 
+	// AtMicros sets the timestamp in Epoch microseconds and finalizes
+	// the ILP message. Useful when the application already holds
+	// the timestamp as an Epoch value.
+	//
+	// An error is returned if the timestamp can't be represented
+	// in Epoch nanoseconds.
+	//
+	// If the underlying buffer reaches configured capacity or the
+	// number of buffered messages exceeds the auto-flush trigger, this
+	// method also sends the accumulated messages.
+	AtMicros(ctx context.Context, ts int64) error
+
+	// AtMillis sets the timestamp in Epoch milliseconds and finalizes
+	// the ILP message. Useful when the application already holds
+	// the timestamp as an Epoch value.
+	//
+	// An error is returned if the timestamp can't be represented
+	// in Epoch nanoseconds.
+	//
+	// If the underlying buffer reaches configured capacity or the
+	// number of buffered messages exceeds the auto-flush trigger, this
+	// method also sends the accumulated messages.
+	AtMillis(ctx context.Context, ts int64) error
+
+	// AtRaw appends a complete, pre-escaped ILP line to the buffer
+	// as a single message. The line is not validated, so it's up
+	// to the caller to make sure that it's correct; a malformed line
+	// is rejected by the server along with the whole batch. The
+	// trailing newline is optional.
+	//
+	// Should not be called while a message built with Table is
+	// pending. Fails if the sender has a redactor, see WithRedactor.
+	//
+	// If the underlying buffer reaches configured capacity or the
+	// number of buffered messages exceeds the auto-flush trigger, this
+	// method also sends the accumulated messages.
+	AtRaw(ctx context.Context, line []byte) error
+
 	// Flush sends the accumulated messages via the underlying
 	// connection. Should be called periodically to make sure that
 	// all messages are sent to the server.
@@ -138,8 +248,108 @@ type LineSender interface {
 	// batches followed by a Flush call. The optimal batch size may
 	// vary from one thousand to few thousand messages depending on
 	// the message size.
+	//
+	// A failed flush drops the whole batch from the buffer. That
+	// includes a failed or short TCP write: the unwritten tail is not
+	// kept for the next Flush, since it may start in the middle of a
+	// message. The batch can be brought back with Restore from
+	// a Checkpoint taken before the flush.
 	Flush(ctx context.Context) error
 
+	// FlushWithStats works in the same way as Flush, but also
+	// returns statistics of the flushed batch. Useful for logging
+	// throughput and adaptive batching.
+	//
+	// In case of an error, zero statistics are returned.
+	FlushWithStats(ctx context.Context) (FlushStats, error)
+
+	// WriteRows writes the given rows to the buffer in one go. It's
+	// friendlier for batch ETL jobs than the chained API.
+	//
+	// Invalid rows are discarded while the valid ones are written.
+	// Once all rows are processed, a *MultiRowError listing the index
+	// and the error of each invalid row is returned. Errors not related
+	// to the rows, such as auto-flush errors, are returned as is and
+	// stop the write, while the preceding rows stay in the buffer.
+	//
+	// If the underlying buffer reaches configured capacity or the
+	// number of buffered messages exceeds the auto-flush trigger, this
+	// method also sends the accumulated messages.
+	WriteRows(ctx context.Context, rows []Row) error
+
+	// Write writes the given row to the buffer. Unlike WriteRows,
+	// an invalid row error is returned as is.
+	//
+	// If the underlying buffer reaches configured capacity or the
+	// number of buffered messages exceeds the auto-flush trigger, this
+	// method also sends the accumulated messages.
+	Write(ctx context.Context, row Row) error
+
+	// WriteStruct writes a struct value, or a pointer to a struct, as
+	// an ILP message. The field to column mapping is defined by the
+	// "qdb" struct tags, see SchemaFromStruct for the tag format. If
+	// table is empty, the struct type name is used.
+	//
+	// Encoding plans of struct types are kept in a cache shared with
+	// Encoder instances, so field metadata is not recomputed on each
+	// call. For hot paths with a known type, prefer Encoder.
+	//
+	// If the underlying buffer reaches configured capacity or the
+	// number of buffered messages exceeds the auto-flush trigger, this
+	// method also sends the accumulated messages.
+	WriteStruct(ctx context.Context, table string, v interface{}) error
+
+	// RawWriter returns an io.Writer that accepts pre-formatted,
+	// newline-terminated ILP lines and appends them to the buffer.
+	// The lines go through the same buffering and auto-flush logic
+	// as the messages written with the other methods, which lets
+	// existing line protocol producers reuse the sender's transport.
+	//
+	// The lines are not validated. An incomplete trailing line is
+	// kept by the writer until its newline is written. Writes fail
+	// if there is a pending message or the sender has a redactor.
+	//
+	// Write calls auto-flush with a background context. The returned
+	// writer is bound to the sender and shares its lack of thread safety.
+	RawWriter() io.Writer
+
+	// Checkpoint returns a snapshot of the buffer state that includes
+	// all completed messages. The buffer can be rolled back to the
+	// snapshot with Restore.
+	//
+	// Checkpoints are cheap and may be taken before each group of
+	// related messages or before a flush attempt.
+	Checkpoint() Checkpoint
+
+	// Restore rolls the buffer back to the given checkpoint, dropping
+	// the messages written after the checkpoint, along with the pending
+	// message, if any.
+	//
+	// Checkpoints taken before a failed flush attempt bring back the
+	// messages of the failed batch, so that they can be sent again.
+	// Note that part of the batch may have been already delivered to
+	// the server. A checkpoint becomes invalid once the buffer is
+	// successfully flushed, and an error is returned in that case.
+	Restore(cp Checkpoint) error
+
+	// Config returns a snapshot of the sender configuration, including
+	// the defaults. It can be used to create more senders with
+	// the exact same settings via NewLineSenderFromConfig.
+	Config() ConfigSnapshot
+
+	// PendingFlush returns a token that is resolved once the messages
+	// completed so far are flushed, either explicitly or by auto-flush.
+	// If the sender is closed before that, the token is resolved with
+	// an error. If there are no such messages, the returned token is
+	// already resolved.
+	PendingFlush() *FlushToken
+
+	// ServerInfo returns the server version and capabilities. The
+	// HTTP sender queries the /settings endpoint the first time the
+	// method is called, unless WithFeatureNegotiation was used.
+	// Other senders return an error wrapping ErrUnsupportedBySender.
+	ServerInfo(ctx context.Context) (ServerInfo, error)
+
 	// Close closes the underlying HTTP client.
 	//
 	// If auto-flush is enabled, the client will flush any remaining buffered
@@ -147,6 +357,36 @@ type LineSender interface {
 	Close(ctx context.Context) error
 }
 
+// FlushStats holds statistics of a flushed batch of ILP messages.
+type FlushStats struct {
+	// Rows is the number of flushed messages.
+	Rows int
+	// Bytes is the number of flushed bytes.
+	Bytes int
+	// Duration is the time taken by the flush, including retries.
+	Duration time.Duration
+	// TruncatedStrings is the number of string values truncated
+	// in the batch, see WithMaxStringLength.
+	TruncatedStrings int
+}
+
+// flushWithStats calls the given flush function and collects
+// statistics of the batch flushed by it.
+func flushWithStats(buf *buffer, flush func() error) (FlushStats, error) {
+	stats := FlushStats{
+		Rows:             buf.msgCount(),
+		Bytes:            buf.Len(),
+		TruncatedStrings: buf.truncated,
+	}
+	start := time.Now()
+	err := flush()
+	if err != nil {
+		return FlushStats{}, err
+	}
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
+
 const (
 	defaultHttpAddress = "127.0.0.1:9000"
 	defaultTcpAddress  = "127.0.0.1:9009"
@@ -155,6 +395,8 @@ const (
 	defaultMaxBufferSize  = 100 * 1024 * 1024 // 100MB
 	defaultFileNameLimit  = 127
 
+	defaultTruncationMarker = "..."
+
 	defaultAutoFlushRows     = 75000
 	defaultAutoFlushInterval = time.Second
 
@@ -180,15 +422,29 @@ const (
 )
 
 type lineSenderConfig struct {
-	senderType    senderType
-	address       string
-	initBufSize   int
-	maxBufSize    int
-	fileNameLimit int
-	httpTransport *http.Transport
+	senderType senderType
+	// Set when both WithHttp and WithTcp options were provided.
+	senderTypeConflict bool
+	// Set when the sender type and TLS mode come from an address
+	// scheme, e.g. "https://", so TLS must not be enabled
+	// automatically.
+	explicitScheme bool
+	address        string
+	initBufSize    int
+	maxBufSize     int
+	fileNameLimit  int
+	httpTransport  *http.Transport
+	http2          bool
+
+	// HTTP connection pool fields
+	httpMaxIdleConns    int
+	httpMaxConnsPerHost int
+	httpIdleConnTimeout time.Duration
+	httpKeepAlivePing   time.Duration
 
 	// Retry/timeout-related fields
 	retryTimeout   time.Duration
+	maxRetries     int
 	minThroughput  int
 	requestTimeout time.Duration
 
@@ -203,6 +459,89 @@ type lineSenderConfig struct {
 	// Auto-flush fields
 	autoFlushRows     int
 	autoFlushInterval time.Duration
+	autoFlushBytes    int
+	autoFlushDisabled bool
+
+	// Pending rows guard fields
+	maxPendingRows    int
+	pendingRowsPolicy PendingRowsPolicy
+
+	// Monotonic timestamp guard fields
+	tsGuard     bool
+	tsTolerance time.Duration
+	tsWarn      func(err error)
+
+	circuitBreaker *CircuitBreakerConfig
+
+	backoff      Backoff
+	deliveryMode DeliveryMode
+
+	bufferPool *BufferPool
+	shedder    *Shedder
+
+	oversizedRowSize int
+
+	memoryLimit    int64
+	memoryOverflow OverflowPolicy
+
+	bufferSwap         bool
+	disconnectDetector bool
+
+	rowInterceptors []func(*RowView) error
+	redactor        Redactor
+	schemas         *SchemaRegistry
+	anyRules        AnyColumnRules
+	dupFilter       *DuplicateFilter
+	strictSchema    bool
+
+	// Delivery deadline fields
+	deliveryTimeout time.Duration
+	deadLetter      func(batch []byte, err error)
+	partialFlush    bool
+
+	// TCP idle connection timeout
+	tcpIdleTimeout time.Duration
+
+	// Delay of the IPv4 fallback when dialing dual-stack hosts.
+	dialFallbackDelay time.Duration
+
+	// Existing connection to be used by the TCP sender
+	// instead of dialing.
+	conn net.Conn
+
+	// Disk spool fields
+	spoolDir       string
+	spoolThreshold int
+
+	chunkedThreshold int
+	negotiate        bool
+
+	globalSymbols map[string]string
+
+	metrics MetricsHook
+
+	debugWriter   io.Writer
+	debugMaxBytes int
+
+	wireTrace io.Writer
+
+	tee io.Writer
+
+	reorderSymbols bool
+	ctrlChars      ControlCharPolicy
+	validation     ValidationLevel
+
+	// String length limit fields
+	maxStrLen        int
+	strLenPolicy     StringLengthPolicy
+	truncMarker      string
+	truncMarkerSet   bool
+	floatPrecision   int
+	uint64AsLong256  bool
+	clientTimestamps bool
+
+	dryRun bool
+	strict bool
 }
 
 // LineSenderOption defines line sender config option.
@@ -211,6 +550,9 @@ type LineSenderOption func(*lineSenderConfig)
 // WithHttp enables ingestion over HTTP protocol.
 func WithHttp() LineSenderOption {
 	return func(s *lineSenderConfig) {
+		if s.senderType == tcpSenderType {
+			s.senderTypeConflict = true
+		}
 		s.senderType = httpSenderType
 	}
 }
@@ -218,6 +560,9 @@ func WithHttp() LineSenderOption {
 // WithTcp enables ingestion over TCP protocol.
 func WithTcp() LineSenderOption {
 	return func(s *lineSenderConfig) {
+		if s.senderType == httpSenderType {
+			s.senderTypeConflict = true
+		}
 		s.senderType = tcpSenderType
 	}
 }
@@ -298,17 +643,216 @@ func WithRetryTimeout(t time.Duration) LineSenderOption {
 	}
 }
 
+// WithMaxRetries sets the maximum number of retries of a failed
+// flush. Defaults to 0, which means that retries are only limited
+// by the retry timeout. Retries stop as soon as either of the limits
+// is reached. Once the retries are exhausted, flush returns
+// a MaxRetriesError holding the number of attempts.
+//
+// Only available for the HTTP sender.
+func WithMaxRetries(n int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.maxRetries = n
+	}
+}
+
 // WithInitBufferSize sets the desired initial buffer capacity
 // in bytes to be used when sending ILP messages. Defaults to 128KB.
 //
 // This setting is a soft limit, i.e. the underlying buffer may
 // grow larger than the provided value.
+//
+// The TCP sender flushes the buffer automatically once it grows
+// beyond the initial capacity, unless WithAutoFlushBytes is set.
 func WithInitBufferSize(sizeInBytes int) LineSenderOption {
 	return func(s *lineSenderConfig) {
 		s.initBufSize = sizeInBytes
 	}
 }
 
+// WithBufferPool makes the sender take its buffer from the given
+// pool when it starts a batch and return the buffer once the batch
+// is flushed successfully. Sharing one pool across many senders,
+// e.g. the ones of a LineSenderPool, caps the memory held by idle
+// senders.
+func WithBufferPool(p *BufferPool) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.bufferPool = p
+	}
+}
+
+// WithDuplicateFilter makes the sender drop rows byte-identical to
+// the ones buffered since the last flush. Dropped rows are not
+// reported as errors, but are counted by the DuplicateFilter.
+func WithDuplicateFilter(f *DuplicateFilter) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.dupFilter = f
+	}
+}
+
+// WithShedder makes the sender shed the load with the given Shedder
+// once the limit set with WithMaxPendingRows is reached, instead of
+// applying the pending rows policy. The sender flushes at the limit
+// first. If the flush fails, the rows are kept and the new ones are
+// shed until a flush succeeds; a TCP sender with WithBufferSwap also
+// sheds them while the previous batch is being written. Dropped rows
+// are not reported as errors, but are counted by the Shedder.
+func WithShedder(sh *Shedder) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.shedder = sh
+	}
+}
+
+// WithOversizedRowSize makes the sender send rows larger than
+// the given size in bytes right away at At time, so that the buffer
+// doesn't keep the capacity grown by such rows. The TCP sender
+// flushes the buffer along with the row, while the HTTP sender
+// sends the preceding rows and the oversized row in separate
+// requests. If only the request with the oversized row fails, the
+// preceding rows are not sent again. Once sent, the buffer shrinks
+// back to its initial capacity. Defaults to 0, which means that rows
+// of any size are buffered as usual.
+//
+// The row is still encoded into the buffer as a whole: neither
+// sender streams it to the connection in segments, so the buffer
+// grows to fit the row until the flush.
+func WithOversizedRowSize(bytes int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.oversizedRowSize = bytes
+	}
+}
+
+// WithAnyColumnRules sets the coercion rules used by AnyColumn,
+// e.g. the encoding of []byte values.
+func WithAnyColumnRules(rules AnyColumnRules) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.anyRules = rules
+	}
+}
+
+// WithSchemaRegistry makes the sender check the column value types
+// against the table schemas registered in the given registry. Values
+// conflicting with the registered types fail the message with
+// ErrColumnTypeMismatch returned by At or AtNow.
+func WithSchemaRegistry(r *SchemaRegistry) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.schemas = r
+	}
+}
+
+// WithStrictSchema makes the sender created with WithSchemaRegistry
+// reject symbols and columns missing in the registered schemas with
+// ErrUnknownColumn, so that typos in column names don't make the
+// server create junk columns. Tables that are not registered are not
+// checked.
+func WithStrictSchema() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.strictSchema = true
+	}
+}
+
+// WithRedactor sets a function that masks or hashes sensitive symbol
+// and column values, e.g. PII fields, before they're written to the
+// sender's buffer, so that they never leave the process. The
+// redactor is called for every value, so it should return the
+// value as is for the columns that don't need redaction.
+//
+// Raw ILP lines can't be redacted, so AtRaw, RawWriter and
+// BatchWriter fail with a redactor set. The symbols set with
+// WithGlobalSymbols are not redacted either, since they are part
+// of the sender's configuration.
+//
+//	qdb.WithRedactor(func(table, column string, value interface{}) (interface{}, bool) {
+//		if column == "email" {
+//			return hash(value.(string)), true
+//		}
+//		return value, true
+//	})
+func WithRedactor(fn Redactor) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.redactor = fn
+	}
+}
+
+// WithRowInterceptor adds a function called by At and AtNow just
+// before each row is finalized, e.g. to enrich, validate or audit
+// rows without modifying every call site. Interceptors are called
+// in the order they were added. If an interceptor returns an error,
+// the row is discarded and At returns the error.
+//
+// Interceptors are called on the sender's goroutine, so they should
+// be cheap.
+func WithRowInterceptor(fn func(*RowView) error) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.rowInterceptors = append(s.rowInterceptors, fn)
+	}
+}
+
+// WithBufferSwap makes the TCP sender swap the buffer with an empty
+// one on flush and write the detached buffer to the connection in
+// the background, so that new rows can be added right away and no
+// bytes are copied between buffering and I/O. Two buffers are used
+// in turn, or the ones of the BufferPool set with WithBufferPool.
+//
+// Flush returns once the write has started. Its outcome is reported
+// by the next Flush or Close call, which wait for the write, while
+// the flush token is resolved as soon as it's done. FlushRetry
+// waits for the write, so the batch can be retried.
+//
+// Only available for the TCP sender.
+func WithBufferSwap() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.bufferSwap = true
+	}
+}
+
+// WithDisconnectDetection makes the TCP sender watch the connection
+// in a background goroutine and detect server-side disconnects right
+// away, e.g. the ones caused by ILP parse errors. Otherwise, they are
+// only noticed by a later flush, if at all, since writes to a closed
+// connection may succeed locally.
+//
+// Once a disconnect is detected, the next At or Flush call returns
+// an error wrapping ErrServerDisconnected, and the buffered messages
+// are sent over a new connection on the following flush.
+//
+// Only available for the TCP sender.
+func WithDisconnectDetection() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.disconnectDetector = true
+	}
+}
+
+// WithMemoryLimit caps the memory used by the buffered ILP messages
+// of all senders created with this option, including the ones of a
+// LineSenderPool. The usage is accounted process-wide, so each sender
+// compares the total against its own limit. Once the limit is
+// exceeded, At applies the policy set with WithMemoryOverflowPolicy.
+// The current usage is reported by GetMemoryStats. Defaults to 0,
+// which means no limit.
+//
+// Only the completed messages in the sender buffers are accounted.
+// The idle buffers of a BufferPool, the rows queued by an AsyncSender
+// and the batches spooled with WithSpillToDisk are not.
+func WithMemoryLimit(bytes int64) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.memoryLimit = bytes
+	}
+}
+
+// WithMemoryOverflowPolicy sets what At does once the process-wide
+// memory limit set with WithMemoryLimit is exceeded. OverflowBlock
+// flushes the sender's buffer, blocking At for the duration of the
+// flush. If other senders keep the usage over the limit, At returns
+// ErrMemoryLimit after the flush; the message is sent in that case.
+// OverflowReject drops the message and returns ErrMemoryLimit.
+// Defaults to OverflowBlock.
+func WithMemoryOverflowPolicy(p OverflowPolicy) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.memoryOverflow = p
+	}
+}
+
 // WithMaxBufferSize sets the maximum buffer capacity
 // in bytes to be used when sending ILP messages. The sender will
 // return an error if the limit is reached. Defaults to 100MB.
@@ -322,8 +866,13 @@ func WithMaxBufferSize(sizeInBytes int) LineSenderOption {
 
 // WithFileNameLimit sets maximum file name length in chars
 // allowed by the server. Affects maximum table and column name
-// lengths accepted by the sender. Should be set to the same value
-// as on the server. Defaults to 127.
+// lengths accepted by the sender, so that lengthy names fail
+// locally instead of the whole batch being rejected by the server.
+// Should be set to the same value as on the server. Defaults to 127.
+//
+// The limit is replaced with the server's one if feature negotiation
+// is enabled and the server reports it, see WithFeatureNegotiation.
+// The equivalent config string key is max_name_len.
 func WithFileNameLimit(limit int) LineSenderOption {
 	return func(s *lineSenderConfig) {
 		s.fileNameLimit = limit
@@ -333,6 +882,21 @@ func WithFileNameLimit(limit int) LineSenderOption {
 // WithAddress sets address to connect to. Should be in the
 // "host:port" format. Defaults to "127.0.0.1:9000" in case
 // of HTTP and "127.0.0.1:9009" in case of TCP.
+//
+// IPv6 literals must be enclosed in square brackets when a port
+// is specified, e.g. "[::1]:9009". A bare IPv6 literal, e.g. "::1",
+// gets the default port of the sender type.
+//
+// The address may also have one of the "http://", "https://",
+// "tcp://" or "tcps://" scheme prefixes, e.g. "https://db:9000",
+// in which case the transport and TLS are inferred from the scheme,
+// so WithHttp, WithTcp and WithTls may be omitted. The port then
+// defaults to 9000 for HTTP and 9009 for TCP.
+//
+// Without a scheme, TLS with the system root certificates is enabled
+// automatically for QuestDB Cloud addresses, i.e. the ones in the
+// questdb.net domain. Use the "http://" or "tcp://" scheme to connect
+// to such addresses without TLS.
 func WithAddress(addr string) LineSenderOption {
 	return func(s *lineSenderConfig) {
 		s.address = addr
@@ -362,14 +926,126 @@ func WithHttpTransport(t *http.Transport) LineSenderOption {
 	}
 }
 
+// WithHttp2 makes the sender negotiate HTTP/2 with the server. With
+// HTTP/2, concurrent flushes of all senders sharing the transport are
+// multiplexed over a single connection, which improves throughput on
+// high-latency links. See AsyncSenderConfig.ShardByTable for a way to
+// have multiple in-flight flushes while keeping the row order per
+// table.
+//
+// HTTP/2 is only negotiated over TLS connections, plain text
+// connections keep using HTTP/1.1. The option is ignored when
+// WithHttpTransport is in use.
+//
+// Only available for the HTTP sender.
+func WithHttp2() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.http2 = true
+	}
+}
+
+// WithHttpMaxIdleConns sets the max number of idle connections
+// kept by the HTTP transport, both in total and per host. Defaults
+// to 64.
+//
+// Senders with the same connection pool settings share the transport
+// and, thus, the connections. The option is ignored when
+// WithHttpTransport is in use.
+//
+// Only available for the HTTP sender.
+func WithHttpMaxIdleConns(n int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.httpMaxIdleConns = n
+	}
+}
+
+// WithHttpMaxConnsPerHost limits the number of connections per host,
+// including the ones in use. Flushes over the limit wait for a free
+// connection. Defaults to 0, which means no limit.
+//
+// Senders with the same connection pool settings share the transport
+// and, thus, the connections. The option is ignored when
+// WithHttpTransport is in use.
+//
+// Only available for the HTTP sender.
+func WithHttpMaxConnsPerHost(n int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.httpMaxConnsPerHost = n
+	}
+}
+
+// WithHttpIdleConnTimeout sets the time after which idle connections
+// are closed. Defaults to 2 minutes.
+//
+// Senders with the same connection pool settings share the transport
+// and, thus, the connections. The option is ignored when
+// WithHttpTransport is in use.
+//
+// Only available for the HTTP sender.
+func WithHttpIdleConnTimeout(d time.Duration) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.httpIdleConnTimeout = d
+	}
+}
+
+// WithHttpKeepAlivePing makes the sender send a GET /ping request
+// to the server once no request was sent for the given interval, so
+// that the pooled connection is kept open between infrequent flushes.
+// This way, the first flush after an idle period doesn't pay for
+// a new TLS handshake or hit a connection half-closed by a proxy.
+// Disabled by default.
+//
+// The interval should be shorter than the idle connection timeout
+// of the server, the proxies in between and the client, see
+// WithHttpIdleConnTimeout.
+//
+// Only available for the HTTP sender.
+func WithHttpKeepAlivePing(interval time.Duration) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.httpKeepAlivePing = interval
+	}
+}
+
+// WithDialFallbackDelay sets the delay after which a connection
+// attempt over IPv4 is started in parallel with a pending IPv6 one
+// when the server's host name resolves to both address families,
+// as described in RFC 8305 (Happy Eyeballs). This avoids long
+// connection delays in dual-stack environments with broken IPv6.
+//
+// Defaults to 0, which means the net.Dialer default of 300ms.
+// A negative value disables the parallel attempts, so addresses
+// are tried one after another.
+//
+// For the HTTP sender, the option is ignored when WithHttpTransport
+// is in use.
+func WithDialFallbackDelay(d time.Duration) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.dialFallbackDelay = d
+	}
+}
+
+// WithIdleTimeout makes the sender close the connection if no
+// messages were flushed for the given duration. The connection is
+// checked and, if necessary, dialed again on the next flush. This
+// avoids writing to connections that were silently dropped due to
+// stale NAT mappings or server-side idle timeouts.
+//
+// Only available for the TCP sender.
+func WithIdleTimeout(d time.Duration) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.tcpIdleTimeout = d
+	}
+}
+
 // WithAutoFlushDisabled turns off auto-flushing behavior.
-// To send ILP messages, the user must call Flush().
+// To send ILP messages, the user must call Flush(). Close doesn't
+// flush either, so the messages buffered since the last Flush are
+// discarded. Takes precedence over the other auto-flush options.
 //
 // Only available for the HTTP sender.
 func WithAutoFlushDisabled() LineSenderOption {
 	return func(s *lineSenderConfig) {
-		s.autoFlushRows = 0
-		s.autoFlushInterval = 0
+		s.autoFlushDisabled = true
 	}
 }
 
@@ -384,6 +1060,21 @@ func WithAutoFlushRows(rows int) LineSenderOption {
 	}
 }
 
+// WithAutoFlushBytes sets the buffer size in bytes that must be
+// breached in order to trigger an auto-flush, independently of
+// the initial buffer capacity. This way, large buffers may be
+// pre-allocated with WithInitBufferSize without changing the flush
+// cadence, and vice versa.
+//
+// Defaults to 0, in which case the TCP sender flushes once the
+// buffer grows beyond the initial capacity, while the HTTP sender
+// relies on the row count and interval based auto-flushes only.
+func WithAutoFlushBytes(bytes int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.autoFlushBytes = bytes
+	}
+}
+
 // WithAutoFlushInterval the interval at which the Sender
 // automatically flushes its buffer. Defaults to 1 second.
 //
@@ -394,18 +1085,470 @@ func WithAutoFlushInterval(interval time.Duration) LineSenderOption {
 	}
 }
 
-// LineSenderFromEnv creates a LineSender with a config string defined by the QDB_CLIENT_CONF
-// environment variable. See LineSenderFromConf for the config string format.
+// PendingRowsPolicy defines what happens when the limit set with
+// WithMaxPendingRows is reached.
+type PendingRowsPolicy int
+
+const (
+	// PendingRowsPolicyFlush makes the sender flush the buffer
+	// as soon as the limit is reached.
+	PendingRowsPolicyFlush PendingRowsPolicy = iota
+	// PendingRowsPolicyError makes the sender reject messages beyond
+	// the limit with an error until the buffer is flushed.
+	PendingRowsPolicyError
+)
+
+// WithMaxPendingRows limits the number of rows that may be buffered
+// without a flush, regardless of their size in bytes. The policy
+// defines whether the sender flushes the buffer or rejects new rows
+// once the limit is reached.
 //
-// This is a convenience method suitable for Cloud environments.
-func LineSenderFromEnv(ctx context.Context) (LineSender, error) {
-	conf := strings.TrimSpace(os.Getenv("QDB_CLIENT_CONF"))
-	if conf == "" {
-		return nil, errors.New("QDB_CLIENT_CONF environment variable is not set")
+// Unlike WithAutoFlushRows, this option is available for both
+// HTTP and TCP senders. Zero disables the limit.
+func WithMaxPendingRows(rows int, policy PendingRowsPolicy) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.maxPendingRows = rows
+		s.pendingRowsPolicy = policy
 	}
-	c, err := confFromStr(conf)
-	if err != nil {
-		return nil, err
+}
+
+// WithMonotonicTimestamps enables a per-table check that rejects
+// rows whose designated timestamp is older than the latest timestamp
+// sent to the same table by more than the given tolerance. Such
+// rows lead to out-of-order (O3) ingestion on the server side,
+// which is expensive, and usually indicate a client clock bug.
+//
+// Rows finalized with AtNow are not checked, unless
+// WithClientTimestamps is set: such rows get the client time as
+// their designated timestamp. Rows dropped by the sender, e.g.
+// duplicates, are not taken into account.
+func WithMonotonicTimestamps(tolerance time.Duration) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.tsGuard = true
+		s.tsTolerance = tolerance
+		s.tsWarn = nil
+	}
+}
+
+// WithMonotonicTimestampWarnings works in the same way as
+// WithMonotonicTimestamps, but the rows whose designated timestamp
+// goes backwards beyond the tolerance are still sent. The warn
+// function is called with the error wrapping ErrTimestampOutOfOrder
+// for each such row once it's added to the buffer, e.g. to log it.
+func WithMonotonicTimestampWarnings(tolerance time.Duration, warn func(err error)) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.tsGuard = true
+		s.tsTolerance = tolerance
+		s.tsWarn = warn
+	}
+}
+
+// WithSymbolReordering allows Symbol calls after column methods
+// within a message. Such symbols are moved in front of the columns
+// internally, as required by ILP. Useful when the data comes from
+// maps or third-party structs with unpredictable field order.
+//
+// Each reordered symbol costs a pass over the columns of
+// the pending message.
+func WithSymbolReordering() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.reorderSymbols = true
+	}
+}
+
+// ControlCharPolicy defines how control chars, i.e. ASCII chars
+// below 0x20 and DEL, are handled in string and symbol values.
+type ControlCharPolicy int
+
+const (
+	// ControlCharsEscape escapes newlines and carriage returns, so
+	// that they're stored as is, and sends other control chars
+	// unchanged. This is the default.
+	ControlCharsEscape ControlCharPolicy = iota
+	// ControlCharsStrip removes all control chars, including
+	// newlines, carriage returns and tabs, from the values.
+	ControlCharsStrip
+	// ControlCharsReject rejects messages with control chars in
+	// the values with ErrControlChar.
+	ControlCharsReject
+)
+
+// WithControlCharPolicy sets the policy for control chars found in
+// string and symbol values, e.g. in log messages. Table and column
+// names with control chars are always rejected.
+func WithControlCharPolicy(policy ControlCharPolicy) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.ctrlChars = policy
+	}
+}
+
+// ValidationLevel defines how thoroughly the sender validates
+// messages before sending them.
+type ValidationLevel int
+
+const (
+	// ValidationBasic rejects illegal chars in table and column
+	// names. This is the default.
+	ValidationBasic ValidationLevel = iota
+	// ValidationOff skips the per-byte validation and escaping of
+	// table and column names, which are written as is. Only the
+	// name emptiness and length are checked. Meant for trusted
+	// pipelines with known-safe generated names; names with chars
+	// that need escaping, such as spaces, lead to malformed lines.
+	ValidationOff
+	// ValidationServerParity adds the checks done by the server on
+	// top of the basic ones, so that messages the server would
+	// reject fail locally: consecutive '.' chars in table names,
+	// invalid UTF-8 in string and symbol values, and designated
+	// timestamps before 1970-01-01.
+	ValidationServerParity
+)
+
+// WithValidationLevel sets the message validation level.
+// See ValidationLevel for the available levels.
+func WithValidationLevel(level ValidationLevel) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.validation = level
+	}
+}
+
+// StringLengthPolicy defines what happens to string column values
+// exceeding the limit set with WithMaxStringLength.
+type StringLengthPolicy int
+
+const (
+	// StringLengthTruncate truncates the values to the limit and
+	// appends the truncation marker to them.
+	StringLengthTruncate StringLengthPolicy = iota
+	// StringLengthError rejects messages with such values.
+	StringLengthError
+)
+
+// WithMaxStringLength limits the length of string column values
+// in bytes, so that rogue log lines or payload dumps can't balloon
+// the rows. Truncated values are cut at a UTF-8 char boundary and
+// end with the marker set with WithTruncationMarker, "..." by
+// default, so that they fit in the limit along with the marker.
+// The number of truncated values is reported in
+// FlushStats. Zero disables the limit.
+func WithMaxStringLength(n int, policy StringLengthPolicy) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.maxStrLen = n
+		s.strLenPolicy = policy
+	}
+}
+
+// WithTruncationMarker sets the marker appended to string values
+// truncated due to WithMaxStringLength. The marker may be empty.
+func WithTruncationMarker(marker string) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.truncMarker = marker
+		s.truncMarkerSet = true
+	}
+}
+
+// WithFloatPrecision limits float columns to the given number of
+// significant digits, e.g. 1.2345678 is sent as 1.235 with the
+// precision of 4. This saves bytes at the cost of precision.
+//
+// By default, the shortest representation that parses back to the
+// exact same float64 value is used. The precision must be in the
+// [1, 17] range; zero restores the default.
+func WithFloatPrecision(precision int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.floatPrecision = precision
+	}
+}
+
+// WithUint64AsLong256 makes Uint64Column send values as long256
+// instead of long, so that the whole uint64 range can be stored.
+// Without this option, values that don't fit into long are rejected.
+//
+// The option affects all uint64 columns, so that a column never
+// changes its type depending on the value.
+func WithUint64AsLong256() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.uint64AsLong256 = true
+	}
+}
+
+// WithClientTimestamps makes AtNow use the client clock for the
+// designated timestamp of the message. By default, AtNow leaves
+// the timestamp to the server, so it's assigned when the message
+// is received, which may happen much later than the message was
+// built due to buffering and retries.
+//
+// With this option, rows finalized with AtNow are also subject to
+// the WithMonotonicTimestamps check, if enabled.
+func WithClientTimestamps() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.clientTimestamps = true
+	}
+}
+
+// WithCircuitBreaker enables a circuit breaker around flushes. The
+// circuit opens after the configured number of consecutive flush
+// failures. While it's open, flushes are short-circuited with
+// ErrCircuitOpen instead of contacting the server, which prevents
+// retry storms against a server that is down. Once the open timeout
+// passes, a single probe flush is sent: the circuit closes on its
+// success and opens again on failure.
+//
+// Errors reported by the server for a malformed batch do not count
+// as failures.
+func WithCircuitBreaker(conf CircuitBreakerConfig) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.circuitBreaker = &conf
+	}
+}
+
+// WithBackoff sets the backoff strategy for the delays between
+// retries of failed flushes of the HTTP sender and between
+// reconnects done by FlushRetry in the TCP sender. By default,
+// the delay starts with 10 milliseconds and is doubled after each
+// retry up to 1 second, with a small jitter.
+//
+// Use the Delay field to provide a custom strategy, e.g. to align
+// the client behavior with the infrastructure's retry budgets.
+func WithBackoff(b Backoff) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.backoff = b
+	}
+}
+
+// WithDeliveryMode sets the delivery semantics of the sender.
+// Defaults to DeliveryAtLeastOnce, in which case failed HTTP
+// requests are retried, spooled batches are replayed and FlushRetry
+// re-sends the batch over a new TCP connection.
+//
+// With DeliveryAtMostOnce, failed batches are dropped and counted
+// in MetricRowsDropped. HTTP requests are not retried and FlushRetry
+// only reconnects, so that subsequent batches can be sent. The mode
+// fits tables without deduplication where duplicate rows are worse
+// than lost ones. WithMaxRetries and WithSpillToDisk are not
+// available in this mode.
+func WithDeliveryMode(mode DeliveryMode) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.deliveryMode = mode
+	}
+}
+
+// WithDeliveryTimeout bounds the total time a batch may spend in
+// delivery attempts, including retries, reconnects and the backoff
+// between them. Once the timeout passes, the batch is dropped and
+// passed to the dead-letter handler, if any, and the flush returns
+// an error wrapping ErrDeliveryTimeout. This way, hopeless batches
+// don't pin memory. Defaults to 0, which means no timeout.
+//
+// For the TCP sender, the timeout applies to FlushRetry calls.
+func WithDeliveryTimeout(d time.Duration) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.deliveryTimeout = d
+	}
+}
+
+// WithDeadLetterHandler sets the function called with the ILP
+// messages of each batch dropped due to WithDeliveryTimeout and
+// the flush error, e.g. to write them to a dead-letter file. The
+// HTTP sender also calls it with the rows rejected by the server in
+// partially accepted batches, along with a *PartialFlushError, see
+// WithPartialFlush. The
+// slice must not be retained after the call returns.
+func WithDeadLetterHandler(fn func(batch []byte, err error)) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.deadLetter = fn
+	}
+}
+
+// WithPartialFlush makes the HTTP sender trust the per-line errors
+// of a rejected batch, i.e. a response with an "errors" array of
+// {"line","message"} objects, as a report that the server committed
+// the other rows. The accepted rows are then dropped from the buffer
+// and a *PartialFlushError is returned. No QuestDB server release
+// sends this format: /write rejects the whole batch. Only enable it
+// for a server or proxy known to commit the valid rows, since any
+// other one sending such a body would lose them.
+//
+// Only available for the HTTP sender.
+func WithPartialFlush() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.partialFlush = true
+	}
+}
+
+// WithSpillToDisk enables the degraded mode: once the number of
+// consecutive flush failures caused by an unavailable server reaches
+// the given threshold, flushed batches are written to files in the
+// given directory instead of being sent, and Flush succeeds. Once per
+// second, a batch is sent to the server as a probe. When the server
+// recovers, the spooled batches are replayed in the background, so
+// the mode is transparent to the producing code. An interrupted
+// replay is resumed after the next successful flush. Flushes wait
+// for the replay of the current batch to complete.
+//
+// Spooled batches that were not replayed before Close are kept in the
+// directory and replayed by the next sender using it. The directory
+// must not be shared by multiple senders at the same time.
+//
+// Only available for the HTTP sender.
+func WithSpillToDisk(dir string, failureThreshold int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.spoolDir = dir
+		s.spoolThreshold = failureThreshold
+	}
+}
+
+// WithFeatureNegotiation makes the sender query the server's
+// /settings endpoint on construction to learn the max table and
+// column name length, the max number of columns in a row, the max
+// request size, the supported ILP protocol versions and the server
+// version. The limits reported by the server are applied to
+// client-side validation: the name length overrides
+// WithFileNameLimit and the request size lowers the limit set with
+// WithMaxBufferSize. If the server is unreachable or doesn't report
+// the settings, the sender falls back to the configured values.
+// The symbols set with WithGlobalSymbols count towards the columns
+// of each row, while raw ILP lines are not checked.
+//
+// Only available for the HTTP sender.
+func WithFeatureNegotiation() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.negotiate = true
+	}
+}
+
+// WithChunkedUploads makes the sender stream batches of at least
+// threshold bytes with chunked transfer encoding instead of
+// announcing their size with the Content-Length header. Spooled
+// batches are streamed right from the spool files, so they are never
+// loaded into memory as a whole.
+//
+// Only available for the HTTP sender.
+func WithChunkedUploads(threshold int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.chunkedThreshold = threshold
+	}
+}
+
+// WithGlobalSymbols sets symbols that are added to every message
+// written by the sender, e.g. host, region or service name. The
+// symbols go right after the table name, in the order of their names,
+// and must not be added to the messages once again. Raw ILP lines
+// written with AtRaw or RawWriter are sent as is.
+func WithGlobalSymbols(symbols map[string]string) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.globalSymbols = make(map[string]string, len(symbols))
+		for k, v := range symbols {
+			s.globalSymbols[k] = v
+		}
+	}
+}
+
+// WithMetrics makes the sender report flush metrics, such as
+// the number of sent rows and flush durations, into the given hook.
+// See MetricsHook for the list of reported metrics.
+func WithMetrics(hook MetricsHook) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.metrics = hook
+	}
+}
+
+// WithDebugWriter makes the sender copy every flushed payload to
+// the given writer, e.g. os.Stderr or a file, which helps when
+// troubleshooting rows rejected by the server. If maxBytes is
+// positive, longer payloads are truncated to that size. Zero means
+// no truncation.
+//
+// The writer is called on the flush path, so it should be fast.
+func WithDebugWriter(w io.Writer, maxBytes int) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.debugWriter = w
+		s.debugMaxBytes = maxBytes
+	}
+}
+
+// WithWireTrace makes the sender log timestamped connect, TLS
+// handshake, authentication and flush events to the given writer,
+// along with hex dumps of the first 64 bytes of the exchanged
+// payloads. It helps to diagnose handshake and authentication issues
+// without network capture tools. Credentials and signatures are
+// never traced.
+//
+// The writer is called on the connect and flush paths, so it
+// should be fast.
+func WithWireTrace(w io.Writer) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.wireTrace = w
+	}
+}
+
+// WithTee makes the sender duplicate every batch to the given
+// writer right before the batch is sent to the server, e.g. to keep
+// a write-ahead audit trail in a file. Each Write call receives
+// a whole batch of newline-terminated ILP lines.
+//
+// Since the batches are written before they are sent, the trail also
+// holds the batches that failed or were rejected by the server, and
+// a batch sent once again, e.g. after Restore or by FlushRetry, is
+// written once again. Batches spilled with WithSpillToDisk are
+// written once, and not when they are replayed.
+//
+// For dual writes to a second QuestDB instance, pass the RawWriter
+// of another sender. Since lines written there are buffered, that
+// sender has to be flushed by the caller or via its auto-flush.
+//
+// If the tee write fails, the flush fails with the tee error and
+// the batch is not sent to the server.
+func WithTee(w io.Writer) LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.tee = w
+	}
+}
+
+// WithDryRun makes the sender encode and validate ILP messages
+// without ever opening a connection. Instead, flushed messages
+// are kept in memory and can be read via the DryRunSender
+// interface implemented by the sender. Useful for validating
+// ingestion code in CI and for generating fixture files.
+//
+// All HTTP or TCP sender settings are validated as usual, but
+// auto-flushing is disabled: messages are only moved to the
+// output on explicit Flush and Close calls.
+func WithDryRun() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.dryRun = true
+	}
+}
+
+// WithStrictMode makes the sender detect API misuse and panic with
+// a *MisuseError holding the stack trace of the offending call,
+// instead of deferring errors to At calls or silently corrupting
+// the buffer. Detected misuse includes Table calls before the pending
+// message is finished, Symbol calls after a column, column and At
+// calls without Table, and concurrent calls from multiple goroutines.
+//
+// The concurrency check only detects overlapping calls, so it
+// complements, but does not replace the Go race detector. Strict mode
+// adds a small overhead to each call, so it is mostly meant for
+// development and testing.
+func WithStrictMode() LineSenderOption {
+	return func(s *lineSenderConfig) {
+		s.strict = true
+	}
+}
+
+// LineSenderFromEnv creates a LineSender with a config string defined by the QDB_CLIENT_CONF
+// environment variable. See LineSenderFromConf for the config string format.
+//
+// This is a convenience method suitable for Cloud environments.
+func LineSenderFromEnv(ctx context.Context) (LineSender, error) {
+	conf := strings.TrimSpace(os.Getenv("QDB_CLIENT_CONF"))
+	if conf == "" {
+		return nil, errors.New("QDB_CLIENT_CONF environment variable is not set")
+	}
+	c, err := confFromStr(conf)
+	if err != nil {
+		return nil, err
 	}
 	return newLineSender(ctx, c)
 }
@@ -429,6 +1572,7 @@ func LineSenderFromEnv(ctx context.Context) (LineSender, error) {
 // -------------------
 // addr:           hostname/port of QuestDB endpoint
 // init_buf_size:  initial growable ILP buffer size in bytes (defaults to 128KiB)
+// max_name_len:   max table and column name length in chars (defaults to 127)
 // tls_verify:     determines if TLS certificates should be validated (defaults to "on", can be set to "unsafe_off")
 //
 // http(s)-only
@@ -441,7 +1585,9 @@ func LineSenderFromEnv(ctx context.Context) (LineSender, error) {
 // request_min_throughput: bytes per second, used to calculate each request's timeout (defaults to 100KiB/s)
 // request_timeout:        minimum request timeout in milliseconds (defaults to 10 seconds)
 // retry_timeout:          cumulative maximum millisecond duration spent in retries (defaults to 10 seconds)
+// max_retries:            maximum number of retries of a failed flush (defaults to 0, i.e. limited by retry_timeout only)
 // max_buf_size:           buffer growth limit in bytes. Client errors if breached (default is 100MiB)
+// auto_flush_bytes:       auto-flushing is triggered above this buffer size in bytes (unset by default)
 //
 // tcp(s)-only
 // -----------
@@ -466,22 +1612,171 @@ func NewLineSender(ctx context.Context, opts ...LineSenderOption) (LineSender, e
 	return newLineSender(ctx, conf)
 }
 
+// NewLineSenderFromConn creates a TCP sender that uses the given
+// connection instead of dialing one, e.g. a connection with a custom
+// TLS handshake, a tunneled connection or an in-memory pipe in tests.
+// The sender takes ownership of the connection and closes it on Close,
+// or right away if the sender can't be created.
+//
+// WithTcp is implied. Since the sender can't establish a new
+// connection, TLS and idle timeout options are not available, and
+// FlushRetry fails instead of reconnecting. If WithAuth is provided,
+// the authentication handshake is done over the given connection.
+func NewLineSenderFromConn(ctx context.Context, conn net.Conn, opts ...LineSenderOption) (LineSender, error) {
+	if conn == nil {
+		return nil, errors.New("connection is nil")
+	}
+	s, err := newLineSenderFromConn(ctx, conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func newLineSenderFromConn(ctx context.Context, conn net.Conn, opts []LineSenderOption) (LineSender, error) {
+	conf := &lineSenderConfig{senderType: tcpSenderType}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	if conf.senderType != tcpSenderType {
+		return nil, errors.New("only the TCP sender can use an existing connection")
+	}
+	if conf.dryRun {
+		return nil, errors.New("dry run is not available with an existing connection")
+	}
+	if conf.tlsMode != tlsDisabled {
+		return nil, errors.New("TLS is not available with an existing connection: do the TLS handshake on the connection instead")
+	}
+	if conf.tcpIdleTimeout > 0 {
+		return nil, errors.New("idleTimeout setting is not available with an existing connection")
+	}
+	conf.conn = conn
+	return newLineSender(ctx, conf)
+}
+
 func newLineSender(ctx context.Context, conf *lineSenderConfig) (LineSender, error) {
+	s, err := newLineSender0(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	if conf.strict {
+		return newStrictLineSender(s), nil
+	}
+	return s, nil
+}
+
+func newLineSender0(ctx context.Context, conf *lineSenderConfig) (LineSender, error) {
+	err := sanitizeConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	if conf.dryRun {
+		return newDryRunLineSender(conf)
+	}
+	if conf.senderType == tcpSenderType {
+		return newTcpLineSender(ctx, conf)
+	}
+	return newHttpLineSender(ctx, conf)
+}
+
+// cloudDomainSuffix is the domain of QuestDB Cloud instances.
+// Connections to such instances use TLS.
+const cloudDomainSuffix = ".questdb.net"
+
+// applyAddressScheme strips the scheme prefix from the address,
+// if any, and sets the sender type, TLS mode and default port
+// corresponding to the scheme. If no scheme is provided and the
+// address points to QuestDB Cloud, TLS is enabled.
+func applyAddressScheme(conf *lineSenderConfig) error {
+	i := strings.Index(conf.address, "://")
+	if i < 0 {
+		if !conf.explicitScheme && conf.tlsMode == tlsDisabled && isCloudAddress(conf.address) {
+			conf.tlsMode = tlsEnabled
+		}
+		return nil
+	}
+	scheme, addr := conf.address[:i], strings.TrimSuffix(conf.address[i+3:], "/")
+	if addr == "" || strings.Contains(addr, "/") {
+		return fmt.Errorf("invalid address: %s", conf.address)
+	}
+
+	var schemeConf lineSenderConfig
+	if err := setSchema(&schemeConf, scheme); err != nil {
+		return fmt.Errorf("invalid address scheme: %s", scheme)
+	}
+	if conf.senderType != noSenderType && conf.senderType != schemeConf.senderType {
+		return fmt.Errorf("address scheme %s conflicts with the configured sender type", scheme)
+	}
+	if conf.tlsMode != tlsDisabled && schemeConf.tlsMode == tlsDisabled {
+		return fmt.Errorf("address scheme %s conflicts with the configured TLS mode", scheme)
+	}
+	conf.senderType = schemeConf.senderType
+	conf.explicitScheme = true
+	if conf.tlsMode == tlsDisabled {
+		conf.tlsMode = schemeConf.tlsMode
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		port := "9000"
+		if conf.senderType == tcpSenderType {
+			port = "9009"
+		}
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), port)
+	}
+	conf.address = addr
+	return nil
+}
+
+// normalizeIpv6Address adds the default port to bare and bracketed
+// IPv6 literals, e.g. "::1" becomes "[::1]:9009". Other addresses
+// are returned as is.
+func normalizeIpv6Address(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	ip := host
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		// Strip the zone, e.g. "fe80::1%eth0".
+		ip = host[:i]
+	}
+	if !strings.Contains(ip, ":") || net.ParseIP(ip) == nil {
+		return addr
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// isCloudAddress reports whether the "host[:port]" address
+// belongs to the QuestDB Cloud domain.
+func isCloudAddress(addr string) bool {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	return strings.HasSuffix(strings.ToLower(host), cloudDomainSuffix)
+}
+
+// sanitizeConf validates the config and sets the defaults
+// for the configured sender type.
+func sanitizeConf(conf *lineSenderConfig) error {
+	err := applyAddressScheme(conf)
+	if err != nil {
+		return err
+	}
 	switch conf.senderType {
 	case tcpSenderType:
-		err := sanitizeTcpConf(conf)
-		if err != nil {
-			return nil, err
-		}
-		return newTcpLineSender(ctx, conf)
+		err = sanitizeTcpConf(conf)
 	case httpSenderType:
-		err := sanitizeHttpConf(conf)
-		if err != nil {
-			return nil, err
-		}
-		return newHttpLineSender(conf)
+		err = sanitizeHttpConf(conf)
+	default:
+		return errors.New("sender type is not specified: use WithHttp or WithTcp")
+	}
+	if err != nil {
+		return err
 	}
-	return nil, errors.New("sender type is not specified: use WithHttp or WithTcp")
+	_, err = encodeGlobalSymbols(conf.globalSymbols, conf.fileNameLimit)
+	return err
 }
 
 func sanitizeTcpConf(conf *lineSenderConfig) error {
@@ -497,6 +1792,9 @@ func sanitizeTcpConf(conf *lineSenderConfig) error {
 	if conf.retryTimeout != 0 {
 		return errors.New("retryTimeout setting is not available in the TCP client")
 	}
+	if conf.maxRetries != 0 {
+		return errors.New("maxRetries setting is not available in the TCP client")
+	}
 	if conf.minThroughput != 0 {
 		return errors.New("minThroughput setting is not available in the TCP client")
 	}
@@ -506,9 +1804,39 @@ func sanitizeTcpConf(conf *lineSenderConfig) error {
 	if conf.autoFlushInterval != 0 {
 		return errors.New("autoFlushInterval setting is not available in the TCP client")
 	}
+	if conf.autoFlushDisabled {
+		return errors.New("autoFlushDisabled setting is not available in the TCP client")
+	}
+	if conf.partialFlush {
+		return errors.New("partialFlush setting is not available in the TCP client")
+	}
+	if conf.spoolDir != "" {
+		return errors.New("spill to disk is not available in the TCP client")
+	}
+	if conf.chunkedThreshold != 0 {
+		return errors.New("chunked uploads are not available in the TCP client")
+	}
+	if conf.negotiate {
+		return errors.New("feature negotiation is not available in the TCP client")
+	}
 	if conf.maxBufSize != 0 {
 		return errors.New("maxBufferSize setting is not available in the TCP client")
 	}
+	if conf.httpUser != "" || conf.httpPass != "" || conf.httpToken != "" {
+		return errors.New("basic and token authentication is not available in the TCP client: use WithAuth instead")
+	}
+	if conf.httpTransport != nil {
+		return errors.New("httpTransport setting is not available in the TCP client")
+	}
+	if conf.http2 {
+		return errors.New("HTTP/2 is not available in the TCP client")
+	}
+	if conf.httpMaxIdleConns != 0 || conf.httpMaxConnsPerHost != 0 || conf.httpIdleConnTimeout != 0 {
+		return errors.New("HTTP connection pool settings are not available in the TCP client")
+	}
+	if conf.httpKeepAlivePing != 0 {
+		return errors.New("keep-alive ping setting is not available in the TCP client")
+	}
 	if conf.tcpKey == "" && conf.tcpKeyId != "" {
 		return errors.New("tcpKey is empty and tcpKeyId is not. both (or none) must be provided")
 	}
@@ -520,6 +1848,7 @@ func sanitizeTcpConf(conf *lineSenderConfig) error {
 	if conf.address == "" {
 		conf.address = defaultTcpAddress
 	}
+	conf.address = normalizeIpv6Address(conf.address, "9009")
 	if conf.initBufSize == 0 {
 		conf.initBufSize = defaultInitBufferSize
 	}
@@ -540,11 +1869,24 @@ func sanitizeHttpConf(conf *lineSenderConfig) error {
 	if (conf.httpUser != "" || conf.httpPass != "") && conf.httpToken != "" {
 		return errors.New("both basic and token authentication cannot be used")
 	}
+	if conf.tcpKeyId != "" || conf.tcpKey != "" {
+		return errors.New("tcpKeyId and tcpKey settings are not available in the HTTP client: use WithBasicAuth or WithBearerToken instead")
+	}
+	if conf.tcpIdleTimeout != 0 {
+		return errors.New("idleTimeout setting is not available in the HTTP client: use WithHttpIdleConnTimeout instead")
+	}
+	if conf.bufferSwap {
+		return errors.New("buffer swap setting is not available in the HTTP client")
+	}
+	if conf.disconnectDetector {
+		return errors.New("disconnect detection is not available in the HTTP client")
+	}
 
 	// Set defaults
 	if conf.address == "" {
 		conf.address = defaultHttpAddress
 	}
+	conf.address = normalizeIpv6Address(conf.address, "9000")
 	if conf.requestTimeout == 0 {
 		conf.requestTimeout = defaultRequestTimeout
 	}
@@ -554,11 +1896,17 @@ func sanitizeHttpConf(conf *lineSenderConfig) error {
 	if conf.minThroughput == 0 {
 		conf.minThroughput = defaultMinThroughput
 	}
-	if conf.autoFlushRows == 0 {
-		conf.autoFlushRows = defaultAutoFlushRows
-	}
-	if conf.autoFlushInterval == 0 {
-		conf.autoFlushInterval = defaultAutoFlushInterval
+	if conf.autoFlushDisabled {
+		conf.autoFlushRows = 0
+		conf.autoFlushInterval = 0
+		conf.autoFlushBytes = 0
+	} else {
+		if conf.autoFlushRows == 0 {
+			conf.autoFlushRows = defaultAutoFlushRows
+		}
+		if conf.autoFlushInterval == 0 {
+			conf.autoFlushInterval = defaultAutoFlushInterval
+		}
 	}
 	if conf.initBufSize == 0 {
 		conf.initBufSize = defaultInitBufferSize
@@ -574,12 +1922,19 @@ func sanitizeHttpConf(conf *lineSenderConfig) error {
 }
 
 func validateConf(conf *lineSenderConfig) error {
+	if conf.senderTypeConflict {
+		return errors.New("both WithHttp and WithTcp options are provided")
+	}
+
 	if conf.initBufSize < 0 {
 		return fmt.Errorf("initial buffer size is negative: %d", conf.initBufSize)
 	}
 	if conf.maxBufSize < 0 {
 		return fmt.Errorf("max buffer size is negative: %d", conf.maxBufSize)
 	}
+	if conf.maxBufSize > 0 && conf.initBufSize > conf.maxBufSize {
+		return fmt.Errorf("initial buffer size is greater than max buffer size: %d > %d", conf.initBufSize, conf.maxBufSize)
+	}
 
 	if conf.fileNameLimit < 0 {
 		return fmt.Errorf("file name limit is negative: %d", conf.fileNameLimit)
@@ -588,6 +1943,9 @@ func validateConf(conf *lineSenderConfig) error {
 	if conf.retryTimeout < 0 {
 		return fmt.Errorf("retry timeout is negative: %d", conf.retryTimeout)
 	}
+	if conf.maxRetries < 0 {
+		return fmt.Errorf("max retries is negative: %d", conf.maxRetries)
+	}
 	if conf.requestTimeout < 0 {
 		return fmt.Errorf("request timeout is negative: %d", conf.requestTimeout)
 	}
@@ -595,6 +1953,18 @@ func validateConf(conf *lineSenderConfig) error {
 		return fmt.Errorf("min throughput is negative: %d", conf.minThroughput)
 	}
 
+	if conf.memoryLimit < 0 {
+		return fmt.Errorf("memory limit is negative: %d", conf.memoryLimit)
+	}
+	if conf.memoryOverflow != OverflowBlock && conf.memoryOverflow != OverflowReject {
+		return fmt.Errorf("unknown memory overflow policy: %d", conf.memoryOverflow)
+	}
+	if conf.oversizedRowSize < 0 {
+		return fmt.Errorf("oversized row size is negative: %d", conf.oversizedRowSize)
+	}
+	if conf.autoFlushBytes < 0 {
+		return fmt.Errorf("auto flush bytes is negative: %d", conf.autoFlushBytes)
+	}
 	if conf.autoFlushRows < 0 {
 		return fmt.Errorf("auto flush rows is negative: %d", conf.autoFlushRows)
 	}
@@ -602,5 +1972,98 @@ func validateConf(conf *lineSenderConfig) error {
 		return fmt.Errorf("auto flush interval is negative: %d", conf.autoFlushInterval)
 	}
 
+	if conf.maxPendingRows < 0 {
+		return fmt.Errorf("max pending rows is negative: %d", conf.maxPendingRows)
+	}
+	if conf.debugMaxBytes < 0 {
+		return fmt.Errorf("debug writer max bytes is negative: %d", conf.debugMaxBytes)
+	}
+	if conf.pendingRowsPolicy != PendingRowsPolicyFlush && conf.pendingRowsPolicy != PendingRowsPolicyError {
+		return fmt.Errorf("unknown pending rows policy: %d", conf.pendingRowsPolicy)
+	}
+	if conf.anyRules.Bytes < BytesAsString || conf.anyRules.Bytes > BytesAsHex {
+		return fmt.Errorf("unknown bytes encoding: %d", conf.anyRules.Bytes)
+	}
+	if conf.strictSchema && conf.schemas == nil {
+		return errors.New("strict schema mode requires a schema registry")
+	}
+	if sh := conf.shedder; sh != nil {
+		if sh.strategy < SheddingDropNewest || sh.strategy > SheddingSample {
+			return fmt.Errorf("unknown shedding strategy: %d", sh.strategy)
+		}
+		if conf.maxPendingRows == 0 {
+			return errors.New("shedding requires max pending rows to be set")
+		}
+	}
+	if conf.ctrlChars < ControlCharsEscape || conf.ctrlChars > ControlCharsReject {
+		return fmt.Errorf("unknown control char policy: %d", conf.ctrlChars)
+	}
+	if conf.validation < ValidationBasic || conf.validation > ValidationServerParity {
+		return fmt.Errorf("unknown validation level: %d", conf.validation)
+	}
+	if conf.maxStrLen < 0 {
+		return fmt.Errorf("max string length is negative: %d", conf.maxStrLen)
+	}
+	if conf.strLenPolicy != StringLengthTruncate && conf.strLenPolicy != StringLengthError {
+		return fmt.Errorf("unknown string length policy: %d", conf.strLenPolicy)
+	}
+
+	if conf.tsTolerance < 0 {
+		return fmt.Errorf("monotonic timestamp tolerance is negative: %d", conf.tsTolerance)
+	}
+	if conf.tcpIdleTimeout < 0 {
+		return fmt.Errorf("idle timeout is negative: %d", conf.tcpIdleTimeout)
+	}
+
+	if conf.floatPrecision < 0 || conf.floatPrecision > 17 {
+		return fmt.Errorf("float precision is out of [1, 17] range: %d", conf.floatPrecision)
+	}
+
+	if conf.spoolDir != "" && conf.spoolThreshold <= 0 {
+		return fmt.Errorf("spill to disk failure threshold is not positive: %d", conf.spoolThreshold)
+	}
+	if conf.httpMaxIdleConns < 0 {
+		return fmt.Errorf("max idle connections is negative: %d", conf.httpMaxIdleConns)
+	}
+	if conf.httpMaxConnsPerHost < 0 {
+		return fmt.Errorf("max connections per host is negative: %d", conf.httpMaxConnsPerHost)
+	}
+	if conf.httpIdleConnTimeout < 0 {
+		return fmt.Errorf("idle connection timeout is negative: %d", conf.httpIdleConnTimeout)
+	}
+	if conf.httpKeepAlivePing < 0 {
+		return fmt.Errorf("keep-alive ping interval is negative: %d", conf.httpKeepAlivePing)
+	}
+	if conf.chunkedThreshold < 0 {
+		return fmt.Errorf("chunked upload threshold is negative: %d", conf.chunkedThreshold)
+	}
+	switch conf.deliveryMode {
+	case DeliveryAtLeastOnce:
+	case DeliveryAtMostOnce:
+		if conf.maxRetries != 0 {
+			return errors.New("maxRetries setting is not available in the at-most-once delivery mode")
+		}
+		if conf.spoolDir != "" {
+			return errors.New("spill to disk is not available in the at-most-once delivery mode")
+		}
+	default:
+		return fmt.Errorf("unknown delivery mode: %d", conf.deliveryMode)
+	}
+	if err := validateBackoff(conf.backoff); err != nil {
+		return err
+	}
+	if conf.deliveryTimeout < 0 {
+		return fmt.Errorf("delivery timeout is negative: %d", conf.deliveryTimeout)
+	}
+
+	if cb := conf.circuitBreaker; cb != nil {
+		if cb.FailureThreshold <= 0 {
+			return fmt.Errorf("circuit breaker failure threshold is not positive: %d", cb.FailureThreshold)
+		}
+		if cb.OpenTimeout < 0 {
+			return fmt.Errorf("circuit breaker open timeout is negative: %d", cb.OpenTimeout)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,168 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SenderConfig is a struct-based alternative to LineSenderOption
+// functions. Unlike options, a config struct can be loaded from
+// YAML or JSON files, compared in tests and passed across package
+// boundaries.
+//
+// The fields follow the config string format described in
+// LineSenderFromConf. Zero values stand for the defaults. Durations
+// are decoded from JSON as nanoseconds.
+//
+// Example usage:
+//
+//	conf := qdb.SenderConfig{
+//		Schema:         "http",
+//		Address:        "localhost:9000",
+//		RequestTimeout: 5 * time.Second,
+//	}
+//	sender, err := conf.Build(ctx)
+type SenderConfig struct {
+	// Schema is one of "http", "https", "tcp" or "tcps".
+	Schema  string `json:"schema" yaml:"schema"`
+	Address string `json:"addr,omitempty" yaml:"addr,omitempty"`
+
+	// Username and Token are the key id and the private key for
+	// the TCP sender, or the basic auth user and the bearer token
+	// for the HTTP sender. Password is only available for HTTP.
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"`
+
+	// TlsInsecureSkipVerify disables server certificate validation.
+	// Should only be used for testing purposes.
+	TlsInsecureSkipVerify bool `json:"tls_insecure_skip_verify,omitempty" yaml:"tls_insecure_skip_verify,omitempty"`
+
+	AutoFlushDisabled bool          `json:"auto_flush_disabled,omitempty" yaml:"auto_flush_disabled,omitempty"`
+	AutoFlushRows     int           `json:"auto_flush_rows,omitempty" yaml:"auto_flush_rows,omitempty"`
+	AutoFlushInterval time.Duration `json:"auto_flush_interval,omitempty" yaml:"auto_flush_interval,omitempty"`
+	AutoFlushBytes    int           `json:"auto_flush_bytes,omitempty" yaml:"auto_flush_bytes,omitempty"`
+
+	InitBufferSize int `json:"init_buf_size,omitempty" yaml:"init_buf_size,omitempty"`
+	MaxBufferSize  int `json:"max_buf_size,omitempty" yaml:"max_buf_size,omitempty"`
+
+	// MaxNameLength is the max table and column name length,
+	// see WithFileNameLimit.
+	MaxNameLength int `json:"max_name_len,omitempty" yaml:"max_name_len,omitempty"`
+
+	MinThroughput  int           `json:"min_throughput,omitempty" yaml:"min_throughput,omitempty"`
+	RequestTimeout time.Duration `json:"request_timeout,omitempty" yaml:"request_timeout,omitempty"`
+	RetryTimeout   time.Duration `json:"retry_timeout,omitempty" yaml:"retry_timeout,omitempty"`
+	MaxRetries     int           `json:"max_retries,omitempty" yaml:"max_retries,omitempty"`
+}
+
+// Validate checks the config without creating a sender. It returns
+// the same errors that Build would return for an invalid config.
+func (c *SenderConfig) Validate() error {
+	conf, err := c.toConf()
+	if err != nil {
+		return err
+	}
+	return sanitizeConf(conf)
+}
+
+// Build creates a new LineSender with the config. Additional options,
+// e.g. the ones that have no corresponding fields, are applied on
+// top of the config.
+func (c *SenderConfig) Build(ctx context.Context, opts ...LineSenderOption) (LineSender, error) {
+	conf, err := c.toConf()
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	return newLineSender(ctx, conf)
+}
+
+// ConfigSnapshot is an immutable copy of the complete configuration
+// of a sender, as returned by LineSender.Config.
+type ConfigSnapshot struct {
+	conf lineSenderConfig
+}
+
+// NewLineSenderFromConfig creates a new LineSender with the same
+// configuration as the one of the snapshot. Additional options are
+// applied on top of the snapshot, e.g. to give each sender its own
+// spill to disk directory, since senders must not share it.
+func NewLineSenderFromConfig(ctx context.Context, cfg ConfigSnapshot, opts ...LineSenderOption) (LineSender, error) {
+	conf := cfg.conf
+	if conf.senderType == noSenderType {
+		return nil, errors.New("config snapshot is empty: use LineSender.Config to obtain one")
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	return newLineSender(ctx, &conf)
+}
+
+func (c *SenderConfig) toConf() (*lineSenderConfig, error) {
+	conf := &lineSenderConfig{}
+	err := setSchema(conf, c.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	conf.address = c.Address
+	switch conf.senderType {
+	case httpSenderType:
+		conf.httpUser = c.Username
+		conf.httpPass = c.Password
+		conf.httpToken = c.Token
+	case tcpSenderType:
+		if c.Password != "" {
+			return nil, errors.New("password is only supported for HTTP sender")
+		}
+		conf.tcpKeyId = c.Username
+		conf.tcpKey = c.Token
+	}
+	if c.TlsInsecureSkipVerify {
+		if conf.tlsMode == tlsDisabled {
+			return nil, errors.New("TLS certificate verification can only be disabled for https and tcps schemas")
+		}
+		conf.tlsMode = tlsInsecureSkipVerify
+	}
+
+	conf.autoFlushRows = c.AutoFlushRows
+	conf.autoFlushInterval = c.AutoFlushInterval
+	conf.autoFlushBytes = c.AutoFlushBytes
+	conf.autoFlushDisabled = c.AutoFlushDisabled
+	conf.initBufSize = c.InitBufferSize
+	conf.maxBufSize = c.MaxBufferSize
+	conf.fileNameLimit = c.MaxNameLength
+	conf.minThroughput = c.MinThroughput
+	conf.requestTimeout = c.RequestTimeout
+	conf.retryTimeout = c.RetryTimeout
+	conf.maxRetries = c.MaxRetries
+	return conf, nil
+}
@@ -0,0 +1,210 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrUnsupportedByServer is returned when a feature is not supported
+// by the server the sender talks to.
+var ErrUnsupportedByServer = errors.New("feature is not supported by the server")
+
+// ServerInfo describes the server the sender is connected to.
+type ServerInfo struct {
+	// Version is the server release version, e.g. "8.1.0". Empty
+	// if the server doesn't report it.
+	Version string
+	// ProtocolVersions lists the supported ILP protocol versions.
+	// Older servers don't report it, in which case only version 1
+	// is supported.
+	ProtocolVersions []int
+	// MaxNameLength is the max length of table and column names.
+	MaxNameLength int
+	// MaxColumns is the max number of symbols and columns in
+	// a row; 0 if not reported.
+	MaxColumns int
+	// MaxRequestSize is the max size of an ILP/HTTP request body;
+	// 0 if not reported.
+	MaxRequestSize int
+	// Arrays is set if the server accepts n-dimensional array
+	// columns.
+	Arrays bool
+	// BinaryDoubles is set if the server accepts binary encoded
+	// double values.
+	BinaryDoubles bool
+}
+
+// Require returns an error wrapping ErrUnsupportedByServer if the
+// server doesn't support the given ILP protocol version.
+func (si ServerInfo) Require(protocolVersion int) error {
+	for _, v := range si.ProtocolVersions {
+		if v == protocolVersion {
+			return nil
+		}
+	}
+	if protocolVersion == 1 && len(si.ProtocolVersions) == 0 {
+		return nil
+	}
+	return fmt.Errorf("ILP protocol version %d: %w", protocolVersion, ErrUnsupportedByServer)
+}
+
+// serverSettings holds the server features learned from
+// the /settings endpoint.
+type serverSettings struct {
+	// version is the server release version, e.g. "8.1.0".
+	version string
+	// protocolVersions lists the supported ILP protocol versions.
+	// Older servers don't report it, in which case it's nil.
+	protocolVersions []int
+	// maxFileNameLength is the max length of table and column
+	// names; 0 if not reported.
+	maxFileNameLength int
+	// maxColumns is the max number of symbols and columns in
+	// a row; 0 if not reported.
+	maxColumns int
+	// maxRecvBufSize is the max size of an ILP/HTTP request body;
+	// 0 if not reported.
+	maxRecvBufSize int
+}
+
+// apply parameterizes the buffer validation with the server limits.
+// The buffer limit is lowered to the server request size limit, but
+// never below the initial buffer size.
+func (ss *serverSettings) apply(b *buffer, initBufSize int) {
+	if ss.maxFileNameLength > 0 {
+		b.fileNameLimit = ss.maxFileNameLength
+	}
+	if ss.maxColumns > 0 {
+		b.maxColumns = ss.maxColumns
+	}
+	if limit := ss.maxRecvBufSize; limit > 0 {
+		if limit < initBufSize {
+			limit = initBufSize
+		}
+		if b.maxBufSize == 0 || limit < b.maxBufSize {
+			b.maxBufSize = limit
+		}
+	}
+}
+
+func (ss *serverSettings) info(fileNameLimit int) ServerInfo {
+	si := ServerInfo{
+		Version:          ss.version,
+		ProtocolVersions: ss.protocolVersions,
+		MaxNameLength:    ss.maxFileNameLength,
+		MaxColumns:       ss.maxColumns,
+		MaxRequestSize:   ss.maxRecvBufSize,
+	}
+	if si.MaxNameLength == 0 {
+		si.MaxNameLength = fileNameLimit
+	}
+	// Arrays and binary doubles came with ILP protocol version 2.
+	for _, v := range ss.protocolVersions {
+		if v >= 2 {
+			si.Arrays = true
+			si.BinaryDoubles = true
+		}
+	}
+	return si
+}
+
+// fetchServerSettings queries the /settings endpoint of the server.
+func fetchServerSettings(ctx context.Context, client *http.Client, conf *lineSenderConfig) (*serverSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, conf.requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, httpBaseUri(conf)+"/settings", nil)
+	if err != nil {
+		return nil, err
+	}
+	setAuthHeader(req, conf.httpUser, conf.httpPass, conf.httpToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%d: %s -- %s", resp.StatusCode, resp.Status, body)
+	}
+	return parseServerSettings(body)
+}
+
+func parseServerSettings(body []byte) (*serverSettings, error) {
+	// Newer servers nest the settings in the "config" object,
+	// while older ones return a flat object.
+	var (
+		raw struct {
+			Config map[string]json.RawMessage `json:"config"`
+		}
+		settings = map[string]json.RawMessage{}
+	)
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode server settings: %w", err)
+	}
+	if raw.Config != nil {
+		settings = raw.Config
+	} else if err := json.Unmarshal(body, &settings); err != nil {
+		return nil, fmt.Errorf("failed to decode server settings: %w", err)
+	}
+
+	ss := &serverSettings{}
+	if v, ok := settings["release.version"]; ok {
+		if err := json.Unmarshal(v, &ss.version); err != nil {
+			return nil, fmt.Errorf("invalid release.version setting: %w", err)
+		}
+	}
+	if v, ok := settings["line.proto.support.versions"]; ok {
+		if err := json.Unmarshal(v, &ss.protocolVersions); err != nil {
+			return nil, fmt.Errorf("invalid line.proto.support.versions setting: %w", err)
+		}
+	}
+	if v, ok := settings["cairo.max.file.name.length"]; ok {
+		if err := json.Unmarshal(v, &ss.maxFileNameLength); err != nil {
+			return nil, fmt.Errorf("invalid cairo.max.file.name.length setting: %w", err)
+		}
+	}
+	if v, ok := settings["line.max.columns"]; ok {
+		if err := json.Unmarshal(v, &ss.maxColumns); err != nil {
+			return nil, fmt.Errorf("invalid line.max.columns setting: %w", err)
+		}
+	}
+	if v, ok := settings["line.http.max.recv.buffer.size"]; ok {
+		if err := json.Unmarshal(v, &ss.maxRecvBufSize); err != nil {
+			return nil, fmt.Errorf("invalid line.http.max.recv.buffer.size setting: %w", err)
+		}
+	}
+	return ss, nil
+}
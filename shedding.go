@@ -0,0 +1,179 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+// SheddingStrategy defines which rows a Shedder drops once the limit
+// set with WithMaxPendingRows is reached.
+type SheddingStrategy int
+
+const (
+	// SheddingDropNewest drops the new rows until the buffer is
+	// flushed.
+	SheddingDropNewest SheddingStrategy = iota
+	// SheddingDropOldest drops the oldest buffered row to make room
+	// for each new one.
+	SheddingDropOldest
+	// SheddingSample keeps a new row with the sample rate of its
+	// table, dropping the oldest buffered row to make room. Rows that
+	// are not sampled are dropped. Tables without a sample rate are
+	// always kept.
+	SheddingSample
+)
+
+// Shedder sheds the load of senders whose buffers are full, e.g.
+// when the server is slow to accept the flushed rows. It's meant for
+// telemetry use cases where freshness beats completeness. The
+// dropped rows are counted per table.
+//
+// A Shedder may be shared by multiple senders, see WithShedder.
+type Shedder struct {
+	strategy SheddingStrategy
+
+	mu      sync.Mutex
+	rates   map[string]float64
+	dropped map[string]int64
+}
+
+// NewShedder creates a Shedder with the given strategy.
+func NewShedder(strategy SheddingStrategy) *Shedder {
+	return &Shedder{
+		strategy: strategy,
+		rates:    make(map[string]float64),
+		dropped:  make(map[string]int64),
+	}
+}
+
+// SetSampleRate sets the probability, from 0 to 1, of keeping a new
+// row of the table in the SheddingSample strategy.
+func (s *Shedder) SetSampleRate(table string, rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rates[table] = rate
+}
+
+// DroppedRows returns the number of dropped rows per table.
+func (s *Shedder) DroppedRows() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := make(map[string]int64, len(s.dropped))
+	for table, n := range s.dropped {
+		dropped[table] = n
+	}
+	return dropped
+}
+
+// admit reports whether a new row of the table should be buffered
+// in place of the oldest one.
+func (s *Shedder) admit(table string) bool {
+	switch s.strategy {
+	case SheddingDropOldest:
+		return true
+	case SheddingSample:
+		s.mu.Lock()
+		rate, ok := s.rates[table]
+		s.mu.Unlock()
+		return !ok || rand.Float64() < rate
+	default:
+		return false
+	}
+}
+
+func (s *Shedder) drop(table string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped[table]++
+}
+
+// shed applies the shedding strategy to the pending message if the
+// buffer is full. It returns false if the pending message should be
+// dropped.
+func (b *buffer) shed() bool {
+	if b.shedder == nil || b.maxPendingRows == 0 || b.msgCount() < b.maxPendingRows {
+		return true
+	}
+	if !b.shedder.admit(b.tableName) {
+		b.shedder.drop(b.tableName)
+		return false
+	}
+	b.shedder.drop(b.dropOldestMsg())
+	return true
+}
+
+// flushPendingRows flushes the buffer once the max pending rows limit
+// is reached. With a shedder, the rows of a failed flush are kept if
+// keep is true, and the new rows are shed until the next flush. Rows
+// rejected by the server or handed over to a dead letter or reject
+// handler are not kept.
+func (b *buffer) flushPendingRows(ctx context.Context, flush func(context.Context) error, keep bool) error {
+	if b.shedder == nil {
+		return flush(ctx)
+	}
+	cp := b.checkpoint()
+	err := flush(ctx)
+	var httpErr *HttpError
+	if err == nil || !keep || errors.As(err, &httpErr) ||
+		errors.Is(err, ErrDeliveryTimeout) || errors.Is(err, ErrCircuitOpen) {
+		return err
+	}
+	if b.restore(cp) == nil {
+		b.shedding = true
+	}
+	return err
+}
+
+// dropOldestMsg removes the first completed message from the buffer
+// and returns its table name. Checkpoints taken before the call are
+// no longer valid.
+func (b *buffer) dropOldestMsg() string {
+	table := msgTableName(b.Bytes()[:b.msgStart(1)])
+	b.dropFirstMsgs(1)
+	return table
+}
+
+// msgTableName returns the unescaped table name of an ILP message.
+func msgTableName(msg []byte) string {
+	name := make([]byte, 0, 32)
+	for i := 0; i < len(msg); i++ {
+		switch ch := msg[i]; ch {
+		case ',', ' ':
+			return string(name)
+		case '\\':
+			if i+1 < len(msg) {
+				i++
+				name = append(name, msg[i])
+			}
+		default:
+			name = append(name, ch)
+		}
+	}
+	return string(name)
+}
@@ -0,0 +1,226 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	spoolFileExt       = ".ilp"
+	spoolTmpFileExt    = ".tmp"
+	spoolProbeInterval = time.Second
+)
+
+// diskSpool keeps batches of ILP messages as files in a local
+// directory while the server is unavailable, and replays them in
+// the background once the server recovers.
+//
+// All methods except the replay goroutine are called from the sender's
+// goroutine. Spooled files are written under a temporary name and then
+// renamed, so the replay goroutine never sees partially written files.
+// The send function passed to the replay must serialize itself with
+// the sender's flushes.
+type diskSpool struct {
+	dir       string
+	threshold int
+
+	seq       uint64
+	failures  int
+	degraded  bool
+	lastProbe time.Time
+	// pending is set if the directory may contain files to replay.
+	// It's only cleared by the replay goroutine once the directory
+	// is drained.
+	pending int32
+
+	replaying int32
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func newDiskSpool(dir string, threshold int) (*diskSpool, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %v", err)
+	}
+	sp := &diskSpool{
+		dir:       dir,
+		threshold: threshold,
+	}
+	names, err := sp.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		// Continue the sequence of the files left by a previous sender.
+		last := strings.TrimSuffix(filepath.Base(names[len(names)-1]), spoolFileExt)
+		sp.seq, _ = strconv.ParseUint(last, 10, 64)
+		sp.pending = 1
+	}
+	sp.ctx, sp.cancel = context.WithCancel(context.Background())
+	return sp, nil
+}
+
+// files returns the paths of the spooled files, oldest first.
+func (sp *diskSpool) files() ([]string, error) {
+	entries, err := os.ReadDir(sp.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), spoolFileExt) {
+			// Sequence numbers are zero-padded, so lexical order
+			// is the spooling order.
+			names = append(names, filepath.Join(sp.dir, e.Name()))
+		}
+	}
+	return names, nil
+}
+
+// write spools a batch of ILP messages.
+func (sp *diskSpool) write(data []byte) error {
+	sp.seq++
+	name := filepath.Join(sp.dir, fmt.Sprintf("%020d", sp.seq))
+	err := os.WriteFile(name+spoolTmpFileExt, data, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write spool file: %v", err)
+	}
+	err = os.Rename(name+spoolTmpFileExt, name+spoolFileExt)
+	if err != nil {
+		return fmt.Errorf("failed to write spool file: %v", err)
+	}
+	atomic.StoreInt32(&sp.pending, 1)
+	return nil
+}
+
+// spilling returns true if the next batch should be spooled instead
+// of sent. While in degraded mode, a batch is sent to the server as
+// a probe once per probe interval.
+func (sp *diskSpool) spilling() bool {
+	if !sp.degraded {
+		return false
+	}
+	if time.Since(sp.lastProbe) < spoolProbeInterval {
+		return true
+	}
+	sp.lastProbe = time.Now()
+	return false
+}
+
+// recordFailure counts a failed flush and returns true if the
+// spool is in degraded mode.
+func (sp *diskSpool) recordFailure() bool {
+	sp.failures++
+	if !sp.degraded && sp.failures >= sp.threshold {
+		sp.degraded = true
+		sp.lastProbe = time.Now()
+	}
+	return sp.degraded
+}
+
+// recordSuccess leaves the degraded mode and starts replaying
+// the spooled files, if any.
+func (sp *diskSpool) recordSuccess(send func(ctx context.Context, body io.ReadSeeker, size int64) error) {
+	sp.failures = 0
+	sp.degraded = false
+	if atomic.LoadInt32(&sp.pending) == 1 {
+		sp.replay(send)
+	}
+}
+
+// replay sends the spooled files in a background goroutine, oldest
+// first, and removes them once delivered. The replay stops on the
+// first failure; the remaining files are replayed after the next
+// successful flush.
+func (sp *diskSpool) replay(send func(ctx context.Context, body io.ReadSeeker, size int64) error) {
+	if !atomic.CompareAndSwapInt32(&sp.replaying, 0, 1) {
+		// The running replay picks up new files. If it's about to
+		// exit, pending stays set and the next flush restarts it.
+		return
+	}
+	sp.wg.Add(1)
+	go func() {
+		defer sp.wg.Done()
+		defer atomic.StoreInt32(&sp.replaying, 0)
+		for {
+			names, err := sp.files()
+			if err != nil {
+				return
+			}
+			if len(names) == 0 {
+				// A file spooled after the listing sets pending
+				// again, so it's either listed here or replayed
+				// by the next run.
+				atomic.StoreInt32(&sp.pending, 0)
+				if names, err = sp.files(); err != nil || len(names) == 0 {
+					return
+				}
+				atomic.StoreInt32(&sp.pending, 1)
+			}
+			for _, name := range names {
+				if sp.ctx.Err() != nil {
+					return
+				}
+				if err := sp.replayFile(name, send); err != nil {
+					return
+				}
+				os.Remove(name)
+			}
+		}
+	}()
+}
+
+// replayFile streams the spooled file to the server.
+func (sp *diskSpool) replayFile(name string, send func(ctx context.Context, body io.ReadSeeker, size int64) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return send(sp.ctx, f, fi.Size())
+}
+
+// close stops the replay, if any. Files that were not replayed
+// are kept for the next sender using the same directory.
+func (sp *diskSpool) close() {
+	sp.cancel()
+	sp.wg.Wait()
+}
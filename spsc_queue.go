@@ -0,0 +1,138 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// spscSpins is the number of times a waiting side yields before
+	// it starts to sleep.
+	spscSpins = 64
+	spscSleep = 50 * time.Microsecond
+)
+
+type spscQueue struct {
+	items []QueueItem
+	mask  uint64
+
+	// head is the next slot to read, owned by the consumer, while
+	// tail is the next slot to write, owned by the producer. They're
+	// padded to avoid false sharing between the two sides.
+	head uint64
+	_    [56]byte
+	tail uint64
+	_    [56]byte
+
+	closed int32
+	done   chan struct{}
+}
+
+// NewSPSCQueue creates a lock-free in-memory queue for the topology
+// with a single producer and a single consumer, i.e. an AsyncSender
+// with one worker whose Send is called from one goroutine at a time.
+// It avoids the mutex contention of the other queues, while its
+// waiting sides spin and then sleep briefly instead of parking. The
+// size is rounded up to a power of two.
+//
+// The queue must not be used with multiple producers or consumers.
+func NewSPSCQueue(size int) AsyncQueue {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &spscQueue{
+		items: make([]QueueItem, n),
+		mask:  uint64(n - 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// spscWait backs off the n-th attempt of a waiting side.
+func spscWait(ctx context.Context, done chan struct{}, n int) error {
+	if n < spscSpins {
+		runtime.Gosched()
+		return nil
+	}
+	t := time.NewTimer(spscSleep)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+	case <-t.C:
+	}
+	return nil
+}
+
+func (q *spscQueue) Push(ctx context.Context, item QueueItem, wait bool) error {
+	tail := atomic.LoadUint64(&q.tail)
+	for n := 0; tail-atomic.LoadUint64(&q.head) == uint64(len(q.items)); n++ {
+		if !wait {
+			return ErrQueueFull
+		}
+		if err := spscWait(ctx, nil, n); err != nil {
+			return err
+		}
+	}
+	q.items[tail&q.mask] = item
+	atomic.StoreUint64(&q.tail, tail+1)
+	return nil
+}
+
+func (q *spscQueue) Pop() (QueueItem, bool) {
+	head := atomic.LoadUint64(&q.head)
+	for n := 0; head == atomic.LoadUint64(&q.tail); n++ {
+		if atomic.LoadInt32(&q.closed) == 1 {
+			// Recheck, since the last item may be pushed right
+			// before Close.
+			if head == atomic.LoadUint64(&q.tail) {
+				return QueueItem{}, false
+			}
+			break
+		}
+		spscWait(context.Background(), q.done, n)
+	}
+	item := q.items[head&q.mask]
+	q.items[head&q.mask] = QueueItem{}
+	atomic.StoreUint64(&q.head, head+1)
+	return item, true
+}
+
+func (q *spscQueue) Len() int {
+	head := atomic.LoadUint64(&q.head)
+	return int(atomic.LoadUint64(&q.tail) - head)
+}
+
+func (q *spscQueue) Close() error {
+	if atomic.CompareAndSwapInt32(&q.closed, 0, 1) {
+		close(q.done)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"io"
+	"math/big"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// MisuseError is the panic value used by senders created with
+// the WithStrictMode option when an API misuse is detected.
+type MisuseError struct {
+	// Reason describes the detected misuse.
+	Reason string
+	// Stack is the stack trace of the goroutine that misused
+	// the sender.
+	Stack []byte
+}
+
+// Error returns the misuse reason followed by the stack trace.
+func (e *MisuseError) Error() string {
+	return fmt.Sprintf("sender misuse: %s\n%s", e.Reason, e.Stack)
+}
+
+// strictLineSender wraps a sender and panics on API misuse
+// instead of producing deferred errors or corrupted buffers.
+type strictLineSender struct {
+	sender LineSender
+	buf    *buffer
+	// busy is set to 1 while a method call is in progress. Used to
+	// detect concurrent calls from multiple goroutines.
+	busy int32
+}
+
+// strictDryRunLineSender preserves the DryRunSender interface
+// of the wrapped sender.
+type strictDryRunLineSender struct {
+	*strictLineSender
+}
+
+func (s strictDryRunLineSender) Lines() *LineIterator {
+	s.enter()
+	defer s.exit()
+	return s.sender.(DryRunSender).Lines()
+}
+
+// strictRetryLineSender preserves the RetryFlusher interface
+// of the wrapped sender.
+type strictRetryLineSender struct {
+	*strictLineSender
+}
+
+func (s strictRetryLineSender) FlushRetry(ctx context.Context, policy RetryPolicy) error {
+	s.enter()
+	defer s.exit()
+	return s.sender.(RetryFlusher).FlushRetry(ctx, policy)
+}
+
+func newStrictLineSender(s LineSender) LineSender {
+	ss := &strictLineSender{
+		sender: s,
+		buf:    s.(bufferedSender).lineBuffer(),
+	}
+	if _, ok := s.(DryRunSender); ok {
+		return strictDryRunLineSender{ss}
+	}
+	if _, ok := s.(RetryFlusher); ok {
+		return strictRetryLineSender{ss}
+	}
+	return ss
+}
+
+func misuse(reason string) {
+	panic(&MisuseError{
+		Reason: reason,
+		Stack:  debug.Stack(),
+	})
+}
+
+func (s *strictLineSender) enter() {
+	if !atomic.CompareAndSwapInt32(&s.busy, 0, 1) {
+		misuse("concurrent call detected: sender must not be used by multiple goroutines")
+	}
+}
+
+func (s *strictLineSender) exit() {
+	atomic.StoreInt32(&s.busy, 0)
+}
+
+// checkTable panics if no table was provided for the pending
+// message. Messages that already failed are left to the wrapped
+// sender, so that the original error is reported.
+func (s *strictLineSender) checkTable(method string) {
+	if s.buf.LastErr() == nil && !s.buf.HasTable() {
+		misuse(method + " called without Table")
+	}
+}
+
+// checkSymbol panics if a symbol can't be added to the pending
+// message.
+func (s *strictLineSender) checkSymbol(method string) {
+	s.checkTable(method)
+	if s.buf.LastErr() == nil && s.buf.HasFields() && !s.buf.reorderSymbols {
+		misuse(method + " called after a column")
+	}
+}
+
+func (s *strictLineSender) Table(name string) LineSender {
+	s.enter()
+	defer s.exit()
+	if s.buf.LastErr() == nil && s.buf.HasTable() {
+		misuse("Table called before the pending message was finished with At or AtNow")
+	}
+	s.sender.Table(name)
+	return s
+}
+
+func (s *strictLineSender) Symbol(name, val string) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkSymbol("Symbol")
+	s.sender.Symbol(name, val)
+	return s
+}
+
+func (s *strictLineSender) SymbolStringer(name string, val fmt.Stringer) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkSymbol("SymbolStringer")
+	s.sender.SymbolStringer(name, val)
+	return s
+}
+
+func (s *strictLineSender) Int64Column(name string, val int64) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("Int64Column")
+	s.sender.Int64Column(name, val)
+	return s
+}
+
+func (s *strictLineSender) Uint64Column(name string, val uint64) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("Uint64Column")
+	s.sender.Uint64Column(name, val)
+	return s
+}
+
+func (s *strictLineSender) Long256Column(name string, val *big.Int) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("Long256Column")
+	s.sender.Long256Column(name, val)
+	return s
+}
+
+func (s *strictLineSender) TimestampColumn(name string, ts time.Time) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("TimestampColumn")
+	s.sender.TimestampColumn(name, ts)
+	return s
+}
+
+func (s *strictLineSender) TimestampMicrosColumn(name string, ts int64) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("TimestampMicrosColumn")
+	s.sender.TimestampMicrosColumn(name, ts)
+	return s
+}
+
+func (s *strictLineSender) TimestampNanosColumn(name string, ts int64) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("TimestampNanosColumn")
+	s.sender.TimestampNanosColumn(name, ts)
+	return s
+}
+
+func (s *strictLineSender) Float64Column(name string, val float64) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("Float64Column")
+	s.sender.Float64Column(name, val)
+	return s
+}
+
+func (s *strictLineSender) StringColumn(name, val string) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("StringColumn")
+	s.sender.StringColumn(name, val)
+	return s
+}
+
+func (s *strictLineSender) StringColumnMarshaler(name string, val encoding.TextMarshaler) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("StringColumnMarshaler")
+	s.sender.StringColumnMarshaler(name, val)
+	return s
+}
+
+func (s *strictLineSender) BoolColumn(name string, val bool) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("BoolColumn")
+	s.sender.BoolColumn(name, val)
+	return s
+}
+
+func (s *strictLineSender) AnyColumn(name string, val interface{}) LineSender {
+	s.enter()
+	defer s.exit()
+	s.checkTable("AnyColumn")
+	s.sender.AnyColumn(name, val)
+	return s
+}
+
+func (s *strictLineSender) At(ctx context.Context, ts time.Time) error {
+	s.enter()
+	defer s.exit()
+	s.checkTable("At")
+	return s.sender.At(ctx, ts)
+}
+
+func (s *strictLineSender) AtNow(ctx context.Context) error {
+	s.enter()
+	defer s.exit()
+	s.checkTable("AtNow")
+	return s.sender.AtNow(ctx)
+}
+
+func (s *strictLineSender) AtMicros(ctx context.Context, ts int64) error {
+	s.enter()
+	defer s.exit()
+	s.checkTable("AtMicros")
+	return s.sender.AtMicros(ctx, ts)
+}
+
+func (s *strictLineSender) AtMillis(ctx context.Context, ts int64) error {
+	s.enter()
+	defer s.exit()
+	s.checkTable("AtMillis")
+	return s.sender.AtMillis(ctx, ts)
+}
+
+func (s *strictLineSender) AtRaw(ctx context.Context, line []byte) error {
+	s.enter()
+	defer s.exit()
+	if s.buf.LastErr() == nil && s.buf.HasTable() {
+		misuse("AtRaw called before the pending message was finished with At or AtNow")
+	}
+	return s.sender.AtRaw(ctx, line)
+}
+
+func (s *strictLineSender) Flush(ctx context.Context) error {
+	s.enter()
+	defer s.exit()
+	return s.sender.Flush(ctx)
+}
+
+func (s *strictLineSender) FlushWithStats(ctx context.Context) (FlushStats, error) {
+	s.enter()
+	defer s.exit()
+	return s.sender.FlushWithStats(ctx)
+}
+
+func (s *strictLineSender) Close(ctx context.Context) error {
+	s.enter()
+	defer s.exit()
+	return s.sender.Close(ctx)
+}
+
+func (s *strictLineSender) WriteRows(ctx context.Context, rows []Row) error {
+	return writeRows(ctx, s, rows)
+}
+
+func (s *strictLineSender) Write(ctx context.Context, row Row) error {
+	return writeRow(ctx, s, &row)
+}
+
+func (s *strictLineSender) WriteStruct(ctx context.Context, table string, v interface{}) error {
+	return writeStruct(ctx, s, table, v)
+}
+
+func (s *strictLineSender) RawWriter() io.Writer {
+	s.enter()
+	defer s.exit()
+	return s.sender.RawWriter()
+}
+
+func (s *strictLineSender) Checkpoint() Checkpoint {
+	s.enter()
+	defer s.exit()
+	return s.sender.Checkpoint()
+}
+
+func (s *strictLineSender) Restore(cp Checkpoint) error {
+	s.enter()
+	defer s.exit()
+	return s.sender.Restore(cp)
+}
+
+func (s *strictLineSender) Config() ConfigSnapshot {
+	return s.sender.Config()
+}
+
+func (s *strictLineSender) PendingFlush() *FlushToken {
+	s.enter()
+	defer s.exit()
+	return s.sender.PendingFlush()
+}
+
+func (s *strictLineSender) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	s.enter()
+	defer s.exit()
+	return s.sender.ServerInfo(ctx)
+}
+
+func (s *strictLineSender) lineBuffer() *buffer {
+	return s.buf
+}
@@ -0,0 +1,188 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func recoverMisuse(f func()) (misuse *qdb.MisuseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			misuse = r.(*qdb.MisuseError)
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestStrictModeMisuse(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		name   string
+		write  func(s qdb.LineSender)
+		reason string
+	}{
+		{
+			"table after columns",
+			func(s qdb.LineSender) {
+				s.Table(testTable).Int64Column("a", 1).Table(testTable)
+			},
+			"Table called before the pending message was finished",
+		},
+		{
+			"column without table",
+			func(s qdb.LineSender) {
+				s.Int64Column("a", 1)
+			},
+			"Int64Column called without Table",
+		},
+		{
+			"at without table",
+			func(s qdb.LineSender) {
+				s.At(ctx, time.UnixMicro(1))
+			},
+			"At called without Table",
+		},
+		{
+			"symbol after column",
+			func(s qdb.LineSender) {
+				s.Table(testTable).StringColumn("a", "b").Symbol("c", "d")
+			},
+			"Symbol called after a column",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithStrictMode())
+			assert.NoError(t, err)
+
+			misuse := recoverMisuse(func() { tc.write(sender) })
+			if assert.NotNil(t, misuse) {
+				assert.Contains(t, misuse.Reason, tc.reason)
+				assert.Contains(t, string(misuse.Stack), "TestStrictModeMisuse")
+			}
+		})
+	}
+}
+
+func TestStrictModeValidUsage(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithStrictMode())
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Symbol("sym", "foo").Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+
+	// Deferred errors are reported as usual.
+	err = sender.Table("bad?table").Int64Column("a", 1).AtNow(ctx)
+	assert.ErrorContains(t, err, "table name contains an illegal char")
+
+	err = sender.Close(ctx)
+	assert.NoError(t, err)
+
+	var lines []string
+	it := sender.(qdb.DryRunSender).Lines()
+	for it.Next() {
+		lines = append(lines, it.Line())
+	}
+	assert.Equal(t, []string{testTable + ",sym=foo a=1i"}, lines)
+}
+
+func TestStrictModeFlushRetry(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithStrictMode())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+
+	rf, ok := sender.(qdb.RetryFlusher)
+	if !assert.True(t, ok) {
+		return
+	}
+	err = rf.FlushRetry(ctx, qdb.RetryPolicy{MaxRetries: 3})
+	assert.NoError(t, err)
+
+	expectLines(t, srv.BackCh, []string{testTable + " a=1i"})
+}
+
+func TestStrictModeConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(srv.Listener.Addr().String()), qdb.WithStrictMode())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Blocks until the server responds.
+		assert.NoError(t, sender.Flush(ctx))
+	}()
+
+	// Wait for the flush to reach the server.
+	<-started
+
+	misuse := recoverMisuse(func() {
+		sender.Table(testTable)
+	})
+	close(release)
+	wg.Wait()
+
+	if assert.NotNil(t, misuse) {
+		assert.Contains(t, misuse.Reason, "concurrent call detected")
+	}
+}
@@ -0,0 +1,300 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct fields are mapped to columns with the "qdb" tag:
+//
+//	type Trade struct {
+//		Symbol string    `qdb:"symbol,symbol,capacity=256"`
+//		Price  float64   `qdb:"price"`
+//		Ts     time.Time `qdb:"ts,designated,partition=DAY"`
+//		Note   string    `qdb:"-"`
+//	}
+//
+// The first tag element is the column name. If it's empty, the
+// field name is used. Fields tagged with "-" and unexported
+// fields are ignored. The following options are supported:
+//
+//	symbol       - string field is written as a symbol
+//	varchar      - string field has the VARCHAR type in the generated
+//	               DDL instead of the legacy STRING type
+//	capacity=N   - symbol capacity used in the generated DDL
+//	index        - symbol column is indexed in the generated DDL
+//	designated   - time.Time field is used as the designated timestamp
+//	partition=P  - partitioning used in the generated DDL, only
+//	               allowed for the designated timestamp
+const structTagName = "qdb"
+
+type fieldKind int64
+
+const (
+	fieldSymbol    fieldKind = 0
+	fieldString    fieldKind = 1
+	fieldBool      fieldKind = 2
+	fieldInt       fieldKind = 3
+	fieldUint      fieldKind = 4
+	fieldFloat     fieldKind = 5
+	fieldTimestamp fieldKind = 6
+	fieldLong256   fieldKind = 7
+)
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	bigIntType = reflect.TypeOf(&big.Int{})
+)
+
+// structField describes how a struct field maps to a column.
+type structField struct {
+	index   int
+	name    string
+	kind    fieldKind
+	colType ColumnType
+
+	symbolCapacity int
+	indexed        bool
+}
+
+// structPlan describes how a struct type maps to a table row.
+// Symbols are kept separately since they have to be written
+// before any other column.
+type structPlan struct {
+	typ         reflect.Type
+	symbols     []structField
+	columns     []structField
+	designated  int
+	partitionBy PartitionBy
+}
+
+func newStructPlan(typ reflect.Type) (*structPlan, error) {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, got %s", typ)
+	}
+
+	p := &structPlan{
+		typ:        typ,
+		designated: -1,
+	}
+	names := make(map[string]struct{})
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag, tagged := f.Tag.Lookup(structTagName)
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		if f.Anonymous && !tagged {
+			return nil, fmt.Errorf("embedded field %s must be tagged or ignored with \"-\"", f.Name)
+		}
+
+		sf, designated, partitionBy, err := parseStructField(f, i, tag)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %w", f.Name, typ, err)
+		}
+
+		if _, ok := names[sf.name]; ok {
+			return nil, fmt.Errorf("duplicate column name %q in %s", sf.name, typ)
+		}
+		names[sf.name] = struct{}{}
+
+		switch {
+		case designated:
+			if p.designated != -1 {
+				return nil, fmt.Errorf("multiple designated timestamps in %s", typ)
+			}
+			p.designated = len(p.columns)
+			p.partitionBy = partitionBy
+			p.columns = append(p.columns, sf)
+		case sf.kind == fieldSymbol:
+			p.symbols = append(p.symbols, sf)
+		default:
+			p.columns = append(p.columns, sf)
+		}
+	}
+	if len(p.symbols) == 0 && len(p.columns) == 0 {
+		return nil, fmt.Errorf("no columns found in %s", typ)
+	}
+	return p, nil
+}
+
+func parseStructField(f reflect.StructField, index int, tag string) (sf structField, designated bool, partitionBy PartitionBy, err error) {
+	opts := strings.Split(tag, ",")
+	sf.index = index
+	sf.name = opts[0]
+	if sf.name == "" {
+		sf.name = f.Name
+	}
+
+	symbol, varchar := false, false
+	for _, opt := range opts[1:] {
+		key, val, _ := strings.Cut(opt, "=")
+		switch key {
+		case "symbol":
+			symbol = true
+		case "varchar":
+			varchar = true
+		case "designated":
+			designated = true
+		case "index":
+			sf.indexed = true
+		case "capacity":
+			sf.symbolCapacity, err = strconv.Atoi(val)
+			if err != nil || sf.symbolCapacity <= 0 {
+				return sf, false, "", fmt.Errorf("invalid symbol capacity %q", val)
+			}
+		case "partition":
+			partitionBy = PartitionBy(strings.ToUpper(val))
+			if !validPartitionBy(partitionBy) {
+				return sf, false, "", fmt.Errorf("invalid partitioning %q", val)
+			}
+		default:
+			return sf, false, "", fmt.Errorf("unknown tag option %q", opt)
+		}
+	}
+
+	sf.kind, sf.colType, err = structFieldKind(f.Type)
+	if err != nil {
+		return sf, false, "", err
+	}
+	if symbol {
+		if sf.kind != fieldString {
+			return sf, false, "", errors.New("only string fields can be symbols")
+		}
+		sf.kind = fieldSymbol
+		sf.colType = ColumnTypeSymbol
+	} else if sf.symbolCapacity != 0 || sf.indexed {
+		return sf, false, "", errors.New("capacity and index options require the symbol option")
+	}
+	if varchar {
+		if sf.kind != fieldString {
+			return sf, false, "", errors.New("only non-symbol string fields can be varchars")
+		}
+		sf.colType = ColumnTypeVarchar
+	}
+	if designated && sf.kind != fieldTimestamp {
+		return sf, false, "", errors.New("designated timestamp must be a time.Time field")
+	}
+	if partitionBy != "" && !designated {
+		return sf, false, "", errors.New("partition option requires the designated option")
+	}
+	return sf, designated, partitionBy, nil
+}
+
+func structFieldKind(typ reflect.Type) (fieldKind, ColumnType, error) {
+	switch typ {
+	case timeType:
+		return fieldTimestamp, ColumnTypeTimestamp, nil
+	case bigIntType:
+		return fieldLong256, ColumnTypeLong256, nil
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return fieldString, ColumnTypeString, nil
+	case reflect.Bool:
+		return fieldBool, ColumnTypeBoolean, nil
+	case reflect.Int8:
+		return fieldInt, ColumnTypeByte, nil
+	case reflect.Int16, reflect.Uint8:
+		return fieldInt, ColumnTypeShort, nil
+	case reflect.Int32, reflect.Uint16:
+		return fieldInt, ColumnTypeInt, nil
+	case reflect.Int, reflect.Int64:
+		return fieldInt, ColumnTypeLong, nil
+	case reflect.Uint32:
+		return fieldUint, ColumnTypeLong, nil
+	case reflect.Float32:
+		return fieldFloat, ColumnTypeFloat, nil
+	case reflect.Float64:
+		return fieldFloat, ColumnTypeDouble, nil
+	}
+	return 0, "", fmt.Errorf("unsupported field type %s", typ)
+}
+
+func validPartitionBy(p PartitionBy) bool {
+	switch p {
+	case PartitionByNone, PartitionByHour, PartitionByDay, PartitionByWeek, PartitionByMonth, PartitionByYear:
+		return true
+	}
+	return false
+}
+
+// SchemaFromStruct infers the schema of the given table from the "qdb"
+// tags of a struct. v may be a struct value, a pointer to a struct or
+// a reflect.Type of a struct.
+//
+// The schema can be applied with RestClient.CreateTable. Symbols come
+// first in the resulting schema, followed by the remaining columns in
+// the field declaration order.
+func SchemaFromStruct(table string, v interface{}) (TableSchema, error) {
+	typ, ok := v.(reflect.Type)
+	if !ok {
+		typ = reflect.TypeOf(v)
+	}
+	if typ == nil {
+		return TableSchema{}, errors.New("expected a struct, got nil")
+	}
+	p, err := newStructPlan(typ)
+	if err != nil {
+		return TableSchema{}, err
+	}
+	return p.schema(table), nil
+}
+
+func (p *structPlan) schema(table string) TableSchema {
+	s := TableSchema{
+		Name:        table,
+		Columns:     make([]ColumnSchema, 0, len(p.symbols)+len(p.columns)),
+		PartitionBy: p.partitionBy,
+	}
+	for _, f := range p.symbols {
+		s.Columns = append(s.Columns, ColumnSchema{
+			Name:           f.name,
+			Type:           f.colType,
+			SymbolCapacity: f.symbolCapacity,
+			Indexed:        f.indexed,
+		})
+	}
+	for i, f := range p.columns {
+		s.Columns = append(s.Columns, ColumnSchema{
+			Name: f.name,
+			Type: f.colType,
+		})
+		if i == p.designated {
+			s.DesignatedTimestamp = f.name
+		}
+	}
+	return s
+}
@@ -0,0 +1,209 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type testTrade struct {
+	Price    float64   `qdb:"price"`
+	Symbol   string    `qdb:"symbol,symbol,capacity=256,index"`
+	Amount   int32     `qdb:"amount"`
+	Side     string    `qdb:"side,symbol"`
+	Ts       time.Time `qdb:"ts,designated,partition=day"`
+	Filled   bool
+	Hash     *big.Int  `qdb:"hash"`
+	Created  time.Time `qdb:"created"`
+	Ignored  string    `qdb:"-"`
+	internal string
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+	expected := qdb.TableSchema{
+		Name: "trades",
+		Columns: []qdb.ColumnSchema{
+			{Name: "symbol", Type: qdb.ColumnTypeSymbol, SymbolCapacity: 256, Indexed: true},
+			{Name: "side", Type: qdb.ColumnTypeSymbol},
+			{Name: "price", Type: qdb.ColumnTypeDouble},
+			{Name: "amount", Type: qdb.ColumnTypeInt},
+			{Name: "ts", Type: qdb.ColumnTypeTimestamp},
+			{Name: "Filled", Type: qdb.ColumnTypeBoolean},
+			{Name: "hash", Type: qdb.ColumnTypeLong256},
+			{Name: "created", Type: qdb.ColumnTypeTimestamp},
+		},
+		DesignatedTimestamp: "ts",
+		PartitionBy:         qdb.PartitionByDay,
+	}
+
+	for _, v := range []interface{}{testTrade{internal: "foo"}, &testTrade{}, reflect.TypeOf(testTrade{})} {
+		schema, err := qdb.SchemaFromStruct("trades", v)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, schema)
+	}
+
+	schema, err := qdb.SchemaFromStruct("trades", testTrade{})
+	assert.NoError(t, err)
+	ddl, err := schema.DDL()
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE TABLE "trades" ("symbol" SYMBOL CAPACITY 256 INDEX, "side" SYMBOL, "price" DOUBLE, "amount" INT, `+
+		`"ts" TIMESTAMP, "Filled" BOOLEAN, "hash" LONG256, "created" TIMESTAMP) TIMESTAMP("ts") PARTITION BY DAY`, ddl)
+}
+
+func TestSchemaFromStructVarchar(t *testing.T) {
+	type event struct {
+		Legacy  string    `qdb:"legacy"`
+		Message string    `qdb:"message,varchar"`
+		Ts      time.Time `qdb:"ts,designated"`
+	}
+
+	schema, err := qdb.SchemaFromStruct("events", event{})
+	assert.NoError(t, err)
+	ddl, err := schema.DDL()
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE TABLE "events" ("legacy" STRING, "message" VARCHAR, "ts" TIMESTAMP) TIMESTAMP("ts")`, ddl)
+
+	sender, err := qdb.NewLineSender(context.Background(), qdb.WithHttp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	err = sender.WriteStruct(context.Background(), "events", event{
+		Legacy:  "foo",
+		Message: "bar",
+		Ts:      time.UnixMicro(1),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "events legacy=\"foo\",message=\"bar\" 1000\n", qdb.Messages(sender))
+}
+
+func TestSchemaFromStructErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		val         interface{}
+		expectedErr string
+	}{
+		{"nil", nil, "expected a struct, got nil"},
+		{"not a struct", 42, "expected a struct, got int"},
+		{"no columns", struct{ a int }{}, "no columns found"},
+		{
+			"unsupported type",
+			struct {
+				A []int `qdb:"a"`
+			}{},
+			"unsupported field type []int",
+		},
+		{
+			"non-string symbol",
+			struct {
+				A int `qdb:"a,symbol"`
+			}{},
+			"only string fields can be symbols",
+		},
+		{
+			"non-string varchar",
+			struct {
+				A int `qdb:"a,varchar"`
+			}{},
+			"only non-symbol string fields can be varchars",
+		},
+		{
+			"varchar symbol",
+			struct {
+				A string `qdb:"a,symbol,varchar"`
+			}{},
+			"only non-symbol string fields can be varchars",
+		},
+		{
+			"non-timestamp designated",
+			struct {
+				A int `qdb:"a,designated"`
+			}{},
+			"designated timestamp must be a time.Time field",
+		},
+		{
+			"multiple designated",
+			struct {
+				A time.Time `qdb:"a,designated"`
+				B time.Time `qdb:"b,designated"`
+			}{},
+			"multiple designated timestamps",
+		},
+		{
+			"duplicate names",
+			struct {
+				A int64 `qdb:"a"`
+				B int64 `qdb:"a"`
+			}{},
+			"duplicate column name \"a\"",
+		},
+		{
+			"capacity without symbol",
+			struct {
+				A string `qdb:"a,capacity=10"`
+			}{},
+			"capacity and index options require the symbol option",
+		},
+		{
+			"invalid capacity",
+			struct {
+				A string `qdb:"a,symbol,capacity=abc"`
+			}{},
+			"invalid symbol capacity",
+		},
+		{
+			"invalid partitioning",
+			struct {
+				A time.Time `qdb:"a,designated,partition=decade"`
+			}{},
+			"invalid partitioning",
+		},
+		{
+			"partition without designated",
+			struct {
+				A time.Time `qdb:"a,partition=day"`
+			}{},
+			"partition option requires the designated option",
+		},
+		{
+			"unknown option",
+			struct {
+				A string `qdb:"a,foobar"`
+			}{},
+			"unknown tag option \"foobar\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := qdb.SchemaFromStruct("foo", tc.val)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
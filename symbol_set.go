@@ -0,0 +1,94 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import "fmt"
+
+// SymbolSet writes a symbol column whose values are restricted to
+// a fixed set, such as an enum. It protects the column from
+// unbounded cardinality growth caused by bugs upstream.
+//
+// Example usage:
+//
+//	sides := qdb.NewSymbolSet("side", "buy", "sell")
+//	err := sides.Write(sender.Table("trades"), side).
+//		Float64Column("price", 2615.54).
+//		AtNow(ctx)
+//
+// SymbolSet is immutable, so it's safe for concurrent use.
+type SymbolSet struct {
+	name        string
+	allowed     map[string]struct{}
+	fallback    string
+	hasFallback bool
+}
+
+// NewSymbolSet returns a SymbolSet for the column with the given
+// name which accepts only the given values.
+func NewSymbolSet(name string, allowed ...string) *SymbolSet {
+	s := &SymbolSet{
+		name:    name,
+		allowed: make(map[string]struct{}, len(allowed)),
+	}
+	for _, val := range allowed {
+		s.allowed[val] = struct{}{}
+	}
+	return s
+}
+
+// WithFallback returns a copy of the set which writes the given
+// value instead of rejecting unknown values, e.g. "other".
+func (s *SymbolSet) WithFallback(val string) *SymbolSet {
+	c := *s
+	c.fallback = val
+	c.hasFallback = true
+	return &c
+}
+
+// Allowed reports whether the value belongs to the set.
+func (s *SymbolSet) Allowed(val string) bool {
+	_, ok := s.allowed[val]
+	return ok
+}
+
+// Write adds the symbol value to the pending message of the sender.
+// The sender must be created by this package.
+//
+// Unknown values are replaced with the fallback value, if any.
+// Otherwise, the message fails with an error returned by the At
+// or AtNow call.
+func (s *SymbolSet) Write(sender LineSender, val string) LineSender {
+	if !s.Allowed(val) {
+		if !s.hasFallback {
+			buf := sender.(bufferedSender).lineBuffer()
+			if buf.lastErr == nil {
+				buf.lastErr = fmt.Errorf("symbol value is not allowed: %s: %s: %w", s.name, val, ErrSymbolNotAllowed)
+			}
+			return sender
+		}
+		val = s.fallback
+	}
+	return sender.Symbol(s.name, val)
+}
@@ -0,0 +1,62 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"testing"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSymbolSet(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	sides := qdb.NewSymbolSet("side", "buy", "sell")
+	assert.True(t, sides.Allowed("buy"))
+	assert.False(t, sides.Allowed("hold"))
+
+	err = sides.Write(sender.Table(testTable), "buy").Int64Column("qty", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sides.Write(sender.Table(testTable), "hold").Int64Column("qty", 2).AtNow(ctx)
+	assert.ErrorContains(t, err, "symbol value is not allowed: side: hold")
+
+	others := sides.WithFallback("other")
+	err = others.Write(sender.Table(testTable), "hold").Int64Column("qty", 3).AtNow(ctx)
+	assert.NoError(t, err)
+	// The original set is not affected.
+	err = sides.Write(sender.Table(testTable), "hold").AtNow(ctx)
+	assert.Error(t, err)
+
+	assert.Equal(t,
+		testTable+",side=buy qty=1i\n"+
+			testTable+",side=other qty=3i\n",
+		qdb.Messages(sender))
+}
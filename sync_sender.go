@@ -0,0 +1,117 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"sync"
+)
+
+// SyncSender wraps a LineSender with a lock, so that it can be shared
+// by concurrent goroutines. Since chained calls can't be protected by
+// the lock, SyncSender only provides the methods that write complete
+// rows.
+type SyncSender struct {
+	mu     sync.Mutex
+	sender LineSender
+	err    error
+}
+
+// NewSyncSender returns a SyncSender which writes rows to the given
+// sender. The sender must not be used directly after that.
+func NewSyncSender(s LineSender) *SyncSender {
+	return &SyncSender{sender: s}
+}
+
+// WriteRows writes the rows as ILP messages. See LineSender.WriteRows
+// for the details.
+func (s *SyncSender) WriteRows(ctx context.Context, rows []Row) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.sender.WriteRows(ctx, rows)
+}
+
+// WriteStruct writes the struct as an ILP message. See
+// LineSender.WriteStruct for the details.
+func (s *SyncSender) WriteStruct(ctx context.Context, table string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.sender.WriteStruct(ctx, table, v)
+}
+
+// Flush sends the accumulated messages.
+func (s *SyncSender) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.sender.Flush(ctx)
+}
+
+// Close flushes the accumulated messages and closes the underlying
+// sender.
+func (s *SyncSender) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	err := s.sender.Flush(ctx)
+	if closeErr := s.sender.Close(ctx); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+var (
+	defaultSender     *SyncSender
+	defaultSenderOnce sync.Once
+)
+
+// Default returns the process-wide default sender. The sender is
+// created on first use with the config string defined by the
+// QDB_CLIENT_CONF environment variable, see LineSenderFromEnv.
+// It lets small tools and scripts write rows without passing
+// a sender around:
+//
+//	err := qdb.Default().WriteStruct(ctx, "trades", trade)
+//
+// If the sender can't be created, all its methods return the error.
+// Call Default().Close before the process exits to send the pending
+// rows.
+func Default() *SyncSender {
+	defaultSenderOnce.Do(func() {
+		s, err := LineSenderFromEnv(context.Background())
+		defaultSender = &SyncSender{sender: s, err: err}
+	})
+	return defaultSender
+}
@@ -0,0 +1,90 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	qdb "github.com/questdb/go-questdb-client/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncSender(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	s := qdb.NewSyncSender(sender)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := s.WriteRows(ctx, []qdb.Row{{
+				Table:   testTable,
+				Columns: []qdb.TypedValue{{Name: "a", Value: int64(i)}},
+			}})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 10, qdb.MsgCount(sender))
+
+	err = s.Close(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, qdb.MsgCount(sender))
+}
+
+func TestDefaultSender(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestHttpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	t.Setenv("QDB_CLIENT_CONF", "")
+	qdb.ResetDefault()
+	err = qdb.Default().Flush(ctx)
+	assert.ErrorContains(t, err, "QDB_CLIENT_CONF environment variable is not set")
+
+	t.Setenv("QDB_CLIENT_CONF", fmt.Sprintf("http::addr=%s;", srv.Addr()))
+	qdb.ResetDefault()
+	defer qdb.ResetDefault()
+	assert.Same(t, qdb.Default(), qdb.Default())
+
+	err = qdb.Default().WriteRows(ctx, []qdb.Row{{
+		Table:   testTable,
+		Columns: []qdb.TypedValue{{Name: "a", Value: int64(1)}},
+	}})
+	assert.NoError(t, err)
+	err = qdb.Default().Close(ctx)
+	assert.NoError(t, err)
+
+	expectLines(t, srv.BackCh, []string{testTable + " a=1i"})
+}
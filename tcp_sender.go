@@ -32,9 +32,11 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/tls"
+	"encoding"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"time"
@@ -44,21 +46,76 @@ type tcpLineSender struct {
 	buf     buffer
 	address string
 	conn    net.Conn
+	watch   *connWatch
+	breaker *circuitBreaker
+	raw     *rawWriter
+	metrics MetricsHook
+	debug   *debugWriter
+	trace   *wireTracer
+	tee     io.Writer
+
+	delivery     deliveryDeadline
+	backoff      Backoff
+	deliveryMode DeliveryMode
+
+	// Connection settings kept for reconnects.
+	// injected is set if the connection was provided by the user,
+	// in which case reconnects are not possible.
+	injected      bool
+	tlsMode       tlsMode
+	keyId         string
+	key           *ecdsa.PrivateKey
+	fallbackDelay time.Duration
+
+	// Buffer size that triggers an auto-flush.
+	autoFlushBytes int
+	// Rows larger than this are flushed right away.
+	oversizedRowSize int
+
+	// Buffer swap fields
+	bufferSwap bool
+	spare      []byte
+
+	// detectDisconnects enables the connection watch.
+	detectDisconnects bool
+	inflight          *tcpInflightFlush
+
+	// Idle connection fields
+	idleTimeout time.Duration
+	lastFlush   time.Time
+
+	conf lineSenderConfig
 }
 
-func newTcpLineSender(ctx context.Context, conf *lineSenderConfig) (*tcpLineSender, error) {
-	var (
-		d    net.Dialer
-		key  *ecdsa.PrivateKey
-		conn net.Conn
-		err  error
-	)
+var errCannotReconnect = errors.New("cannot reconnect: the sender uses an existing connection")
 
+func newTcpLineSender(ctx context.Context, conf *lineSenderConfig) (*tcpLineSender, error) {
 	s := &tcpLineSender{
-		address: conf.address,
-		// TCP sender doesn't limit max buffer size, hence 0
-		buf: newBuffer(conf.initBufSize, 0, conf.fileNameLimit),
+		address:           conf.address,
+		tlsMode:           conf.tlsMode,
+		fallbackDelay:     conf.dialFallbackDelay,
+		breaker:           newCircuitBreaker(conf.circuitBreaker),
+		idleTimeout:       conf.tcpIdleTimeout,
+		metrics:           newMetricsHook(conf.metrics),
+		debug:             newDebugWriter(conf.debugWriter, conf.debugMaxBytes),
+		trace:             newWireTracer(conf.wireTrace),
+		tee:               conf.tee,
+		delivery:          deliveryDeadline{timeout: conf.deliveryTimeout, deadLetter: conf.deadLetter},
+		backoff:           conf.backoff,
+		deliveryMode:      conf.deliveryMode,
+		autoFlushBytes:    conf.autoFlushBytes,
+		oversizedRowSize:  conf.oversizedRowSize,
+		bufferSwap:        conf.bufferSwap,
+		detectDisconnects: conf.disconnectDetector,
+		conf:              *conf,
 	}
+	var err error
+	s.buf, err = newBufferFromConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	// TCP sender doesn't limit max buffer size, hence 0
+	s.buf.maxBufSize = 0
 
 	// Process tcp args in the same exact way that we do in v2
 	if conf.tcpKeyId != "" && conf.tcpKey != "" {
@@ -67,47 +124,104 @@ func newTcpLineSender(ctx context.Context, conf *lineSenderConfig) (*tcpLineSend
 			return nil, fmt.Errorf("failed to decode auth key: %v", err)
 		}
 		// TODO(puzpuzpuz): migrate to crypto/ecdh one we don't need to support Go 1.19
-		key = new(ecdsa.PrivateKey)
+		key := new(ecdsa.PrivateKey)
 		key.PublicKey.Curve = elliptic.P256()
 		key.PublicKey.X, key.PublicKey.Y = key.PublicKey.Curve.ScalarBaseMult(rawKey)
 		key.D = new(big.Int).SetBytes(rawKey)
+		s.keyId = conf.tcpKeyId
+		s.key = key
+	}
+
+	if conf.conn != nil {
+		s.injected = true
+		// Don't let config snapshots share the connection.
+		s.conf.conn = nil
+		if err := s.authenticate(ctx, conf.conn); err != nil {
+			return nil, err
+		}
+		s.conn = conf.conn
+		s.watch = s.watchConn(s.conn)
+		s.lastFlush = time.Now()
+		return s, nil
 	}
 
-	if conf.tlsMode == tlsDisabled {
+	err = s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect opens a new connection to the server and authenticates
+// it, if necessary.
+func (s *tcpLineSender) connect(ctx context.Context) error {
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if s.injected {
+		return errCannotReconnect
+	}
+	s.trace.event("connect: tcp %s, tls=%v", s.address, s.tlsMode != tlsDisabled)
+	d := &net.Dialer{FallbackDelay: s.fallbackDelay}
+	if s.tlsMode == tlsDisabled {
 		conn, err = d.DialContext(ctx, "tcp", s.address)
 	} else {
 		config := &tls.Config{}
-		if conf.tlsMode == tlsInsecureSkipVerify {
+		if s.tlsMode == tlsInsecureSkipVerify {
 			config.InsecureSkipVerify = true
 		}
-		conn, err = tls.DialWithDialer(&d, "tcp", s.address, config)
+		td := tls.Dialer{NetDialer: d, Config: config}
+		conn, err = td.DialContext(ctx, "tcp", s.address)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to server: %v", err)
+		s.trace.event("connect failed: %v", err)
+		return fmt.Errorf("failed to connect to server: %v", err)
+	}
+	s.trace.event("connected: local=%s, remote=%s", conn.LocalAddr(), conn.RemoteAddr())
+	if tlsConn, ok := conn.(*tls.Conn); ok && s.trace != nil {
+		s.trace.tlsState(tlsConn.ConnectionState())
 	}
+	if err = s.authenticate(ctx, conn); err != nil {
+		return err
+	}
+
+	s.conn = conn
+	s.watch = s.watchConn(conn)
+	s.lastFlush = time.Now()
+	return nil
+}
 
-	if key != nil {
+// authenticate does the authentication handshake over the given
+// connection, if necessary. The connection is closed on failure.
+func (s *tcpLineSender) authenticate(ctx context.Context, conn net.Conn) error {
+	if s.key != nil {
 		if deadline, ok := ctx.Deadline(); ok {
 			conn.SetDeadline(deadline)
 		}
 
-		_, err = conn.Write([]byte(conf.tcpKeyId + "\n"))
+		s.trace.event("auth: sending key id %s", s.keyId)
+		_, err := conn.Write([]byte(s.keyId + "\n"))
 		if err != nil {
+			s.trace.event("auth failed: %v", err)
 			conn.Close()
-			return nil, fmt.Errorf("failed to write key id: %v", err)
+			return fmt.Errorf("failed to write key id: %v", err)
 		}
 
 		reader := bufio.NewReader(conn)
 		raw, err := reader.ReadBytes('\n')
+		s.trace.payload(raw, "auth: challenge received, %d bytes", len(raw))
 		if len(raw) < 2 {
+			s.trace.event("auth failed: empty challenge: %v", err)
 			conn.Close()
-			return nil, fmt.Errorf("empty challenge response from server: %v", err)
+			return fmt.Errorf("empty challenge response from server: %v", err)
 		}
 		// Remove the `\n` in the last position.
 		raw = raw[:len(raw)-1]
 		if err != nil {
 			conn.Close()
-			return nil, fmt.Errorf("failed to read challenge response from server: %v", err)
+			return fmt.Errorf("failed to read challenge response from server: %v", err)
 		}
 
 		// Hash the challenge with sha256.
@@ -115,33 +229,51 @@ func newTcpLineSender(ctx context.Context, conf *lineSenderConfig) (*tcpLineSend
 		hash.Write(raw)
 		hashed := hash.Sum(nil)
 
-		stdSig, err := ecdsa.SignASN1(rand.Reader, key, hashed)
+		stdSig, err := ecdsa.SignASN1(rand.Reader, s.key, hashed)
 		if err != nil {
 			conn.Close()
-			return nil, fmt.Errorf("failed to sign challenge using auth key: %v", err)
+			return fmt.Errorf("failed to sign challenge using auth key: %v", err)
 		}
 		_, err = conn.Write([]byte(base64.StdEncoding.EncodeToString(stdSig) + "\n"))
 		if err != nil {
+			s.trace.event("auth failed: %v", err)
 			conn.Close()
-			return nil, fmt.Errorf("failed to write signed challenge: %v", err)
+			return fmt.Errorf("failed to write signed challenge: %v", err)
 		}
+		s.trace.event("auth: signed challenge sent")
 
 		// Reset the deadline.
 		conn.SetDeadline(time.Time{})
 	}
+	return nil
+}
 
-	s.conn = conn
-
-	return s, nil
+// ensureConn closes the connection if it stayed idle for longer
+// than the idle timeout and dials a new one, if necessary.
+func (s *tcpLineSender) ensureConn(ctx context.Context) error {
+	if s.conn != nil && s.idleTimeout > 0 && time.Since(s.lastFlush) > s.idleTimeout {
+		s.conn.Close()
+		s.conn = nil
+		s.watch = nil
+	}
+	if s.conn == nil {
+		return s.connect(ctx)
+	}
+	return nil
 }
 
 func (s *tcpLineSender) Close(_ context.Context) error {
+	flushErr := s.waitFlush()
+	s.buf.resolveFlush(errClosedBeforeFlush)
+	s.buf.releaseMem()
 	if s.conn != nil {
 		conn := s.conn
 		s.conn = nil
-		return conn.Close()
+		if err := conn.Close(); err != nil {
+			return err
+		}
 	}
-	return nil
+	return flushErr
 }
 
 func (s *tcpLineSender) Table(name string) LineSender {
@@ -154,11 +286,21 @@ func (s *tcpLineSender) Symbol(name, val string) LineSender {
 	return s
 }
 
+func (s *tcpLineSender) SymbolStringer(name string, val fmt.Stringer) LineSender {
+	s.buf.SymbolStringer(name, val)
+	return s
+}
+
 func (s *tcpLineSender) Int64Column(name string, val int64) LineSender {
 	s.buf.Int64Column(name, val)
 	return s
 }
 
+func (s *tcpLineSender) Uint64Column(name string, val uint64) LineSender {
+	s.buf.Uint64Column(name, val)
+	return s
+}
+
 func (s *tcpLineSender) Long256Column(name string, val *big.Int) LineSender {
 	s.buf.Long256Column(name, val)
 	return s
@@ -169,6 +311,16 @@ func (s *tcpLineSender) TimestampColumn(name string, ts time.Time) LineSender {
 	return s
 }
 
+func (s *tcpLineSender) TimestampMicrosColumn(name string, ts int64) LineSender {
+	s.buf.TimestampMicrosColumn(name, ts)
+	return s
+}
+
+func (s *tcpLineSender) TimestampNanosColumn(name string, ts int64) LineSender {
+	s.buf.TimestampNanosColumn(name, ts)
+	return s
+}
+
 func (s *tcpLineSender) Float64Column(name string, val float64) LineSender {
 	s.buf.Float64Column(name, val)
 	return s
@@ -179,11 +331,21 @@ func (s *tcpLineSender) StringColumn(name, val string) LineSender {
 	return s
 }
 
+func (s *tcpLineSender) StringColumnMarshaler(name string, val encoding.TextMarshaler) LineSender {
+	s.buf.StringColumnMarshaler(name, val)
+	return s
+}
+
 func (s *tcpLineSender) BoolColumn(name string, val bool) LineSender {
 	s.buf.BoolColumn(name, val)
 	return s
 }
 
+func (s *tcpLineSender) AnyColumn(name string, val interface{}) LineSender {
+	s.buf.AnyColumn(name, val)
+	return s
+}
+
 func (s *tcpLineSender) Flush(ctx context.Context) error {
 	err := s.buf.LastErr()
 	s.buf.ClearLastErr()
@@ -193,30 +355,220 @@ func (s *tcpLineSender) Flush(ctx context.Context) error {
 	}
 	if s.buf.HasTable() {
 		s.buf.DiscardPendingMsg()
-		return errors.New("pending ILP message must be finalized with At or AtNow before calling Flush")
+		return fmt.Errorf("%w before calling Flush", ErrPendingMessage)
 	}
 
 	if err = ctx.Err(); err != nil {
 		return err
 	}
+	if err = s.waitFlush(); err != nil {
+		return err
+	}
+	if err = s.checkConn(); err != nil {
+		return err
+	}
+
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	if !s.breaker.allow() {
+		return s.breaker.reject(&s.buf)
+	}
+	var (
+		start = time.Now()
+		rows  = s.buf.msgCount()
+		size  = s.buf.Len()
+	)
+	if err = s.ensureConn(ctx); err != nil {
+		s.breaker.record(err)
+		s.buf.dropFailed(err)
+		reportFlush(s.metrics, s.deliveryMode, rows, size, start, err)
+		return err
+	}
 	if deadline, ok := ctx.Deadline(); ok {
 		s.conn.SetWriteDeadline(deadline)
 	} else {
 		s.conn.SetWriteDeadline(time.Time{})
 	}
 
-	if _, err := s.buf.WriteTo(s.conn); err != nil {
+	s.debug.dump(s.buf.Bytes())
+	s.trace.payload(s.buf.Bytes(), "flush: %d bytes, %d rows", size, rows)
+	if err = teeBatch(s.tee, s.buf.Bytes()); err != nil {
+		s.buf.dropFailed(err)
+		reportFlush(s.metrics, s.deliveryMode, rows, size, start, err)
+		return err
+	}
+	if s.bufferSwap {
+		s.flushSwap(rows, start)
+		return nil
+	}
+	_, err = s.buf.WriteTo(s.conn)
+	s.breaker.record(err)
+	reportFlush(s.metrics, s.deliveryMode, rows, size, start, err)
+	if err != nil {
+		s.trace.event("flush failed: %v", err)
 		return err
 	}
+	s.trace.event("flush done")
+	s.lastFlush = time.Now()
 
 	// bytes.Buffer grows as 2*cap+n, so we use 3x as the threshold.
 	if s.buf.Cap() > 3*s.buf.initBufSize {
 		// Shrink the buffer back to desired capacity.
 		s.buf.ResetSize()
 	}
+	s.metrics.Gauge(MetricBufferCapacity, float64(s.buf.Cap()))
+	return nil
+}
+
+// tcpInflightFlush is a batch detached from the buffer and being
+// written to the connection in the background.
+type tcpInflightFlush struct {
+	batch detachedBatch
+	rows  int
+	start time.Time
+	done  chan error
+}
+
+// flushSwap swaps the buffer with an empty one and writes the
+// detached batch in the background, so that new rows can be added
+// while the batch is sent. The outcome is collected by waitFlush.
+func (s *tcpLineSender) flushSwap(rows int, start time.Time) {
+	f := &tcpInflightFlush{
+		batch: s.buf.detach(s.spare),
+		rows:  rows,
+		start: start,
+		done:  make(chan error, 1),
+	}
+	s.spare = nil
+	s.inflight = f
+	go func(conn net.Conn) {
+		n, err := conn.Write(f.batch.data)
+		if err == nil && n < len(f.batch.data) {
+			err = io.ErrShortWrite
+		}
+		// The token is no longer reachable through the buffer, so
+		// it may be resolved here.
+		if f.batch.token != nil {
+			f.batch.token.resolve(err)
+		}
+		f.done <- err
+	}(s.conn)
+}
+
+// pending reports whether the batch is still being written.
+func (f *tcpInflightFlush) pending() bool {
+	select {
+	case err := <-f.done:
+		f.done <- err
+		return false
+	default:
+		return true
+	}
+}
+
+// waitFlush waits for the batch written in the background, if any,
+// and returns its error. The batch of a failed write is kept, so
+// that it can be restored from a checkpoint, while the memory of a
+// sent one is reused.
+func (s *tcpLineSender) waitFlush() error {
+	f := s.inflight
+	if f == nil {
+		return nil
+	}
+	s.inflight = nil
+	err := <-f.done
+	s.breaker.record(err)
+	reportFlush(s.metrics, s.deliveryMode, f.rows, len(f.batch.data), f.start, err)
+	if err != nil {
+		s.buf.keepFailed(f.batch)
+		return err
+	}
+	s.lastFlush = time.Now()
+	switch {
+	case s.buf.pool != nil:
+		s.buf.pool.put(f.batch.data[:0])
+	case cap(f.batch.data) <= 3*s.buf.initBufSize:
+		s.spare = f.batch.data[:0]
+	}
 	return nil
 }
 
+// flushSync flushes the buffer and waits until the batch is written,
+// even if the buffer is swapped on flush.
+func (s *tcpLineSender) flushSync(ctx context.Context) error {
+	err := s.Flush(ctx)
+	if err == nil {
+		err = s.waitFlush()
+	}
+	return err
+}
+
+func (s *tcpLineSender) FlushWithStats(ctx context.Context) (FlushStats, error) {
+	return flushWithStats(&s.buf, func() error {
+		return s.Flush(ctx)
+	})
+}
+
+func (s *tcpLineSender) FlushRetry(ctx context.Context, policy RetryPolicy) error {
+	deliveryCtx, cancel := s.delivery.withTimeout(ctx)
+	defer cancel()
+
+	cp := s.buf.checkpoint()
+	err := s.flushRetry(deliveryCtx, policy, cp)
+	if err = s.delivery.check(ctx, deliveryCtx, err); errors.Is(err, ErrDeliveryTimeout) {
+		// Bring back the expired batch to hand it over.
+		if s.buf.restore(cp) == nil {
+			s.delivery.drop(s.buf.Bytes(), err)
+			s.buf.dropFailed(err)
+		}
+	}
+	return err
+}
+
+func (s *tcpLineSender) flushRetry(ctx context.Context, policy RetryPolicy, cp Checkpoint) error {
+	err := s.flushSync(ctx)
+	if !isTransientNetError(err) {
+		return err
+	}
+	if s.deliveryMode == DeliveryAtMostOnce {
+		// The batch is dropped. Close the broken connection, so that
+		// the next flush reconnects.
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		return err
+	}
+
+	backoff := policy.backoff(s.backoff)
+	for retries := 0; err != nil && retries < policy.MaxRetries; retries++ {
+		if sleepErr := sleepCtx(ctx, backoff.delay(retries)); sleepErr != nil {
+			return sleepErr
+		}
+
+		// Bring back the failed batch and send it over a new
+		// connection. Failed reconnects are retried as well.
+		if err = s.buf.restore(cp); err != nil {
+			return err
+		}
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		err = s.connect(ctx)
+		if err != nil {
+			s.buf.dropFailed(err)
+			continue
+		}
+		err = s.flushSync(ctx)
+		if !isTransientNetError(err) {
+			return err
+		}
+	}
+	return err
+}
+
 func (s *tcpLineSender) AtNow(ctx context.Context) error {
 	return s.At(ctx, time.Time{})
 }
@@ -231,13 +583,108 @@ func (s *tcpLineSender) At(ctx context.Context, ts time.Time) error {
 	if err != nil {
 		return err
 	}
+	return s.autoFlush(ctx)
+}
+
+func (s *tcpLineSender) AtMicros(ctx context.Context, ts int64) error {
+	err := s.buf.AtMicros(ts)
+	if err != nil {
+		return err
+	}
+	return s.autoFlush(ctx)
+}
+
+func (s *tcpLineSender) AtMillis(ctx context.Context, ts int64) error {
+	err := s.buf.AtMillis(ts)
+	if err != nil {
+		return err
+	}
+	return s.autoFlush(ctx)
+}
 
-	if s.buf.Len() > s.buf.initBufSize {
+func (s *tcpLineSender) AtRaw(ctx context.Context, line []byte) error {
+	err := s.buf.AtRaw(line)
+	if err != nil {
+		return err
+	}
+	return s.autoFlush(ctx)
+}
+
+func (s *tcpLineSender) autoFlush(ctx context.Context) error {
+	if err := s.checkConn(); err != nil {
+		return err
+	}
+	if err := s.buf.checkMemory(ctx, s.Flush); err != nil {
+		return err
+	}
+	if s.buf.oversizedLastMsg(s.oversizedRowSize) {
+		err := s.Flush(ctx)
+		if err == nil {
+			// Don't keep the capacity grown by the row.
+			s.buf.ResetSize()
+		}
+		return err
+	}
+	if s.buf.pendingRowsFull() {
+		if s.buf.shedder != nil && s.inflight != nil && s.inflight.pending() {
+			// Shed the new rows instead of waiting for the write.
+			return nil
+		}
+		return s.buf.flushPendingRows(ctx, s.Flush, s.deliveryMode == DeliveryAtLeastOnce)
+	}
+	threshold := s.buf.initBufSize
+	if s.autoFlushBytes > 0 {
+		threshold = s.autoFlushBytes
+	}
+	if s.buf.Len() > threshold {
 		return s.Flush(ctx)
 	}
 	return nil
 }
 
+func (s *tcpLineSender) WriteRows(ctx context.Context, rows []Row) error {
+	return writeRows(ctx, s, rows)
+}
+
+func (s *tcpLineSender) Write(ctx context.Context, row Row) error {
+	return writeRow(ctx, s, &row)
+}
+
+func (s *tcpLineSender) WriteStruct(ctx context.Context, table string, v interface{}) error {
+	return writeStruct(ctx, s, table, v)
+}
+
+func (s *tcpLineSender) RawWriter() io.Writer {
+	if s.raw == nil {
+		s.raw = newRawWriter(&s.buf, s.autoFlush)
+	}
+	return s.raw
+}
+
+func (s *tcpLineSender) Checkpoint() Checkpoint {
+	return s.buf.checkpoint()
+}
+
+func (s *tcpLineSender) Restore(cp Checkpoint) error {
+	return s.buf.restore(cp)
+}
+
+func (s *tcpLineSender) Config() ConfigSnapshot {
+	return ConfigSnapshot{conf: s.conf}
+}
+
+func (s *tcpLineSender) PendingFlush() *FlushToken {
+	return s.buf.pendingFlush()
+}
+
+func (s *tcpLineSender) ServerInfo(_ context.Context) (ServerInfo, error) {
+	return ServerInfo{}, fmt.Errorf("server info is not available in the TCP client: %w", ErrUnsupportedBySender)
+}
+
+func (s *tcpLineSender) lineBuffer() *buffer {
+	return &s.buf
+}
+
 // Messages returns a copy of accumulated ILP messages that are not
 // flushed to the TCP connection yet. Useful for debugging purposes.
 func (s *tcpLineSender) Messages() string {
@@ -246,7 +693,7 @@ func (s *tcpLineSender) Messages() string {
 
 // MsgCount returns the number of buffered messages
 func (s *tcpLineSender) MsgCount() int {
-	return s.buf.msgCount
+	return s.buf.msgCount()
 }
 
 // BufLen returns the number of bytes written to the buffer.
@@ -25,9 +25,16 @@
 package questdb_test
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -172,6 +179,11 @@ func TestTcpPathologicalCasesFromConf(t *testing.T) {
 			config:      "tcp::auto_flush_interval=5;",
 			expectedErr: "autoFlushInterval setting is not available",
 		},
+		{
+			name:        "auto_flush off",
+			config:      "tcp::auto_flush=off;",
+			expectedErr: "autoFlushDisabled setting is not available",
+		},
 		{
 			name:        "tcp key but no id",
 			config:      "tcp::token=test_key;",
@@ -207,6 +219,20 @@ func TestTcpPathologicalCasesFromConf(t *testing.T) {
 	}
 }
 
+func TestTcpAutoFlushDisabledIsRejected(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAutoFlushDisabled())
+	assert.ErrorContains(t, err, "autoFlushDisabled setting is not available")
+
+	_, err = qdb.LineSenderFromConf(ctx, "tcp::addr=localhost:9009;auto_flush=off;")
+	assert.ErrorContains(t, err, "autoFlushDisabled setting is not available")
+
+	cfg := qdb.SenderConfig{Schema: "tcp", AutoFlushDisabled: true}
+	_, err = cfg.Build(ctx)
+	assert.ErrorContains(t, err, "autoFlushDisabled setting is not available")
+}
+
 func TestErrorOnFlushWhenMessageIsPending(t *testing.T) {
 	ctx := context.Background()
 
@@ -225,6 +251,503 @@ func TestErrorOnFlushWhenMessageIsPending(t *testing.T) {
 	assert.Empty(t, qdb.Messages(sender))
 }
 
+func TestEpochDesignatedTimestamps(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtMicros(ctx, 42)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 2).AtMillis(ctx, 42)
+	assert.NoError(t, err)
+	err = sender.Flush(ctx)
+	assert.NoError(t, err)
+
+	expectLines(t, srv.BackCh, []string{
+		testTable + " a_col=1i 42000",
+		testTable + " a_col=2i 42000000",
+	})
+}
+
+func TestEpochTimestampColumns(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.
+		Table(testTable).
+		TimestampMicrosColumn("c1", 42).
+		TimestampNanosColumn("c2", 42999).
+		TimestampNanosColumn("c3", -1).
+		TimestampColumn("c4", time.Unix(0, -1)).
+		AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+" c1=42t,c2=42t,c3=-1t,c4=-1t\n", qdb.Messages(sender))
+}
+
+func TestClientTimestamps(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithClientTimestamps())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	before := time.Now().UnixNano()
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	after := time.Now().UnixNano()
+	// Explicit timestamps are kept as is.
+	err = sender.Table(testTable).Int64Column("a_col", 2).At(ctx, time.Unix(0, 42))
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(qdb.Messages(sender), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	prefix := testTable + " a_col=1i "
+	assert.True(t, strings.HasPrefix(lines[0], prefix))
+	ts, err := strconv.ParseInt(strings.TrimPrefix(lines[0], prefix), 10, 64)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, ts, before)
+	assert.LessOrEqual(t, ts, after)
+	assert.Equal(t, testTable+" a_col=2i 42", lines[1])
+}
+
+func TestMaxPendingRows(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithTcp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithMaxPendingRows(2, qdb.PendingRowsPolicyFlush),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for i := 0; i < 3; i++ {
+		err = sender.Table(testTable).Int64Column("a_col", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+	expectLines(t, srv.BackCh, []string{
+		testTable + " a_col=0i",
+		testTable + " a_col=1i",
+	})
+
+	sender, err = qdb.NewLineSender(
+		ctx,
+		qdb.WithTcp(),
+		qdb.WithDryRun(),
+		qdb.WithMaxPendingRows(2, qdb.PendingRowsPolicyError),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for i := 0; i < 2; i++ {
+		err = sender.Table(testTable).Int64Column("a_col", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	err = sender.Table(testTable).Int64Column("a_col", 2).AtNow(ctx)
+	assert.ErrorContains(t, err, "max pending rows limit reached")
+	err = sender.AtRaw(ctx, []byte(testTable+" a_col=2i"))
+	assert.ErrorContains(t, err, "max pending rows limit reached")
+	assert.Equal(t, 2, qdb.MsgCount(sender))
+
+	err = sender.Flush(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 2).AtNow(ctx)
+	assert.NoError(t, err)
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithMaxPendingRows(-1, qdb.PendingRowsPolicyFlush))
+	assert.ErrorContains(t, err, "max pending rows is negative")
+}
+
+func TestMonotonicTimestampGuard(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithTcp(),
+		qdb.WithAddress(srv.Addr()),
+		qdb.WithMonotonicTimestamps(10*time.Nanosecond),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).At(ctx, time.Unix(0, 100))
+	assert.NoError(t, err)
+	// Within the tolerance.
+	err = sender.Table(testTable).Int64Column("a_col", 2).At(ctx, time.Unix(0, 90))
+	assert.NoError(t, err)
+	// Beyond the tolerance.
+	err = sender.Table(testTable).Int64Column("a_col", 3).At(ctx, time.Unix(0, 89))
+	assert.ErrorContains(t, err, "designated timestamp goes backwards beyond the tolerance")
+	// Other tables are tracked separately.
+	err = sender.Table("another_table").Int64Column("a_col", 4).At(ctx, time.Unix(0, 1))
+	assert.NoError(t, err)
+	// Server-assigned timestamps are not checked.
+	err = sender.Table(testTable).Int64Column("a_col", 5).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Flush(ctx)
+	assert.NoError(t, err)
+
+	expectLines(t, srv.BackCh, []string{
+		testTable + " a_col=1i 100",
+		testTable + " a_col=2i 90",
+		"another_table a_col=4i 1",
+		testTable + " a_col=5i",
+	})
+}
+
+func TestMonotonicTimestampGuardDroppedRows(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithTcp(),
+		qdb.WithDryRun(),
+		qdb.WithMonotonicTimestamps(0),
+		qdb.WithMaxPendingRows(2, qdb.PendingRowsPolicyFlush),
+		qdb.WithShedder(qdb.NewShedder(qdb.SheddingDropNewest)),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	cp := sender.Checkpoint()
+	err = sender.Table(testTable).Int64Column("a_col", 1).At(ctx, time.Unix(0, 100))
+	assert.NoError(t, err)
+
+	// Restored rows don't move the guard forward.
+	err = sender.Restore(cp)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 2).At(ctx, time.Unix(0, 50))
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 3).At(ctx, time.Unix(0, 60))
+	assert.NoError(t, err)
+
+	// Neither do shed rows.
+	err = sender.Table(testTable).Int64Column("a_col", 4).At(ctx, time.Unix(0, 200))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, qdb.MsgCount(sender))
+	err = sender.Flush(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 5).At(ctx, time.Unix(0, 70))
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 6).At(ctx, time.Unix(0, 65))
+	assert.ErrorIs(t, err, qdb.ErrTimestampOutOfOrder)
+}
+
+func TestMonotonicTimestampWarnings(t *testing.T) {
+	ctx := context.Background()
+
+	var warnings []error
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithTcp(),
+		qdb.WithDryRun(),
+		qdb.WithMonotonicTimestampWarnings(0, func(err error) {
+			warnings = append(warnings, err)
+		}),
+		qdb.WithClientTimestamps(),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	future := time.Now().Add(time.Hour)
+	err = sender.Table(testTable).Int64Column("a_col", 1).At(ctx, future)
+	assert.NoError(t, err)
+	// The row is sent, but reported.
+	err = sender.Table(testTable).Int64Column("a_col", 2).At(ctx, future.Add(-time.Second))
+	assert.NoError(t, err)
+	// With client timestamps, AtNow rows are checked too.
+	err = sender.Table(testTable).Int64Column("a_col", 3).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, qdb.MsgCount(sender))
+
+	if assert.Len(t, warnings, 2) {
+		assert.ErrorIs(t, warnings[0], qdb.ErrTimestampOutOfOrder)
+		assert.ErrorContains(t, warnings[1], "designated timestamp goes backwards beyond the tolerance")
+	}
+}
+
+func TestSymbolReordering(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithSymbolReordering())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.
+		Table(testTable).
+		Symbol("s1", "a").
+		Int64Column("c1", 1).
+		Symbol("s2", "b c").
+		StringColumn("c2", "d").
+		Symbol("s3", "e").
+		AtNow(ctx)
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Float64Column("c1", 1.5).Symbol("s1", "a").AtNow(ctx)
+	assert.NoError(t, err)
+
+	assert.Equal(t,
+		testTable+",s1=a,s2=b\\ c,s3=e c1=1i,c2=\"d\"\n"+
+			testTable+",s1=a c1=1.5\n",
+		qdb.Messages(sender))
+
+	// Without the option, symbols after columns are rejected.
+	sender, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("c1", 1).Symbol("s1", "a").AtNow(ctx)
+	assert.ErrorContains(t, err, "symbols have to be written before any other column")
+}
+
+func TestControlCharPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	const msg = "line 1\nline 2\r\n\tend\x00"
+
+	testCases := []struct {
+		name     string
+		policy   qdb.ControlCharPolicy
+		expected string
+	}{
+		{
+			"escape",
+			qdb.ControlCharsEscape,
+			testTable + ",sym=line\\ 1\\\nline\\ 2\\\r\\\n\tend\x00 msg=\"line 1\\\nline 2\\\r\\\n\tend\x00\"\n",
+		},
+		{
+			"strip",
+			qdb.ControlCharsStrip,
+			testTable + ",sym=line\\ 1line\\ 2end msg=\"line 1line 2end\"\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithControlCharPolicy(tc.policy))
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			err = sender.Table(testTable).Symbol("sym", msg).StringColumn("msg", msg).AtNow(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, qdb.Messages(sender))
+		})
+	}
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithControlCharPolicy(qdb.ControlCharsReject))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).StringColumn("msg", msg).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrControlChar)
+	assert.ErrorContains(t, err, "control char at offset 6")
+	err = sender.Table(testTable).StringColumn("msg", "ok").AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+" msg=\"ok\"\n", qdb.Messages(sender))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithControlCharPolicy(42))
+	assert.ErrorContains(t, err, "unknown control char policy: 42")
+}
+
+func TestValidationLevel(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithValidationLevel(qdb.ValidationOff))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	// Names are written as is.
+	err = sender.Table("a?b").Int64Column("c/d", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table("").Int64Column("c", 1).AtNow(ctx)
+	assert.ErrorContains(t, err, "table name cannot be empty")
+	assert.Equal(t, "a?b c/d=1i\n", qdb.Messages(sender))
+
+	testCases := []struct {
+		name     string
+		writerFn func(s qdb.LineSender) error
+		errMsg   string
+	}{
+		{
+			"consecutive dots",
+			func(s qdb.LineSender) error {
+				return s.Table("a..b").Int64Column("c", 1).AtNow(ctx)
+			},
+			"table name contains consecutive '.' chars",
+		},
+		{
+			"invalid utf-8",
+			func(s qdb.LineSender) error {
+				return s.Table(testTable).StringColumn("c", "a\xffb").AtNow(ctx)
+			},
+			"string value is not valid UTF-8",
+		},
+		{
+			"pre-1970 timestamp",
+			func(s qdb.LineSender) error {
+				return s.Table(testTable).Int64Column("c", 1).At(ctx, time.Unix(-1, 0))
+			},
+			"designated timestamp is before 1970-01-01",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			// Basic validation lets the message through.
+			assert.NoError(t, tc.writerFn(sender))
+
+			sender, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithValidationLevel(qdb.ValidationServerParity))
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			err = tc.writerFn(sender)
+			assert.ErrorContains(t, err, tc.errMsg)
+			assert.ErrorIs(t, err, qdb.ErrInvalidMessage)
+			assert.Zero(t, qdb.MsgCount(sender))
+		})
+	}
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithValidationLevel(42))
+	assert.ErrorContains(t, err, "unknown validation level: 42")
+}
+
+func TestMaxStringLength(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithMaxStringLength(5, qdb.StringLengthTruncate))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).StringColumn("s1", "12345").StringColumn("s2", "123456").AtNow(ctx)
+	assert.NoError(t, err)
+	// Values are cut at a UTF-8 char boundary.
+	err = sender.Table(testTable).StringColumn("s1", "1ж3456").AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		testTable+" s1=\"12345\",s2=\"12...\"\n"+
+			testTable+" s1=\"1...\"\n",
+		qdb.Messages(sender))
+
+	// Rolled back values are not counted.
+	cp := sender.Checkpoint()
+	err = sender.Table(testTable).StringColumn("s1", "123456").AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Restore(cp))
+
+	stats, err := sender.FlushWithStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.TruncatedStrings)
+
+	// A marker longer than the limit is cut.
+	sender, err = qdb.NewLineSender(
+		ctx,
+		qdb.WithTcp(),
+		qdb.WithDryRun(),
+		qdb.WithMaxStringLength(2, qdb.StringLengthTruncate),
+		qdb.WithTruncationMarker("...."),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).StringColumn("s", "abc").AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+" s=\"..\"\n", qdb.Messages(sender))
+
+	sender, err = qdb.NewLineSender(
+		ctx,
+		qdb.WithTcp(),
+		qdb.WithDryRun(),
+		qdb.WithMaxStringLength(3, qdb.StringLengthTruncate),
+		qdb.WithTruncationMarker(""),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).StringColumn("s", "abcdef").AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+" s=\"abc\"\n", qdb.Messages(sender))
+
+	sender, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithMaxStringLength(3, qdb.StringLengthError))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).StringColumn("s", "abcdef").AtNow(ctx)
+	assert.ErrorContains(t, err, "string value length exceeds the limit: length=6, limit=3")
+	assert.ErrorIs(t, err, qdb.ErrValueOutOfRange)
+	assert.Zero(t, qdb.MsgCount(sender))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithMaxStringLength(-1, qdb.StringLengthError))
+	assert.ErrorContains(t, err, "max string length is negative")
+}
+
+func TestFloatPrecision(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithFloatPrecision(4))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.
+		Table(testTable).
+		Float64Column("c1", 1.2345678).
+		Float64Column("c2", 42).
+		Float64Column("c3", 1.23456e-99).
+		AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+" c1=1.235,c2=42,c3=1.235E-99\n", qdb.Messages(sender))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithFloatPrecision(18))
+	assert.ErrorContains(t, err, "float precision is out of [1, 17] range")
+}
+
+func TestUint64Column(t *testing.T) {
+	ctx := context.Background()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Uint64Column("c1", math.MaxInt64).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Uint64Column("c1", math.MaxInt64+1).AtNow(ctx)
+	assert.ErrorContains(t, err, "uint64 value does not fit into long column")
+	assert.Equal(t, testTable+" c1=9223372036854775807i\n", qdb.Messages(sender))
+
+	sender, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithUint64AsLong256())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Uint64Column("c1", 42).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Uint64Column("c1", math.MaxUint64).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		testTable+" c1=0x2ai\n"+
+			testTable+" c1=0xffffffffffffffffi\n",
+		qdb.Messages(sender))
+}
+
 func TestErrorOnUnavailableServer(t *testing.T) {
 	ctx := context.Background()
 
@@ -284,24 +807,194 @@ func TestErrorOnContextDeadline(t *testing.T) {
 	t.Fail()
 }
 
-func BenchmarkLineSenderBatch1000(b *testing.B) {
+func TestFlushRetryReconnects(t *testing.T) {
 	ctx := context.Background()
 
-	srv, err := newTestTcpServer(readAndDiscard)
-	assert.NoError(b, err)
-	defer srv.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
 
-	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
-	assert.NoError(b, err)
+	firstClosed := make(chan struct{})
+	linesCh := make(chan string, 10)
+	go func() {
+		// Reset the first connection to break the sender.
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		// Let the client finish the dial.
+		time.Sleep(50 * time.Millisecond)
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+		close(firstClosed)
+
+		conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			linesCh <- scanner.Text()
+		}
+	}()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(l.Addr().String()))
+	assert.NoError(t, err)
 	defer sender.Close(ctx)
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		for j := 0; j < 1000; j++ {
-			sender.
-				Table(testTable).
-				Symbol("sym_col", "test_ilp1").
-				Float64Column("double_col", float64(i)+0.42).
+	<-firstClosed
+	// Give the client some time to receive the RST packet.
+	time.Sleep(100 * time.Millisecond)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+
+	err = sender.(qdb.RetryFlusher).FlushRetry(ctx, qdb.RetryPolicy{MaxRetries: 3})
+	assert.NoError(t, err)
+	assert.Zero(t, qdb.BufLen(sender))
+
+	expectLines(t, linesCh, []string{fmt.Sprintf("%s a=1i", testTable)})
+}
+
+func TestFlushRetryDeliveryTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	closed := make(chan struct{})
+	go func() {
+		// Reset the connection and stop listening, so that
+		// reconnects fail.
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+		l.Close()
+		close(closed)
+	}()
+
+	var deadLetters []string
+	sender, err := qdb.NewLineSender(
+		ctx,
+		qdb.WithTcp(),
+		qdb.WithAddress(l.Addr().String()),
+		qdb.WithDeliveryTimeout(200*time.Millisecond),
+		qdb.WithDeadLetterHandler(func(batch []byte, err error) {
+			deadLetters = append(deadLetters, string(batch))
+		}),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	<-closed
+	time.Sleep(100 * time.Millisecond)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+
+	err = sender.(qdb.RetryFlusher).FlushRetry(ctx, qdb.RetryPolicy{MaxRetries: 1000, InitialInterval: 50 * time.Millisecond})
+	assert.ErrorIs(t, err, qdb.ErrDeliveryTimeout)
+	assert.Equal(t, []string{testTable + " a=1i\n"}, deadLetters)
+	assert.Zero(t, qdb.BufLen(sender))
+}
+
+func TestFlushRetryAtMostOnce(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	firstClosed := make(chan struct{})
+	linesCh := make(chan string, 10)
+	go func() {
+		// Reset the first connection to break the sender.
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+		close(firstClosed)
+
+		conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			linesCh <- scanner.Text()
+		}
+	}()
+
+	hook := newTestMetricsHook()
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(l.Addr().String()),
+		qdb.WithDeliveryMode(qdb.DeliveryAtMostOnce), qdb.WithMetrics(hook))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	<-firstClosed
+	time.Sleep(100 * time.Millisecond)
+
+	// The failed batch is dropped rather than re-sent.
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.(qdb.RetryFlusher).FlushRetry(ctx, qdb.RetryPolicy{MaxRetries: 3})
+	assert.Error(t, err)
+	assert.Zero(t, qdb.BufLen(sender))
+	assert.Equal(t, int64(1), hook.counter(qdb.MetricRowsDropped))
+
+	// The next batch goes over a new connection.
+	err = sender.Table(testTable).Int64Column("a", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.(qdb.RetryFlusher).FlushRetry(ctx, qdb.RetryPolicy{MaxRetries: 3})
+	assert.NoError(t, err)
+
+	expectLines(t, linesCh, []string{fmt.Sprintf("%s a=2i", testTable)})
+}
+
+func TestFlushRetryReturnsNonTransientErrors(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	sender.Table(testTable).Int64Column("a", 1)
+
+	err = sender.(qdb.RetryFlusher).FlushRetry(ctx, qdb.RetryPolicy{MaxRetries: 3})
+	assert.ErrorContains(t, err, "pending ILP message must be finalized")
+}
+
+func BenchmarkLineSenderBatch1000(b *testing.B) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(readAndDiscard)
+	assert.NoError(b, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()))
+	assert.NoError(b, err)
+	defer sender.Close(ctx)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 1000; j++ {
+			sender.
+				Table(testTable).
+				Symbol("sym_col", "test_ilp1").
+				Float64Column("double_col", float64(i)+0.42).
 				Int64Column("long_col", int64(i)).
 				StringColumn("str_col", "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua").
 				BoolColumn("bool_col", true).
@@ -337,3 +1030,748 @@ func BenchmarkLineSenderNoFlush(b *testing.B) {
 	}
 	sender.Flush(ctx)
 }
+
+func TestIdleTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	// Each accepted connection sends its first line to the channel.
+	lines := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				l, _ := bufio.NewReader(conn).ReadString('\n')
+				lines <- l
+			}()
+		}
+	}()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(ln.Addr().String()), qdb.WithIdleTimeout(50*time.Millisecond))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for i := 0; i < 2; i++ {
+		err = sender.Table(testTable).Int64Column("a_col", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, sender.Flush(ctx))
+
+		select {
+		case l := <-lines:
+			assert.Equal(t, fmt.Sprintf("%s a_col=%di\n", testTable, i), l)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no line received over a new connection")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestGlobalSymbols(t *testing.T) {
+	ctx := context.Background()
+
+	symbols := map[string]string{"region": "eu-west", "host": "srv-1"}
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithGlobalSymbols(symbols))
+	assert.NoError(t, err)
+	// The option keeps a copy of the map.
+	symbols["host"] = "srv-2"
+
+	err = sender.Table(testTable).Symbol("side", "buy").Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("a_col", 2).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		testTable+",host=srv-1,region=eu-west,side=buy a_col=1i\n"+
+			testTable+",host=srv-1,region=eu-west a_col=2i\n",
+		qdb.Messages(sender))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithGlobalSymbols(map[string]string{"a.b": "c"}))
+	assert.ErrorContains(t, err, "invalid global symbol")
+}
+
+func TestMetricsHookTcp(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	hook := newTestMetricsHook()
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithMetrics(hook))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	size := len(qdb.Messages(sender))
+	assert.NoError(t, sender.Flush(ctx))
+
+	assert.Equal(t, int64(1), hook.counter(qdb.MetricFlushes))
+	assert.Equal(t, int64(1), hook.counter(qdb.MetricRowsSent))
+	assert.Equal(t, int64(size), hook.counter(qdb.MetricBytesSent))
+}
+
+func TestDebugWriter(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	var full, truncated strings.Builder
+	sender1, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithDebugWriter(&full, 0))
+	assert.NoError(t, err)
+	defer sender1.Close(ctx)
+	sender2, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithDebugWriter(&truncated, 10))
+	assert.NoError(t, err)
+	defer sender2.Close(ctx)
+
+	for _, s := range []qdb.LineSender{sender1, sender2} {
+		err = s.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, s.Flush(ctx))
+	}
+
+	line := testTable + " a_col=1i\n"
+	assert.Equal(t, line, full.String())
+	assert.Equal(t, fmt.Sprintf("%s\n... %d bytes truncated\n", line[:10], len(line)-10), truncated.String())
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithDebugWriter(&full, -1))
+	assert.ErrorContains(t, err, "debug writer max bytes is negative")
+}
+
+func TestNewLineSenderFromConn(t *testing.T) {
+	ctx := context.Background()
+
+	client, server := net.Pipe()
+	lines := make(chan string, 2)
+	go func() {
+		r := bufio.NewReader(server)
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- l
+		}
+	}()
+
+	sender, err := qdb.NewLineSenderFromConn(ctx, client)
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+	assert.Equal(t, testTable+" a_col=1i\n", <-lines)
+
+	// Closing the sender closes the connection.
+	assert.NoError(t, sender.Close(ctx))
+	_, ok := <-lines
+	assert.False(t, ok)
+
+	_, err = qdb.NewLineSenderFromConn(ctx, client, qdb.WithHttp())
+	assert.ErrorContains(t, err, "only the TCP sender can use an existing connection")
+	_, err = qdb.NewLineSenderFromConn(ctx, client, qdb.WithTls())
+	assert.ErrorContains(t, err, "TLS is not available with an existing connection")
+	_, err = qdb.NewLineSenderFromConn(ctx, nil)
+	assert.ErrorContains(t, err, "connection is nil")
+
+	// The connection is closed if the sender can't be created.
+	for _, opt := range []qdb.LineSenderOption{
+		qdb.WithHttp(),
+		qdb.WithShedder(qdb.NewShedder(qdb.SheddingDropNewest)),
+	} {
+		client, server := net.Pipe()
+		_, err = qdb.NewLineSenderFromConn(ctx, client, opt)
+		assert.Error(t, err)
+		_, err = server.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+	}
+}
+
+func TestDialFallbackDelay(t *testing.T) {
+	ctx := context.Background()
+
+	for _, delay := range []time.Duration{-1, 50 * time.Millisecond} {
+		for _, http := range []bool{false, true} {
+			t.Run(fmt.Sprintf("delay=%s,http=%v", delay, http), func(t *testing.T) {
+				var (
+					srv *testServer
+					err error
+				)
+				opt := qdb.WithTcp()
+				if http {
+					srv, err = newTestHttpServer(sendToBackChannel)
+					opt = qdb.WithHttp()
+				} else {
+					srv, err = newTestTcpServer(sendToBackChannel)
+				}
+				assert.NoError(t, err)
+				defer srv.Close()
+				_, port, err := net.SplitHostPort(srv.Addr())
+				assert.NoError(t, err)
+
+				// localhost may resolve to both ::1 and 127.0.0.1 while
+				// the server only listens on the latter.
+				sender, err := qdb.NewLineSender(ctx, opt, qdb.WithAddress("localhost:"+port), qdb.WithDialFallbackDelay(delay))
+				assert.NoError(t, err)
+				defer sender.Close(ctx)
+
+				err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+				assert.NoError(t, err)
+				assert.NoError(t, sender.Flush(ctx))
+				expectLines(t, srv.BackCh, []string{testTable + " a_col=1i"})
+			})
+		}
+	}
+}
+
+func TestOversizedRow(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()),
+		qdb.WithInitBufferSize(1024), qdb.WithAutoFlushBytes(1<<20), qdb.WithOversizedRowSize(64))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+
+	// The oversized row is flushed right away along with the
+	// preceding ones, and the buffer shrinks back.
+	big := strings.Repeat("x", 4096)
+	err = sender.Table(testTable).StringColumn("b", big).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, qdb.BufLen(sender))
+	assert.Equal(t, 1024, qdb.BufCap(sender))
+	expectLines(t, srv.BackCh, []string{testTable + " a=1i", testTable + " b=\"" + big + "\""})
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithOversizedRowSize(-1))
+	assert.ErrorContains(t, err, "oversized row size is negative")
+}
+
+func TestAutoFlushBytes(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	// A large buffer doesn't delay the flushes.
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()),
+		qdb.WithInitBufferSize(1024*1024), qdb.WithAutoFlushBytes(16))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a_col", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, qdb.BufLen(sender))
+	expectLines(t, srv.BackCh, []string{testTable + " a_col=1i"})
+
+	// A small buffer doesn't speed up the flushes.
+	sender2, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()),
+		qdb.WithInitBufferSize(16), qdb.WithAutoFlushBytes(1024))
+	assert.NoError(t, err)
+	defer sender2.Close(ctx)
+
+	for i := 0; i < 3; i++ {
+		err = sender2.Table(testTable).Int64Column("a_col", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, qdb.MsgCount(sender2))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAutoFlushBytes(-1))
+	assert.ErrorContains(t, err, "auto flush bytes is negative")
+}
+
+func TestMemoryLimit(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	opts := []qdb.LineSenderOption{
+		qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithAutoFlushBytes(1 << 20),
+		qdb.WithMemoryLimit(100), qdb.WithMemoryOverflowPolicy(qdb.OverflowReject),
+	}
+	s1, err := qdb.NewLineSender(ctx, opts...)
+	assert.NoError(t, err)
+	defer s1.Close(ctx)
+	s2, err := qdb.NewLineSender(ctx, opts...)
+	assert.NoError(t, err)
+	defer s2.Close(ctx)
+
+	base := qdb.GetMemoryStats()
+
+	// The usage is shared by both senders.
+	row := strings.Repeat("x", 20)
+	assert.NoError(t, s1.Table(testTable).StringColumn("a", row).AtNow(ctx))
+	n := qdb.BufLen(s1)
+	assert.NoError(t, s2.Table(testTable).StringColumn("a", row).AtNow(ctx))
+	assert.Equal(t, base.InUse+int64(2*n), qdb.GetMemoryStats().InUse)
+
+	// The row over the limit is rejected.
+	err = s2.Table(testTable).StringColumn("a", row).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrMemoryLimit)
+	assert.Equal(t, 1, qdb.MsgCount(s2))
+	stats := qdb.GetMemoryStats()
+	assert.Equal(t, base.InUse+int64(2*n), stats.InUse)
+	assert.Equal(t, base.Rejected+1, stats.Rejected)
+
+	// A blocking sender flushes its own rows, but doesn't wait for
+	// the idle ones.
+	s3, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()),
+		qdb.WithAutoFlushBytes(1<<20), qdb.WithMemoryLimit(int64(n)))
+	assert.NoError(t, err)
+	defer s3.Close(ctx)
+	err = s3.Table(testTable).StringColumn("a", row).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrMemoryLimit)
+	assert.Zero(t, qdb.MsgCount(s3))
+
+	// Flushes release the memory.
+	assert.NoError(t, s1.Flush(ctx))
+	assert.NoError(t, s2.Flush(ctx))
+	assert.Equal(t, base.InUse, qdb.GetMemoryStats().InUse)
+	assert.NoError(t, s3.Table(testTable).StringColumn("a", row).AtNow(ctx))
+	assert.Equal(t, 1, qdb.MsgCount(s3))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithMemoryLimit(-1))
+	assert.ErrorContains(t, err, "memory limit is negative")
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithMemoryOverflowPolicy(42))
+	assert.ErrorContains(t, err, "unknown memory overflow policy")
+}
+
+func TestShedder(t *testing.T) {
+	ctx := context.Background()
+
+	// Nothing listens on the address, so that the flushes fail.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	testCases := []struct {
+		name     string
+		strategy qdb.SheddingStrategy
+		rate     float64
+		expected []string
+		dropped  map[string]int64
+	}{
+		{
+			name:     "drop newest",
+			strategy: qdb.SheddingDropNewest,
+			expected: []string{"t1 a=0i", "t1 a=1i"},
+			dropped:  map[string]int64{"t1": 1, "t 2": 1},
+		},
+		{
+			name:     "drop oldest",
+			strategy: qdb.SheddingDropOldest,
+			expected: []string{"t1 a=2i", "t\\ 2 a=3i"},
+			dropped:  map[string]int64{"t1": 2},
+		},
+		{
+			name:     "sample",
+			strategy: qdb.SheddingSample,
+			expected: []string{"t1 a=1i", "t1 a=2i"},
+			dropped:  map[string]int64{"t1": 1, "t 2": 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sh := qdb.NewShedder(tc.strategy)
+			sh.SetSampleRate("t 2", 0)
+
+			sender, err := qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithAddress(addr), qdb.WithRetryTimeout(0),
+				qdb.WithMaxPendingRows(2, qdb.PendingRowsPolicyError), qdb.WithShedder(sh))
+			assert.NoError(t, err)
+			defer sender.Close(ctx)
+
+			for i, table := range []string{"t1", "t1", "t1", "t 2"} {
+				err = sender.Table(table).Int64Column("a", int64(i)).AtNow(ctx)
+				if i == 1 {
+					// The failed flush keeps the rows.
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			}
+			assert.Equal(t, 2, qdb.MsgCount(sender))
+			assert.Equal(t, tc.dropped, sh.DroppedRows())
+			assert.Equal(t, strings.Join(tc.expected, "\n")+"\n", qdb.Messages(sender))
+		})
+	}
+
+	t.Run("healthy server", func(t *testing.T) {
+		srv, err := newTestTcpServer(sendToBackChannel)
+		assert.NoError(t, err)
+		defer srv.Close()
+
+		sh := qdb.NewShedder(qdb.SheddingDropNewest)
+		sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()),
+			qdb.WithMaxPendingRows(2, qdb.PendingRowsPolicyError), qdb.WithShedder(sh))
+		assert.NoError(t, err)
+		defer sender.Close(ctx)
+
+		// The rows are flushed at the limit instead of being shed.
+		for i := 0; i < 4; i++ {
+			err = sender.Table("t1").Int64Column("a", int64(i)).AtNow(ctx)
+			assert.NoError(t, err)
+		}
+		assert.Zero(t, qdb.MsgCount(sender))
+		assert.Empty(t, sh.DroppedRows())
+		expectLines(t, srv.BackCh, []string{"t1 a=0i", "t1 a=1i", "t1 a=2i", "t1 a=3i"})
+	})
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithShedder(qdb.NewShedder(qdb.SheddingDropNewest)))
+	assert.ErrorContains(t, err, "shedding requires max pending rows")
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithMaxPendingRows(1, qdb.PendingRowsPolicyFlush),
+		qdb.WithShedder(qdb.NewShedder(42)))
+	assert.ErrorContains(t, err, "unknown shedding strategy")
+}
+
+func TestBufferSwap(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()),
+		qdb.WithInitBufferSize(1024), qdb.WithBufferSwap())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for i := 0; i < 3; i++ {
+		err = sender.Table(testTable).Int64Column("a", int64(i)).AtNow(ctx)
+		assert.NoError(t, err)
+		token := sender.PendingFlush()
+
+		// The buffer is swapped, so rows can be added while the
+		// batch is written.
+		assert.NoError(t, sender.Flush(ctx))
+		assert.Zero(t, qdb.BufLen(sender))
+		assert.Equal(t, 1024, qdb.BufCap(sender))
+
+		expectLines(t, srv.BackCh, []string{fmt.Sprintf("%s a=%di", testTable, i)})
+		assert.NoError(t, token.Result(ctx))
+	}
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithBufferSwap())
+	assert.ErrorContains(t, err, "buffer swap setting is not available")
+}
+
+func TestRowInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(readAndDiscard)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	var audited []string
+	errTenant := errors.New("unknown tenant")
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()),
+		qdb.WithRowInterceptor(func(v *qdb.RowView) error {
+			if v.Table() == "other" {
+				return errTenant
+			}
+			v.StringColumn("tenant", "acme")
+			return nil
+		}),
+		qdb.WithRowInterceptor(func(v *qdb.RowView) error {
+			line := string(v.Line())
+			if ts, ok := v.Timestamp(); ok {
+				line += fmt.Sprintf(" @%d", ts.UnixNano())
+			}
+			audited = append(audited, line)
+			return nil
+		}),
+	)
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).At(ctx, time.Unix(0, 1000))
+	assert.NoError(t, err)
+	err = sender.Table("other").Int64Column("a", 2).AtNow(ctx)
+	assert.ErrorIs(t, err, errTenant)
+	err = sender.Table(testTable).Symbol("s", "x").AtNow(ctx)
+	assert.NoError(t, err)
+
+	assert.Equal(t, testTable+" a=1i,tenant=\"acme\" 1000\n"+testTable+",s=x tenant=\"acme\"\n", qdb.Messages(sender))
+	assert.Equal(t, []string{
+		testTable + " a=1i,tenant=\"acme\" @1000",
+		testTable + ",s=x tenant=\"acme\"",
+	}, audited)
+}
+
+func TestRedactor(t *testing.T) {
+	ctx := context.Background()
+
+	var seen []string
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(),
+		qdb.WithRedactor(func(table, column string, value interface{}) (interface{}, bool) {
+			seen = append(seen, fmt.Sprintf("%s.%s=%v", table, column, value))
+			switch column {
+			case "email":
+				return "***", true
+			case "user_id":
+				return fmt.Sprintf("h%d", value.(int64)*31), true
+			case "ip":
+				return nil, false
+			case "bad":
+				return int64(1), true
+			}
+			return value, true
+		}))
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).
+		Symbol("email", "john@example.com").
+		Symbol("ip", "10.0.0.1").
+		Int64Column("user_id", 42).
+		Float64Column("amount", 1.5).
+		AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+",email=*** user_id=\"h1302\",amount=1.5\n", qdb.Messages(sender))
+	assert.Equal(t, []string{
+		testTable + ".email=john@example.com",
+		testTable + ".ip=10.0.0.1",
+		testTable + ".user_id=42",
+		testTable + ".amount=1.5",
+	}, seen)
+
+	err = sender.Table(testTable).Symbol("bad", "x").AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrUnsupportedType)
+
+	// Raw lines would bypass the redactor.
+	err = sender.AtRaw(ctx, []byte(testTable+",email=john@example.com a=1i\n"))
+	assert.ErrorContains(t, err, "raw ILP lines are not available with a redactor")
+	_, err = sender.RawWriter().Write([]byte(testTable + ",email=john@example.com a=1i\n"))
+	assert.ErrorContains(t, err, "raw ILP lines are not available with a redactor")
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	reg := qdb.NewSchemaRegistry()
+	err := reg.Register(qdb.TableSchema{
+		Name: testTable,
+		Columns: []qdb.ColumnSchema{
+			{Name: "sym", Type: qdb.ColumnTypeSymbol},
+			{Name: "qty", Type: qdb.ColumnTypeLong},
+			{Name: "price", Type: qdb.ColumnTypeDouble},
+			{Name: "note", Type: qdb.ColumnTypeVarchar},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Error(t, reg.Register(qdb.TableSchema{}))
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(), qdb.WithSchemaRegistry(reg))
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Symbol("sym", "a").Int64Column("qty", 1).
+		Float64Column("price", 1.5).StringColumn("note", "x").BoolColumn("other", true).AtNow(ctx)
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Float64Column("qty", 1.5).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrColumnTypeMismatch)
+	assert.ErrorContains(t, err, "double value conflicts with the registered column type: table "+testTable+", column qty, type LONG")
+	err = sender.Table(testTable).Symbol("note", "x").AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrColumnTypeMismatch)
+
+	// Unregistered tables are not checked.
+	err = sender.Table("other").Float64Column("qty", 1.5).AtNow(ctx)
+	assert.NoError(t, err)
+
+	assert.Equal(t, testTable+",sym=a qty=1i,price=1.5,note=\"x\",other=t\nother qty=1.5\n", qdb.Messages(sender))
+}
+
+func TestStrictSchema(t *testing.T) {
+	ctx := context.Background()
+
+	reg := qdb.NewSchemaRegistry()
+	err := reg.Register(qdb.TableSchema{
+		Name:    testTable,
+		Columns: []qdb.ColumnSchema{{Name: "sym", Type: qdb.ColumnTypeSymbol}, {Name: "qty", Type: qdb.ColumnTypeLong}},
+	})
+	assert.NoError(t, err)
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(),
+		qdb.WithSchemaRegistry(reg), qdb.WithStrictSchema())
+	assert.NoError(t, err)
+
+	err = sender.Table(testTable).Symbol("sym", "a").Int64Column("qty", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	err = sender.Table(testTable).Int64Column("qyt", 1).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrUnknownColumn)
+	assert.ErrorContains(t, err, "table "+testTable+", column qyt")
+	err = sender.Table(testTable).Symbol("sm", "a").Int64Column("qty", 1).AtNow(ctx)
+	assert.ErrorIs(t, err, qdb.ErrUnknownColumn)
+	err = sender.Table("other").Int64Column("qyt", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testTable+",sym=a qty=1i\nother qyt=1i\n", qdb.Messages(sender))
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithStrictSchema())
+	assert.ErrorContains(t, err, "strict schema mode requires a schema registry")
+}
+
+func TestDuplicateFilter(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	f := qdb.NewDuplicateFilter()
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithDuplicateFilter(f))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	for _, v := range []int64{1, 1, 2, 1} {
+		err = sender.Table(testTable).Int64Column("a", v).At(ctx, time.UnixMicro(1))
+		assert.NoError(t, err)
+	}
+	err = sender.Table(testTable).Int64Column("a", 1).At(ctx, time.UnixMicro(2))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, qdb.MsgCount(sender))
+	assert.Equal(t, int64(2), f.Suppressed())
+
+	assert.NoError(t, sender.Flush(ctx))
+
+	// The window restarts after a flush.
+	err = sender.Table(testTable).Int64Column("a", 1).At(ctx, time.UnixMicro(1))
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+	assert.Equal(t, int64(2), f.Suppressed())
+
+	// Rows removed by a rollback may be added again.
+	cp := sender.Checkpoint()
+	err = sender.Table(testTable).Int64Column("a", 3).At(ctx, time.UnixMicro(1))
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Restore(cp))
+	err = sender.Table(testTable).Int64Column("a", 3).At(ctx, time.UnixMicro(1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, qdb.MsgCount(sender))
+	assert.NoError(t, sender.Flush(ctx))
+	assert.Equal(t, int64(2), f.Suppressed())
+
+	expectLines(t, srv.BackCh, []string{
+		testTable + " a=1i 1000",
+		testTable + " a=2i 1000",
+		testTable + " a=1i 2000",
+		testTable + " a=1i 1000",
+		testTable + " a=3i 1000",
+	})
+}
+
+func TestDuplicateFilterShedding(t *testing.T) {
+	ctx := context.Background()
+
+	f := qdb.NewDuplicateFilter()
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithDryRun(),
+		qdb.WithDuplicateFilter(f),
+		qdb.WithMaxPendingRows(2, qdb.PendingRowsPolicyFlush),
+		qdb.WithShedder(qdb.NewShedder(qdb.SheddingDropOldest)))
+	assert.NoError(t, err)
+
+	// The hash of the oldest row is forgotten once it's shed.
+	for _, v := range []int64{1, 2, 3, 1} {
+		err = sender.Table(testTable).Int64Column("a", v).At(ctx, time.UnixMicro(1))
+		assert.NoError(t, err)
+	}
+	assert.Zero(t, f.Suppressed())
+	assert.Equal(t, testTable+" a=3i 1000\n"+testTable+" a=1i 1000\n", qdb.Messages(sender))
+}
+
+func TestWireTrace(t *testing.T) {
+	ctx := context.Background()
+
+	srv, err := newTestTcpServer(sendToBackChannel)
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	var trace strings.Builder
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(srv.Addr()), qdb.WithWireTrace(&trace))
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Flush(ctx))
+	expectLines(t, srv.BackCh, []string{testTable + " a=1i"})
+
+	out := trace.String()
+	assert.Contains(t, out, "connect: tcp "+srv.Addr()+", tls=false")
+	assert.Contains(t, out, "connected: local=")
+	assert.Contains(t, out, fmt.Sprintf("flush: %d bytes, 1 rows", len(testTable)+6))
+	// The hex dump holds the payload prefix.
+	assert.Contains(t, out, "|my_test_table a=|")
+	assert.Contains(t, out, "flush done")
+}
+
+func TestDisconnectDetection(t *testing.T) {
+	ctx := context.Background()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	firstClosed := make(chan struct{})
+	linesCh := make(chan string, 10)
+	go func() {
+		// Close the first connection as if the server failed
+		// to parse a line.
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Close()
+		close(firstClosed)
+
+		conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			linesCh <- scanner.Text()
+		}
+	}()
+
+	sender, err := qdb.NewLineSender(ctx, qdb.WithTcp(), qdb.WithAddress(l.Addr().String()), qdb.WithDisconnectDetection())
+	assert.NoError(t, err)
+	defer sender.Close(ctx)
+
+	<-firstClosed
+	assert.Eventually(t, func() bool {
+		err = sender.Table(testTable).Int64Column("a", 1).AtNow(ctx)
+		return err != nil
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, err, qdb.ErrServerDisconnected)
+
+	// The buffered rows are sent over a new connection.
+	assert.NoError(t, sender.Flush(ctx))
+	select {
+	case l := <-linesCh:
+		assert.Equal(t, testTable+" a=1i", l)
+	case <-time.After(3 * time.Second):
+		t.Fatal("no line received over a new connection")
+	}
+
+	_, err = qdb.NewLineSender(ctx, qdb.WithHttp(), qdb.WithDisconnectDetection())
+	assert.ErrorContains(t, err, "disconnect detection is not available in the HTTP client")
+}
@@ -0,0 +1,92 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"fmt"
+	"net"
+)
+
+// connWatch detects server-side disconnects of a TCP connection.
+// The server never writes to ILP/TCP connections once they are
+// authenticated, so any read result, EOF or RST means that the
+// connection is gone, e.g. because the server failed to parse
+// a line. Without the watch, the sender only notices on a later
+// flush, if at all, since writes to a closed connection may succeed
+// locally.
+type connWatch struct {
+	done chan struct{}
+	err  error
+}
+
+// watchConn starts the read-side goroutine, if enabled. It exits
+// once the connection is closed by either side.
+func (s *tcpLineSender) watchConn(conn net.Conn) *connWatch {
+	if !s.detectDisconnects {
+		return nil
+	}
+	w := &connWatch{done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		if err == nil {
+			err = fmt.Errorf("unexpected %d bytes from server", n)
+		}
+		w.err = err
+	}()
+	return w
+}
+
+// disconnected returns the read error if the connection is gone.
+func (w *connWatch) disconnected() error {
+	if w == nil {
+		return nil
+	}
+	select {
+	case <-w.done:
+		return w.err
+	default:
+		return nil
+	}
+}
+
+// checkConn closes the connection if the server has disconnected,
+// so that the next flush reconnects, and returns an error wrapping
+// ErrServerDisconnected. The buffered messages are kept.
+func (s *tcpLineSender) checkConn() error {
+	if s.watch == nil || s.conn == nil || s.inflight != nil {
+		return nil
+	}
+	cause := s.watch.disconnected()
+	if cause == nil {
+		return nil
+	}
+	s.trace.event("server disconnect detected: %v", cause)
+	s.conn.Close()
+	s.conn = nil
+	s.watch = nil
+	return fmt.Errorf("%w: %v", ErrServerDisconnected, cause)
+}
@@ -0,0 +1,173 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// columnTransform holds the transformer registered for a column.
+// Only one of the functions is set.
+type columnTransform struct {
+	str func(string) string
+	flt func(float64) float64
+	int func(int64) int64
+}
+
+// WithEncoderStringTransform registers a transformer applied by the
+// encoder to the values of the given string or symbol column, e.g.
+// to lower-case symbols. The column name is the one used in the ILP
+// message.
+func WithEncoderStringTransform(column string, fn func(string) string) EncoderOption {
+	return func(c *encoderConfig) {
+		c.transform(column, columnTransform{str: fn})
+	}
+}
+
+// WithEncoderFloatTransform registers a transformer applied by the
+// encoder to the values of the given double column, e.g. for unit
+// conversion or rounding.
+func WithEncoderFloatTransform(column string, fn func(float64) float64) EncoderOption {
+	return func(c *encoderConfig) {
+		c.transform(column, columnTransform{flt: fn})
+	}
+}
+
+// WithEncoderIntTransform registers a transformer applied by the
+// encoder to the values of the given integer column.
+func WithEncoderIntTransform(column string, fn func(int64) int64) EncoderOption {
+	return func(c *encoderConfig) {
+		c.transform(column, columnTransform{int: fn})
+	}
+}
+
+func (c *encoderConfig) transform(column string, t columnTransform) {
+	if c.transforms == nil {
+		c.transforms = make(map[string]columnTransform)
+	}
+	c.transforms[column] = t
+}
+
+// withTransforms returns a copy of the encoder with the writers of
+// the transformed columns replaced. The encoder itself is shared via
+// the plan cache, so it's left intact.
+func (e *structEncoder) withTransforms(transforms map[string]columnTransform) (*structEncoder, error) {
+	if len(transforms) == 0 {
+		return e, nil
+	}
+	cp := *e
+	cp.symbols = append([]encoderField(nil), e.symbols...)
+	cp.columns = append([]encoderField(nil), e.columns...)
+	found := 0
+	for _, fields := range [][]encoderField{cp.symbols, cp.columns} {
+		for i := range fields {
+			f := &fields[i]
+			t, ok := transforms[f.name]
+			if !ok {
+				continue
+			}
+			w, err := newTransformWriter(f, t)
+			if err != nil {
+				return nil, err
+			}
+			f.write = w
+			found++
+		}
+	}
+	if found < len(transforms) {
+		for name := range transforms {
+			if !e.hasField(name) {
+				return nil, fmt.Errorf("transformed column is not found: %s", name)
+			}
+		}
+	}
+	return &cp, nil
+}
+
+func (e *structEncoder) hasField(name string) bool {
+	for _, fields := range [][]encoderField{e.symbols, e.columns} {
+		for _, f := range fields {
+			if f.name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newTransformWriter(f *encoderField, t columnTransform) (fieldWriter, error) {
+	switch {
+	case t.str != nil && f.kind == fieldSymbol:
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.Symbol(name, t.str(*(*string)(p)))
+		}, nil
+	case t.str != nil && f.kind == fieldString:
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.StringColumn(name, t.str(*(*string)(p)))
+		}, nil
+	case t.flt != nil && f.kind == fieldFloat:
+		if f.rkind == reflect.Float32 {
+			return func(b *buffer, name string, p unsafe.Pointer) {
+				b.Float64Column(name, t.flt(float64(*(*float32)(p))))
+			}, nil
+		}
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.Float64Column(name, t.flt(*(*float64)(p)))
+		}, nil
+	case t.int != nil && (f.kind == fieldInt || f.kind == fieldUint):
+		read := intFieldReader(f.kind, f.rkind)
+		return func(b *buffer, name string, p unsafe.Pointer) {
+			b.Int64Column(name, t.int(read(p)))
+		}, nil
+	}
+	return nil, fmt.Errorf("transformer type doesn't match the column type: %s", f.name)
+}
+
+// intFieldReader returns a reader of the integer field values. The
+// pointer casts are safe, since the kinds are validated by
+// newStructPlan.
+func intFieldReader(kind fieldKind, k reflect.Kind) func(p unsafe.Pointer) int64 {
+	if kind == fieldUint {
+		return func(p unsafe.Pointer) int64 { return int64(*(*uint32)(p)) }
+	}
+	switch k {
+	case reflect.Int8:
+		return func(p unsafe.Pointer) int64 { return int64(*(*int8)(p)) }
+	case reflect.Int16:
+		return func(p unsafe.Pointer) int64 { return int64(*(*int16)(p)) }
+	case reflect.Uint8:
+		return func(p unsafe.Pointer) int64 { return int64(*(*uint8)(p)) }
+	case reflect.Int32:
+		return func(p unsafe.Pointer) int64 { return int64(*(*int32)(p)) }
+	case reflect.Uint16:
+		return func(p unsafe.Pointer) int64 { return int64(*(*uint16)(p)) }
+	case reflect.Int:
+		return func(p unsafe.Pointer) int64 { return int64(*(*int)(p)) }
+	default:
+		return func(p unsafe.Pointer) int64 { return *(*int64)(p) }
+	}
+}
@@ -72,7 +72,11 @@ func newTestHttpServer(serverType serverType) (*testServer, error) {
 }
 
 func newTestServerWithProtocol(serverType serverType, protocol string) (*testServer, error) {
-	tcp, err := net.Listen("tcp", "127.0.0.1:")
+	return newTestServerOnAddress(serverType, protocol, "127.0.0.1:")
+}
+
+func newTestServerOnAddress(serverType serverType, protocol, addr string) (*testServer, error) {
+	tcp, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -250,3 +254,43 @@ func expectLines(t *testing.T, linesCh chan string, expected []string) {
 		return reflect.DeepEqual(expected, actual)
 	}, 3*time.Second, 100*time.Millisecond)
 }
+
+// testMetricsHook records the reported counters and gauges.
+type testMetricsHook struct {
+	mu         sync.Mutex
+	counters   map[string]int64
+	gauges     map[string]float64
+	histograms map[string]int
+}
+
+func newTestMetricsHook() *testMetricsHook {
+	return &testMetricsHook{
+		counters:   make(map[string]int64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]int),
+	}
+}
+
+func (h *testMetricsHook) Counter(name string, delta int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counters[name] += delta
+}
+
+func (h *testMetricsHook) Gauge(name string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.gauges[name] = value
+}
+
+func (h *testMetricsHook) Histogram(name string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.histograms[name]++
+}
+
+func (h *testMetricsHook) counter(name string) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.counters[name]
+}
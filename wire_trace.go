@@ -0,0 +1,143 @@
+/*******************************************************************************
+ *     ___                  _   ____  ____
+ *    / _ \ _   _  ___  ___| |_|  _ \| __ )
+ *   | | | | | | |/ _ \/ __| __| | | |  _ \
+ *   | |_| | |_| |  __/\__ \ |_| |_| | |_) |
+ *    \__\_\\__,_|\___||___/\__|____/|____/
+ *
+ *  Copyright (c) 2014-2019 Appsicle
+ *  Copyright (c) 2019-2022 QuestDB
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ *
+ ******************************************************************************/
+
+package questdb
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// wireTracePrefixSize is the max number of payload bytes dumped
+// per traced event.
+const wireTracePrefixSize = 64
+
+// wireTracer logs timestamped connection, authentication and flush
+// events to a user-provided writer. A nil wireTracer does nothing.
+type wireTracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newWireTracer(w io.Writer) *wireTracer {
+	if w == nil {
+		return nil
+	}
+	return &wireTracer{w: w}
+}
+
+// event writes a single trace line. Write errors are ignored, since
+// they shouldn't affect the sender.
+func (t *wireTracer) event(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.write(format, args...)
+}
+
+// payload writes a trace line followed by a hex dump of the payload
+// prefix.
+func (t *wireTracer) payload(data []byte, format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.write(format, args...)
+	if len(data) > wireTracePrefixSize {
+		data = data[:wireTracePrefixSize]
+	}
+	if len(data) > 0 {
+		io.WriteString(t.w, hex.Dump(data))
+	}
+}
+
+func (t *wireTracer) write(format string, args ...interface{}) {
+	fmt.Fprintf(t.w, "%s %s\n", time.Now().UTC().Format("2006-01-02T15:04:05.000000Z"), fmt.Sprintf(format, args...))
+}
+
+// tlsState traces the negotiated TLS parameters.
+func (t *wireTracer) tlsState(state tls.ConnectionState) {
+	t.event("tls handshake done: version=%s, cipher=%s, server=%s",
+		tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), state.ServerName)
+}
+
+// withClientTrace attaches HTTP connection tracing to the context.
+func (t *wireTracer) withClientTrace(ctx context.Context) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.event("connection acquired: local=%s, remote=%s, reused=%v",
+				info.Conn.LocalAddr(), info.Conn.RemoteAddr(), info.Reused)
+		},
+		ConnectStart: func(network, addr string) {
+			t.event("connect: %s %s", network, addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				t.event("connect failed: %s %s: %v", network, addr, err)
+				return
+			}
+			t.event("connected: %s %s", network, addr)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				t.event("tls handshake failed: %v", err)
+				return
+			}
+			t.tlsState(state)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err != nil {
+				t.event("request write failed: %v", info.Err)
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.event("response started")
+		},
+	})
+}
+
+// httpAuthScheme returns the traced name of the authentication
+// scheme, never the credentials.
+func httpAuthScheme(user, pass, token string) string {
+	switch {
+	case user != "" && pass != "":
+		return "basic"
+	case token != "":
+		return "token"
+	default:
+		return "none"
+	}
+}